@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Aggregator aggregates the transaction log entries, by server and cube, over rolling windows, as
+// in the last 1m, 5m and 1h, counting the writes, summing the absolute changes of numeric values
+// and collecting the distinct users. Every time the smallest window has passed, a summary record
+// for every window and cube is emitted and the metrics are updated, making write storms stand out.
+type Aggregator struct {
+	windows    []time.Duration
+	resolution time.Duration
+	mutex      sync.Mutex
+	buckets    []*aggregateBucket // Oldest first
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// aggregateBucket holds the statistics of the entries processed within one period of the resolution.
+type aggregateBucket struct {
+	start time.Time
+	cubes map[aggregateKey]*cubeStats
+}
+
+// aggregateKey identifies a cube on a server.
+type aggregateKey struct {
+	server string
+	cube   string
+}
+
+// cubeStats are the statistics of the writes to a cube.
+type cubeStats struct {
+	writes int
+	change float64
+	users  map[string]bool
+}
+
+// NewAggregator creates and returns a new Aggregator aggregating over the windows, the smallest of
+// which defines the resolution of all of them.
+func NewAggregator(windows []time.Duration) *Aggregator {
+	a := new(Aggregator)
+	a.windows = append([]time.Duration(nil), windows...)
+	sort.Slice(a.windows, func(i, j int) bool { return a.windows[i] < a.windows[j] })
+	a.resolution = a.windows[0]
+
+	return a
+}
+
+// NewAggregatorFromEnv creates an Aggregator aggregating over the comma-separated list of windows
+// specified by TM1_AGGREGATE_WINDOWS, as in "1m,5m,1h", or returns nil if not specified.
+func NewAggregatorFromEnv() (*Aggregator, error) {
+	var windows []time.Duration
+	for _, window := range splitList(os.Getenv("TM1_AGGREGATE_WINDOWS")) {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window specified in TM1_AGGREGATE_WINDOWS: %s", window)
+		}
+		windows = append(windows, d)
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	return NewAggregator(windows), nil
+}
+
+// Add adds the entry to the statistics of its cube.
+func (a *Aggregator) Add(entry *odata.TransactionLogEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bucket := a.bucket(time.Now())
+	key := aggregateKey{server: entry.Server, cube: entry.Cube}
+	stats, ok := bucket.cubes[key]
+	if !ok {
+		stats = &cubeStats{users: map[string]bool{}}
+		bucket.cubes[key] = stats
+	}
+	stats.writes++
+	stats.users[entry.User] = true
+	if oldValue, newValue, ok := entry.NumericValues(); ok {
+		stats.change += math.Abs(newValue - oldValue)
+	}
+}
+
+// Start emits the summary records, every time the smallest window has passed, until stopped.
+func (a *Aggregator) Start(emit func(record map[string]interface{}) error) {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(a.resolution)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case now := <-ticker.C:
+				for _, record := range a.summarize(now) {
+					if err := emit(record); err != nil {
+						logger.Warn("Unable to emit summary record", "error", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops emitting summary records.
+func (a *Aggregator) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+// bucket returns the bucket for the time, dropping buckets that fell outside the largest window.
+// The caller is expected to hold the lock.
+func (a *Aggregator) bucket(now time.Time) *aggregateBucket {
+	start := now.Truncate(a.resolution)
+	if n := len(a.buckets); n == 0 || a.buckets[n-1].start.Before(start) {
+		a.buckets = append(a.buckets, &aggregateBucket{start: start, cubes: map[aggregateKey]*cubeStats{}})
+	}
+	cutoff := start.Add(-a.windows[len(a.windows)-1])
+	for len(a.buckets) > 0 && a.buckets[0].start.Before(cutoff) {
+		a.buckets = a.buckets[1:]
+	}
+	return a.buckets[len(a.buckets)-1]
+}
+
+// summarize returns the summary records, of every window and cube, and updates the metrics.
+func (a *Aggregator) summarize(now time.Time) []map[string]interface{} {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.bucket(now)
+
+	windowWrites.Reset()
+	windowChange.Reset()
+	windowUsers.Reset()
+
+	var records []map[string]interface{}
+	for _, window := range a.windows {
+		// The window consists of the buckets completed within it, leaving out the current one
+		to := now.Truncate(a.resolution)
+		from := to.Add(-window)
+		totals := map[aggregateKey]*cubeStats{}
+		for _, bucket := range a.buckets {
+			if bucket.start.Before(from) || !bucket.start.Before(to) {
+				continue
+			}
+			for key, stats := range bucket.cubes {
+				total, ok := totals[key]
+				if !ok {
+					total = &cubeStats{users: map[string]bool{}}
+					totals[key] = total
+				}
+				total.writes += stats.writes
+				total.change += stats.change
+				for user := range stats.users {
+					total.users[user] = true
+				}
+			}
+		}
+
+		for key, total := range totals {
+			users := make([]string, 0, len(total.users))
+			for user := range total.users {
+				users = append(users, user)
+			}
+			sort.Strings(users)
+			record := map[string]interface{}{
+				"Type":      "Summary",
+				"Window":    window.String(),
+				"From":      from.UTC().Format(time.RFC3339),
+				"To":        to.UTC().Format(time.RFC3339),
+				"Cube":      key.cube,
+				"Writes":    total.writes,
+				"AbsChange": total.change,
+				"Users":     users,
+			}
+			if key.server != "" {
+				record["Server"] = key.server
+			}
+			records = append(records, record)
+
+			windowWrites.WithLabelValues(key.cube, window.String()).Set(float64(total.writes))
+			windowChange.WithLabelValues(key.cube, window.String()).Set(total.change)
+			windowUsers.WithLabelValues(key.cube, window.String()).Set(float64(len(users)))
+		}
+	}
+	return records
+}
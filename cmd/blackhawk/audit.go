@@ -0,0 +1,159 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// AuditEvent is a change to the security, or configuration, of a server, as in a client being
+// assigned to a group or a group being granted access to a cube, derived from a transaction log
+// entry written to one of the security control cubes or a message log entry of the security loggers.
+type AuditEvent struct {
+	Type       string            `json:"Type"` // Always AuditEvent
+	Server     string            `json:"Server,omitempty"`
+	TimeStamp  string            `json:"TimeStamp"`
+	Source     string            `json:"Source"`          // TransactionLog or MessageLog
+	Actor      string            `json:"Actor,omitempty"` // User making the change, if known
+	Action     string            `json:"Action"`
+	ObjectType string            `json:"ObjectType,omitempty"` // Client, Cube, Dimension, Element, ...
+	Object     string            `json:"Object,omitempty"`
+	Details    map[string]string `json:"Details,omitempty"`
+	OldValue   interface{}       `json:"OldValue,omitempty"`
+	NewValue   interface{}       `json:"NewValue,omitempty"`
+	Message    string            `json:"Message,omitempty"`
+}
+
+func init() {
+	sinks.RegisterBufferedType("AuditEvent", (*AuditEvent)(nil))
+}
+
+// The security control cubes whose first dimension identifies the object secured, by the type of
+// the object, and whose second dimension is the group.
+var securityCubes = map[string]string{
+	"}CubeSecurity":        "Cube",
+	"}DimensionSecurity":   "Dimension",
+	"}ProcessSecurity":     "Process",
+	"}ChoreSecurity":       "Chore",
+	"}ApplicationSecurity": "Application",
+}
+
+// Patterns identifying the security related message log entries.
+var (
+	securityLoggerPattern = regexp.MustCompile(`(?i)^TM1\.(Security|Login|Audit)`)
+	loginPattern          = regexp.MustCompile(`(?i)\blogin (success|succeeded|failure|failed)\b`)
+	loginUserPattern      = regexp.MustCompile(`(?i)\buser:?\s*"?([^"\s,]+)`)
+	clientPattern         = regexp.MustCompile(`(?i)\bclient "(.+?)" (?:was )?(created|added|deleted|removed)\b`)
+	groupPattern          = regexp.MustCompile(`(?i)\b(?:client|user) "(.+?)" (?:was )?(added|assigned|removed) (?:to|from) group "(.+?)"`)
+	securityRefresh       = regexp.MustCompile(`(?i)\bsecurity refresh`)
+)
+
+// Auditor derives audit events from the entries of the transaction and message logs of a server.
+type Auditor struct {
+	server *Server
+}
+
+// NewAuditor creates and returns a new Auditor of the server.
+func NewAuditor(server *Server) *Auditor {
+	a := new(Auditor)
+	a.server = server
+
+	return a
+}
+
+// Transaction returns the audit event for the transaction log entry, or nil if the entry wasn't
+// written to one of the security control cubes.
+func (a *Auditor) Transaction(entry *odata.TransactionLogEntry) *AuditEvent {
+	if a == nil || !strings.HasPrefix(entry.Cube, "}") || len(entry.Tuple) < 2 {
+		return nil
+	}
+
+	event := &AuditEvent{
+		Type:      "AuditEvent",
+		Server:    a.server.Name,
+		TimeStamp: entry.TimeStamp,
+		Source:    "TransactionLog",
+		Actor:     entry.User,
+		OldValue:  entry.OldValue,
+		NewValue:  entry.NewValue,
+		Details:   map[string]string{},
+	}
+	object, group := entry.Tuple[0], entry.Tuple[1]
+	switch {
+	case entry.Cube == "}ClientGroups":
+		event.ObjectType, event.Object = "Client", object
+		event.Details["Group"] = group
+		event.Action = "AssignGroup"
+		if _, value := entry.StringValues(); value == "" {
+			event.Action = "UnassignGroup"
+		}
+	case entry.Cube == "}ClientProperties":
+		event.ObjectType, event.Object = "Client", object
+		event.Details["Property"] = group
+		event.Action = "SetClientProperty"
+	case securityCubes[entry.Cube] != "":
+		event.ObjectType, event.Object = securityCubes[entry.Cube], object
+		event.Details["Group"] = group
+		event.Action = "SetSecurity"
+	case strings.HasPrefix(entry.Cube, "}ElementSecurity_"):
+		event.ObjectType, event.Object = "Element", object
+		event.Details["Dimension"] = strings.TrimPrefix(entry.Cube, "}ElementSecurity_")
+		event.Details["Group"] = group
+		event.Action = "SetSecurity"
+	case strings.HasPrefix(entry.Cube, "}CellSecurity_"):
+		// The last dimension of a cell security cube is the group
+		event.ObjectType, event.Object = "Cell", strings.TrimPrefix(entry.Cube, "}CellSecurity_")
+		event.Details["Tuple"] = strings.Join(entry.Tuple[:len(entry.Tuple)-1], ",")
+		event.Details["Group"] = entry.Tuple[len(entry.Tuple)-1]
+		event.Action = "SetSecurity"
+	default:
+		return nil
+	}
+	return event
+}
+
+// Message returns the audit event for the message log entry, or nil if the entry isn't security related.
+func (a *Auditor) Message(entry *odata.MessageLogEntry) *AuditEvent {
+	if a == nil {
+		return nil
+	}
+
+	event := &AuditEvent{
+		Type:      "AuditEvent",
+		Server:    a.server.Name,
+		TimeStamp: entry.TimeStamp,
+		Source:    "MessageLog",
+		Message:   entry.Message,
+	}
+	if match := groupPattern.FindStringSubmatch(entry.Message); match != nil {
+		event.ObjectType, event.Object = "Client", match[1]
+		event.Details = map[string]string{"Group": match[3]}
+		event.Action = "AssignGroup"
+		if strings.EqualFold(match[2], "removed") {
+			event.Action = "UnassignGroup"
+		}
+	} else if match := clientPattern.FindStringSubmatch(entry.Message); match != nil {
+		event.ObjectType, event.Object = "Client", match[1]
+		event.Action = "CreateClient"
+		if action := strings.ToLower(match[2]); action == "deleted" || action == "removed" {
+			event.Action = "DeleteClient"
+		}
+	} else if match := loginPattern.FindStringSubmatch(entry.Message); match != nil {
+		event.Action = "LoginSucceeded"
+		if result := strings.ToLower(match[1]); result == "failure" || result == "failed" {
+			event.Action = "LoginFailed"
+		}
+		if user := loginUserPattern.FindStringSubmatch(entry.Message); user != nil {
+			event.Actor = user[1]
+		}
+	} else if securityRefresh.MatchString(entry.Message) {
+		event.Action = "SecurityRefresh"
+	} else if securityLoggerPattern.MatchString(entry.Logger) {
+		event.Action = "SecurityMessage"
+	} else {
+		return nil
+	}
+	return event
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/internal/testutil"
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/tracker"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// TestBufferedRecords checks every record derived from the entries, written to the sinks on top of
+// the entries themselves, is queued by the buffered sink while the sink is unavailable, and replayed
+// as the same type, with the same content, once it is available again.
+func TestBufferedRecords(t *testing.T) {
+	change := 50.0
+	records := []interface{}{
+		&tracker.Gap{Type: "Gap", Server: "dev", Collection: "TransactionLogEntries", TimeStamp: "2024-01-01T10:00:00Z",
+			Reason: "delta link lost", Recovery: tracker.RecoverFromLastEntry, From: odata.EntryPosition{ID: 10, TimeStamp: "2024-01-01T09:59:00Z"},
+			Until: odata.EntryPosition{ID: 20, TimeStamp: "2024-01-01T10:00:00Z"}, Recovered: 10},
+		&tracker.Gap{Type: "Gap", Server: "dev", Collection: "TransactionLogEntries", TimeStamp: "2024-01-01T10:01:00Z",
+			Reason: "IDs 21 to 23 missing", Recovery: tracker.RecoverByBackfill, From: odata.EntryPosition{ID: 20, TimeStamp: "2024-01-01T10:00:00Z"},
+			Until: odata.EntryPosition{ID: 24, TimeStamp: "2024-01-01T10:00:30Z"}, FirstMissingID: 21, LastMissingID: 23, Skipped: 1, Recovered: 2},
+		&ProcessExecution{Type: "ProcessExecution", Server: "dev", Kind: "Process", Name: "Load Sales", User: "Admin", ThreadID: 42,
+			Start: "2024-01-01T10:00:00Z", End: "2024-01-01T10:00:05Z", Duration: 5, Outcome: "MinorErrors", ErrorFile: "TM1ProcessError_Load Sales.log",
+			Errors: []string{"Data source not found"}},
+		&AuditEvent{Type: "AuditEvent", Server: "dev", TimeStamp: "2024-01-01T10:00:00Z", Source: "TransactionLog", Actor: "Admin",
+			Action: "GroupAccessChanged", ObjectType: "Cube", Object: "Sales", Details: map[string]string{"Group": "Planners"}, OldValue: "READ", NewValue: "WRITE"},
+		&ConfigurationChange{Type: "ConfigurationChange", Server: "dev", TimeStamp: "2024-01-01T10:00:00Z", Source: "ActiveConfiguration",
+			Parameter: "Administration.MaximumUserSandboxSize", OldValue: 100.0, NewValue: 200.0},
+		&MetadataChange{Type: "MetadataChange", Server: "dev", TimeStamp: "2024-01-01T10:00:00Z", Change: "ElementsChanged", Dimension: "Month",
+			Hierarchy: "Month", ElementCount: 13, OldElementCount: 12, AddedElements: []string{"Adj"}},
+		&AnomalyEvent{Type: "AnomalyEvent", Server: "dev", TimeStamp: "2024-01-01T03:00:00Z", User: "Admin", Anomaly: "Volume", Cube: "Sales",
+			Hour: 3, Writes: 5000, Baseline: 40, Message: "Admin wrote 5000 cells to Sales within the hour"},
+		&rules.CellChangeEvent{Type: "CellChangeEvent", Watch: "Revenue", Server: "dev", TimeStamp: "2024-01-01T10:00:00Z", User: "Admin",
+			Cube: "Sales", Tuple: []string{"2024", "Jan", "Revenue"}, OldValue: 100.0, NewValue: 150.0, Change: &change, Message: "Revenue changed"},
+	}
+
+	testutil.BufferedReplay(t, records)
+}
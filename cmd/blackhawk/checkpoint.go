@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/tracker"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// newCheckpointFromEnv creates the checkpoint persisting the progress of tracking in the store
+// specified by the environment variables, as described for newCheckpointStoreFromEnv, or returns nil
+// if no store is specified.
+func newCheckpointFromEnv() (*odata.Checkpoint, error) {
+	store, err := newCheckpointStoreFromEnv()
+	if err != nil || store == nil {
+		return nil, err
+	}
+	return odata.NewCheckpoint(store), nil
+}
+
+// newCheckpointStoreFromEnv creates the checkpoint store specified by TM1_CHECKPOINT_STORE, being
+// file, the default, redis, etcd or sql, or returns nil if no store is specified. The file store
+// saves the checkpoint in the file specified by TM1_CHECKPOINT_PATH, the others, which can be shared
+// by multiple instances of the tracker, save the state of every collection by its URL prefixed by
+// TM1_CHECKPOINT_PREFIX, followed, if the entries are partitioned across multiple instances, by the
+// shard, so every shard keeps track of its own progress.
+func newCheckpointStoreFromEnv() (odata.CheckpointStore, error) {
+	storeType := os.Getenv("TM1_CHECKPOINT_STORE")
+	if storeType == "" {
+		if os.Getenv("TM1_CHECKPOINT_PATH") == "" {
+			return nil, nil
+		}
+		storeType = "file"
+	}
+	prefix := os.Getenv("TM1_CHECKPOINT_PREFIX")
+	if prefix == "" {
+		prefix = "blackhawk/checkpoints/"
+	}
+	shard, err := shardFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if shard != nil {
+		prefix += shardKey(shard) + "/"
+	}
+
+	var store odata.CheckpointStore
+	switch storeType {
+	case "file":
+		path := os.Getenv("TM1_CHECKPOINT_PATH")
+		if path == "" {
+			return nil, fmt.Errorf("no checkpoint file specified using TM1_CHECKPOINT_PATH")
+		}
+		fileStore, err := odata.NewFileCheckpointStore(path)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+
+	case "redis":
+		client, err := newRedisClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		store = odata.NewRedisCheckpointStore(client, prefix)
+
+	case "etcd":
+		client, err := newEtcdClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		store = odata.NewEtcdCheckpointStore(client, prefix)
+
+	case "sql":
+		sqlStore, err := odata.NewSQLCheckpointStore(os.Getenv("TM1_CHECKPOINT_SQL_DRIVER"), os.Getenv("TM1_CHECKPOINT_SQL_DSN"), prefix)
+		if err != nil {
+			return nil, err
+		}
+		store = sqlStore
+
+	default:
+		return nil, fmt.Errorf("unknown checkpoint store: %s", storeType)
+	}
+	return store, nil
+}
+
+// newRedisClientFromEnv creates the client of the Redis server specified by TM1_CHECKPOINT_REDIS_URL.
+func newRedisClientFromEnv() (*odata.RedisClient, error) {
+	redisURL := os.Getenv("TM1_CHECKPOINT_REDIS_URL")
+	if redisURL == "" {
+		return nil, fmt.Errorf("no redis server specified using TM1_CHECKPOINT_REDIS_URL")
+	}
+	return odata.NewRedisClient(redisURL)
+}
+
+// newEtcdClientFromEnv creates the client of the etcd cluster at the endpoints specified by
+// TM1_CHECKPOINT_ETCD_ENDPOINTS, authenticating as TM1_CHECKPOINT_ETCD_USER, if specified, using
+// TM1_CHECKPOINT_ETCD_PASSWORD.
+func newEtcdClientFromEnv() (*odata.EtcdClient, error) {
+	endpoints := splitList(os.Getenv("TM1_CHECKPOINT_ETCD_ENDPOINTS"))
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd endpoints specified using TM1_CHECKPOINT_ETCD_ENDPOINTS")
+	}
+	return odata.NewEtcdClient(endpoints, os.Getenv("TM1_CHECKPOINT_ETCD_USER"), os.Getenv("TM1_CHECKPOINT_ETCD_PASSWORD"), nil), nil
+}
+
+// shardKey returns the shard as used in the keys of the checkpoint store, as in shard-2-of-4.
+func shardKey(shard *tracker.Shard) string {
+	return fmt.Sprintf("shard-%d-of-%d", shard.Index, shard.Count)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const usage = `Usage: blackhawk [command] [flags]
+
+Commands:
+  track transactions    Track the transaction log of the TM1 server
+  track messages        Track the message log of the TM1 server
+  track auditlog        Track the audit log of the TM1 server
+  track collection <name>
+                        Track any other collection, supporting track-changes, of the TM1 server
+  top                   Track the transaction log of the TM1 server, showing its live activity in a dashboard
+  threads watch         Watch the threads of the TM1 server and warn about hung threads
+  sessions watch        Watch the sessions of the TM1 server and report logins, logouts and idle sessions
+  config watch          Watch the configuration of the TM1 server and write its changes to the sinks
+  dimensions watch      Watch the dimensions of the TM1 server and write their structural changes to the sinks
+  schema txn|msg|audit  Print the versioned schema of the transaction, message or audit log entries written to the sinks
+  validate              Validate the configuration, and the connectivity to the servers and sinks, without tracking
+  databases list        List the databases hosted by the Planning Analytics Engine, version 12 or later
+  mock tm1              Serve a fake TM1 server, to which a transaction log entry gets written every interval
+  mock sink             Serve a fake target server for the http sink, printing the entries it receives
+  audit                 Track the security changes, derived from the transaction and message logs, of the TM1 server
+  export --from <time> --to <time>
+                        Export the transaction log entries written in a time range, without tracking
+  replay --from <file> [--speed 10x]
+                        Replay the entries archived by the file sink through the filter, rules and sinks
+  query <sql>           Run an SQL query against the recent entries kept by the sqlite sink
+  service install|uninstall|start|stop|restart|status [command]
+                        Install, and control, a Windows service or systemd unit running the command
+  version               Print the version of the tracker
+
+If no command is specified the collection defined by TM1_TRACKER_COLLECTION is tracked.
+Run 'blackhawk <command> -h' to see the flags supported by a command.
+`
+
+// runCommand executes the command specified by the command line arguments.
+func runCommand(args []string) {
+	if len(args) == 0 {
+		collection := os.Getenv("TM1_TRACKER_COLLECTION")
+		if collection == "" {
+			collection = "TransactionLogEntries"
+		}
+		track(collection)
+		return
+	}
+
+	switch args[0] {
+	case "track":
+		if len(args) < 2 {
+			exitWithUsage()
+		}
+		switch args[1] {
+		case "transactions":
+			parseFlags(newTrackFlagSet("track transactions"), args[2:])
+			track("TransactionLogEntries")
+		case "messages":
+			queryThreshold, _ = time.ParseDuration(os.Getenv("TM1_QUERY_THRESHOLD"))
+			flags := newTrackFlagSet("track messages")
+			flags.DurationVar(&queryThreshold, "query-threshold", queryThreshold, "report MDX queries taking longer than this, 0 to disable (TM1_QUERY_THRESHOLD)")
+			parseFlags(flags, args[2:])
+			track("MessageLogEntries")
+		case "auditlog":
+			parseFlags(newTrackFlagSet("track auditlog"), args[2:])
+			track("AuditLogEntries")
+		case "collection":
+			if len(args) < 3 {
+				exitWithUsage()
+			}
+			parseFlags(newTrackFlagSet("track collection"), args[3:])
+			track(args[2])
+		default:
+			exitWithUsage()
+		}
+
+	case "top":
+		parseFlags(newFlagSet("top"), args[1:])
+		top()
+
+	case "threads":
+		if len(args) < 2 || args[1] != "watch" {
+			exitWithUsage()
+		}
+		threshold, err := time.ParseDuration(os.Getenv("TM1_THREAD_THRESHOLD"))
+		if err != nil {
+			threshold = time.Minute
+		}
+		cancelAfter, _ := time.ParseDuration(os.Getenv("TM1_THREAD_CANCEL_AFTER"))
+		cancelFunctions := os.Getenv("TM1_THREAD_CANCEL_FUNCTIONS")
+		dryRun, _ := strconv.ParseBool(os.Getenv("TM1_THREAD_CANCEL_DRY_RUN"))
+		flags := newFlagSet("threads watch")
+		flags.DurationVar(&threshold, "threshold", threshold, "time a thread can be busy before it's considered hung (TM1_THREAD_THRESHOLD)")
+		flags.DurationVar(&cancelAfter, "cancel-after", cancelAfter, "time a thread can be busy before it gets cancelled, 0 to disable (TM1_THREAD_CANCEL_AFTER)")
+		flags.StringVar(&cancelFunctions, "cancel-functions", cancelFunctions, "comma-separated list of functions, as in ExecuteMDX, of threads that may be cancelled (TM1_THREAD_CANCEL_FUNCTIONS)")
+		flags.BoolVar(&dryRun, "dry-run", dryRun, "only report the threads that would be cancelled (TM1_THREAD_CANCEL_DRY_RUN)")
+		parseFlags(flags, args[2:])
+
+		var enforcement *ThreadEnforcement
+		if cancelAfter > 0 {
+			enforcement = &ThreadEnforcement{Limit: cancelAfter, Functions: splitList(cancelFunctions), DryRun: dryRun}
+			if len(enforcement.Functions) == 0 {
+				fmt.Fprintln(os.Stderr, "The functions of threads that may be cancelled need to be specified using --cancel-functions")
+				os.Exit(2)
+			}
+		}
+		watchThreads(threshold, enforcement)
+
+	case "sessions":
+		if len(args) < 2 || args[1] != "watch" {
+			exitWithUsage()
+		}
+		idleThreshold, err := time.ParseDuration(os.Getenv("TM1_SESSION_IDLE_THRESHOLD"))
+		if err != nil {
+			idleThreshold = time.Hour
+		}
+		summaryInterval, _ := time.ParseDuration(os.Getenv("TM1_SESSION_SUMMARY_INTERVAL"))
+		flags := newFlagSet("sessions watch")
+		flags.DurationVar(&idleThreshold, "idle-threshold", idleThreshold, "time a session can be idle before it's reported, 0 to disable (TM1_SESSION_IDLE_THRESHOLD)")
+		flags.DurationVar(&summaryInterval, "summary", summaryInterval, "interval between summaries of all sessions, 0 to disable (TM1_SESSION_SUMMARY_INTERVAL)")
+		parseFlags(flags, args[2:])
+		watchSessions(idleThreshold, summaryInterval)
+
+	case "config":
+		if len(args) < 2 || args[1] != "watch" {
+			exitWithUsage()
+		}
+		flags := newFlagSet("config watch")
+		flags.Var(consoleOption("TM1_CONSOLE_FORMAT"), "console", "print the changes to stdout, instead of writing them to the sinks, as pretty, json or template (TM1_CONSOLE_FORMAT)")
+		flags.Var(consoleOption("TM1_CONSOLE_TEMPLATE"), "template", "Go template the changes are printed with to stdout, instead of writing them to the sinks (TM1_CONSOLE_TEMPLATE)")
+		parseFlags(flags, args[2:])
+		watchConfiguration()
+
+	case "dimensions":
+		if len(args) < 2 || args[1] != "watch" {
+			exitWithUsage()
+		}
+		dimensions := os.Getenv("TM1_METADATA_DIMENSIONS")
+		flags := newFlagSet("dimensions watch")
+		flags.StringVar(&dimensions, "dimensions", dimensions, "comma-separated list of dimensions to watch, all but the control dimensions if none (TM1_METADATA_DIMENSIONS)")
+		flags.Var(consoleOption("TM1_CONSOLE_FORMAT"), "console", "print the changes to stdout, instead of writing them to the sinks, as pretty, json or template (TM1_CONSOLE_FORMAT)")
+		flags.Var(consoleOption("TM1_CONSOLE_TEMPLATE"), "template", "Go template the changes are printed with to stdout, instead of writing them to the sinks (TM1_CONSOLE_TEMPLATE)")
+		parseFlags(flags, args[2:])
+		watchDimensions(splitList(dimensions))
+
+	case "audit":
+		parseFlags(newFlagSet("audit"), args[1:])
+		auditOnly = true
+		track("TransactionLogEntries", "MessageLogEntries")
+
+	case "schema":
+		if len(args) < 2 {
+			exitWithUsage()
+		}
+		format := "json"
+		flags := flag.NewFlagSet("blackhawk schema", flag.ExitOnError)
+		flags.StringVar(&format, "format", format, "format of the schema, json, for a JSON Schema, or avro")
+		parseFlags(flags, args[2:])
+		printSchema(args[1], format)
+
+	case "validate":
+		collections := os.Getenv("TM1_TRACKER_COLLECTION")
+		if collections == "" {
+			collections = "TransactionLogEntries"
+		}
+		flags := newFlagSet("validate")
+		flags.StringVar(&collections, "collections", collections, "comma-separated list of collections to check support tracking changes (TM1_TRACKER_COLLECTION)")
+		flags.Var(queryOption("$filter"), "filter", "$filter query option applied to the collections (TM1_TRACKER_FILTER)")
+		parseFlags(flags, args[1:])
+		validate(splitList(collections))
+
+	case "databases":
+		if len(args) < 2 || args[1] != "list" {
+			exitWithUsage()
+		}
+		parseFlags(newFlagSet("databases list"), args[2:])
+		listDatabases()
+
+	case "export":
+		var from, to timeFlag
+		flags := newTrackFlagSet("export")
+		flags.Var(&from, "from", "start of the time range, as in 2006-01-02 or 2006-01-02T15:04:05Z")
+		flags.Var(&to, "to", "end of the time range, inclusive, a date including the whole day (defaults to now)")
+		parseFlags(flags, args[1:])
+		if from.IsZero() {
+			fmt.Fprintln(os.Stderr, "The start of the time range needs to be specified using --from")
+			os.Exit(2)
+		}
+		if to.IsZero() {
+			to = timeFlag{Time: time.Now()}
+		}
+		export(from.Time, to.end())
+
+	case "replay":
+		path := ""
+		speed := "max"
+		queryThreshold, _ = time.ParseDuration(os.Getenv("TM1_QUERY_THRESHOLD"))
+		flags := newFlagSet("replay")
+		flags.StringVar(&path, "from", path, "file, as written by the file sink, optionally gzip compressed, to replay the entries of, - for stdin")
+		flags.StringVar(&speed, "speed", speed, "multiple, as in 10x, of the pace at which the entries were written to replay them at, max for as fast as possible")
+		flags.DurationVar(&queryThreshold, "query-threshold", queryThreshold, "report MDX queries taking longer than this, 0 to disable (TM1_QUERY_THRESHOLD)")
+		flags.Var(consoleOption("TM1_CONSOLE_FORMAT"), "console", "print the entries to stdout, instead of writing them to the sinks, as pretty, json or template (TM1_CONSOLE_FORMAT)")
+		flags.Var(consoleOption("TM1_CONSOLE_TEMPLATE"), "template", "Go template the entries are printed with to stdout, instead of writing them to the sinks (TM1_CONSOLE_TEMPLATE)")
+		parseFlags(flags, args[1:])
+		if path == "" {
+			fmt.Fprintln(os.Stderr, "The file to replay needs to be specified using --from")
+			os.Exit(2)
+		}
+		replaySpeed, err := parseSpeed(speed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		replay(path, replaySpeed)
+
+	case "query":
+		path := sqlitePath()
+		format := "table"
+		flags := newFlagSet("query")
+		flags.StringVar(&path, "db", path, "path of the database of the sqlite sink (TM1_SQLITE_PATH)")
+		flags.StringVar(&format, "format", format, "format the result is printed in, table, json or csv")
+		parseFlags(flags, args[1:])
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "The SQL query needs to be specified, as in blackhawk query \"SELECT cube_name, COUNT(*) FROM tm1_entries GROUP BY cube_name\"")
+			os.Exit(2)
+		}
+		os.Setenv("TM1_SQLITE_PATH", path)
+		runQuery(flags.Arg(0), format)
+
+	case "mock":
+		if len(args) < 2 {
+			exitWithUsage()
+		}
+		switch args[1] {
+		case "tm1":
+			addr := ":49010"
+			var restartEvery time.Duration
+			var withholdEvery int
+			flags := newFlagSet("mock tm1")
+			flags.StringVar(&addr, "addr", addr, "address to serve the fake TM1 server on")
+			flags.DurationVar(&restartEvery, "restart-every", 0, "simulate a restart of the fake TM1 server, invalidating its delta links, this often, 0 to disable")
+			flags.IntVar(&withholdEvery, "withhold-every", 0, "leave every so many entries out of the log, unless asked for by ID, simulating skipped IDs, 0 to disable")
+			parseFlags(flags, args[2:])
+			mockTM1(addr, restartEvery, withholdEvery)
+		case "sink":
+			addr := ":12345"
+			flags := newFlagSet("mock sink")
+			flags.StringVar(&addr, "addr", addr, "address to serve the fake target server on")
+			parseFlags(flags, args[2:])
+			mockSink(addr)
+		default:
+			exitWithUsage()
+		}
+
+	case "service":
+		if len(args) < 2 {
+			exitWithUsage()
+		}
+		switch args[1] {
+		case "install", "uninstall", "start", "stop", "restart", "status", "run":
+			runService(args[1], args[2:])
+		default:
+			exitWithUsage()
+		}
+
+	case "version":
+		fmt.Println("blackhawk " + trackerVersion())
+
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+
+	default:
+		exitWithUsage()
+	}
+}
+
+// newFlagSet returns the set of flags, supported by every command, which override the settings
+// defined by the environment variables.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("blackhawk "+name, flag.ExitOnError)
+	flags.StringVar(&tm1ServiceRootURL, "url", tm1ServiceRootURL, "service root URL of the TM1 server (TM1_SERVICE_ROOT_URL)")
+	flags.StringVar(&tm1User, "user", tm1User, "name of the user to log in with (TM1_USER)")
+	flags.StringVar(&tm1Database, "database", tm1Database, "database of the Planning Analytics Engine, version 12 or later (TM1_DATABASE)")
+	flags.IntVar(&interval, "interval", interval, "interval, in seconds, between requests to the server (TM1_TRACKER_INTERVAL)")
+	flags.BoolFunc("trace-http", "log wire-level dumps, with credentials redacted, of the requests to, and responses of, the server (TM1_TRACE_HTTP)", func(value string) error {
+		enable, err := strconv.ParseBool(value)
+		if enable {
+			enableHTTPTrace()
+		}
+		return err
+	})
+	return flags
+}
+
+// newTrackFlagSet returns the set of flags supported by every track command, which, next to the
+// flags supported by every command, allow specifying query options applied to the tracked
+// collection.
+func newTrackFlagSet(name string) *flag.FlagSet {
+	flags := newFlagSet(name)
+	flags.Var(queryOption("$filter"), "filter", "$filter query option applied to the collection (TM1_TRACKER_FILTER)")
+	flags.Var(queryOption("$select"), "select", "$select query option applied to the collection (TM1_TRACKER_SELECT)")
+	flags.Var(queryOption("$top"), "top", "$top query option applied to the collection (TM1_TRACKER_TOP)")
+	flags.Var(consoleOption("TM1_CONSOLE_FORMAT"), "console", "print the entries to stdout, instead of writing them to the sinks, as pretty, json or template (TM1_CONSOLE_FORMAT)")
+	flags.Var(consoleOption("TM1_CONSOLE_TEMPLATE"), "template", "Go template the entries are printed with to stdout, instead of writing them to the sinks (TM1_CONSOLE_TEMPLATE)")
+	return flags
+}
+
+// queryOption is a flag.Value setting the query option with its name.
+type queryOption string
+
+func (o queryOption) String() string {
+	return queryOptions[string(o)]
+}
+
+func (o queryOption) Set(value string) error {
+	queryOptions[string(o)] = value
+	return nil
+}
+
+// consoleOption is a flag.Value setting the environment variable with its name, and the console
+// sink as the only sink, so the entries are printed instead of written to the configured sinks.
+type consoleOption string
+
+func (o consoleOption) String() string {
+	return os.Getenv(string(o))
+}
+
+func (o consoleOption) Set(value string) error {
+	os.Setenv("TM1_SINK", "console")
+	return os.Setenv(string(o), value)
+}
+
+// timeFlag is a flag.Value holding a point in time, specified either as a date or in RFC 3339 format.
+type timeFlag struct {
+	time.Time
+	date bool // Specified as a date
+}
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(value string) error {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid time %q, expected 2006-01-02 or 2006-01-02T15:04:05Z", value)
+	}
+	t.Time = parsed
+	t.date = len(value) == len("2006-01-02")
+	return nil
+}
+
+// end returns the end, exclusive, of the time range ending at, and including, the time of the flag:
+// the start of the next day if specified as a date, the next second otherwise, as the time stamps of
+// the entries are in seconds.
+func (t *timeFlag) end() time.Time {
+	if t.date {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Truncate(time.Second).Add(time.Second)
+}
+
+// parseFlags parses the flags passed to a command.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	flags.Parse(args)
+
+	if interval < 1 {
+		fmt.Fprintln(os.Stderr, "The interval needs to be at least 1 second")
+		os.Exit(2)
+	}
+}
+
+// exitWithUsage prints the usage to stderr and exits.
+func exitWithUsage() {
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeFlagEndIncludesWholeDay(t *testing.T) {
+	for value, want := range map[string]string{
+		"2024-01-31":                "2024-02-01T00:00:00Z",
+		"2024-01-31T12:00:00Z":      "2024-01-31T12:00:01Z",
+		"2024-01-31T12:00:00.5Z":    "2024-01-31T12:00:01Z",
+		"2024-01-31T12:00:00+01:00": "2024-01-31T11:00:01Z",
+	} {
+		var flag timeFlag
+		if err := flag.Set(value); err != nil {
+			t.Fatal(err)
+		}
+		if end := flag.end().UTC().Format(time.RFC3339); end != want {
+			t.Errorf("%s ends at %s, expected %s", value, end, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the tracker as read from the configuration file. Every value in it
+// is the equivalent of an environment variable, which, if set, overrides the value in the file.
+type Config struct {
+	Servers   []ServerConfig                    `yaml:"servers"`
+	Tracking  TrackingConfig                    `yaml:"tracking"`
+	Filters   FilterConfig                      `yaml:"filters"`
+	Sinks     map[string]map[string]interface{} `yaml:"sinks"`
+	Transform TransformConfig                   `yaml:"transform"`
+	Rules     string                            `yaml:"rules"`
+	Watches   string                            `yaml:"watches"`
+	Script    string                            `yaml:"script"`
+}
+
+// ServerConfig is the configuration of a TM1 server to be tracked.
+type ServerConfig struct {
+	Name           string                 `yaml:"name"`
+	ServiceRootURL string                 `yaml:"service_root_url"`
+	Authentication string                 `yaml:"authentication"`
+	User           string                 `yaml:"user"`
+	Password       string                 `yaml:"password"`
+	CAMNamespace   string                 `yaml:"cam_namespace"`
+	Database       string                 `yaml:"database"`
+	SessionContext string                 `yaml:"session_context"`
+	Headers        map[string]interface{} `yaml:"headers"`
+}
+
+// TrackingConfig is the configuration of what, and how, gets tracked.
+type TrackingConfig struct {
+	Collection      string `yaml:"collection"`
+	Interval        int    `yaml:"interval"`
+	Filter          string `yaml:"filter"`
+	Select          string `yaml:"select"`
+	Top             int    `yaml:"top"`
+	Checkpoint      string `yaml:"checkpoint"`
+	QueryThreshold  string `yaml:"query_threshold"`
+	ThreadThreshold string `yaml:"thread_threshold"`
+	SessionIdle     string `yaml:"session_idle_threshold"`
+	SessionSummary  string `yaml:"session_summary_interval"`
+	Aggregate       string `yaml:"aggregate_windows"`
+	Adaptive        bool   `yaml:"adaptive"`
+	MinInterval     string `yaml:"min_interval"`
+	MaxInterval     string `yaml:"max_interval"`
+	Shard           string `yaml:"shard"`
+}
+
+// FilterConfig is the configuration of the filter deciding which entries get written to the sink.
+type FilterConfig struct {
+	Cubes      []string `yaml:"cubes"`
+	Users      []string `yaml:"users"`
+	Elements   []string `yaml:"elements"`
+	Expression string   `yaml:"expression"`
+}
+
+// TransformConfig is the configuration of the transformation of the entries before they get written
+// to the sinks.
+type TransformConfig struct {
+	Fields []string               `yaml:"fields"`
+	Rename map[string]interface{} `yaml:"rename"`
+	Tags   map[string]interface{} `yaml:"tags"`
+}
+
+// sinkEnvPrefixes maps the name of every sink to the prefix of its environment variables.
+var sinkEnvPrefixes = map[string]string{
+	"http":          "TM1_SINK_",
+	"kafka":         "TM1_KAFKA_",
+	"file":          "TM1_FILE_",
+	"console":       "TM1_CONSOLE_",
+	"csv":           "TM1_CSV_",
+	"parquet":       "TM1_PARQUET_",
+	"archive":       "TM1_ARCHIVE_",
+	"sql":           "TM1_SQL_",
+	"influxdb":      "TM1_INFLUXDB_",
+	"timescaledb":   "TM1_TIMESCALEDB_",
+	"sqlite":        "TM1_SQLITE_",
+	"elasticsearch": "TM1_ES_",
+	"webhook":       "TM1_WEBHOOK_",
+	"splunk":        "TM1_SPLUNK_",
+	"syslog":        "TM1_SYSLOG_",
+	"gelf":          "TM1_GELF_",
+	"eventhubs":     "TM1_EVENTHUBS_",
+	"kinesis":       "TM1_KINESIS_",
+	"nats":          "TM1_NATS_",
+	"mqtt":          "TM1_MQTT_",
+	"pubsub":        "TM1_PUBSUB_",
+	"bigquery":      "TM1_BIGQUERY_",
+	"broadcast":     "TM1_BROADCAST_",
+	"grpc":          "TM1_GRPC_",
+}
+
+// loadConfigFile reads the configuration file, specified by the TM1_CONFIG_FILE environment
+// variable or blackhawk.yaml by default, and sets the environment variables equivalent to the values
+// in it, unless already set, allowing environment variables to override any value in the file. It
+// is not an error for the default configuration file not to exist.
+func loadConfigFile() error {
+	path := os.Getenv("TM1_CONFIG_FILE")
+	if path == "" {
+		path = "blackhawk.yaml"
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %s", path, err)
+	}
+	return config.setEnv()
+}
+
+// setEnv sets the environment variables equivalent to the values in the configuration, unless they
+// are already set.
+func (c *Config) setEnv() error {
+	// A single server doesn't need a name, in which case the unprefixed variables are used
+	if len(c.Servers) == 1 && c.Servers[0].Name == "" {
+		c.Servers[0].setEnv("TM1_")
+	} else if len(c.Servers) > 0 {
+		names := make([]string, len(c.Servers))
+		for i, server := range c.Servers {
+			if server.Name == "" {
+				return fmt.Errorf("server %d in configuration file has no name", i+1)
+			}
+			names[i] = server.Name
+			server.setEnv(serverEnvPrefix(server.Name))
+		}
+		setEnvDefault("TM1_SERVERS", strings.Join(names, ","))
+	}
+
+	setEnvDefault("TM1_TRACKER_COLLECTION", c.Tracking.Collection)
+	if c.Tracking.Interval > 0 {
+		setEnvDefault("TM1_TRACKER_INTERVAL", strconv.Itoa(c.Tracking.Interval))
+	}
+	if c.Tracking.Adaptive {
+		setEnvDefault("TM1_TRACKER_ADAPTIVE", "true")
+	}
+	setEnvDefault("TM1_TRACKER_MIN_INTERVAL", c.Tracking.MinInterval)
+	setEnvDefault("TM1_TRACKER_MAX_INTERVAL", c.Tracking.MaxInterval)
+	setEnvDefault("TM1_TRACKER_FILTER", c.Tracking.Filter)
+	setEnvDefault("TM1_TRACKER_SELECT", c.Tracking.Select)
+	if c.Tracking.Top > 0 {
+		setEnvDefault("TM1_TRACKER_TOP", strconv.Itoa(c.Tracking.Top))
+	}
+	setEnvDefault("TM1_CHECKPOINT_PATH", c.Tracking.Checkpoint)
+	setEnvDefault("TM1_SHARD", c.Tracking.Shard)
+	setEnvDefault("TM1_QUERY_THRESHOLD", c.Tracking.QueryThreshold)
+	setEnvDefault("TM1_THREAD_THRESHOLD", c.Tracking.ThreadThreshold)
+	setEnvDefault("TM1_SESSION_IDLE_THRESHOLD", c.Tracking.SessionIdle)
+	setEnvDefault("TM1_SESSION_SUMMARY_INTERVAL", c.Tracking.SessionSummary)
+	setEnvDefault("TM1_AGGREGATE_WINDOWS", c.Tracking.Aggregate)
+
+	setEnvDefault("TM1_FILTER_CUBES", strings.Join(c.Filters.Cubes, ","))
+	setEnvDefault("TM1_FILTER_USERS", strings.Join(c.Filters.Users, ","))
+	setEnvDefault("TM1_FILTER_ELEMENTS", strings.Join(c.Filters.Elements, ","))
+	setEnvDefault("TM1_FILTER_EXPRESSION", c.Filters.Expression)
+
+	// Every setting of a sink maps to the environment variable named after the sink's prefix and the
+	// setting, as in TM1_KAFKA_BROKERS for the brokers setting of the kafka sink
+	names := make([]string, 0, len(c.Sinks))
+	for name := range c.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prefix, ok := sinkEnvPrefixes[name]
+		if !ok {
+			return fmt.Errorf("unknown sink in configuration file: %s", name)
+		}
+		for key, value := range c.Sinks[name] {
+			setEnvDefault(prefix+strings.ToUpper(key), configValue(value))
+		}
+	}
+	setEnvDefault("TM1_SINK", strings.Join(names, ","))
+	setEnvDefault("TM1_TRANSFORM_FIELDS", strings.Join(c.Transform.Fields, ","))
+	setEnvDefault("TM1_TRANSFORM_RENAME", configValue(c.Transform.Rename))
+	setEnvDefault("TM1_TRANSFORM_TAGS", configValue(c.Transform.Tags))
+	setEnvDefault("TM1_RULES_FILE", c.Rules)
+	setEnvDefault("TM1_WATCH_FILE", c.Watches)
+	setEnvDefault("TM1_SCRIPT_FILE", c.Script)
+
+	return nil
+}
+
+// setEnv sets the environment variables, named using the prefix, equivalent to the server's values.
+func (s ServerConfig) setEnv(prefix string) {
+	setEnvDefault(prefix+"SERVICE_ROOT_URL", s.ServiceRootURL)
+	setEnvDefault(prefix+"AUTHENTICATION", s.Authentication)
+	setEnvDefault(prefix+"USER", s.User)
+	setEnvDefault(prefix+"PASSWORD", s.Password)
+	setEnvDefault(prefix+"CAM_NAMESPACE", s.CAMNamespace)
+	setEnvDefault(prefix+"DATABASE", s.Database)
+	setEnvDefault(prefix+"SESSION_CONTEXT", s.SessionContext)
+	setEnvDefault(prefix+"HTTP_HEADERS", configValue(s.Headers))
+}
+
+// configEnv are the environment variables set from the configuration file, which are set again
+// when it gets reloaded.
+var configEnv = map[string]bool{}
+
+// setEnvDefault sets the environment variable to the value, unless the value is empty or the
+// environment variable is already set.
+func setEnvDefault(key string, value string) {
+	if value == "" {
+		return
+	}
+	if _, ok := os.LookupEnv(key); !ok {
+		os.Setenv(key, value)
+		configEnv[key] = true
+	}
+}
+
+// configValue returns the representation of a value in the configuration file as an environment
+// variable. Lists are represented as comma-separated lists and maps, like headers, as
+// semicolon-separated lists of "Name: Value" pairs.
+func configValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = configValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + ": " + configValue(v[key])
+		}
+		return strings.Join(pairs, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
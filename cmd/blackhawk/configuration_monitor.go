@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// ConfigurationChange is a change to a parameter of the active or static configuration of a server.
+type ConfigurationChange struct {
+	Type      string      `json:"Type"` // Always ConfigurationChange
+	Server    string      `json:"Server,omitempty"`
+	TimeStamp string      `json:"TimeStamp"` // Time the change was detected
+	Source    string      `json:"Source"`    // ActiveConfiguration or StaticConfiguration
+	Parameter string      `json:"Parameter"` // Path of the parameter, as in Administration.MaximumUserSandboxSize
+	OldValue  interface{} `json:"OldValue"`  // Value before the change, nil if the parameter got added
+	NewValue  interface{} `json:"NewValue"`  // Value after the change, nil if the parameter got removed
+}
+
+func init() {
+	sinks.RegisterBufferedType("ConfigurationChange", (*ConfigurationChange)(nil))
+}
+
+// configurationSources are the endpoints, relative to the service root, holding the configuration.
+var configurationSources = []string{"ActiveConfiguration", "StaticConfiguration"}
+
+// ConfigurationMonitor polls the active and static configuration of the server, comparing every
+// snapshot with the previous one, and writes a ConfigurationChange to the sink for every parameter
+// that has been changed, added or removed since.
+type ConfigurationMonitor struct {
+	server    *Server
+	sink      sinks.Sink
+	snapshots map[string]map[string]interface{}
+	logger    *slog.Logger
+}
+
+// NewConfigurationMonitor creates and returns a new ConfigurationMonitor for the server, writing the
+// changes to the sink.
+func NewConfigurationMonitor(server *Server, sink sinks.Sink) *ConfigurationMonitor {
+	m := new(ConfigurationMonitor)
+	m.server = server
+	m.sink = sink
+	m.snapshots = map[string]map[string]interface{}{}
+	m.logger = newLogger("configuration").With("server", server.String())
+
+	return m
+}
+
+// Run polls the configuration every interval until the context is done.
+func (m *ConfigurationMonitor) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		for _, source := range configurationSources {
+			snapshot, err := m.fetchConfiguration(ctx, source)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return err
+			}
+			if err := m.check(source, snapshot, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchConfiguration retrieves the configuration from the source, flattened to its parameters, by path.
+func (m *ConfigurationMonitor) fetchConfiguration(ctx context.Context, source string) (map[string]interface{}, error) {
+	resp, err := m.server.Client.ExecuteGETRequestEx(ctx, m.server.ServiceRootURL+source, func(*http.Request) {})
+	if err != nil {
+		return nil, err
+	}
+	err = odata.ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving its " + source + "."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var configuration map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&configuration); err != nil {
+		return nil, err
+	}
+	parameters := map[string]interface{}{}
+	flattenConfiguration("", configuration, parameters)
+	return parameters, nil
+}
+
+// check compares the snapshot of the configuration with the previous one of the source, writing a
+// change for every parameter that differs. The first snapshot of a source isn't reported.
+func (m *ConfigurationMonitor) check(source string, snapshot map[string]interface{}, now time.Time) error {
+	previous, ok := m.snapshots[source]
+	m.snapshots[source] = snapshot
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	for name := range previous {
+		if _, ok := snapshot[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changed := false
+	for _, name := range names {
+		oldValue, newValue := previous[name], snapshot[name]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		m.logger.Info("Configuration changed", "source", source, "parameter", name, "old", oldValue, "new", newValue)
+		change := &ConfigurationChange{
+			Type:      "ConfigurationChange",
+			Server:    m.server.Name,
+			TimeStamp: now.UTC().Format(time.RFC3339),
+			Source:    source,
+			Parameter: name,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+		}
+		if err := m.sink.Write(change); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if changed {
+		return m.sink.Flush()
+	}
+	return nil
+}
+
+// flattenConfiguration adds the parameters of the configuration, nested in sections, to the map by
+// their path, as in Administration.ServerName, skipping any annotations.
+func flattenConfiguration(prefix string, configuration map[string]interface{}, parameters map[string]interface{}) {
+	for name, value := range configuration {
+		if strings.Contains(name, "@") {
+			continue
+		}
+		if section, ok := value.(map[string]interface{}); ok {
+			flattenConfiguration(prefix+name+".", section, parameters)
+			continue
+		}
+		parameters[prefix+name] = value
+	}
+}
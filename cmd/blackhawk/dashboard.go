@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// The number of seconds of writes the dashboard keeps track of, and the maximum number of rows of
+// every list it shows.
+const (
+	dashboardSeconds = 60
+	dashboardRows    = 8
+)
+
+// sparkBlocks are the blocks drawing the sparkline of the writes per second, from low to high.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// The dashboard, if any, showing the live activity of the servers being tracked.
+var dashboard *Dashboard
+
+// Dashboard keeps track of the live activity of the servers, as in the writes per second, the
+// cubes written to and the users writing most, the active threads and the alerts raised, as shown
+// by blackhawk top. It captures the log output while it's shown as well, which would otherwise
+// garble the terminal. The dashboard is safe for concurrent use.
+type Dashboard struct {
+	mutex   sync.Mutex
+	started time.Time
+	writes  [dashboardSeconds]int // Writes by second, indexed by the second modulo dashboardSeconds
+	second  int64                 // Last second writes were counted for
+	total   int
+	cubes   map[string]int
+	users   map[string]int
+	threads map[string][]odata.Thread // Busy threads by server
+	alerts  []dashboardAlert
+	log     []string
+	output  io.Writer // Where log output goes, nil while it's captured
+}
+
+// dashboardAlert is an alert raised, as shown by the dashboard.
+type dashboardAlert struct {
+	time    time.Time
+	rule    string
+	message string
+}
+
+// NewDashboard creates and returns a new Dashboard, passing the log output through to stderr until
+// it gets captured.
+func NewDashboard() *Dashboard {
+	d := new(Dashboard)
+	d.started = time.Now()
+	d.cubes = map[string]int{}
+	d.users = map[string]int{}
+	d.threads = map[string][]odata.Thread{}
+	d.output = os.Stderr
+
+	return d
+}
+
+// Add counts the entry, if a transaction log entry, as a write, to its cube, by its user.
+func (d *Dashboard) Add(entry interface{}) {
+	e, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.advance(time.Now().Unix())
+	d.writes[d.second%dashboardSeconds]++
+	d.total++
+	d.cubes[e.Cube]++
+	d.users[e.User]++
+}
+
+// Alert records the alert raised, keeping the most recent ones only.
+func (d *Dashboard) Alert(alert *rules.Alert) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.alerts = append(d.alerts, dashboardAlert{time: time.Now(), rule: alert.Rule, message: alert.Message})
+	if len(d.alerts) > dashboardRows {
+		d.alerts = d.alerts[len(d.alerts)-dashboardRows:]
+	}
+}
+
+// SetThreads records the busy threads of the server.
+func (d *Dashboard) SetThreads(server string, threads []odata.Thread) {
+	var busy []odata.Thread
+	for _, thread := range threads {
+		if thread.State == "Run" || thread.State == "Wait" {
+			busy = append(busy, thread)
+		}
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.threads[server] = busy
+}
+
+// Write captures the log output, keeping the most recent lines, unless it's passed through.
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.output != nil {
+		return d.output.Write(p)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		d.log = append(d.log, line)
+	}
+	if len(d.log) > dashboardRows {
+		d.log = d.log[len(d.log)-dashboardRows:]
+	}
+	return len(p), nil
+}
+
+// CaptureLog starts capturing the log output, to be shown by the dashboard.
+func (d *Dashboard) CaptureLog() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.output = nil
+}
+
+// ReleaseLog stops capturing the log output, writing the lines captured, and passing any further
+// output through, to the writer.
+func (d *Dashboard) ReleaseLog(output io.Writer) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, line := range d.log {
+		fmt.Fprintln(output, line)
+	}
+	d.log = nil
+	d.output = output
+}
+
+// WatchThreads polls the threads of the server every interval, until the context is done.
+// Failing to retrieve the threads doesn't affect tracking, the threads simply aren't shown.
+func (d *Dashboard) WatchThreads(ctx context.Context, server *Server, interval time.Duration) {
+	monitor := NewThreadMonitor(server, 0, nil)
+	for {
+		threads, err := monitor.fetchThreads(ctx)
+		if err != nil && ctx.Err() == nil {
+			monitor.logger.Warn("Unable to retrieve the threads", "error", err)
+		}
+		d.SetThreads(server.String(), threads)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// advance moves on to the second, forgetting the writes counted for the seconds passed since.
+func (d *Dashboard) advance(second int64) {
+	if d.second == 0 || second-d.second >= dashboardSeconds {
+		d.writes = [dashboardSeconds]int{}
+	} else {
+		for s := d.second + 1; s <= second; s++ {
+			d.writes[s%dashboardSeconds] = 0
+		}
+	}
+	if second > d.second {
+		d.second = second
+	}
+}
+
+// render returns the dashboard as shown in a terminal of the width.
+func (d *Dashboard) render(servers string, width int) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.advance(now.Unix())
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "blackhawk top - %s    %s    up %s    (q to quit)\n\n", servers, now.Format("15:04:05"), now.Sub(d.started).Round(time.Second))
+
+	// The writes per second over the last 10 seconds and the last minute, excluding the current second
+	var last10, last60 int
+	spark := make([]int, dashboardSeconds-1)
+	max := 0
+	for i := range spark {
+		second := d.second - int64(len(spark)) + int64(i)
+		spark[i] = d.writes[second%dashboardSeconds]
+		if spark[i] > max {
+			max = spark[i]
+		}
+		last60 += spark[i]
+		if i >= len(spark)-10 {
+			last10 += spark[i]
+		}
+	}
+	fmt.Fprintf(&b, "Writes/s  %.1f (1m avg %.1f)    Total %d\n", float64(last10)/10, float64(last60)/float64(len(spark)), d.total)
+	line := []rune{}
+	for _, n := range spark {
+		if max == 0 {
+			line = append(line, sparkBlocks[0])
+			continue
+		}
+		line = append(line, sparkBlocks[n*(len(sparkBlocks)-1)/max])
+	}
+	fmt.Fprintf(&b, "Last 1m   %s\n\n", string(line))
+
+	// The cubes and users, side by side
+	cubes, users := topCounts(d.cubes), topCounts(d.users)
+	column := (width - 2) / 2
+	if column < 30 {
+		column = 30
+	}
+	fmt.Fprintf(&b, "%-*s  %s\n", column, "TOP CUBES", "TOP USERS")
+	for i := 0; i < dashboardRows && (i < len(cubes) || i < len(users)); i++ {
+		left, right := "", ""
+		if i < len(cubes) {
+			left = formatCount(cubes[i], column)
+		}
+		if i < len(users) {
+			right = formatCount(users[i], column)
+		}
+		fmt.Fprintf(&b, "%-*s  %s\n", column, left, right)
+	}
+
+	// The busy threads of every server
+	var threads []string
+	for _, server := range threadServers(d.threads) {
+		for _, thread := range d.threads[server] {
+			threads = append(threads, fmt.Sprintf("%-6d %-12s %-16s %-5s %-12s %-24s %s", thread.ID, truncate(server, 12), truncate(thread.Name, 16),
+				thread.State, truncate(thread.Function, 12), truncate(thread.ObjectName, 24), thread.ElapsedTime))
+		}
+	}
+	fmt.Fprintf(&b, "\nACTIVE THREADS (%d)\n", len(threads))
+	if len(threads) > 0 {
+		fmt.Fprintf(&b, "%-6s %-12s %-16s %-5s %-12s %-24s %s\n", "ID", "SERVER", "USER", "STATE", "FUNCTION", "OBJECT", "ELAPSED")
+	}
+	for i, thread := range threads {
+		if i == dashboardRows {
+			fmt.Fprintf(&b, "... and %d more\n", len(threads)-dashboardRows)
+			break
+		}
+		b.WriteString(truncate(thread, width) + "\n")
+	}
+
+	b.WriteString("\nRECENT ALERTS\n")
+	for i := len(d.alerts) - 1; i >= 0; i-- {
+		alert := d.alerts[i]
+		b.WriteString(truncate(alert.time.Format("15:04:05")+"  "+alert.rule+"  "+strings.ReplaceAll(alert.message, "\n", " "), width) + "\n")
+	}
+
+	if len(d.log) > 0 {
+		b.WriteString("\nLOG\n")
+		for _, line := range d.log {
+			b.WriteString(truncate(line, width) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// dashboardCount is the number of writes to a cube, or by a user.
+type dashboardCount struct {
+	name  string
+	count int
+}
+
+// topCounts returns the counts, highest first.
+func topCounts(counts map[string]int) []dashboardCount {
+	var top []dashboardCount
+	for name, count := range counts {
+		top = append(top, dashboardCount{name: name, count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return top[i].name < top[j].name
+	})
+	return top
+}
+
+// formatCount returns the name, padded, followed by the count, fitting the width.
+func formatCount(c dashboardCount, width int) string {
+	count := fmt.Sprint(c.count)
+	return fmt.Sprintf("%-*s %s", width-len(count)-1, truncate(c.name, width-len(count)-1), count)
+}
+
+// truncate returns the text, cut off at the width.
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if width <= 0 || len(runes) <= width {
+		return text
+	}
+	return string(runes[:width])
+}
+
+// threadServers returns the servers the threads are known of, sorted.
+func threadServers(threads map[string][]odata.Thread) []string {
+	keys := make([]string, 0, len(threads))
+	for key := range threads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dashboardTick is the message redrawing the dashboard every second.
+type dashboardTick time.Time
+
+// dashboardModel is the terminal UI showing the dashboard, redrawn every second.
+type dashboardModel struct {
+	dashboard *Dashboard
+	servers   string
+	width     int
+}
+
+func (m dashboardModel) Init() tea.Cmd {
+	return m.tick()
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case dashboardTick:
+		return m, m.tick()
+	}
+	return m, nil
+}
+
+func (m dashboardModel) View() string {
+	return m.dashboard.render(m.servers, m.width)
+}
+
+// tick returns the command sending the next tick, a second from now.
+func (m dashboardModel) tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return dashboardTick(t)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Enricher enriches transaction log entries with the element, by dimension name, of every
+// dimension of the cube and, optionally, the values of the attributes of those elements. The
+// dimensions of cubes and the attributes of elements are cached, so they are retrieved from the
+// server only once. If a limiter is set, the lookups of the dimensions of cubes and the attributes
+// of elements not cached yet are limited to its rate.
+type Enricher struct {
+	server     *Server
+	attributes []string
+	limiter    *rate.Limiter
+	mutex      sync.Mutex
+	dimensions map[string][]string
+	elements   map[[2]string]map[string]interface{}
+}
+
+// NewEnricher creates and returns a new Enricher for the server, retrieving the values of the
+// attributes, if any, of the elements.
+func NewEnricher(server *Server, attributes []string) *Enricher {
+	e := new(Enricher)
+	e.server = server
+	e.attributes = attributes
+	e.dimensions = map[string][]string{}
+	e.elements = map[[2]string]map[string]interface{}{}
+
+	return e
+}
+
+// NewEnricherFromEnv creates an Enricher for the server if TM1_ENRICH is set to true, retrieving
+// the attributes specified by TM1_ENRICH_ATTRIBUTES, at no more lookups per second than specified
+// by TM1_ENRICH_RATE_LIMIT, if at all, or returns nil otherwise.
+func NewEnricherFromEnv(server *Server) *Enricher {
+	if enrich, _ := strconv.ParseBool(os.Getenv("TM1_ENRICH")); !enrich {
+		return nil
+	}
+	e := NewEnricher(server, splitList(os.Getenv("TM1_ENRICH_ATTRIBUTES")))
+	if limit, err := strconv.ParseFloat(os.Getenv("TM1_ENRICH_RATE_LIMIT"), 64); err == nil && limit > 0 {
+		e.limiter = odata.NewLimiter(limit, 0)
+	}
+	return e
+}
+
+// Enrich sets the Elements, and, if any attributes are to be retrieved, the Attributes of the entry.
+func (e *Enricher) Enrich(entry *odata.TransactionLogEntry) error {
+	dimensions, err := e.cubeDimensions(entry.Cube)
+	if err != nil {
+		return err
+	}
+
+	entry.Elements = make(map[string]string, len(dimensions))
+	for i, dimension := range dimensions {
+		if i >= len(entry.Tuple) {
+			break
+		}
+		entry.Elements[dimension] = entry.Tuple[i]
+	}
+	if len(e.attributes) == 0 {
+		return nil
+	}
+
+	attributes, err := e.elementAttributes(entry.Elements)
+	if err != nil {
+		return err
+	}
+	entry.Attributes = attributes
+	return nil
+}
+
+// cubeDimensions returns the dimensions of the cube, retrieving them if not cached yet.
+func (e *Enricher) cubeDimensions(cube string) ([]string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if dimensions, ok := e.dimensions[cube]; ok {
+		return dimensions, nil
+	}
+	if err := e.wait(1); err != nil {
+		return nil, err
+	}
+	dimensions, err := e.server.Client.CubeDimensions(e.server.ServiceRootURL, cube)
+	if err != nil {
+		return nil, err
+	}
+	e.dimensions[cube] = dimensions
+	return dimensions, nil
+}
+
+// elementAttributes returns the values of the attributes, by dimension name, of the elements, by
+// dimension name, retrieving, in a single round trip if batching is enabled, those not cached yet.
+func (e *Enricher) elementAttributes(elements map[string]string) (map[string]map[string]interface{}, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	attributes := make(map[string]map[string]interface{}, len(elements))
+	var missing [][2]string
+	for dimension, element := range elements {
+		key := [2]string{dimension, element}
+		if values, ok := e.elements[key]; ok {
+			attributes[dimension] = values
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return attributes, nil
+	}
+
+	if err := e.wait(len(missing)); err != nil {
+		return nil, err
+	}
+	values, err := e.server.Client.ElementsAttributes(e.server.ServiceRootURL, missing, e.attributes)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range missing {
+		e.elements[key] = values[i]
+		attributes[key[0]] = values[i]
+	}
+	return attributes, nil
+}
+
+// wait waits, if a limiter is set, until that many lookups are allowed.
+func (e *Enricher) wait(lookups int) error {
+	if e.limiter == nil {
+		return nil
+	}
+	for i := 0; i < lookups; i++ {
+		if err := e.limiter.Wait(context.Background()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
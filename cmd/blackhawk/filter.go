@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/tracker"
+)
+
+// NewFilterFromEnv creates a Filter as defined by the TM1_FILTER_CUBES, TM1_FILTER_USERS and
+// TM1_FILTER_ELEMENTS environment variables, each containing a comma-separated list, and the
+// TM1_FILTER_EXPRESSION environment variable. If none of them are set nil is returned.
+func NewFilterFromEnv() (*tracker.Filter, error) {
+	cubes := splitList(os.Getenv("TM1_FILTER_CUBES"))
+	users := splitList(os.Getenv("TM1_FILTER_USERS"))
+	elements := splitList(os.Getenv("TM1_FILTER_ELEMENTS"))
+	expression := os.Getenv("TM1_FILTER_EXPRESSION")
+	if len(cubes) == 0 && len(users) == 0 && len(elements) == 0 && expression == "" {
+		return nil, nil
+	}
+	return tracker.NewFilter(cubes, users, elements, expression)
+}
+
+// splitList splits a comma-separated list, ignoring any empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitPairs splits a semicolon-separated list of "Name: Value" pairs, like headers, into a map,
+// ignoring any item without a colon.
+func splitPairs(list string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(list, ";") {
+		if parts := strings.SplitN(pair, ":", 2); len(parts) == 2 {
+			pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Health keeps track of the state of the tracker, reported using the /healthz and /readyz endpoints,
+// allowing an orchestrator, like Kubernetes, to restart the tracker if it got wedged.
+type Health struct {
+	mutex         sync.Mutex
+	maxDeltaAge   time.Duration
+	servers       map[string]*serverHealth
+	sinkErr       error
+	checkpointErr error
+	role          string // Role, leader or standby, of the tracker, if leader election is enabled
+}
+
+// serverHealth is the state of a server being tracked.
+type serverHealth struct {
+	since     time.Time // Time tracking started
+	lastDelta time.Time // Time the last response got processed successfully
+	err       error     // Error tracking stopped with, if any
+}
+
+// NewHealth creates and returns a new Health considering the tracker wedged if a server being
+// tracked didn't return a delta for longer than maxDeltaAge.
+func NewHealth(maxDeltaAge time.Duration) *Health {
+	h := new(Health)
+	h.maxDeltaAge = maxDeltaAge
+	h.servers = map[string]*serverHealth{}
+
+	return h
+}
+
+// NewHealthFromEnv creates a Health using TM1_HEALTH_MAX_DELTA_AGE, which defaults to ten times the
+// interval between requests, or, if polling adapts the interval, its ceiling, or five minutes,
+// whichever is longer.
+func NewHealthFromEnv() *Health {
+	maxDeltaAge, err := time.ParseDuration(os.Getenv("TM1_HEALTH_MAX_DELTA_AGE"))
+	if err != nil || maxDeltaAge <= 0 {
+		maxDeltaAge = 10 * time.Duration(interval) * time.Second
+		if polling, _ := newPollingFromEnv(); polling != nil {
+			maxDeltaAge = 10 * polling.Max
+		}
+		if maxDeltaAge < 5*time.Minute {
+			maxDeltaAge = 5 * time.Minute
+		}
+	}
+	return NewHealth(maxDeltaAge)
+}
+
+// The health of the tracker.
+var health = NewHealth(5 * time.Minute)
+
+// Track registers the server as being tracked.
+func (h *Health) Track(server *Server) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.servers[healthKey(server)] = &serverHealth{since: time.Now()}
+}
+
+// Lead records whether the tracker is the leader, actively tracking, or stands by, in which case the
+// servers aren't being tracked, and thus aren't expected to return any delta. Becoming the leader, the
+// servers are tracked anew.
+func (h *Health) Lead(leading bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.role = "standby"
+	if leading {
+		h.role = "leader"
+		for _, sh := range h.servers {
+			*sh = serverHealth{since: time.Now()}
+		}
+	}
+}
+
+// Delta records the successful processing of a response from the server.
+func (h *Health) Delta(server *Server) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if sh, ok := h.servers[healthKey(server)]; ok {
+		sh.lastDelta = time.Now()
+	}
+}
+
+// Failed records that tracking the server stopped with the error.
+func (h *Health) Failed(server *Server, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if sh, ok := h.servers[healthKey(server)]; ok {
+		sh.err = err
+	}
+}
+
+// SinkResult records the result of the last attempt to deliver entries to the sink.
+func (h *Health) SinkResult(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sinkErr = err
+}
+
+// CheckpointResult records the result of the last attempt to persist the checkpoint.
+func (h *Health) CheckpointResult(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checkpointErr = err
+}
+
+// healthKey returns the key of the server, which, as a server can be tracked for multiple
+// collections at once, includes the collection.
+func healthKey(server *Server) string {
+	if server.tracker == nil {
+		return server.String()
+	}
+	return server.String() + " " + server.tracker.Collection
+}
+
+// status returns the status of the tracker, and whether it is alive, as in not wedged, and ready,
+// as in every server has been processed successfully and the last delivery and checkpoint succeeded.
+func (h *Health) status() (map[string]interface{}, bool, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	alive, ready := true, true
+	servers := map[string]interface{}{}
+	for name, sh := range h.servers {
+		if h.role == "standby" {
+			servers[name] = map[string]interface{}{}
+			continue
+		}
+		status := map[string]interface{}{}
+		last := sh.lastDelta
+		if last.IsZero() {
+			ready = false
+			last = sh.since
+		} else {
+			status["lastDelta"] = sh.lastDelta.UTC().Format(time.RFC3339)
+			status["lastDeltaAge"] = time.Since(sh.lastDelta).Round(time.Second).String()
+		}
+		if sh.err != nil {
+			alive, ready = false, false
+			status["error"] = sh.err.Error()
+		} else if time.Since(last) > h.maxDeltaAge {
+			alive, ready = false, false
+			status["error"] = "no delta processed for longer than " + h.maxDeltaAge.String()
+		}
+		servers[name] = status
+	}
+
+	status := map[string]interface{}{"servers": servers, "sink": "ok", "checkpoint": "ok"}
+	if h.sinkErr != nil {
+		ready = false
+		status["sink"] = h.sinkErr.Error()
+	}
+	if h.checkpointErr != nil {
+		ready = false
+		status["checkpoint"] = h.checkpointErr.Error()
+	}
+	if h.role != "" {
+		status["role"] = h.role
+	}
+	return status, alive, ready
+}
+
+// ServeLiveness serves the status of the tracker, responding with 503 Service Unavailable if it's wedged.
+func (h *Health) ServeLiveness(w http.ResponseWriter, r *http.Request) {
+	status, alive, _ := h.status()
+	writeStatus(w, status, alive)
+}
+
+// ServeReadiness serves the status of the tracker, responding with 503 Service Unavailable if it's not ready.
+func (h *Health) ServeReadiness(w http.ResponseWriter, r *http.Request) {
+	status, _, ready := h.status()
+	writeStatus(w, status, ready)
+}
+
+// writeStatus writes the status as the JSON response, with 200 OK if ok, 503 Service Unavailable otherwise.
+func writeStatus(w http.ResponseWriter, status map[string]interface{}, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
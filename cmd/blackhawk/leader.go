@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Leader elects, using a lease shared by multiple instances of the tracker, the one instance, the
+// leader, actively tracking, while the others stand by, ready to take over, continuing from the shared
+// checkpoint, once the leader stops renewing the lease.
+type Leader struct {
+	lease odata.Lease
+	ttl   time.Duration
+}
+
+// NewLeader creates and returns a new Leader electing the leader using the lease, which lasts for
+// the ttl unless renewed, which the leader does every third of the ttl.
+func NewLeader(lease odata.Lease, ttl time.Duration) *Leader {
+	l := new(Leader)
+	l.lease = lease
+	l.ttl = ttl
+
+	return l
+}
+
+// newLeaderFromEnv creates, if TM1_LEADER_ELECTION is set to true, the Leader electing the leader
+// using a lease, named TM1_LEADER_KEY, blackhawk/leader by default, followed, if the entries are
+// partitioned across multiple instances, by the shard, kept in the checkpoint store, which therefore
+// has to be redis, etcd or sql. The lease lasts for TM1_LEADER_LEASE, by default the interval, and is
+// held by TM1_LEADER_ID, by default the host name and process ID of the tracker.
+func newLeaderFromEnv() (*Leader, error) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("TM1_LEADER_ELECTION")); !enabled {
+		return nil, nil
+	}
+	ttl := time.Duration(interval) * time.Second
+	if value := os.Getenv("TM1_LEADER_LEASE"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl < time.Second {
+			return nil, fmt.Errorf("invalid TM1_LEADER_LEASE: %s", value)
+		}
+	}
+	key := os.Getenv("TM1_LEADER_KEY")
+	if key == "" {
+		key = "blackhawk/leader"
+	}
+	shard, err := shardFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if shard != nil {
+		key += "/" + shardKey(shard)
+	}
+	id := os.Getenv("TM1_LEADER_ID")
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	var lease odata.Lease
+	switch storeType := os.Getenv("TM1_CHECKPOINT_STORE"); storeType {
+	case "redis":
+		client, err := newRedisClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		lease = odata.NewRedisLease(client, key, id)
+
+	case "etcd":
+		client, err := newEtcdClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		lease = odata.NewEtcdLease(client, key, id)
+
+	case "sql":
+		sqlLease, err := odata.NewSQLLease(os.Getenv("TM1_CHECKPOINT_SQL_DRIVER"), os.Getenv("TM1_CHECKPOINT_SQL_DSN"), key, id)
+		if err != nil {
+			return nil, err
+		}
+		lease = sqlLease
+
+	default:
+		return nil, fmt.Errorf("leader election requires a checkpoint store shared by the instances, redis, etcd or sql, not %q", storeType)
+	}
+	return NewLeader(lease, ttl), nil
+}
+
+// Run stands by, trying to acquire the lease every third of the ttl, until it's acquired, and then,
+// while leading, runs fn with a context that gets cancelled once the lease is lost, standing by again
+// thereafter, until ctx is done, or fn returns by itself, as in all tracking stopped, returning
+// whether fn succeeded every time. The lease is kept, until released, once Run returns.
+func (l *Leader) Run(ctx context.Context, fn func(context.Context) bool) bool {
+	ok := true
+	standingBy := false
+	for {
+		held, err := l.lease.Acquire(l.ttl)
+		if err != nil {
+			logger.Warn("Unable to acquire leadership", "error", err)
+		}
+		if held {
+			logger.Info("Elected leader, tracking")
+			succeeded, lost := l.lead(ctx, fn)
+			ok = ok && succeeded
+			if !lost {
+				return ok
+			}
+			standingBy = false
+		}
+		if !standingBy {
+			logger.Info("Standing by, waiting for leadership", "lease", l.ttl.String())
+			standingBy = true
+		}
+		select {
+		case <-ctx.Done():
+			return ok
+		case <-time.After(l.ttl / 3):
+		}
+	}
+}
+
+// lead runs fn, renewing the lease every third of the ttl, until fn returns, cancelling fn as soon as
+// the lease is lost, or can't be renewed for two thirds of the ttl, so fn stops before the lease
+// expires and another instance takes over. It returns whether fn succeeded and whether the lease
+// was lost.
+func (l *Leader) lead(ctx context.Context, fn func(context.Context) bool) (bool, bool) {
+	leading, stop := context.WithCancel(ctx)
+	defer stop()
+	health.Lead(true)
+	defer health.Lead(false)
+	leadership.Set(1)
+	defer leadership.Set(0)
+	done := make(chan bool, 1)
+	go func() {
+		done <- fn(leading)
+	}()
+
+	renewed := time.Now()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case ok := <-done:
+			return ok, false
+		case <-ticker.C:
+			held, err := l.lease.Acquire(l.ttl)
+			if held {
+				renewed = time.Now()
+				continue
+			}
+			if err != nil && time.Since(renewed) < l.ttl-l.ttl/3 {
+				logger.Warn("Unable to renew leadership", "error", err)
+				continue
+			}
+			logger.Warn("Lost leadership, stopping tracking", "error", err)
+			stop()
+			ok := <-done
+			return ok, true
+		}
+	}
+}
+
+// Release releases the lease, if held, so a standby can take over right away.
+func (l *Leader) Release() {
+	if err := l.lease.Release(); err != nil {
+		logger.Warn("Unable to release leadership", "error", err)
+	}
+}
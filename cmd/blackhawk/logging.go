@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// The logger of the tracker itself, other modules get their own logger using newLogger.
+var logger = slog.Default()
+
+// The logger reporting on the sinks.
+var sinksLogger = slog.Default()
+
+// The level, and optional per module levels, and the format of the log output.
+var logLevel = slog.LevelInfo
+var logModuleLevels = map[string]slog.Level{}
+var logJSON bool
+var logOutput io.Writer = os.Stderr
+
+// Whether wire-level dumps of the requests to, and the responses of, the servers are logged.
+var traceHTTP bool
+
+// setupLogging configures logging as defined by the TM1_LOG_LEVEL and TM1_LOG_FORMAT environment
+// variables. TM1_LOG_LEVEL holds the level, one of trace, debug, info, warn or error, optionally
+// followed by per module levels, as in "info,odata=debug". TM1_LOG_FORMAT is either text or json.
+// If TM1_TRACE_HTTP is set, the odata module logs at the trace level.
+func setupLogging() error {
+	for _, level := range splitList(os.Getenv("TM1_LOG_LEVEL")) {
+		module := ""
+		if i := strings.Index(level, "="); i >= 0 {
+			module, level = strings.TrimSpace(level[:i]), strings.TrimSpace(level[i+1:])
+		}
+		var l slog.Level
+		if strings.EqualFold(level, "trace") {
+			l = odata.LevelTrace
+		} else if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level specified in TM1_LOG_LEVEL: %s", level)
+		}
+		if module == "" {
+			logLevel = l
+		} else {
+			logModuleLevels[module] = l
+		}
+	}
+
+	switch format := os.Getenv("TM1_LOG_FORMAT"); format {
+	case "", "text":
+		logJSON = false
+	case "json":
+		logJSON = true
+	default:
+		return fmt.Errorf("invalid log format specified in TM1_LOG_FORMAT: %s", format)
+	}
+
+	if traceHTTP, _ = strconv.ParseBool(os.Getenv("TM1_TRACE_HTTP")); traceHTTP {
+		logModuleLevels["odata"] = odata.LevelTrace
+	}
+
+	logger = newLogger("tracker")
+	slog.SetDefault(logger)
+	sinksLogger = newLogger("sinks")
+	odata.Logger = newLogger("odata")
+	return nil
+}
+
+// newLogger returns the logger for the module, logging at the level configured for the module.
+func newLogger(module string) *slog.Logger {
+	level, ok := logModuleLevels[module]
+	if !ok {
+		level = logLevel
+	}
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.LevelKey && len(groups) == 0 && a.Value.Any() == odata.LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+		return a
+	}}
+
+	var handler slog.Handler
+	if logJSON {
+		handler = slog.NewJSONHandler(logOutput, options)
+	} else {
+		handler = slog.NewTextHandler(logOutput, options)
+	}
+	return slog.New(handler).With("module", module)
+}
+
+// enableHTTPTrace enables logging wire-level dumps of the requests to, and the responses of, the
+// servers, lowering the level of the odata module to trace.
+func enableHTTPTrace() {
+	traceHTTP = true
+	logModuleLevels["odata"] = odata.LevelTrace
+	odata.Logger = newLogger("odata")
+}
+
+// fatal logs the message, at the error level, and terminates the tracker.
+func fatal(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
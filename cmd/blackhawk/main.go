@@ -0,0 +1,863 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/tracker"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+	"github.com/joho/godotenv"
+)
+
+// The version of the tracker, set when building a release, as in -ldflags "-X main.version=1.2.3".
+var version string
+
+// Environment variables, which can be overridden using command line flags
+var tm1ServiceRootURL string
+var tm1User string
+var tm1Database string
+var interval int
+var queryOptions map[string]string
+
+// The sink all processed entries get written to.
+var sink sinks.Sink
+
+// The filter deciding which transaction log entries get written to the sink, if any.
+var filter *tracker.Filter
+
+// The alerting engine evaluating the rules against every entry, before any filtering, if any,
+// replaced when the configuration gets reloaded.
+var alerts *rules.Engine
+var alertsMutex sync.RWMutex
+
+// The watch list deriving cell change events from the transaction log entries writing watched
+// cells, if any, replaced, guarded by alertsMutex, when the configuration gets reloaded.
+var watches *rules.WatchList
+
+// Whether audit events are derived from the entries, and whether only those are written to the sink.
+var auditEnabled bool
+var auditOnly bool
+
+// The aggregator, if any, emitting summaries of the writes per cube over rolling windows.
+var aggregator *Aggregator
+
+// The profiler, if any, deriving anomaly events from writes deviating from the profile of their user.
+var profiler *Profiler
+
+// The query timer threshold, if any, above which MDX queries are reported while tracking the
+// message log.
+var queryThreshold time.Duration
+
+// inspect inspects every entry, before it's filtered, updating the metrics, evaluating the alert
+// rules and feeding the aggregator, profiler, query timer and process monitor. It returns the records derived
+// from the entry, like audit events and process executions, to be written to the sink as well, and
+// whether the entry itself should be written.
+func (s *Server) inspect(entry interface{}) ([]interface{}, bool) {
+	var records []interface{}
+	switch e := entry.(type) {
+	case *odata.TransactionLogEntry:
+		entriesProcessed.WithLabelValues("TransactionLogEntries").Inc()
+		cubeWrites.WithLabelValues(e.Cube).Inc()
+		if e.FutureTimeStamp {
+			futureTimeStamps.Inc()
+		}
+		if aggregator != nil {
+			aggregator.Add(e)
+		}
+		if event := s.auditor.Transaction(e); event != nil {
+			records = append(records, event)
+		}
+		for _, event := range profiler.Add(e) {
+			records = append(records, event)
+		}
+		if watches := currentWatches(); watches != nil {
+			for _, event := range watches.Match(e) {
+				records = append(records, event)
+			}
+		}
+	case *odata.MessageLogEntry:
+		entriesProcessed.WithLabelValues("MessageLogEntries").Inc()
+		if e.FutureTimeStamp {
+			futureTimeStamps.Inc()
+		}
+		if s.queryTimer != nil {
+			s.queryTimer.Process(e)
+		}
+		if event := s.auditor.Message(e); event != nil {
+			records = append(records, event)
+		}
+		if s.processMonitor != nil {
+			if execution := s.processMonitor.Process(e); execution != nil {
+				records = append(records, execution)
+			}
+		}
+	case *odata.AuditLogEntry:
+		entriesProcessed.WithLabelValues("AuditLogEntries").Inc()
+		if e.FutureTimeStamp {
+			futureTimeStamps.Inc()
+		}
+	default:
+		entriesProcessed.WithLabelValues("Entities").Inc()
+	}
+	if alerts := currentAlerts(); alerts != nil {
+		alerts.Evaluate(entry)
+	}
+	if dashboard != nil {
+		dashboard.Add(entry)
+	}
+	if liveTail != nil {
+		liveTail.Add(entry)
+	}
+	return records, !auditOnly
+}
+
+// newTracker creates the tracker of the collection of the server, hooking up the metrics, health,
+// enricher and everything else inspecting the entries.
+func (s *Server) newTracker(collection string) *tracker.Tracker {
+	t := tracker.New(s.ServiceRootURL, collection, nil)
+	t.Name = s.Name
+	t.Inspect = s.inspect
+	if s.TimeZone != "" {
+		location, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			fatal("Invalid time zone", "server", s.String(), "timezone", s.TimeZone, "error", err)
+		}
+		t.TimeZone = location
+		t.ClockSkew = time.Minute
+		if value := os.Getenv("TM1_CLOCK_SKEW_TOLERANCE"); value != "" {
+			if t.ClockSkew, err = time.ParseDuration(value); err != nil {
+				fatal("Invalid clock skew tolerance", "value", value, "error", err)
+			}
+		}
+	}
+	typedValues, _ := strconv.ParseBool(os.Getenv("TM1_TYPED_VALUES"))
+	if s.enricher != nil || typedValues {
+		t.Enrich = func(entry *odata.TransactionLogEntry) {
+			if typedValues {
+				entry.ParseValues()
+			}
+			if s.enricher == nil {
+				return
+			}
+			if err := s.enricher.Enrich(entry); err != nil {
+				logger.Warn("Unable to enrich transaction log entry", "server", s.String(), "entry", entry.ID, "error", err)
+			}
+		}
+	}
+	t.OnParseError = func(raw json.RawMessage, err error) {
+		parseErrors.Inc()
+		if raw != nil {
+			logger.Warn("Skipped entry that couldn't be decoded", "error", err, "entry", string(raw))
+		}
+	}
+	t.OnSinkResult = health.SinkResult
+	t.OnCheckpointResult = health.CheckpointResult
+	t.OnDelta = func(writes map[string]int) {
+		recordDelta(writes)
+		health.Delta(s)
+	}
+	t.OnEmptyDelta = emptyDeltas.Inc
+	t.OnGap = func(gap *tracker.Gap) {
+		gaps.Inc()
+		msg := "Delta link lost, tracking started over"
+		if gap.FirstMissingID != 0 {
+			msg = "Transaction log entries missing"
+		}
+		args := []interface{}{"server", s.String(), "collection", gap.Collection, "reason", gap.Reason, "recovery", gap.Recovery,
+			"from", gap.From.ID, "until", gap.Until.ID, "skipped", gap.Skipped, "recovered", gap.Recovered}
+		logger.Warn(msg, args...)
+		healthNotifier.Notify(msg, gap.Reason, map[string]interface{}{"Server": s.String(), "Skipped": gap.Skipped})
+	}
+
+	return t
+}
+
+func main() {
+	// Load environment variables from .env file, if there is one
+	err := godotenv.Load()
+	if err != nil && !os.IsNotExist(err) {
+		fatal("Error loading .env file", "error", err)
+	}
+
+	// Load the configuration file, if there is one, for any value not set by an environment variable
+	if err := loadConfigFile(); err != nil {
+		fatal("Error loading configuration file", "error", err)
+	}
+
+	// Set up logging, which is configured using environment variables as well
+	if err := setupLogging(); err != nil {
+		fatal("Error setting up logging", "error", err)
+	}
+	if err := setupTracing(); err != nil {
+		fatal("Error setting up tracing", "error", err)
+	}
+	if err := loadPlugins(); err != nil {
+		fatal("Unable to load plugins", "error", err)
+	}
+	healthNotifier = NewHealthNotifierFromEnv()
+	tm1ServiceRootURL = os.Getenv("TM1_SERVICE_ROOT_URL")
+	tm1User = os.Getenv("TM1_USER")
+	tm1Database = os.Getenv("TM1_DATABASE")
+	auditEnabled, _ = strconv.ParseBool(os.Getenv("TM1_AUDIT"))
+	interval, _ = strconv.Atoi(os.Getenv("TM1_TRACKER_INTERVAL"))
+	if interval < 1 {
+		interval = 5
+	}
+	queryOptions = map[string]string{
+		"$filter": os.Getenv("TM1_TRACKER_FILTER"),
+		"$select": os.Getenv("TM1_TRACKER_SELECT"),
+		"$top":    os.Getenv("TM1_TRACKER_TOP"),
+	}
+
+	// Expose the health of the tracker to Prometheus, and orchestrators, if so requested
+	health = NewHealthFromEnv()
+	if metricsAddr := os.Getenv("TM1_METRICS_ADDR"); metricsAddr != "" {
+		serveMetrics(metricsAddr)
+	}
+
+	// Serve the web UI, tailing the entries in the browser, if so requested
+	if uiAddr := os.Getenv("TM1_UI_ADDR"); uiAddr != "" {
+		serveUI(uiAddr)
+	}
+
+	// Execute the command specified on the command line, if any, which can override any of the
+	// settings defined by the environment variables.
+	runCommand(os.Args[1:])
+}
+
+// trackerVersion returns the version of the tracker, which, unless set when building a release, is
+// the version of the module if installed using go install, or dev otherwise.
+func trackerVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// track tracks the collections on every server, writing all their entries to the configured sink,
+// until the tracker gets interrupted or terminated. Every server, and collection, is tracked
+// independently, if tracking fails for one server the others carry on.
+func track(collections ...string) {
+	servers := setupTracking(collections...)
+
+	// Track the collection of transaction or message log entries. This will query the existing
+	// entries and then cause the server to query the delta of the collection (read: just the
+	// changes) after a defined duration.
+	trackServer := func(ctx context.Context, server *Server) error {
+		return server.tracker.Track(ctx, time.Duration(interval)*time.Second)
+	}
+
+	// If leader election is enabled, the servers are only tracked while this instance is the leader,
+	// any other instance standing by until it takes over, continuing from the shared checkpoint.
+	leader, err := newLeaderFromEnv()
+	if err != nil {
+		fatal("Unable to set up leader election", "error", err)
+	}
+	var ok bool
+	if leader == nil {
+		ok = runServers(servers, "Tracking", trackServer)
+	} else {
+		health.Lead(false)
+		ok = leader.Run(shutdownContext(), func(ctx context.Context) bool {
+			return runServersContext(ctx, servers, "Tracking", trackServer)
+		})
+	}
+
+	// Deliver whatever is still pending in the sink. Note that the checkpoint already holds the
+	// last deltaLink for which all entries were processed, so there is nothing left to persist.
+	// Only then a standby can take over.
+	closeOutputs()
+	if leader != nil {
+		leader.Release()
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// top tracks the transaction log on every server, as track does, showing the live activity, as in
+// the writes per second, the cubes written to and the users writing most, the active threads and
+// the alerts raised, in a dashboard taking over the terminal, until it's quit, or the tracker gets
+// interrupted or terminated.
+func top() {
+	// Log through the dashboard, which captures the log output while it takes over the terminal
+	dashboard = NewDashboard()
+	logOutput = dashboard
+	if err := setupLogging(); err != nil {
+		fatal("Error setting up logging", "error", err)
+	}
+
+	servers := setupTracking("TransactionLogEntries")
+	var names []string
+	for _, server := range servers {
+		names = append(names, server.String())
+	}
+	dashboard.CaptureLog()
+	program := tea.NewProgram(dashboardModel{dashboard: dashboard, servers: strings.Join(names, ", ")}, tea.WithAltScreen())
+
+	var ok bool
+	done := make(chan struct{})
+	go func() {
+		ok = runServers(servers, "Tracking", func(ctx context.Context, server *Server) error {
+			if server.Version.SupportsThreads() {
+				go dashboard.WatchThreads(ctx, server, time.Duration(interval)*time.Second)
+			}
+			return server.tracker.Track(ctx, time.Duration(interval)*time.Second)
+		})
+		close(done)
+		program.Quit()
+	}()
+	_, err := program.Run()
+	requestShutdown()
+	<-done
+	dashboard.ReleaseLog(os.Stderr)
+	if err != nil {
+		fatal("Unable to show the dashboard", "error", err)
+	}
+
+	closeOutputs()
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// setupTracking sets up tracking the collections on every server, continuing from the checkpoint,
+// if any, and returns the servers, ready to be tracked.
+func setupTracking(collections ...string) []*Server {
+	servers := setup(collections...)
+
+	// If a checkpoint store is specified we'll continue tracking from the last deltaLink saved in it
+	checkpoint, err := newCheckpointFromEnv()
+	if err != nil {
+		fatal("Unable to load checkpoint", "store", os.Getenv("TM1_CHECKPOINT_STORE"), "error", err)
+	}
+	shard, err := shardFromEnv()
+	if err != nil {
+		fatal("Invalid shard", "error", err)
+	}
+	for _, server := range servers {
+		server.tracker.QueryOptions = queryOptions
+		server.tracker.Checkpoint = checkpoint
+		server.tracker.Shard = shard
+		polling, err := newPollingFromEnv()
+		if err != nil {
+			fatal("Invalid polling interval", "error", err)
+		}
+		server.tracker.Polling = polling
+		if server.tracker.Recovery, server.tracker.MaxIdle, err = recoveryFromEnv(); err != nil {
+			fatal("Invalid delta recovery", "error", err)
+		}
+		if server.tracker.DetectGaps, server.tracker.Backfill, err = gapDetectionFromEnv(); err != nil {
+			fatal("Invalid gap detection", "error", err)
+		}
+		health.Track(server)
+	}
+	enableReload(servers)
+	return servers
+}
+
+// recoveryFromEnv returns how tracking recovers from losing its deltaLink, as specified by
+// TM1_DELTA_RECOVERY, end, last-entry, the default, or off, and the time after which an idle log
+// is presumed to have lost its deltaLink, as specified by TM1_DELTA_MAX_IDLE, if at all.
+func recoveryFromEnv() (tracker.Recovery, time.Duration, error) {
+	var recovery tracker.Recovery
+	switch mode := os.Getenv("TM1_DELTA_RECOVERY"); mode {
+	case "", "last-entry":
+		recovery = tracker.RecoverFromLastEntry
+	case "end":
+		recovery = tracker.RecoverFromEnd
+	case "off":
+		return "", 0, nil
+	default:
+		return "", 0, fmt.Errorf("invalid TM1_DELTA_RECOVERY: %s", mode)
+	}
+	var maxIdle time.Duration
+	if value := os.Getenv("TM1_DELTA_MAX_IDLE"); value != "" {
+		var err error
+		if maxIdle, err = time.ParseDuration(value); err != nil {
+			return "", 0, fmt.Errorf("invalid TM1_DELTA_MAX_IDLE: %s", value)
+		}
+	}
+	return recovery, maxIdle, nil
+}
+
+// gapDetectionFromEnv returns whether the IDs of the transaction log entries are checked for gaps
+// and, if so, whether the entries skipped get backfilled, as specified by TM1_GAP_DETECTION, off,
+// the default, report or backfill.
+func gapDetectionFromEnv() (bool, bool, error) {
+	switch detection := os.Getenv("TM1_GAP_DETECTION"); detection {
+	case "", "off":
+		return false, false, nil
+	case "report", "backfill":
+		return true, detection == "backfill", nil
+	default:
+		return false, false, fmt.Errorf("invalid TM1_GAP_DETECTION: %s", detection)
+	}
+}
+
+// shardFromEnv returns the shard of the entries processed, as specified by TM1_SHARD, as in 2/4 for
+// the second of four shards, if the entries are partitioned across multiple instances of the tracker,
+// or nil if they aren't.
+func shardFromEnv() (*tracker.Shard, error) {
+	value := os.Getenv("TM1_SHARD")
+	if value == "" {
+		return nil, nil
+	}
+	return tracker.ParseShard(value)
+}
+
+// newPollingFromEnv returns, if TM1_TRACKER_ADAPTIVE is set to true, the polling adapting the
+// interval between deltas to the activity of the collection, between the TM1_TRACKER_MIN_INTERVAL
+// floor, 250ms by default, and the TM1_TRACKER_MAX_INTERVAL ceiling, the interval by default.
+func newPollingFromEnv() (*tracker.AdaptivePolling, error) {
+	if adaptive, _ := strconv.ParseBool(os.Getenv("TM1_TRACKER_ADAPTIVE")); !adaptive {
+		return nil, nil
+	}
+	min, max := 250*time.Millisecond, time.Duration(interval)*time.Second
+	var err error
+	if value := os.Getenv("TM1_TRACKER_MIN_INTERVAL"); value != "" {
+		if min, err = time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+	}
+	if value := os.Getenv("TM1_TRACKER_MAX_INTERVAL"); value != "" {
+		if max, err = time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+	}
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("the minimum interval, %s, must be positive and not exceed the maximum interval, %s", min, max)
+	}
+	return tracker.NewAdaptivePolling(min, max), nil
+}
+
+// export reads the transaction log entries written from from up to, but not including, until on
+// every server, writing them to the configured sink, without tracking any subsequent changes. This
+// allows reprocessing history, for example after an outage of the tracker or one of its sinks.
+func export(from time.Time, until time.Time) {
+	servers := setup("TransactionLogEntries")
+
+	// Let the server select the entries in the time range, on top of any filter already specified
+	options := map[string]string{}
+	for name, value := range queryOptions {
+		options[name] = value
+	}
+	timeFilter := "TimeStamp ge " + from.UTC().Format(time.RFC3339) + " and TimeStamp lt " + until.UTC().Format(time.RFC3339)
+	if options["$filter"] != "" {
+		options["$filter"] = "(" + options["$filter"] + ") and " + timeFilter
+	} else {
+		options["$filter"] = timeFilter
+	}
+
+	for _, server := range servers {
+		server.tracker.QueryOptions = options
+	}
+	ok := runServers(servers, "Exporting", func(ctx context.Context, server *Server) error {
+		return server.tracker.Read(ctx)
+	})
+
+	closeOutputs()
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// setup connects to every server, using the processor matching the collection, and sets up the
+// filter and the sink, shared by all servers, the processed entries get written to. If multiple
+// collections are specified, every server is connected to once per collection.
+func setup(collections ...string) []*Server {
+	var servers []*Server
+	for _, collection := range collections {
+		servers = append(servers, connectServers(collection)...)
+	}
+	setupOutputs(servers)
+	return servers
+}
+
+// setupOutputs sets up the filter, the sink, the aggregator, the profiler, the alerting engine and
+// the watch list, shared by the trackers of all servers.
+func setupOutputs(servers []*Server) {
+	// Set up the filter, if any, deciding which entries get written to the sink
+	var err error
+	filter, err = NewFilterFromEnv()
+	if err != nil {
+		fatal("Invalid filter", "error", err)
+	}
+
+	// Set up the sink, or sinks, the processed entries will be written to, which is shared by all
+	// servers
+	sink, err = newSinkFromEnv(servers)
+	if err != nil {
+		fatal("Unable to set up sink", "error", err)
+	}
+	// The sink needs to be safe for concurrent use if it's shared by multiple servers, or if the
+	// aggregator emits its summaries to it as well
+	if servers[0].tracker.Collection == "TransactionLogEntries" {
+		aggregator, err = NewAggregatorFromEnv()
+		if err != nil {
+			fatal("Invalid aggregation", "error", err)
+		}
+		profiler, err = NewProfilerFromEnv()
+		if err != nil {
+			fatal("Unable to set up user profiles", "error", err)
+		}
+	}
+	if len(servers) > 1 || aggregator != nil {
+		sink = sinks.NewSyncSink(sink)
+	}
+	// The sink is replaced, while tracking, if its configuration changes when the configuration
+	// gets reloaded
+	sink = newReloadableSink(sink)
+	if aggregator != nil {
+		aggregator.Start(func(record map[string]interface{}) error {
+			if err := sink.Write(record); err != nil {
+				return err
+			}
+			return sink.Flush()
+		})
+	}
+
+	for _, server := range servers {
+		server.tracker.Sink = sink
+		server.tracker.Filter = filter
+	}
+
+	// Set up the alerting engine, if a rules file is specified
+	alerts, err = newAlertsFromEnv(servers)
+	if err != nil {
+		fatal("Unable to load rules", "path", os.Getenv("TM1_RULES_FILE"), "error", err)
+	}
+
+	// Set up the watch list, if a watch list file is specified
+	watches, err = newWatchesFromEnv(servers)
+	if err != nil {
+		fatal("Unable to load watch list", "path", os.Getenv("TM1_WATCH_FILE"), "error", err)
+	}
+}
+
+// newAlertsFromEnv creates the alerting engine evaluating the rules in the file specified by the
+// TM1_RULES_FILE environment variable, executing the processes of its process actions on the
+// servers, or returns nil if no rules file is specified.
+func newAlertsFromEnv(servers []*Server) (*rules.Engine, error) {
+	rulesFile := os.Getenv("TM1_RULES_FILE")
+	if rulesFile == "" {
+		return nil, nil
+	}
+	engine, err := rules.LoadEngine(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	rulesLogger := newLogger("rules")
+	engine.OnError = func(rule string, err error) {
+		rulesLogger.Error("Alert failed", "rule", rule, "error", err)
+	}
+	if dashboard != nil {
+		engine.OnAlert = dashboard.Alert
+	}
+	engine.SetProcessExecutor(processExecutor(servers, rulesLogger))
+	return engine, nil
+}
+
+func init() {
+	// The rules package, deriving the cell change events, doesn't depend on the sinks
+	sinks.RegisterBufferedType("CellChangeEvent", (*rules.CellChangeEvent)(nil))
+}
+
+// newWatchesFromEnv creates the watch list defined by the file specified by the TM1_WATCH_FILE
+// environment variable, executing the processes of its process actions on the servers, or returns
+// nil if no watch list file is specified.
+func newWatchesFromEnv(servers []*Server) (*rules.WatchList, error) {
+	watchFile := os.Getenv("TM1_WATCH_FILE")
+	if watchFile == "" {
+		return nil, nil
+	}
+	watchList, err := rules.LoadWatchList(watchFile)
+	if err != nil {
+		return nil, err
+	}
+	rulesLogger := newLogger("rules")
+	watchList.SetOnError(func(watch string, err error) {
+		rulesLogger.Error("Watch action failed", "watch", watch, "error", err)
+	})
+	watchList.SetProcessExecutor(processExecutor(servers, rulesLogger))
+	return watchList, nil
+}
+
+// processExecutor returns the executor executing the processes of process actions on the servers.
+func processExecutor(servers []*Server, logger *slog.Logger) rules.ProcessExecutor {
+	return func(name string, process string, parameters map[string]string) error {
+		for _, server := range servers {
+			if server.Name == name {
+				logger.Info("Executing process", "server", name, "process", process)
+				return server.Client.ExecuteProcess(server.ServiceRootURL, process, parameters)
+			}
+		}
+		return fmt.Errorf("unknown server %s to execute process %s on", name, process)
+	}
+}
+
+// connectServers connects to every server, using the processor matching the collection.
+func connectServers(collection string) []*Server {
+	servers := serversFromEnv()
+	for _, server := range servers {
+		switch collection {
+		case "TransactionLogEntries":
+			server.enricher = NewEnricherFromEnv(server)
+		case "MessageLogEntries":
+			if queryThreshold > 0 {
+				server.queryTimer = NewQueryTimer(server, queryThreshold)
+			}
+			if trackProcesses, _ := strconv.ParseBool(os.Getenv("TM1_TRACK_PROCESSES")); trackProcesses {
+				server.processMonitor = NewProcessMonitor(server)
+			}
+		}
+		if auditEnabled || auditOnly {
+			server.auditor = NewAuditor(server)
+		}
+
+		// The tracker picks the processor matching the collection we are going to process
+		server.tracker = server.newTracker(collection)
+		server.connect(server.tracker.Processor())
+		server.tracker.Client = server.Client
+		server.tracker.ServiceRootURL = server.ServiceRootURL
+	}
+	return servers
+}
+
+// closeOutputs delivers whatever is still pending in the sink and fires any pending alerts.
+func closeOutputs() {
+	if aggregator != nil {
+		aggregator.Stop()
+	}
+	if err := profiler.Save(); err != nil {
+		logger.Error("Unable to save user profiles", "path", os.Getenv("TM1_PROFILE_PATH"), "error", err)
+	}
+	if alerts := currentAlerts(); alerts != nil {
+		alerts.Close()
+	}
+	if watches := currentWatches(); watches != nil {
+		watches.Close()
+	}
+	if err := sink.Close(); err != nil {
+		fatal("Unable to close sink", "error", err)
+	}
+	if err := closeDeadLetterSink(); err != nil {
+		fatal("Unable to close dead-letter sink", "error", err)
+	}
+	shutdownTracing()
+}
+
+// watchThreads monitors the threads of every server, warning about threads that have been busy
+// for longer than the threshold, and, if enforcement is passed, cancelling runaway threads, until
+// the monitor gets interrupted or terminated.
+func watchThreads(threshold time.Duration, enforcement *ThreadEnforcement) {
+	servers := serversFromEnv()
+	for _, server := range servers {
+		server.connect(nil)
+		if !server.Version.SupportsThreads() {
+			fatal("Server no longer exposes its threads, watching threads requires a version prior to 12", "server", server.String(), "version", server.Version.String())
+		}
+	}
+
+	ok := runServers(servers, "Watching threads", func(ctx context.Context, server *Server) error {
+		return NewThreadMonitor(server, threshold, enforcement).Run(ctx, time.Duration(interval)*time.Second)
+	})
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// listDatabases prints the databases hosted by every server, a Planning Analytics Engine, version 12
+// or later, one per line, prefixed by the name of the server if multiple servers are configured.
+func listDatabases() {
+	servers := serversFromEnv()
+	for _, server := range servers {
+		server.newClient(nil)
+		databases, err := server.Client.Databases(server.ServiceRootURL)
+		if err != nil {
+			fatal("Unable to retrieve the databases of the server", "server", server.String(), "error", err)
+		}
+		for _, database := range databases {
+			if len(servers) > 1 {
+				fmt.Print(server.String() + ": ")
+			}
+			fmt.Println(database)
+		}
+	}
+}
+
+// printSchema prints the JSON Schema, or, if the format is avro, the Avro schema, of the entries of
+// the type, txn, msg or audit, as emitted by the tracker.
+func printSchema(entryType string, format string) {
+	var entry interface{}
+	switch entryType {
+	case "txn":
+		entry = &odata.TransactionLogEntry{}
+	case "msg":
+		entry = &odata.MessageLogEntry{}
+	case "audit":
+		entry = &odata.AuditLogEntry{}
+	default:
+		exitWithUsage()
+	}
+
+	var schema []byte
+	var err error
+	switch format {
+	case "json":
+		schema, err = sinks.JSONSchema(entry)
+	case "avro":
+		var avroSchema string
+		avroSchema, err = sinks.AvroSchema(entry)
+		schema = []byte(avroSchema)
+	default:
+		fmt.Fprintln(os.Stderr, "The format of the schema needs to be either json or avro")
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal("Unable to derive the schema of the entries", "error", err)
+	}
+	var indented bytes.Buffer
+	json.Indent(&indented, schema, "", "  ")
+	fmt.Println(indented.String())
+}
+
+// watchSessions monitors the sessions of every server, reporting sessions being opened, closed and
+// idle for longer than the idle threshold, until the monitor gets interrupted or terminated.
+func watchSessions(idleThreshold time.Duration, summaryInterval time.Duration) {
+	servers := serversFromEnv()
+	for _, server := range servers {
+		server.connect(nil)
+	}
+
+	ok := runServers(servers, "Watching sessions", func(ctx context.Context, server *Server) error {
+		return NewSessionMonitor(server, idleThreshold, summaryInterval).Run(ctx, time.Duration(interval)*time.Second)
+	})
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// watchConfiguration monitors the configuration of every server, writing its changes to the sink,
+// until the monitor gets interrupted or terminated.
+func watchConfiguration() {
+	watchChanges("Watching configuration", func(ctx context.Context, server *Server) error {
+		return NewConfigurationMonitor(server, sink).Run(ctx, time.Duration(interval)*time.Second)
+	})
+}
+
+// watchDimensions monitors the dimensions, all but the control dimensions if none are passed, of
+// every server, writing their structural changes to the sink, until the monitor gets interrupted or
+// terminated.
+func watchDimensions(dimensions []string) {
+	watchChanges("Watching dimensions", func(ctx context.Context, server *Server) error {
+		return NewMetadataMonitor(server, sink, dimensions).Run(ctx, time.Duration(interval)*time.Second)
+	})
+}
+
+// watchChanges connects to every server, sets up the sink, and runs the monitor, writing the changes
+// it detects to the sink, for every server.
+func watchChanges(action string, monitor func(context.Context, *Server) error) {
+	servers := serversFromEnv()
+	for _, server := range servers {
+		server.connect(nil)
+	}
+
+	var err error
+	sink, err = newSinkFromEnv(servers)
+	if err != nil {
+		fatal("Unable to set up sink", "error", err)
+	}
+	if len(servers) > 1 {
+		sink = sinks.NewSyncSink(sink)
+	}
+
+	ok := runServers(servers, action, monitor)
+
+	closeOutputs()
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// runServers runs the function for every server concurrently, until all of them have returned,
+// which they are asked to do, gracefully, as soon as we receive an interrupt or terminate signal.
+// A failure for one server, which gets logged, doesn't affect the others. Returns false if the
+// function failed for any of the servers.
+func runServers(servers []*Server, action string, fn func(context.Context, *Server) error) bool {
+	return runServersContext(shutdownContext(), servers, action, fn)
+}
+
+// runServersContext runs fn for every server, as runServers does, until ctx is done.
+func runServersContext(ctx context.Context, servers []*Server, action string, fn func(context.Context, *Server) error) bool {
+	ok := true
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			err := fn(ctx, server)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				health.Failed(server, err)
+				args := []interface{}{"server", server.String(), "error", err}
+				if code := odata.ErrorCode(err); code != "" {
+					args = append(args, "code", code)
+				}
+				logger.Error(action+" failed", args...)
+				healthNotifier.Notify(action+" failed", err.Error(), map[string]interface{}{"Server": server.String()})
+				mutex.Lock()
+				ok = false
+				mutex.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+	return ok
+}
+
+// shutdownRequested is closed when the service manager asks the tracker to stop.
+var shutdownRequested = make(chan struct{})
+var shutdownOnce sync.Once
+
+// requestShutdown asks whatever is running to shut down gracefully.
+func requestShutdown() {
+	shutdownOnce.Do(func() { close(shutdownRequested) })
+}
+
+// shutdownContext returns a context which is cancelled as soon as the process receives an interrupt
+// or terminate signal, or a shutdown is requested, allowing whatever is running to shut down gracefully.
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Info("Received signal, shutting down...", "signal", sig.String())
+		case <-shutdownRequested:
+			logger.Info("Service stopping, shutting down...")
+		}
+		cancel()
+	}()
+	return ctx
+}
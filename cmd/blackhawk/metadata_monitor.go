@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// maxChangedElements is the maximum number of added, and removed, elements listed in a MetadataChange.
+const maxChangedElements = 100
+
+// MetadataChange is a structural change to the dimensions of a server, as in a hierarchy being
+// added, elements being added to or removed from a hierarchy, or a hierarchy being rebuilt, i.e.
+// its edges having changed while its elements haven't.
+type MetadataChange struct {
+	Type            string   `json:"Type"` // Always MetadataChange
+	Server          string   `json:"Server,omitempty"`
+	TimeStamp       string   `json:"TimeStamp"` // Time the change was detected
+	Change          string   `json:"Change"`    // DimensionAdded, DimensionRemoved, HierarchyAdded, HierarchyRemoved, ElementsChanged or HierarchyRebuilt
+	Dimension       string   `json:"Dimension"`
+	Hierarchy       string   `json:"Hierarchy,omitempty"`
+	ElementCount    int      `json:"ElementCount"`
+	OldElementCount int      `json:"OldElementCount"`
+	AddedElements   []string `json:"AddedElements,omitempty"`   // At most the first 100 elements added
+	RemovedElements []string `json:"RemovedElements,omitempty"` // At most the first 100 elements removed
+}
+
+func init() {
+	sinks.RegisterBufferedType("MetadataChange", (*MetadataChange)(nil))
+}
+
+// hierarchyState is what the MetadataMonitor remembers about a hierarchy.
+type hierarchyState struct {
+	elements  map[string]bool
+	edgesHash string
+}
+
+// MetadataMonitor polls the elements and edges of the hierarchies of the dimensions of the server,
+// comparing them with the previous poll, and writes a MetadataChange to the sink for every
+// structural change detected since.
+type MetadataMonitor struct {
+	server     *Server
+	sink       sinks.Sink
+	dimensions []string // Dimensions to monitor, all but the control dimensions if none
+	states     map[string]map[string]*hierarchyState
+	logger     *slog.Logger
+}
+
+// NewMetadataMonitor creates and returns a new MetadataMonitor for the dimensions of the server,
+// writing the changes to the sink. If no dimensions are passed all but the control dimensions are
+// monitored.
+func NewMetadataMonitor(server *Server, sink sinks.Sink, dimensions []string) *MetadataMonitor {
+	m := new(MetadataMonitor)
+	m.server = server
+	m.sink = sink
+	m.dimensions = dimensions
+	m.logger = newLogger("metadata").With("server", server.String())
+
+	return m
+}
+
+// Run polls the dimensions every interval until the context is done.
+func (m *MetadataMonitor) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		states, err := m.fetchDimensions(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := m.check(states, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchDimensions retrieves the state of the hierarchies, by name, of every monitored dimension.
+func (m *MetadataMonitor) fetchDimensions(ctx context.Context) (map[string]map[string]*hierarchyState, error) {
+	dimensions := m.dimensions
+	if len(dimensions) == 0 {
+		var res struct {
+			Dimensions []struct {
+				Name string `json:"Name"`
+			} `json:"value"`
+		}
+		if err := m.get(ctx, "Dimensions?$select=Name", "its dimensions", &res); err != nil {
+			return nil, err
+		}
+		for _, dimension := range res.Dimensions {
+			if !strings.HasPrefix(dimension.Name, "}") {
+				dimensions = append(dimensions, dimension.Name)
+			}
+		}
+	}
+
+	states := map[string]map[string]*hierarchyState{}
+	for _, dimension := range dimensions {
+		var res struct {
+			Hierarchies []struct {
+				Name     string `json:"Name"`
+				Elements []struct {
+					Name string `json:"Name"`
+				} `json:"Elements"`
+				Edges []struct {
+					ParentName    string  `json:"ParentName"`
+					ComponentName string  `json:"ComponentName"`
+					Weight        float64 `json:"Weight"`
+				} `json:"Edges"`
+			} `json:"value"`
+		}
+		err := m.get(ctx, "Dimensions("+odata.KeyLiteral(dimension)+")/Hierarchies?$select=Name&$expand=Elements($select=Name),Edges($select=ParentName,ComponentName,Weight)",
+			"the hierarchies of dimension "+dimension, &res)
+		if err != nil {
+			var odataErr *odata.ODataError
+			if errors.As(err, &odataErr) && odataErr.StatusCode == http.StatusNotFound {
+				// The dimension doesn't exist, or got deleted since we listed the dimensions
+				continue
+			}
+			return nil, err
+		}
+
+		hierarchies := map[string]*hierarchyState{}
+		for _, hierarchy := range res.Hierarchies {
+			state := &hierarchyState{elements: make(map[string]bool, len(hierarchy.Elements))}
+			for _, element := range hierarchy.Elements {
+				state.elements[element.Name] = true
+			}
+			edges := make([]string, len(hierarchy.Edges))
+			for i, edge := range hierarchy.Edges {
+				edges[i] = edge.ParentName + "\x00" + edge.ComponentName + "\x00" + strconv.FormatFloat(edge.Weight, 'g', -1, 64)
+			}
+			sort.Strings(edges)
+			hash := sha256.Sum256([]byte(strings.Join(edges, "\n")))
+			state.edgesHash = hex.EncodeToString(hash[:])
+			hierarchies[hierarchy.Name] = state
+		}
+		states[dimension] = hierarchies
+	}
+	return states, nil
+}
+
+// get retrieves the resource, at the URL relative to the service root, decoding it into v.
+func (m *MetadataMonitor) get(ctx context.Context, urlStr string, what string, v interface{}) error {
+	resp, err := m.server.Client.ExecuteGETRequestEx(ctx, m.server.ServiceRootURL+urlStr, func(*http.Request) {})
+	if err != nil {
+		return err
+	}
+	err = odata.ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving " + what + "."
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// check compares the state of the dimensions with the previous one, writing a change for every
+// dimension or hierarchy that differs. The first state isn't reported.
+func (m *MetadataMonitor) check(states map[string]map[string]*hierarchyState, now time.Time) error {
+	previous := m.states
+	m.states = states
+	if previous == nil {
+		return nil
+	}
+
+	dimensions := map[string]bool{}
+	for dimension := range states {
+		dimensions[dimension] = true
+	}
+	for dimension := range previous {
+		dimensions[dimension] = true
+	}
+
+	var changes []*MetadataChange
+	for _, dimension := range sortedNames(dimensions) {
+		hierarchies, oldHierarchies := states[dimension], previous[dimension]
+		switch {
+		case oldHierarchies == nil:
+			changes = append(changes, &MetadataChange{Change: "DimensionAdded", Dimension: dimension, ElementCount: elementCount(hierarchies[dimension])})
+			continue
+		case hierarchies == nil:
+			changes = append(changes, &MetadataChange{Change: "DimensionRemoved", Dimension: dimension, OldElementCount: elementCount(oldHierarchies[dimension])})
+			continue
+		}
+
+		names := map[string]bool{}
+		for name := range hierarchies {
+			names[name] = true
+		}
+		for name := range oldHierarchies {
+			names[name] = true
+		}
+		for _, name := range sortedNames(names) {
+			state, oldState := hierarchies[name], oldHierarchies[name]
+			change := &MetadataChange{Dimension: dimension, Hierarchy: name, ElementCount: elementCount(state), OldElementCount: elementCount(oldState)}
+			switch {
+			case oldState == nil:
+				change.Change = "HierarchyAdded"
+			case state == nil:
+				change.Change = "HierarchyRemoved"
+			default:
+				change.AddedElements = missingElements(state.elements, oldState.elements)
+				change.RemovedElements = missingElements(oldState.elements, state.elements)
+				if len(change.AddedElements) > 0 || len(change.RemovedElements) > 0 {
+					change.Change = "ElementsChanged"
+				} else if state.edgesHash != oldState.edgesHash {
+					change.Change = "HierarchyRebuilt"
+				} else {
+					continue
+				}
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for _, change := range changes {
+		change.Type = "MetadataChange"
+		change.Server = m.server.Name
+		change.TimeStamp = now.UTC().Format(time.RFC3339)
+		m.logger.Info("Metadata changed", "change", change.Change, "dimension", change.Dimension, "hierarchy", change.Hierarchy,
+			"elements", change.ElementCount, "old_elements", change.OldElementCount)
+		if err := m.sink.Write(change); err != nil {
+			return err
+		}
+	}
+	if len(changes) > 0 {
+		return m.sink.Flush()
+	}
+	return nil
+}
+
+// sortedNames returns the names in the set, sorted.
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// elementCount returns the number of elements of the hierarchy, 0 if there is none.
+func elementCount(state *hierarchyState) int {
+	if state == nil {
+		return 0
+	}
+	return len(state.elements)
+}
+
+// missingElements returns, sorted, at most the first 100 elements of a missing from b.
+func missingElements(a map[string]bool, b map[string]bool) []string {
+	var missing []string
+	for element := range a {
+		if !b[element] {
+			missing = append(missing, element)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > maxChangedElements {
+		missing = missing[:maxChangedElements]
+	}
+	return missing
+}
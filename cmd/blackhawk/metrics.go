@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics exposing the health of the tracker to Prometheus
+var (
+	entriesProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_entries_processed_total",
+		Help: "Number of entries processed, by collection.",
+	}, []string{"collection"})
+	deltasFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_deltas_fetched_total",
+		Help: "Number of responses, initial and deltas, fetched and processed successfully.",
+	})
+	emptyDeltas = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_empty_deltas_total",
+		Help: "Number of responses, initial and deltas, processed successfully without holding any new entries.",
+	})
+	gaps = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_gaps_total",
+		Help: "Number of gaps in the entries tracked, as in tracking starting over after losing its delta link, or IDs being skipped.",
+	})
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_config_reloads_total",
+		Help: "Number of times the configuration got reloaded, by result, success or failure.",
+	}, []string{"result"})
+	parseErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_parse_errors_total",
+		Help: "Number of responses that could not be parsed.",
+	})
+	futureTimeStamps = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_future_timestamps_total",
+		Help: "Number of entries with a normalized time stamp lying in the future relative to the clock of the tracker.",
+	})
+	httpErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blackhawk_http_errors_total",
+		Help: "Number of requests to the TM1 server that failed or returned an error status.",
+	})
+	sinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_sink_errors_total",
+		Help: "Number of errors returned by a sink, by sink, if multiple sinks are used.",
+	}, []string{"sink"})
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_dead_letters_total",
+		Help: "Number of entries permanently rejected by a sink and written to the dead-letter sink, by sink.",
+	}, []string{"sink"})
+	cubeWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_cube_writes_total",
+		Help: "Number of transaction log entries processed, by cube.",
+	}, []string{"cube"})
+	cubeWriteRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blackhawk_cube_write_rate",
+		Help: "Writes per second, by cube, observed between the last two deltas.",
+	}, []string{"cube"})
+	windowWrites = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blackhawk_window_writes",
+		Help: "Number of writes, by cube, within the rolling window.",
+	}, []string{"cube", "window"})
+	windowChange = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blackhawk_window_abs_change",
+		Help: "Sum of the absolute changes of numeric values, by cube, within the rolling window.",
+	}, []string{"cube", "window"})
+	windowUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blackhawk_window_users",
+		Help: "Number of distinct users writing, by cube, within the rolling window.",
+	}, []string{"cube", "window"})
+	anomalies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blackhawk_anomalies_total",
+		Help: "Number of writes deviating sharply from the profile of the user making them, by anomaly.",
+	}, []string{"anomaly"})
+	leadership = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blackhawk_leader",
+		Help: "Whether the tracker is the leader, actively tracking, 1, or stands by, 0, if leader election is enabled.",
+	})
+	lastDeltaAge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "blackhawk_last_delta_age_seconds",
+		Help: "Seconds since the last response was fetched and processed successfully.",
+	}, func() float64 {
+		lastDeltaMutex.Lock()
+		defer lastDeltaMutex.Unlock()
+		if lastDelta.IsZero() {
+			return 0
+		}
+		return time.Since(lastDelta).Seconds()
+	})
+)
+
+// Gauges reporting how much is queued, by sink, between processing the entries and delivering them
+var (
+	sinkQueueDepth = newSinkGauge("blackhawk_sink_queue_depth",
+		"Number of entries queued, by sink, for the workers delivering them.")
+	sinkInFlightBytes = newSinkGauge("blackhawk_sink_inflight_bytes",
+		"Number of bytes of encoded entries queued, by sink, for the request streaming them to the target server.")
+)
+
+// sinkGauge is a gauge, by sink, reporting the sum of the values of all instances of a sink, as a
+// sink can be created multiple times, as in once per worker, at the time the gauge is collected.
+type sinkGauge struct {
+	desc    *prometheus.Desc
+	mutex   sync.Mutex
+	sources map[string][]func() int64
+}
+
+// newSinkGauge creates and returns a new sinkGauge.
+func newSinkGauge(name string, help string) *sinkGauge {
+	g := new(sinkGauge)
+	g.desc = prometheus.NewDesc(name, help, []string{"sink"}, nil)
+	g.sources = map[string][]func() int64{}
+
+	return g
+}
+
+// Add adds the function returning the value of an instance of the sink.
+func (g *sinkGauge) Add(sink string, source func() int64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.sources[sink] = append(g.sources[sink], source)
+}
+
+// Describe implements prometheus.Collector.
+func (g *sinkGauge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+// Collect implements prometheus.Collector.
+func (g *sinkGauge) Collect(ch chan<- prometheus.Metric) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for sink, sources := range g.sources {
+		var value int64
+		for _, source := range sources {
+			value += source()
+		}
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, float64(value), sink)
+	}
+}
+
+// Time the last delta was processed successfully
+var lastDelta time.Time
+var lastDeltaMutex sync.Mutex
+
+func init() {
+	prometheus.MustRegister(entriesProcessed, deltasFetched, emptyDeltas, gaps, configReloads, parseErrors, futureTimeStamps, httpErrors, sinkErrors, deadLetters, cubeWrites, cubeWriteRate, windowWrites, windowChange, windowUsers, lastDeltaAge,
+		anomalies, leadership, sinkQueueDepth, sinkInFlightBytes)
+}
+
+// serveMetrics serves the metrics, on the /metrics endpoint, and the health of the tracker, on the
+// /healthz and /readyz endpoints, on the specified address.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", health.ServeLiveness)
+	mux.HandleFunc("/readyz", health.ServeReadiness)
+	mux.HandleFunc("/config/reload", serveReload)
+	for _, name := range splitList(os.Getenv("TM1_SINK")) {
+		if name == "sqlite" {
+			mux.HandleFunc("/query", serveQuery)
+		}
+	}
+	go func() {
+		fatal("Unable to serve metrics", "addr", addr, "error", http.ListenAndServe(addr, mux))
+	}()
+}
+
+// recordDelta records the successful processing of a delta with the given number of writes per cube.
+func recordDelta(writes map[string]int) {
+	deltasFetched.Inc()
+
+	lastDeltaMutex.Lock()
+	now := time.Now()
+	elapsed := now.Sub(lastDelta).Seconds()
+	first := lastDelta.IsZero()
+	lastDelta = now
+	lastDeltaMutex.Unlock()
+
+	// The initial response contains everything written so far, which says nothing about the rate
+	if first {
+		return
+	}
+	cubeWriteRate.Reset()
+	for cube, count := range writes {
+		cubeWriteRate.WithLabelValues(cube).Set(float64(count) / elapsed)
+	}
+}
+
+// metricsTransport is an http.RoundTripper counting failed requests.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip executes the request using the next RoundTripper and counts any failure.
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 400 {
+		httpErrors.Inc()
+	}
+	return resp, err
+}
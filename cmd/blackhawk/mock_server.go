@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// mockTM1 serves a fake TM1 server, at the address, to which a transaction log entry gets written
+// every interval, allowing the tracker to be tried without a live TM1 server. If restartEvery is
+// set, the server simulates a restart that often, invalidating the delta links it served. If
+// withholdEvery is set, every so many entries one is left out of the log, unless asked for by ID.
+func mockTM1(addr string, restartEvery time.Duration, withholdEvery int) {
+	server := fake.NewServer()
+	server.User = tm1User
+	server.Password = os.Getenv("TM1_PASSWORD")
+	if tm1Database != "" {
+		server.Version = "12.4.0"
+		server.Database = tm1Database
+	}
+	go func() {
+		for i := 1; ; i++ {
+			entry := odata.TransactionLogEntry{
+				ChangeSetID: fmt.Sprint(i),
+				TimeStamp:   time.Now().UTC().Format(time.RFC3339),
+				User:        "Admin",
+				Cube:        "Sales",
+				Tuple:       []string{"Actual", "2024", "Jan", "Revenue"},
+				OldValue:    float64(i - 1),
+				NewValue:    float64(i),
+			}
+			if withholdEvery > 0 && i%withholdEvery == 0 {
+				server.WithholdTransactionLogEntries(entry)
+			} else {
+				server.AddTransactionLogEntries(entry)
+			}
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+	}()
+
+	if restartEvery > 0 {
+		go func() {
+			for range time.Tick(restartEvery) {
+				server.Restart()
+				fmt.Println("Mock TM1 server restarted")
+			}
+		}()
+	}
+
+	fmt.Println("Mock TM1 server accepting connections at " + addr + ", service root URL: http://localhost" + addr + "/api/v1/")
+	fatal("Mock TM1 server failed", "error", http.ListenAndServe(addr, server))
+}
+
+// mockSink serves a fake target server, at the address, for the http sink, printing every entry
+// it receives.
+func mockSink(addr string) {
+	receiver := fake.NewReceiver()
+	receiver.OnReceive = func(entries []json.RawMessage) {
+		for _, entry := range entries {
+			fmt.Println(string(entry))
+		}
+	}
+
+	fmt.Println("Mock server accepting connections at " + addr)
+	fatal("Mock server failed", "error", http.ListenAndServe(addr, receiver))
+}
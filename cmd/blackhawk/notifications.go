@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/notify"
+)
+
+// The notifier, if any, posting threshold breaches, hung threads and tracker errors to a channel.
+var healthNotifier *HealthNotifier
+
+// HealthNotifier posts notifications about the health of the tracker, and the servers it tracks, to
+// a channel. Notifications are posted in the background and identical notifications are posted at
+// most once per interval, so an ongoing outage doesn't flood the channel.
+type HealthNotifier struct {
+	notifier notify.Notifier
+	interval time.Duration
+	mutex    sync.Mutex
+	sent     map[string]time.Time
+	logger   *slog.Logger
+}
+
+// NewHealthNotifier creates and returns a new HealthNotifier posting using the notifier.
+func NewHealthNotifier(notifier notify.Notifier, interval time.Duration) *HealthNotifier {
+	h := new(HealthNotifier)
+	h.notifier = notifier
+	h.interval = interval
+	h.sent = map[string]time.Time{}
+	h.logger = newLogger("notify")
+
+	return h
+}
+
+// NewHealthNotifierFromEnv creates a HealthNotifier posting to the Slack and/or Teams incoming
+// webhooks specified by the TM1_NOTIFY_SLACK_URL and TM1_NOTIFY_TEAMS_URL environment variables,
+// or returns nil if neither is specified.
+func NewHealthNotifierFromEnv() *HealthNotifier {
+	var notifiers notify.MultiNotifier
+	if url := os.Getenv("TM1_NOTIFY_SLACK_URL"); url != "" {
+		notifiers = append(notifiers, &notify.SlackNotifier{URL: url})
+	}
+	if url := os.Getenv("TM1_NOTIFY_TEAMS_URL"); url != "" {
+		notifiers = append(notifiers, &notify.TeamsNotifier{URL: url})
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(os.Getenv("TM1_NOTIFY_INTERVAL"))
+	if err != nil {
+		interval = 10 * time.Minute
+	}
+	return NewHealthNotifier(notifiers, interval)
+}
+
+// Notify posts the notification, unless an identical one was posted within the interval. Notify
+// can be called on a nil HealthNotifier, in which case nothing gets posted.
+func (h *HealthNotifier) Notify(title string, text string, fields map[string]interface{}) {
+	if h == nil {
+		return
+	}
+
+	key := title + "\n" + text
+	now := time.Now()
+	h.mutex.Lock()
+	if sent, ok := h.sent[key]; ok && now.Sub(sent) < h.interval {
+		h.mutex.Unlock()
+		return
+	}
+	h.sent[key] = now
+	h.mutex.Unlock()
+
+	go func() {
+		if err := h.notifier.Notify(&notify.Notification{Title: title, Text: text, Fields: fields}); err != nil {
+			h.logger.Error("Unable to post notification", "title", title, "error", err)
+		}
+	}()
+}
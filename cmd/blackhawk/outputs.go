@@ -0,0 +1,694 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// newSinkFromEnv creates the sink, or sinks, the processed entries get written to as defined by
+// the TM1_SINK environment variable, which holds a comma-separated list of sink names. If more
+// than one sink is specified, entries are fanned out to all of them. If none is specified entries
+// are streamed, using a POST request, to a target server. If TM1_CHANGESET_GROUPING is set, the
+// transaction log entries are grouped by their ChangeSetID and written as a change set instead.
+// If TM1_SPREAD_DETECTION is set, write operations changing a large number of cells at once are
+// summarized as a spread. Only the entries matching the filters of the plugins, if any, get written.
+func newSinkFromEnv(servers []*Server) (sinks.Sink, error) {
+	s, err := newMultiSink(servers)
+	if err != nil {
+		return nil, err
+	}
+	if grouping, _ := strconv.ParseBool(os.Getenv("TM1_CHANGESET_GROUPING")); grouping {
+		s = newChangeSetSink(s)
+	}
+	if detection, _ := strconv.ParseBool(os.Getenv("TM1_SPREAD_DETECTION")); detection {
+		s = newSpreadSink(s, servers)
+	}
+	return wrapPluginFilters(s)
+}
+
+// newChangeSetSink wraps the sink in a ChangeSetSink as defined by the TM1_CHANGESET_* environment
+// variables.
+func newChangeSetSink(s sinks.Sink) sinks.Sink {
+	timeout, err := time.ParseDuration(os.Getenv("TM1_CHANGESET_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	maxChanges, err := strconv.Atoi(os.Getenv("TM1_CHANGESET_MAX_CHANGES"))
+	if err != nil || maxChanges < 1 {
+		maxChanges = 10000
+	}
+	return sinks.NewChangeSetSink(s, timeout, maxChanges)
+}
+
+// newSpreadSink wraps the sink in a SpreadSink as defined by the TM1_SPREAD_* environment variables.
+func newSpreadSink(s sinks.Sink, servers []*Server) sinks.Sink {
+	config := sinks.SpreadConfig{Dimensions: cubeDimensions(servers), Parents: elementParents(servers)}
+	var err error
+	config.Window, err = time.ParseDuration(os.Getenv("TM1_SPREAD_WINDOW"))
+	if err != nil || config.Window <= 0 {
+		config.Window = 5 * time.Second
+	}
+	config.MinCells, err = strconv.Atoi(os.Getenv("TM1_SPREAD_MIN_CELLS"))
+	if err != nil || config.MinCells < 2 {
+		config.MinCells = 100
+	}
+	config.Suppress, _ = strconv.ParseBool(os.Getenv("TM1_SPREAD_SUPPRESS_ENTRIES"))
+	return sinks.NewSpreadSink(s, config)
+}
+
+// newMultiSink creates the sinks specified by the TM1_SINK environment variable, fanning out the
+// entries to all of them if more than one is specified.
+func newMultiSink(servers []*Server) (sinks.Sink, error) {
+	names := splitList(os.Getenv("TM1_SINK"))
+	if len(names) == 0 {
+		names = []string{"http"}
+	}
+	if len(names) == 1 {
+		return newRouteSink(names[0], servers)
+	}
+
+	multiSink := sinks.NewMultiSink()
+	multiSink.OnError = func(name string, err error) {
+		sinkErrors.WithLabelValues(name).Inc()
+		sinksLogger.Error("Sink failed", "sink", name, "error", err)
+		healthNotifier.Notify("Sink failed", err.Error(), map[string]interface{}{"Sink": name})
+	}
+	for _, name := range names {
+		s, err := newRouteSink(name, servers)
+		if err != nil {
+			return nil, err
+		}
+		multiSink.Add(name, s)
+	}
+	return multiSink, nil
+}
+
+// newRouteSink creates the sink with the specified name and, if its route is specified, using the
+// ROUTE environment variable of the sink, as in TM1_KAFKA_ROUTE, wraps it in a sink only writing the
+// entries matching the route, an expression in the expression language of the alerting rules.
+func newRouteSink(name string, servers []*Server) (sinks.Sink, error) {
+	s, err := newBufferedSink(name, servers)
+	if err != nil {
+		return nil, err
+	}
+	prefix, ok := sinkEnvPrefixes[name]
+	route := os.Getenv(prefix + "ROUTE")
+	if !ok || route == "" {
+		return s, nil
+	}
+
+	expression, err := rules.CompileExpression(route)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route of sink %s: %s", name, err)
+	}
+	return sinks.NewRouteSink(s, expression.Match), nil
+}
+
+// newBufferedSink creates the sink with the specified name and, if TM1_BUFFER_DIR is specified,
+// wraps it in a sink queueing its entries on disk, in a directory named after the sink, so no
+// entries get lost while the sink is unavailable.
+func newBufferedSink(name string, servers []*Server) (sinks.Sink, error) {
+	s, err := newBatchSink(name, servers)
+	if err != nil {
+		return nil, err
+	}
+	bufferDir := os.Getenv("TM1_BUFFER_DIR")
+	if bufferDir == "" {
+		return s, nil
+	}
+
+	maxSize, err := strconv.ParseInt(os.Getenv("TM1_BUFFER_MAX_SIZE_MB"), 10, 64)
+	if err != nil {
+		maxSize = 1024
+	}
+	bufferedSink, err := sinks.NewBufferedSink(s, filepath.Join(bufferDir, name), maxSize*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	bufferedSink.OnError = func(err error) {
+		sinkErrors.WithLabelValues(name).Inc()
+		sinksLogger.Warn("Sink unavailable, entries remain buffered", "sink", name, "error", err)
+		healthNotifier.Notify("Sink unavailable, entries remain buffered", err.Error(), map[string]interface{}{"Sink": name})
+	}
+	return bufferedSink, nil
+}
+
+// newBatchSink creates the sink with the specified name and, if any of the TM1_BATCH_MAX_ENTRIES,
+// TM1_BATCH_MAX_BYTES or TM1_BATCH_MAX_LATENCY limits is specified, wraps it in a sink delivering
+// the entries in batches limited accordingly.
+func newBatchSink(name string, servers []*Server) (sinks.Sink, error) {
+	s, err := newPoolSink(name, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := sinks.BatchLimits{}
+	limits.MaxEntries, _ = strconv.Atoi(os.Getenv("TM1_BATCH_MAX_ENTRIES"))
+	limits.MaxBytes, _ = strconv.Atoi(os.Getenv("TM1_BATCH_MAX_BYTES"))
+	limits.MaxLatency, _ = time.ParseDuration(os.Getenv("TM1_BATCH_MAX_LATENCY"))
+	if limits.MaxEntries <= 0 && limits.MaxBytes <= 0 && limits.MaxLatency <= 0 {
+		return s, nil
+	}
+	return sinks.NewBatchSink(s, limits), nil
+}
+
+// poolableSinks are the sinks delivering entries over the network, which can be created multiple
+// times to deliver entries concurrently.
+var poolableSinks = map[string]bool{"http": true, "kafka": true, "sql": true, "elasticsearch": true, "webhook": true, "splunk": true, "eventhubs": true, "kinesis": true, "nats": true, "mqtt": true, "pubsub": true, "bigquery": true, "influxdb": true, "timescaledb": true, "syslog": true, "gelf": true}
+
+// newPoolSink creates the sink with the specified name and, if TM1_SINK_WORKERS specifies more than
+// one worker, creates it once per worker delivering entries concurrently, while preserving the
+// order of entries by the field specified by TM1_SINK_ORDER_BY, Cube by default.
+func newPoolSink(name string, servers []*Server) (sinks.Sink, error) {
+	workers, _ := strconv.Atoi(os.Getenv("TM1_SINK_WORKERS"))
+	if workers < 2 || !poolableSinks[name] {
+		return newDeadLetterSink(name, servers)
+	}
+
+	queueSize, err := strconv.Atoi(os.Getenv("TM1_SINK_QUEUE_SIZE"))
+	if err != nil || queueSize < 1 {
+		queueSize = 1000
+	}
+	orderBy := os.Getenv("TM1_SINK_ORDER_BY")
+	if orderBy == "" {
+		orderBy = "Cube"
+	}
+	s, err := sinks.NewPoolSink(func() (sinks.Sink, error) {
+		return newDeadLetterSink(name, servers)
+	}, workers, queueSize, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	sinkQueueDepth.Add(name, s.QueueDepth)
+	return s, nil
+}
+
+// The sink the entries permanently rejected by any sink get written to, if any.
+var deadLetterSink sinks.Sink
+
+// newDeadLetterSink creates the sink with the specified name and, if TM1_DEAD_LETTER_PATH or
+// TM1_DEAD_LETTER_TOPIC is specified, wraps it in a sink writing the entries it permanently rejects
+// to a dead-letter file, respectively Kafka topic, shared by all sinks, instead of failing.
+func newDeadLetterSink(name string, servers []*Server) (sinks.Sink, error) {
+	s, err := newTransformSink(name, servers)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetterSink == nil {
+		if path := os.Getenv("TM1_DEAD_LETTER_PATH"); path != "" {
+			fileSink, err := sinks.NewFileSink(path, sinks.FileRotation{})
+			if err != nil {
+				return nil, err
+			}
+			deadLetterSink = sinks.NewSyncSink(fileSink)
+		} else if topic := os.Getenv("TM1_DEAD_LETTER_TOPIC"); topic != "" {
+			deadLetterSink = sinks.NewSyncSink(sinks.NewKafkaSink(strings.Split(os.Getenv("TM1_KAFKA_BROKERS"), ","), topic, "Sink"))
+		} else {
+			return s, nil
+		}
+	}
+
+	rejecting := sinks.NewDeadLetterSink(name, s, deadLetterSink)
+	rejecting.OnDeadLetter = func(entry interface{}, err error) {
+		deadLetters.WithLabelValues(name).Inc()
+		sinksLogger.Warn("Entry rejected by sink, written to dead-letter sink", "sink", name, "error", err)
+	}
+	return rejecting, nil
+}
+
+// closeDeadLetterSink closes the dead-letter sink, if any.
+func closeDeadLetterSink() error {
+	if deadLetterSink == nil {
+		return nil
+	}
+	return deadLetterSink.Close()
+}
+
+// transformableSinks are the sinks accepting entries of any shape, as opposed to the sql, csv,
+// parquet, bigquery and time-series sinks, which write the fields of the transaction and message
+// log entries into fixed columns.
+var transformableSinks = map[string]bool{"http": true, "kafka": true, "file": true, "elasticsearch": true, "webhook": true, "splunk": true, "eventhubs": true, "kinesis": true, "nats": true, "mqtt": true, "pubsub": true, "syslog": true, "gelf": true, "console": true, "broadcast": true, "grpc": true}
+
+// newTransformSink creates the sink with the specified name and, if any of TM1_TRANSFORM_FIELDS,
+// TM1_TRANSFORM_RENAME or TM1_TRANSFORM_TAGS is specified, wraps it in a sink selecting, renaming
+// and adding fields to every entry before writing it, so the entries match the schema expected
+// downstream. The script specified by the SCRIPT_FILE environment variable of the sink, as in
+// TM1_KAFKA_SCRIPT_FILE, or TM1_SCRIPT_FILE, if any, is run against every entry before that, and the
+// transformers of the plugins, if any, before the script.
+func newTransformSink(name string, servers []*Server) (sinks.Sink, error) {
+	s, err := newSink(name, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	transform := &sinks.Transform{
+		Fields: splitList(os.Getenv("TM1_TRANSFORM_FIELDS")),
+		Rename: splitPairs(os.Getenv("TM1_TRANSFORM_RENAME")),
+		Tags:   splitPairs(os.Getenv("TM1_TRANSFORM_TAGS")),
+	}
+	if !transformableSinks[name] && !isPluginSink(name) {
+		return s, nil
+	}
+	if len(transform.Fields) > 0 || len(transform.Rename) > 0 || len(transform.Tags) > 0 {
+		s = sinks.NewTransformSink(s, transform)
+	}
+
+	// The script of the sink, as in TM1_KAFKA_SCRIPT_FILE, or, if not specified, of all sinks
+	scriptFile := os.Getenv("TM1_SCRIPT_FILE")
+	if prefix, ok := sinkEnvPrefixes[name]; ok && os.Getenv(prefix+"SCRIPT_FILE") != "" {
+		scriptFile = os.Getenv(prefix + "SCRIPT_FILE")
+	}
+	if scriptFile != "" {
+		script, err := rules.LoadScript(scriptFile)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		script.SetOnError(func(err error) {
+			sinksLogger.Error("Script action failed", "sink", name, "error", err)
+		})
+		script.SetProcessExecutor(processExecutor(servers, sinksLogger))
+		s = sinks.NewScriptSink(s, script)
+	}
+	return wrapPluginTransformers(s)
+}
+
+// newEncoder returns the encoder for the format specified using the FORMAT environment variable of
+// the sink, as in TM1_KAFKA_FORMAT, json, cbor, msgpack or avro, nil, encoding the entries as
+// compact JSON, if not specified. The JSON, or Avro, schemas are registered with the schema registry
+// at the URL, if any, using the prefix for their subjects.
+func newEncoder(name string, registryURL string, prefix string) (sinks.Encoder, error) {
+	format := os.Getenv(sinkEnvPrefixes[name] + "FORMAT")
+	switch format {
+	case "", "json":
+		if registryURL != "" {
+			return sinks.NewJSONSchemaEncoder(registryURL, prefix), nil
+		}
+		if format == "" {
+			return nil, nil
+		}
+	case "avro":
+		return sinks.NewAvroEncoder(registryURL, prefix), nil
+	}
+	encoder, err := sinks.NewEncoder(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sFORMAT: %s", sinkEnvPrefixes[name], format)
+	}
+	return encoder, nil
+}
+
+// newSink creates the sink with the specified name, configured using its environment variables,
+// or, if there is no such sink, the sink of the plugin with that name. The servers being tracked are
+// passed for sinks requiring additional information from them.
+func newSink(name string, servers []*Server) (sinks.Sink, error) {
+	switch name {
+	case "http":
+		sinkURL := os.Getenv("TM1_SINK_URL")
+		if sinkURL == "" {
+			sinkURL = "http://localhost:12345"
+		}
+		client := odata.NewClient(http.Client{}, nil)
+		client.Compression, _ = strconv.ParseBool(os.Getenv("TM1_SINK_COMPRESSION"))
+		s := sinks.NewHTTPSink(client, sinkURL)
+		s.MaxInFlightBytes, _ = strconv.Atoi(os.Getenv("TM1_SINK_MAX_INFLIGHT_BYTES"))
+		sinkInFlightBytes.Add(name, s.InFlightBytes)
+		return s, nil
+
+	case "kafka":
+		keyField := os.Getenv("TM1_KAFKA_KEY")
+		if keyField == "" {
+			keyField = "Cube"
+		}
+		topic := os.Getenv("TM1_KAFKA_TOPIC")
+		encoder, err := newEncoder(name, os.Getenv("TM1_KAFKA_SCHEMA_REGISTRY_URL"), topic)
+		if err != nil {
+			return nil, err
+		}
+		s := sinks.NewKafkaSink(strings.Split(os.Getenv("TM1_KAFKA_BROKERS"), ","), topic, keyField)
+		s.Encoder = encoder
+		return s, nil
+
+	case "file":
+		rotation := sinks.FileRotation{}
+		if maxSize, err := strconv.ParseInt(os.Getenv("TM1_FILE_MAX_SIZE_MB"), 10, 64); err == nil {
+			rotation.MaxSize = maxSize * 1024 * 1024
+		}
+		if maxAge, err := time.ParseDuration(os.Getenv("TM1_FILE_MAX_AGE")); err == nil {
+			rotation.MaxAge = maxAge
+		}
+		rotation.Compress, _ = strconv.ParseBool(os.Getenv("TM1_FILE_COMPRESS"))
+		return sinks.NewFileSink(os.Getenv("TM1_FILE_PATH"), rotation)
+
+	case "csv":
+		return sinks.NewCSVSink(os.Getenv("TM1_CSV_DIR"), cubeDimensions(servers)), nil
+
+	case "parquet":
+		config := sinks.ParquetConfig{Dir: os.Getenv("TM1_PARQUET_DIR")}
+		config.RowGroupSize, _ = strconv.Atoi(os.Getenv("TM1_PARQUET_ROW_GROUP_SIZE"))
+		config.MaxFileRows, _ = strconv.Atoi(os.Getenv("TM1_PARQUET_MAX_FILE_ROWS"))
+		config.MaxFileAge, _ = time.ParseDuration(os.Getenv("TM1_PARQUET_MAX_FILE_AGE"))
+		return sinks.NewParquetSink(config), nil
+
+	case "archive":
+		config := sinks.ArchiveConfig{
+			Format:    os.Getenv("TM1_ARCHIVE_FORMAT"),
+			Dir:       os.Getenv("TM1_ARCHIVE_DIR"),
+			KeyLayout: os.Getenv("TM1_ARCHIVE_KEY"),
+		}
+		if maxSize, err := strconv.ParseInt(os.Getenv("TM1_ARCHIVE_MAX_SIZE_MB"), 10, 64); err == nil {
+			config.MaxSegmentSize = maxSize * 1024 * 1024
+		}
+		config.MaxSegmentRows, _ = strconv.Atoi(os.Getenv("TM1_ARCHIVE_MAX_ROWS"))
+		config.MaxSegmentAge, _ = time.ParseDuration(os.Getenv("TM1_ARCHIVE_MAX_AGE"))
+		var err error
+		switch store := os.Getenv("TM1_ARCHIVE_STORE"); store {
+		case "s3":
+			config.Store, err = sinks.NewS3Store(os.Getenv("TM1_ARCHIVE_BUCKET"), os.Getenv("TM1_ARCHIVE_REGION"), os.Getenv("TM1_ARCHIVE_ENDPOINT"), os.Getenv("TM1_ARCHIVE_ENCRYPTION"), os.Getenv("TM1_ARCHIVE_KMS_KEY"))
+		case "azure":
+			config.Store, err = sinks.NewAzureBlobStore(os.Getenv("TM1_ARCHIVE_CONTAINER_URL"), os.Getenv("TM1_ARCHIVE_ENCRYPTION_SCOPE"), os.Getenv("TM1_ARCHIVE_ENCRYPTION_KEY"))
+		case "gcs":
+			config.Store, err = sinks.NewGCSStore(os.Getenv("TM1_ARCHIVE_BUCKET"), os.Getenv("TM1_ARCHIVE_ENDPOINT"), os.Getenv("TM1_ARCHIVE_KMS_KEY"))
+		default:
+			err = fmt.Errorf("unknown archive store: %s", store)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sinks.NewArchiveSink(config)
+
+	case "sql":
+		batchSize, err := strconv.Atoi(os.Getenv("TM1_SQL_BATCH_SIZE"))
+		if err != nil || batchSize < 1 {
+			batchSize = 500
+		}
+		return sinks.NewSQLSink(os.Getenv("TM1_SQL_DRIVER"), os.Getenv("TM1_SQL_DSN"), batchSize)
+
+	case "influxdb":
+		config := sinks.InfluxDBConfig{
+			URL:      os.Getenv("TM1_INFLUXDB_URL"),
+			Org:      os.Getenv("TM1_INFLUXDB_ORG"),
+			Bucket:   os.Getenv("TM1_INFLUXDB_BUCKET"),
+			Token:    os.Getenv("TM1_INFLUXDB_TOKEN"),
+			Database: os.Getenv("TM1_INFLUXDB_DATABASE"),
+			User:     os.Getenv("TM1_INFLUXDB_USER"),
+			Password: os.Getenv("TM1_INFLUXDB_PASSWORD"),
+		}
+		return sinks.NewInfluxDBSink(config, cubeDimensions(servers))
+
+	case "timescaledb":
+		batchSize, err := strconv.Atoi(os.Getenv("TM1_TIMESCALEDB_BATCH_SIZE"))
+		if err != nil || batchSize < 1 {
+			batchSize = 500
+		}
+		return sinks.NewTimescaleDBSink(os.Getenv("TM1_TIMESCALEDB_DSN"), batchSize, cubeDimensions(servers))
+
+	case "sqlite":
+		retentionDays, err := strconv.Atoi(os.Getenv("TM1_SQLITE_RETENTION_DAYS"))
+		if err != nil || retentionDays < 1 {
+			retentionDays = 7
+		}
+		batchSize, err := strconv.Atoi(os.Getenv("TM1_SQLITE_BATCH_SIZE"))
+		if err != nil || batchSize < 1 {
+			batchSize = 500
+		}
+		return sinks.NewSQLiteSink(sqlitePath(), time.Duration(retentionDays)*24*time.Hour, batchSize)
+
+	case "syslog", "gelf":
+		prefix := sinkEnvPrefixes[name]
+		var tlsConfig *tls.Config
+		network := os.Getenv(prefix + "NETWORK")
+		if network == "tls" {
+			skipVerify, _ := strconv.ParseBool(os.Getenv(prefix + "TLS_SKIP_VERIFY"))
+			var err error
+			if tlsConfig, err = odata.NewTLSConfig(os.Getenv(prefix+"TLS_CA_FILE"), os.Getenv(prefix+"TLS_CLIENT_CERT"), os.Getenv(prefix+"TLS_CLIENT_KEY"), skipVerify); err != nil {
+				return nil, err
+			}
+		}
+		if name == "gelf" {
+			return sinks.NewGELFSink(sinks.GELFConfig{Network: network, Address: os.Getenv("TM1_GELF_ADDRESS"), TLS: tlsConfig})
+		}
+		config := sinks.SyslogConfig{
+			Network:          network,
+			Address:          os.Getenv("TM1_SYSLOG_ADDRESS"),
+			TLS:              tlsConfig,
+			AppName:          os.Getenv("TM1_SYSLOG_APP_NAME"),
+			StructuredDataID: os.Getenv("TM1_SYSLOG_SD_ID"),
+		}
+		if facility := os.Getenv("TM1_SYSLOG_FACILITY"); facility != "" {
+			value, err := strconv.Atoi(facility)
+			if err != nil || value < 1 || value > 23 {
+				return nil, fmt.Errorf("invalid TM1_SYSLOG_FACILITY: %s", facility)
+			}
+			config.Facility = value
+		}
+		return sinks.NewSyslogSink(config)
+
+	case "elasticsearch":
+		indexPattern := os.Getenv("TM1_ES_INDEX")
+		if indexPattern == "" {
+			indexPattern = "tm1-{type}-{2006.01}"
+		}
+		return sinks.NewElasticsearchSink(os.Getenv("TM1_ES_URL"), indexPattern, func(req *http.Request) {
+			if apiKey := os.Getenv("TM1_ES_API_KEY"); apiKey != "" {
+				req.Header.Set("Authorization", "ApiKey "+apiKey)
+			} else if user := os.Getenv("TM1_ES_USER"); user != "" {
+				req.SetBasicAuth(user, os.Getenv("TM1_ES_PASSWORD"))
+			}
+		})
+
+	case "console":
+		config := sinks.ConsoleConfig{Format: os.Getenv("TM1_CONSOLE_FORMAT")}
+		out := os.Stdout
+		if os.Getenv("TM1_CONSOLE_OUTPUT") == "stderr" {
+			out = os.Stderr
+		}
+		if text := os.Getenv("TM1_CONSOLE_TEMPLATE"); text != "" {
+			tmpl, err := template.New("console").Funcs(sinks.TemplateFuncs).Parse(text)
+			if err != nil {
+				return nil, err
+			}
+			config.Template = tmpl
+			if config.Format == "" {
+				config.Format = "template"
+			}
+		}
+		switch os.Getenv("TM1_CONSOLE_COLOR") {
+		case "always":
+			config.Color = true
+		case "never":
+		default:
+			// Only color the output of a terminal, unless asked not to
+			info, err := out.Stat()
+			config.Color = err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+		}
+		return sinks.NewConsoleSink(out, config)
+
+	case "webhook":
+		config := sinks.WebhookConfig{
+			URL:         os.Getenv("TM1_WEBHOOK_URL"),
+			Headers:     splitPairs(os.Getenv("TM1_WEBHOOK_HEADERS")),
+			ContentType: os.Getenv("TM1_WEBHOOK_CONTENT_TYPE"),
+		}
+		config.Batch, _ = strconv.ParseBool(os.Getenv("TM1_WEBHOOK_BATCH"))
+		if templateFile := os.Getenv("TM1_WEBHOOK_TEMPLATE_FILE"); templateFile != "" {
+			tmpl, err := template.New(filepath.Base(templateFile)).Funcs(sinks.TemplateFuncs).ParseFiles(templateFile)
+			if err != nil {
+				return nil, err
+			}
+			config.Template = tmpl
+		}
+		if secret := os.Getenv("TM1_WEBHOOK_SECRET"); secret != "" {
+			config.Secret = []byte(secret)
+		}
+		return sinks.NewWebhookSink(config), nil
+
+	case "eventhubs":
+		keyField := os.Getenv("TM1_EVENTHUBS_KEY")
+		if keyField == "" {
+			keyField = "Cube"
+		}
+		encoder, err := newEncoder(name, "", "")
+		if err != nil {
+			return nil, err
+		}
+		s, err := sinks.NewEventHubsSink(os.Getenv("TM1_EVENTHUBS_CONNECTION_STRING"), os.Getenv("TM1_EVENTHUBS_NAME"), keyField)
+		if err != nil {
+			return nil, err
+		}
+		s.Encoder = encoder
+		return s, nil
+
+	case "kinesis":
+		keyField := os.Getenv("TM1_KINESIS_KEY")
+		if keyField == "" {
+			keyField = "Cube"
+		}
+		encoder, err := newEncoder(name, "", "")
+		if err != nil {
+			return nil, err
+		}
+		s, err := sinks.NewKinesisSink(os.Getenv("TM1_KINESIS_STREAM"), os.Getenv("TM1_KINESIS_REGION"), os.Getenv("TM1_KINESIS_ENDPOINT"), keyField)
+		if err != nil {
+			return nil, err
+		}
+		s.Encoder = encoder
+		return s, nil
+
+	case "nats":
+		config := sinks.NATSConfig{
+			URL:             os.Getenv("TM1_NATS_URL"),
+			Subject:         os.Getenv("TM1_NATS_SUBJECT"),
+			CredentialsFile: os.Getenv("TM1_NATS_CREDENTIALS_FILE"),
+			Stream:          os.Getenv("TM1_NATS_STREAM"),
+		}
+		config.JetStream, _ = strconv.ParseBool(os.Getenv("TM1_NATS_JETSTREAM"))
+		config.AckTimeout, _ = time.ParseDuration(os.Getenv("TM1_NATS_ACK_TIMEOUT"))
+		var err error
+		if config.Encoder, err = newEncoder(name, "", ""); err != nil {
+			return nil, err
+		}
+		return sinks.NewNATSSink(config)
+
+	case "mqtt":
+		config := sinks.MQTTConfig{
+			Broker:    os.Getenv("TM1_MQTT_BROKER"),
+			ClientID:  os.Getenv("TM1_MQTT_CLIENT_ID"),
+			User:      os.Getenv("TM1_MQTT_USER"),
+			Password:  os.Getenv("TM1_MQTT_PASSWORD"),
+			Topic:     os.Getenv("TM1_MQTT_TOPIC"),
+			CellTopic: os.Getenv("TM1_MQTT_CELL_TOPIC"),
+		}
+		if qos := os.Getenv("TM1_MQTT_QOS"); qos != "" {
+			value, err := strconv.Atoi(qos)
+			if err != nil || value < 0 || value > 2 {
+				return nil, fmt.Errorf("invalid TM1_MQTT_QOS: %s", qos)
+			}
+			config.QoS = byte(value)
+		}
+		config.RetainCells, _ = strconv.ParseBool(os.Getenv("TM1_MQTT_RETAIN_CELLS"))
+		var err error
+		if config.Encoder, err = newEncoder(name, "", ""); err != nil {
+			return nil, err
+		}
+		return sinks.NewMQTTSink(config)
+
+	case "pubsub":
+		keyField := os.Getenv("TM1_PUBSUB_KEY")
+		if keyField == "" {
+			keyField = "Cube"
+		}
+		endpoint := os.Getenv("TM1_PUBSUB_ENDPOINT")
+		if host := os.Getenv("PUBSUB_EMULATOR_HOST"); endpoint == "" && host != "" {
+			endpoint = "http://" + host
+		}
+		encoder, err := newEncoder(name, "", "")
+		if err != nil {
+			return nil, err
+		}
+		s, err := sinks.NewPubSubSink(os.Getenv("TM1_PUBSUB_PROJECT"), os.Getenv("TM1_PUBSUB_TOPIC"), keyField, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		s.Encoder = encoder
+		return s, nil
+
+	case "bigquery":
+		table := os.Getenv("TM1_BIGQUERY_TABLE")
+		if table == "" {
+			table = "transaction_log"
+		}
+		return sinks.NewBigQuerySink(os.Getenv("TM1_BIGQUERY_PROJECT"), os.Getenv("TM1_BIGQUERY_DATASET"), table, os.Getenv("TM1_BIGQUERY_ENDPOINT"))
+
+	case "splunk":
+		config := sinks.SplunkConfig{
+			URL:        os.Getenv("TM1_SPLUNK_URL"),
+			Token:      os.Getenv("TM1_SPLUNK_TOKEN"),
+			Index:      os.Getenv("TM1_SPLUNK_INDEX"),
+			Source:     os.Getenv("TM1_SPLUNK_SOURCE"),
+			SourceType: os.Getenv("TM1_SPLUNK_SOURCETYPE"),
+			Host:       os.Getenv("TM1_SPLUNK_HOST"),
+		}
+		if config.Source == "" {
+			config.Source = "tm1-blackhawk"
+		}
+		config.BatchSize, _ = strconv.Atoi(os.Getenv("TM1_SPLUNK_BATCH_SIZE"))
+		config.Ack, _ = strconv.ParseBool(os.Getenv("TM1_SPLUNK_ACK"))
+		config.AckTimeout, _ = time.ParseDuration(os.Getenv("TM1_SPLUNK_ACK_TIMEOUT"))
+		config.SkipVerify, _ = strconv.ParseBool(os.Getenv("TM1_SPLUNK_TLS_SKIP_VERIFY"))
+		return sinks.NewSplunkSink(config), nil
+
+	case "broadcast":
+		config := sinks.BroadcastConfig{Addr: os.Getenv("TM1_BROADCAST_ADDR")}
+		if config.Addr == "" {
+			config.Addr = ":8081"
+		}
+		config.Buffer, _ = strconv.Atoi(os.Getenv("TM1_BROADCAST_BUFFER"))
+		config.AllowedOrigins = splitList(os.Getenv("TM1_BROADCAST_ALLOWED_ORIGINS"))
+		config.Token = os.Getenv("TM1_BROADCAST_TOKEN")
+		config.Compile = compileFilter
+		return sinks.NewBroadcastSink(config)
+
+	case "grpc":
+		config := sinks.GRPCConfig{Addr: os.Getenv("TM1_GRPC_ADDR")}
+		if config.Addr == "" {
+			config.Addr = ":50051"
+		}
+		config.Buffer, _ = strconv.Atoi(os.Getenv("TM1_GRPC_BUFFER"))
+		config.Block, _ = strconv.ParseBool(os.Getenv("TM1_GRPC_BLOCK"))
+		config.Compile = compileFilter
+		return sinks.NewGRPCSink(config)
+
+	default:
+		s, err := newPluginSink(name)
+		if err == nil && s == nil {
+			err = fmt.Errorf("unknown sink: %s", name)
+		}
+		return s, err
+	}
+}
+
+// compileFilter compiles the filter expression subscribers of the broadcast and grpc sinks pass,
+// an expression in the expression language of the alerting rules.
+func compileFilter(filter string) (func(entry interface{}) bool, error) {
+	expression, err := rules.CompileExpression(filter)
+	if err != nil {
+		return nil, err
+	}
+	return expression.Match, nil
+}
+
+// cubeDimensions returns the function resolving the dimensions, in order, of a cube on a server.
+func cubeDimensions(servers []*Server) func(server string, cube string) ([]string, error) {
+	return func(server string, cube string) ([]string, error) {
+		for _, s := range servers {
+			if s.Name == server {
+				return s.Client.CubeDimensions(s.ServiceRootURL, cube)
+			}
+		}
+		return nil, fmt.Errorf("unknown server: %s", server)
+	}
+}
+
+// elementParents returns the function resolving the parents of the elements of a dimension on a
+// server.
+func elementParents(servers []*Server) func(server string, dimension string) (map[string][]string, error) {
+	return func(server string, dimension string) (map[string][]string, error) {
+		for _, s := range servers {
+			if s.Name == server {
+				return s.Client.ElementParents(s.ServiceRootURL, dimension)
+			}
+		}
+		return nil, fmt.Errorf("unknown server: %s", server)
+	}
+}
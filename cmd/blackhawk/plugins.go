@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/plugins"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+)
+
+// The plugins, adding custom filters, transformers and sinks, loaded, if any.
+var loadedPlugins []*plugins.Plugin
+
+// loadPlugins loads the plugins, Go plugins built as described by the plugins package, specified as
+// a comma-separated list of paths by the TM1_PLUGINS environment variable. Every plugin is passed the
+// environment variables named after it, as in TM1_PLUGIN_MYFILTER_THRESHOLD for the plugin loaded
+// from myfilter.so, as its configuration, by the remainder of their name, as in THRESHOLD.
+func loadPlugins() error {
+	for _, path := range splitList(os.Getenv("TM1_PLUGINS")) {
+		prefix := "TM1_PLUGIN_" + strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, strings.ToUpper(plugins.Name(path))) + "_"
+		config := map[string]string{}
+		for key, value := range environ() {
+			if strings.HasPrefix(key, prefix) {
+				config[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+		p, err := plugins.Load(path, config)
+		if err != nil {
+			return err
+		}
+		logger.Info("Loaded plugin", "plugin", p.Name, "path", path)
+		loadedPlugins = append(loadedPlugins, p)
+	}
+	return nil
+}
+
+// newPluginSink creates the sink of the plugin with the specified name, or returns nil if there is
+// no such plugin implementing a sink.
+func newPluginSink(name string) (sinks.Sink, error) {
+	for _, p := range loadedPlugins {
+		if p.Name != name {
+			continue
+		}
+		sink, err := p.NewSink()
+		if err != nil || sink == nil {
+			return nil, err
+		}
+		return sinks.NewPluginSink(sink), nil
+	}
+	return nil, nil
+}
+
+// isPluginSink returns true if the sink with the specified name is the sink of a plugin.
+func isPluginSink(name string) bool {
+	if _, ok := sinkEnvPrefixes[name]; ok {
+		return false
+	}
+	for _, p := range loadedPlugins {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapPluginFilters wraps the sink in sinks only writing the entries matching the filters of the
+// plugins, applied in the order the plugins are specified.
+func wrapPluginFilters(s sinks.Sink) (sinks.Sink, error) {
+	for i := len(loadedPlugins) - 1; i >= 0; i-- {
+		filter, err := loadedPlugins[i].NewFilter()
+		if err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			s = sinks.NewPluginFilterSink(s, filter)
+		}
+	}
+	return s, nil
+}
+
+// wrapPluginTransformers wraps the sink in sinks transforming the entries using the transformers of
+// the plugins, applied in the order the plugins are specified.
+func wrapPluginTransformers(s sinks.Sink) (sinks.Sink, error) {
+	for i := len(loadedPlugins) - 1; i >= 0; i-- {
+		transformer, err := loadedPlugins[i].NewTransformer()
+		if err != nil {
+			return nil, err
+		}
+		if transformer != nil {
+			s = sinks.NewPluginTransformSink(s, transformer)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Patterns identifying the message log entries written by the server when a process or chore
+// starts and finishes executing.
+var (
+	processStartPattern  = regexp.MustCompile(`(?i)^Process "(.+?)" executed by user "(.*?)"`)
+	processEndPattern    = regexp.MustCompile(`(?i)^Process "(.+?)":\s*(finished executing normally|finished executing with minor errors|finished executing with errors|execution was aborted)`)
+	processErrorFile     = regexp.MustCompile(`(?i)Error file:\s*<?([^>\s]+)>?`)
+	choreStartPattern    = regexp.MustCompile(`(?i)^Chore "(.+?)" (?:started|executed by user "(.*?)")`)
+	choreEndPattern      = regexp.MustCompile(`(?i)^Chore "(.+?)" (finished|completed|ended|terminated|aborted)`)
+	processOutcomeByText = map[string]string{
+		"finished executing normally":          "Succeeded",
+		"finished executing with minor errors": "MinorErrors",
+		"finished executing with errors":       "Failed",
+		"execution was aborted":                "Aborted",
+	}
+)
+
+// ProcessExecution is the record of the execution of a process or chore, reconstructed from the
+// message log entries written while executing it.
+type ProcessExecution struct {
+	Type      string   `json:"Type"` // Always ProcessExecution
+	Server    string   `json:"Server,omitempty"`
+	Kind      string   `json:"Kind"` // Process or Chore
+	Name      string   `json:"Name"`
+	User      string   `json:"User,omitempty"`
+	ThreadID  int      `json:"ThreadID"`
+	Start     string   `json:"Start"`
+	End       string   `json:"End"`
+	Duration  float64  `json:"Duration"` // In seconds
+	Outcome   string   `json:"Outcome"`  // Succeeded, MinorErrors, Failed or Aborted
+	ErrorFile string   `json:"ErrorFile,omitempty"`
+	Errors    []string `json:"Errors,omitempty"` // Error messages logged while executing
+}
+
+func init() {
+	sinks.RegisterBufferedType("ProcessExecution", (*ProcessExecution)(nil))
+}
+
+// ProcessMonitor correlates the message log entries written when processes and chores start and
+// finish executing, by the thread executing them, reconstructing a record of every execution.
+// As processes can execute other processes, and chores execute processes, executions on a thread
+// are kept on a stack.
+type ProcessMonitor struct {
+	server     *Server
+	executions map[int][]*ProcessExecution
+	logger     *slog.Logger
+}
+
+// NewProcessMonitor creates and returns a new ProcessMonitor of the processes and chores executed
+// on the server.
+func NewProcessMonitor(server *Server) *ProcessMonitor {
+	m := new(ProcessMonitor)
+	m.server = server
+	m.executions = map[int][]*ProcessExecution{}
+	m.logger = newLogger("processes").With("server", server.String())
+
+	return m
+}
+
+// Process processes the next message log entry and returns the execution it completed, if any.
+func (m *ProcessMonitor) Process(entry *odata.MessageLogEntry) *ProcessExecution {
+	stack := m.executions[entry.ThreadID]
+	switch {
+	case processStartPattern.MatchString(entry.Message):
+		match := processStartPattern.FindStringSubmatch(entry.Message)
+		m.start(entry, "Process", match[1], match[2])
+
+	case choreStartPattern.MatchString(entry.Message):
+		match := choreStartPattern.FindStringSubmatch(entry.Message)
+		m.start(entry, "Chore", match[1], match[2])
+
+	case processEndPattern.MatchString(entry.Message):
+		match := processEndPattern.FindStringSubmatch(entry.Message)
+		execution := m.finish(entry, "Process", match[1])
+		if execution != nil {
+			execution.Outcome = processOutcomeByText[strings.ToLower(match[2])]
+			if file := processErrorFile.FindStringSubmatch(entry.Message); file != nil {
+				execution.ErrorFile = file[1]
+			}
+			// A process failing fails whatever executed it as well
+			if stack := m.executions[entry.ThreadID]; execution.Outcome != "Succeeded" && len(stack) > 0 {
+				stack[len(stack)-1].Errors = append(stack[len(stack)-1].Errors, entry.Message)
+			}
+		}
+		return execution
+
+	case choreEndPattern.MatchString(entry.Message):
+		match := choreEndPattern.FindStringSubmatch(entry.Message)
+		execution := m.finish(entry, "Chore", match[1])
+		if execution != nil {
+			execution.Outcome = "Succeeded"
+			if strings.ToLower(match[2]) == "aborted" || strings.ToLower(match[2]) == "terminated" {
+				execution.Outcome = "Aborted"
+			} else if len(execution.Errors) > 0 {
+				execution.Outcome = "Failed"
+			}
+		}
+		return execution
+
+	case entry.Level == "Error" && len(stack) > 0:
+		// Errors are attributed to the execution currently executing on the thread
+		stack[len(stack)-1].Errors = append(stack[len(stack)-1].Errors, entry.Message)
+	}
+	return nil
+}
+
+// start records the start of the execution of the process or chore on the thread.
+func (m *ProcessMonitor) start(entry *odata.MessageLogEntry, kind string, name string, user string) {
+	m.executions[entry.ThreadID] = append(m.executions[entry.ThreadID], &ProcessExecution{
+		Type:     "ProcessExecution",
+		Server:   m.server.Name,
+		Kind:     kind,
+		Name:     name,
+		User:     user,
+		ThreadID: entry.ThreadID,
+		Start:    entry.TimeStamp,
+	})
+}
+
+// finish completes, and returns, the execution of the process or chore on the thread, if its start
+// was seen, in which case the errors of any execution it started, but never saw finish, are
+// attributed to it.
+func (m *ProcessMonitor) finish(entry *odata.MessageLogEntry, kind string, name string) *ProcessExecution {
+	stack := m.executions[entry.ThreadID]
+	for i := len(stack) - 1; i >= 0; i-- {
+		execution := stack[i]
+		if execution.Kind != kind || execution.Name != name {
+			continue
+		}
+		for _, unfinished := range stack[i+1:] {
+			execution.Errors = append(execution.Errors, unfinished.Errors...)
+		}
+		if i == 0 {
+			delete(m.executions, entry.ThreadID)
+		} else {
+			m.executions[entry.ThreadID] = stack[:i]
+		}
+
+		execution.End = entry.TimeStamp
+		start, err1 := time.Parse(time.RFC3339Nano, execution.Start)
+		end, err2 := time.Parse(time.RFC3339Nano, execution.End)
+		if err1 != nil || err2 != nil {
+			m.logger.Warn("Unable to parse time stamps of execution", "name", name, "start", execution.Start, "end", execution.End)
+		} else {
+			execution.Duration = end.Sub(start).Seconds()
+		}
+		m.logger.Debug("Execution finished", "kind", kind, "name", name, "duration", execution.Duration)
+		return execution
+	}
+	return nil
+}
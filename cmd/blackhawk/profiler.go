@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// AnomalyEvent is a write deviating sharply from the profile of the user making it, as in a user
+// writing to a cube they never touched, at an hour they never write, or far more than they
+// typically do, derived from a transaction log entry.
+type AnomalyEvent struct {
+	Type      string  `json:"Type"` // Always AnomalyEvent
+	Server    string  `json:"Server,omitempty"`
+	TimeStamp string  `json:"TimeStamp"`
+	User      string  `json:"User"`
+	Anomaly   string  `json:"Anomaly"` // NewCube, UnusualHour or Volume
+	Cube      string  `json:"Cube"`
+	Hour      int     `json:"Hour"`               // Hour of the day, in UTC, the write was made
+	Writes    int     `json:"Writes,omitempty"`   // Writes by the user within the hour, for Volume
+	Baseline  float64 `json:"Baseline,omitempty"` // Typical writes by the user per hour, for Volume
+	Message   string  `json:"Message"`
+}
+
+func init() {
+	sinks.RegisterBufferedType("AnomalyEvent", (*AnomalyEvent)(nil))
+}
+
+// UserProfile is the rolling baseline of the writes of a user on a server: the cubes written, the
+// hours of the day written at, and the typical number of writes per hour the user writes in.
+type UserProfile struct {
+	FirstWrite time.Time            `json:"FirstWrite"`
+	Cubes      map[string]time.Time `json:"Cubes"` // Last write, by cube
+	Hours      [24]time.Time        `json:"Hours"` // Last write, by hour of the day, in UTC
+	Volume     float64              `json:"Volume"`
+	Hour       time.Time            `json:"Hour"`   // Start of the hour being counted
+	Writes     int                  `json:"Writes"` // Writes within the hour being counted
+	reported   bool                 // Whether the volume of the hour being counted was reported
+}
+
+// Profiler builds a rolling profile of every user, by server, from the transaction log entries, and
+// derives an anomaly event from every entry deviating sharply from the profile of its user. Cubes
+// and hours not written within the retention are dropped from the profile, the volume is the
+// moving average of the writes per hour the user writes in. A user is only checked for anomalies
+// once their profile has been learning for the learning period. A profiler is safe for concurrent
+// use.
+type Profiler struct {
+	Learning  time.Duration // Period the profile of a user is learned before it's checked
+	Retention time.Duration // Period cubes and hours remain typical after last being written
+	Factor    float64       // Multiple of the typical writes per hour reported as anomalous
+	path      string
+	mutex     sync.Mutex
+	profiles  map[string]*UserProfile // By server and user
+}
+
+// volumeSmoothing is the weight of every completed hour in the moving average of the writes per hour.
+const volumeSmoothing = 0.1
+
+// NewProfiler creates and returns a new Profiler, persisting the profiles to the file at the path,
+// if specified, from which they are loaded if it exists.
+func NewProfiler(path string) (*Profiler, error) {
+	p := new(Profiler)
+	p.Learning = 7 * 24 * time.Hour
+	p.Retention = 30 * 24 * time.Hour
+	p.Factor = 100
+	p.path = path
+	p.profiles = map[string]*UserProfile{}
+
+	if path == "" {
+		return p, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// NewProfilerFromEnv creates a Profiler if TM1_PROFILE_USERS is set to true, or returns nil if not.
+// TM1_PROFILE_LEARNING, TM1_PROFILE_RETENTION and TM1_PROFILE_VOLUME_FACTOR override the learning
+// period, the retention and the factor, TM1_PROFILE_PATH the file the profiles are persisted to.
+func NewProfilerFromEnv() (*Profiler, error) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("TM1_PROFILE_USERS")); !enabled {
+		return nil, nil
+	}
+	p, err := NewProfiler(os.Getenv("TM1_PROFILE_PATH"))
+	if err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("TM1_PROFILE_LEARNING"); value != "" {
+		if p.Learning, err = time.ParseDuration(value); err != nil || p.Learning < 0 {
+			return nil, fmt.Errorf("invalid learning period specified in TM1_PROFILE_LEARNING: %s", value)
+		}
+	}
+	if value := os.Getenv("TM1_PROFILE_RETENTION"); value != "" {
+		if p.Retention, err = time.ParseDuration(value); err != nil || p.Retention <= 0 {
+			return nil, fmt.Errorf("invalid retention specified in TM1_PROFILE_RETENTION: %s", value)
+		}
+	}
+	if value := os.Getenv("TM1_PROFILE_VOLUME_FACTOR"); value != "" {
+		if p.Factor, err = strconv.ParseFloat(value, 64); err != nil || p.Factor <= 1 {
+			return nil, fmt.Errorf("invalid factor specified in TM1_PROFILE_VOLUME_FACTOR: %s", value)
+		}
+	}
+	return p, nil
+}
+
+// Add adds the entry to the profile of its user, returning the anomaly events derived from it, if
+// any. The time stamp of the entry, rather than the time it's processed, is used, so replayed
+// entries are profiled as they were written.
+func (p *Profiler) Add(entry *odata.TransactionLogEntry) []*AnomalyEvent {
+	if p == nil || entry.User == "" {
+		return nil
+	}
+	written, err := time.Parse(time.RFC3339Nano, entry.TimeStamp)
+	if err != nil {
+		written = time.Now()
+	}
+	written = written.UTC()
+	hour := written.Hour()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key := entry.Server + "/" + entry.User
+	profile, ok := p.profiles[key]
+	if !ok {
+		profile = &UserProfile{FirstWrite: written, Cubes: map[string]time.Time{}}
+		p.profiles[key] = profile
+	}
+
+	// The volume of an hour is only added to the average once the hour completed
+	if start := written.Truncate(time.Hour); start.After(profile.Hour) {
+		if profile.Writes > 0 {
+			if profile.Volume == 0 {
+				profile.Volume = float64(profile.Writes)
+			} else {
+				profile.Volume += volumeSmoothing * (float64(profile.Writes) - profile.Volume)
+			}
+		}
+		profile.Hour = start
+		profile.Writes = 0
+		profile.reported = false
+	}
+	profile.Writes++
+
+	var events []*AnomalyEvent
+	event := func(anomaly string, message string) *AnomalyEvent {
+		anomalies.WithLabelValues(anomaly).Inc()
+		e := &AnomalyEvent{
+			Type:      "AnomalyEvent",
+			Server:    entry.Server,
+			TimeStamp: entry.TimeStamp,
+			User:      entry.User,
+			Anomaly:   anomaly,
+			Cube:      entry.Cube,
+			Hour:      hour,
+			Message:   message,
+		}
+		events = append(events, e)
+		return e
+	}
+	if written.Sub(profile.FirstWrite) >= p.Learning {
+		if last, ok := profile.Cubes[entry.Cube]; !ok || written.Sub(last) > p.Retention {
+			event("NewCube", fmt.Sprintf("%s wrote to %s, which they didn't write to before", entry.User, entry.Cube))
+		}
+		if last := profile.Hours[hour]; last.IsZero() || written.Sub(last) > p.Retention {
+			event("UnusualHour", fmt.Sprintf("%s wrote to %s at %02d:00 UTC, an hour they don't typically write at",
+				entry.User, entry.Cube, hour))
+		}
+		if profile.Volume > 0 && float64(profile.Writes) > p.Factor*profile.Volume && !profile.reported {
+			profile.reported = true
+			e := event("Volume", fmt.Sprintf("%s wrote %d times within the hour, typically writing %.1f times per hour",
+				entry.User, profile.Writes, profile.Volume))
+			e.Writes = profile.Writes
+			e.Baseline = profile.Volume
+		}
+	}
+	if written.After(profile.Cubes[entry.Cube]) {
+		profile.Cubes[entry.Cube] = written
+	}
+	if written.After(profile.Hours[hour]) {
+		profile.Hours[hour] = written
+	}
+	return events
+}
+
+// Save persists the profiles, dropping the cubes not written within the retention, to the file they
+// were loaded from, if any.
+func (p *Profiler) Save() error {
+	if p == nil || p.path == "" {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, profile := range p.profiles {
+		for cube, last := range profile.Cubes {
+			if profile.Hour.Sub(last) > p.Retention {
+				delete(profile.Cubes, cube)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(p.profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(p.path+".tmp", p.path)
+}
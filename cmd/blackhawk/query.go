@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+)
+
+// sqlitePath returns the path of the database of the sqlite sink, as specified by TM1_SQLITE_PATH,
+// blackhawk.db by default.
+func sqlitePath() string {
+	if path := os.Getenv("TM1_SQLITE_PATH"); path != "" {
+		return path
+	}
+	return "blackhawk.db"
+}
+
+// runQuery runs the SQL query against the database of the sqlite sink, printing the result to stdout
+// as a table, json or csv, as specified by the format.
+func runQuery(sql string, format string) {
+	columns, rows, err := sinks.QuerySQLite(sqlitePath(), sql)
+	if err != nil {
+		fatal("Query failed", "path", sqlitePath(), "error", err)
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		for _, row := range rows {
+			record := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				record[column] = row[i]
+			}
+			encoder.Encode(record)
+		}
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write(columns)
+		for _, row := range rows {
+			writer.Write(queryValues(row))
+		}
+		writer.Flush()
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(columns, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(writer, strings.Join(queryValues(row), "\t"))
+		}
+		writer.Flush()
+	}
+}
+
+// queryValues returns the values of the row of the result of a query as text, leaving NULL empty.
+func queryValues(row []interface{}) []string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		if value != nil {
+			values[i] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
+
+// serveQuery serves the /query endpoint, running the SQL query, specified by the sql parameter or
+// as the body of a POST request, against the database of the sqlite sink, and responding with the
+// columns and rows of the result, or the reason the query failed.
+func serveQuery(w http.ResponseWriter, r *http.Request) {
+	sql := r.URL.Query().Get("sql")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if sql == "" {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			sql = string(body)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(sql) == "" {
+		http.Error(w, "No query specified", http.StatusBadRequest)
+		return
+	}
+
+	columns, rows, err := sinks.QuerySQLite(sqlitePath(), sql)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if rows == nil {
+		rows = [][]interface{}{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"columns": columns, "rows": rows})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Patterns identifying the message log entries written by the server when it starts and finishes
+// executing an MDX query, and the entries containing the MDX itself, when MDX logging is enabled.
+var (
+	queryStartPattern = regexp.MustCompile(`(?i)\b(MDXViewCreate|Execute ?MDX)\b.*\b(entry|start|started|begin)\b`)
+	queryEndPattern   = regexp.MustCompile(`(?i)\b(MDXViewCreate|Execute ?MDX)\b.*\b(exit|finish|finished|end)\b`)
+	queryMDXPattern   = regexp.MustCompile(`(?is)\bSELECT\b.*\bFROM\b`)
+)
+
+// query is an MDX query being executed by a thread.
+type query struct {
+	started time.Time
+	mdx     string
+}
+
+// QueryTimer correlates the message log entries written when an MDX query starts and finishes
+// executing, by the thread and session executing it, to compute how long the query took, and
+// reports any query that took longer than a configured threshold.
+type QueryTimer struct {
+	server     *Server
+	threshold  time.Duration
+	queries    map[[2]int]*query
+	queryCount int       // Number of MDX queries timed
+	lastQuery  time.Time // Time the last MDX query timed finished
+	logger     *slog.Logger
+}
+
+// NewQueryTimer creates and returns a new QueryTimer reporting queries, executed on the server,
+// slower than the threshold.
+func NewQueryTimer(server *Server, threshold time.Duration) *QueryTimer {
+	t := new(QueryTimer)
+	t.server = server
+	t.threshold = threshold
+	t.queries = map[[2]int]*query{}
+	t.logger = newLogger("queries").With("server", server.String())
+
+	return t
+}
+
+// Process processes the next message log entry.
+func (t *QueryTimer) Process(entry *odata.MessageLogEntry) {
+	key := [2]int{entry.ThreadID, entry.SessionID}
+	switch {
+	case queryStartPattern.MatchString(entry.Message):
+		started, err := time.Parse(time.RFC3339Nano, entry.TimeStamp)
+		if err != nil {
+			t.logger.Warn("Unable to parse time stamp of message log entry", "entry", entry.ID, "error", err)
+			return
+		}
+		t.queries[key] = &query{started: started}
+
+	case queryEndPattern.MatchString(entry.Message):
+		q, ok := t.queries[key]
+		if !ok {
+			return
+		}
+		delete(t.queries, key)
+		finished, err := time.Parse(time.RFC3339Nano, entry.TimeStamp)
+		if err != nil {
+			t.logger.Warn("Unable to parse time stamp of message log entry", "entry", entry.ID, "error", err)
+			return
+		}
+
+		t.queryCount++
+		t.lastQuery = finished
+		if duration := finished.Sub(q.started); duration > t.threshold {
+			mdx := q.mdx
+			if mdx == "" {
+				mdx = "(enable MDX logging to see the query)"
+			}
+			t.logger.Warn("Slow query", "thread", entry.ThreadID, "session", entry.SessionID, "duration", duration,
+				"mdx", strings.Join(strings.Fields(mdx), " "))
+			healthNotifier.Notify("Slow query on "+t.server.String(),
+				fmt.Sprintf("Query on thread %d took %s: %s", entry.ThreadID, duration, strings.Join(strings.Fields(mdx), " ")),
+				map[string]interface{}{"Server": t.server.String(), "Thread": entry.ThreadID, "Session": entry.SessionID})
+		}
+
+	case queryMDXPattern.MatchString(entry.Message):
+		if q, ok := t.queries[key]; ok {
+			q.mdx = entry.Message
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+)
+
+// The servers being tracked, of which the filter, alert rules and sink get replaced when the
+// configuration gets reloaded, if any.
+var reloadServers []*Server
+var reloadMutex sync.Mutex
+
+// reloadScripts are the modification times of the script files the current sink was set up with,
+// so the sink gets set up again once any of them changed.
+var reloadScripts string
+
+// reloadableEnvPrefixes are the prefixes of the environment variables configuring the filter, the
+// alert rules, the watch list and the sink, which changes are applied to when the configuration gets reloaded. Any
+// of the sinks' own prefixes apply as well.
+var reloadableEnvPrefixes = []string{"TM1_FILTER_", "TM1_RULES_FILE", "TM1_WATCH_FILE", "TM1_SCRIPT_FILE", "TM1_SINK", "TM1_TRANSFORM_", "TM1_CHANGESET_", "TM1_SPREAD_",
+	"TM1_BATCH_", "TM1_BUFFER_"}
+
+// currentAlerts returns the alerting engine, if any.
+func currentAlerts() *rules.Engine {
+	alertsMutex.RLock()
+	defer alertsMutex.RUnlock()
+	return alerts
+}
+
+// currentWatches returns the watch list, if any.
+func currentWatches() *rules.WatchList {
+	alertsMutex.RLock()
+	defer alertsMutex.RUnlock()
+	return watches
+}
+
+// enableReload allows the configuration of the servers being tracked to be reloaded, when asked to
+// using the /config/reload endpoint or a SIGHUP signal, or, if TM1_CONFIG_WATCH is specified, once
+// the configuration or rules file changed, checking every so often.
+func enableReload(servers []*Server) {
+	reloadMutex.Lock()
+	reloadServers = servers
+	reloadScripts = scriptModTimes()
+	reloadMutex.Unlock()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			logger.Info("Received signal, reloading configuration...")
+			reloadConfig()
+		}
+	}()
+
+	if value := os.Getenv("TM1_CONFIG_WATCH"); value != "" {
+		every, err := time.ParseDuration(value)
+		if err != nil || every <= 0 {
+			fatal("Invalid configuration watch interval", "value", value)
+		}
+		go watchConfig(every)
+	}
+}
+
+// watchConfig reloads the configuration once the configuration file, or the rules file, changed,
+// checking their modification times every so often.
+func watchConfig(every time.Duration) {
+	modified := configModTimes()
+	for range time.Tick(every) {
+		if current := configModTimes(); current != modified {
+			modified = current
+			logger.Info("Configuration changed, reloading configuration...")
+			reloadConfig()
+		}
+	}
+}
+
+// configModTimes returns the modification times of the configuration file, the rules file, the
+// watch list file and the script files.
+func configModTimes() string {
+	path := os.Getenv("TM1_CONFIG_FILE")
+	if path == "" {
+		path = "blackhawk.yaml"
+	}
+	var times []string
+	for _, path := range []string{path, os.Getenv("TM1_RULES_FILE"), os.Getenv("TM1_WATCH_FILE")} {
+		if info, err := os.Stat(path); err == nil {
+			times = append(times, info.ModTime().String())
+		} else {
+			times = append(times, "")
+		}
+	}
+	return strings.Join(append(times, scriptModTimes()), ",")
+}
+
+// scriptModTimes returns the modification times of the script files, specified by TM1_SCRIPT_FILE
+// and the SCRIPT_FILE environment variables of the sinks.
+func scriptModTimes() string {
+	var times []string
+	for key, path := range environ() {
+		if strings.HasSuffix(key, "SCRIPT_FILE") && path != "" {
+			if info, err := os.Stat(path); err == nil {
+				times = append(times, key+"="+info.ModTime().String())
+			} else {
+				times = append(times, key+"=")
+			}
+		}
+	}
+	sort.Strings(times)
+	return strings.Join(times, ",")
+}
+
+// serveReload serves the /config/reload endpoint, reloading the configuration when posted to, and
+// responding with the environment variables which changed, or the reason the reload failed.
+func serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	changed, err := reloadConfig()
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "reloaded", "changed": changed})
+}
+
+// reloadConfig reads the configuration file again and, without interrupting tracking, replaces the
+// filter and the alert rules, reading the rules file again, and, if its configuration changed, the
+// sink. The new configuration is only applied if all of them could be set up, otherwise the current
+// configuration remains in effect. Returns the environment variables which changed.
+func reloadConfig() ([]string, error) {
+	changed, err := reload()
+	if err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		logger.Error("Unable to reload configuration, keeping the current configuration", "error", err)
+		return nil, err
+	}
+	configReloads.WithLabelValues("success").Inc()
+	var ignored []string
+	for _, key := range changed {
+		if !reloadable(key) {
+			ignored = append(ignored, key)
+		}
+	}
+	logger.Info("Configuration reloaded", "changed", strings.Join(changed, ","))
+	if len(ignored) > 0 {
+		logger.Warn("Configuration changes require a restart to take effect", "changed", strings.Join(ignored, ","))
+	}
+	return changed, nil
+}
+
+// reload reloads the configuration, as described for reloadConfig.
+func reload() ([]string, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	if reloadServers == nil {
+		return nil, fmt.Errorf("nothing being tracked")
+	}
+
+	// Set the environment variables from the configuration file again, leaving the others as they are
+	before := environ()
+	previous := configEnv
+	for key := range previous {
+		os.Unsetenv(key)
+	}
+	configEnv = map[string]bool{}
+	restore := func() {
+		for key := range configEnv {
+			os.Unsetenv(key)
+		}
+		for key := range previous {
+			os.Setenv(key, before[key])
+		}
+		configEnv = previous
+	}
+	if err := loadConfigFile(); err != nil {
+		restore()
+		return nil, err
+	}
+	after := environ()
+	var changed []string
+	for key, value := range after {
+		if before[key] != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	// Set up the new filter, alert rules, watch list and, if need be, sink, before replacing any of them
+	newFilter, err := NewFilterFromEnv()
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("invalid filter: %s", err)
+	}
+	newAlerts, err := newAlertsFromEnv(reloadServers)
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("unable to load rules: %s", err)
+	}
+	newWatches, err := newWatchesFromEnv(reloadServers)
+	if err != nil {
+		if newAlerts != nil {
+			newAlerts.Close()
+		}
+		restore()
+		return nil, fmt.Errorf("unable to load watch list: %s", err)
+	}
+	closeNew := func() {
+		if newAlerts != nil {
+			newAlerts.Close()
+		}
+		if newWatches != nil {
+			newWatches.Close()
+		}
+		restore()
+	}
+	var newSink sinks.Sink
+	scripts := scriptModTimes()
+	setUp := scripts != reloadScripts
+	for _, key := range changed {
+		if reloadable(key) && !strings.HasPrefix(key, "TM1_FILTER_") && key != "TM1_RULES_FILE" && key != "TM1_WATCH_FILE" {
+			setUp = true
+			break
+		}
+	}
+	if setUp {
+		if newSink, err = newSinkFromEnv(reloadServers); err != nil {
+			closeNew()
+			return nil, fmt.Errorf("unable to set up sink: %s", err)
+		}
+		if len(reloadServers) > 1 || aggregator != nil {
+			newSink = sinks.NewSyncSink(newSink)
+		}
+	}
+
+	// Replace the sink first, which fails if whatever was written to the current sink can't be
+	// delivered, in which case nothing gets replaced
+	if newSink != nil {
+		old, err := sink.(*reloadableSink).replace(newSink)
+		if err != nil {
+			newSink.Close()
+			closeNew()
+			return nil, fmt.Errorf("unable to deliver the entries written to the current sink: %s", err)
+		}
+		if err := old.Close(); err != nil {
+			sinksLogger.Error("Unable to close replaced sink", "error", err)
+		}
+		reloadScripts = scripts
+	}
+	filter = newFilter
+	for _, server := range reloadServers {
+		server.tracker.SetFilter(newFilter)
+	}
+	alertsMutex.Lock()
+	oldAlerts, oldWatches := alerts, watches
+	alerts, watches = newAlerts, newWatches
+	alertsMutex.Unlock()
+	if oldAlerts != nil {
+		oldAlerts.Close()
+	}
+	if oldWatches != nil {
+		oldWatches.Close()
+	}
+	return changed, nil
+}
+
+// reloadable returns true if changes to the environment variable are applied when the configuration
+// gets reloaded.
+func reloadable(key string) bool {
+	for _, prefix := range reloadableEnvPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range sinkEnvPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// environ returns the environment variables, by name.
+func environ() map[string]string {
+	env := map[string]string{}
+	for _, pair := range os.Environ() {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// reloadableSink is a sink which can be replaced while entries are being written to it, as done
+// when the configuration gets reloaded.
+type reloadableSink struct {
+	mutex sync.RWMutex
+	sink  sinks.Sink
+}
+
+// newReloadableSink creates and returns a new reloadableSink writing to the sink.
+func newReloadableSink(s sinks.Sink) *reloadableSink {
+	r := new(reloadableSink)
+	r.sink = s
+
+	return r
+}
+
+func (r *reloadableSink) Write(entry interface{}) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.sink.Write(entry)
+}
+
+func (r *reloadableSink) Flush() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.sink.Flush()
+}
+
+func (r *reloadableSink) Close() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.sink.Close()
+}
+
+// replace flushes the sink, delivering whatever was written to it, and replaces it with the new
+// sink, returning the replaced sink, which is still to be closed. If the sink can't be flushed it
+// isn't replaced.
+func (r *reloadableSink) replace(s sinks.Sink) (sinks.Sink, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.sink.Flush(); err != nil {
+		return nil, err
+	}
+	old := r.sink
+	r.sink = s
+	return old, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// replay feeds the entries archived in the file, as written by the file sink, and compressed if its
+// name ends with .gz, or read from stdin if the path is -, through the same inspection, filter,
+// alert rules, transformations and sinks as the entries read while tracking, without connecting to
+// any server, at the speed, a multiple of the pace at which the entries were written, or as fast as
+// possible if not positive. This allows testing rules and sinks, and delivering history to a new
+// downstream system.
+func replay(path string, speed float64) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fatal("Unable to open archive", "path", path, "error", err)
+		}
+		defer file.Close()
+		in = file
+		if strings.HasSuffix(path, ".gz") {
+			if in, err = gzip.NewReader(file); err != nil {
+				fatal("Unable to decompress archive", "path", path, "error", err)
+			}
+		}
+	}
+
+	// The entries aren't read from a server, hence there is nothing to enrich them with
+	server := new(Server)
+	if queryThreshold > 0 {
+		server.queryTimer = NewQueryTimer(server, queryThreshold)
+	}
+	if trackProcesses, _ := strconv.ParseBool(os.Getenv("TM1_TRACK_PROCESSES")); trackProcesses {
+		server.processMonitor = NewProcessMonitor(server)
+	}
+	if auditEnabled {
+		server.auditor = NewAuditor(server)
+	}
+	server.tracker = server.newTracker("TransactionLogEntries")
+	setupOutputs([]*Server{server})
+
+	logger.Info("Replaying archive", "path", path, "speed", speed)
+	err := server.tracker.Replay(shutdownContext(), in, speed)
+	closeOutputs()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fatal("Replaying failed", "path", path, "error", err)
+	}
+}
+
+// parseSpeed parses the speed of a replay, a multiple, as in 10x or 0.5, of the pace at which the
+// entries were written, or max, returned as 0, to replay them as fast as possible.
+func parseSpeed(value string) (float64, error) {
+	if value == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed: %s", value)
+	}
+	return speed, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/tracker"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Server is a TM1 server being tracked, together with the client holding the session with it.
+type Server struct {
+	Name           string
+	ServiceRootURL string
+	Authentication string
+	User           string
+	Password       string
+	CAMNamespace   string
+
+	// The database, if the server is a Planning Analytics Engine, version 12 or later, hosting
+	// multiple databases, in which case the service root URL is the one of the engine.
+	Database string
+
+	// The time zone of the server, if its time stamps are to be normalized to UTC, as in
+	// Europe/Amsterdam, or Local for the time zone of the tracker.
+	TimeZone string
+
+	// The tracker of the collection being tracked, or read, from the server.
+	tracker *tracker.Tracker
+
+	// The http client, extended with some odata functions, holding the session with the server.
+	Client *odata.Client
+
+	// The version of the server, known once connected.
+	Version odata.Version
+
+	// The query timer, if any, reporting slow MDX queries while tracking the message log.
+	queryTimer *QueryTimer
+
+	// The process monitor, if any, reconstructing the executions of processes and chores while
+	// tracking the message log.
+	processMonitor *ProcessMonitor
+
+	// The auditor, if any, deriving audit events from the entries of the logs.
+	auditor *Auditor
+
+	// The enricher, if any, adding the elements by dimension, and their attributes, to transaction
+	// log entries.
+	enricher *Enricher
+}
+
+// serversFromEnv returns the servers defined by the environment variables. TM1_SERVERS holds the
+// comma-separated list of names of the servers to track, each configured using environment
+// variables prefixed by TM1_<NAME>_, as in TM1_PROD_SERVICE_ROOT_URL, falling back to the ones
+// without the name if not specified. If TM1_SERVERS is not set, one server, without a name, is
+// configured using the environment variables without a name.
+func serversFromEnv() []*Server {
+	names := splitList(os.Getenv("TM1_SERVERS"))
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	servers := make([]*Server, len(names))
+	for i, name := range names {
+		servers[i] = &Server{
+			Name:           name,
+			ServiceRootURL: serverEnv(name, "SERVICE_ROOT_URL", tm1ServiceRootURL),
+			Authentication: serverEnv(name, "AUTHENTICATION", os.Getenv("TM1_AUTHENTICATION")),
+			User:           serverEnv(name, "USER", tm1User),
+			Password:       serverEnv(name, "PASSWORD", os.Getenv("TM1_PASSWORD")),
+			CAMNamespace:   serverEnv(name, "CAM_NAMESPACE", os.Getenv("TM1_CAM_NAMESPACE")),
+			Database:       serverEnv(name, "DATABASE", tm1Database),
+			TimeZone:       serverEnv(name, "TIMEZONE", os.Getenv("TM1_TIMEZONE")),
+		}
+	}
+	return servers
+}
+
+// serverEnv returns the value of the TM1_<NAME>_<KEY> environment variable for the named server,
+// or the fallback value if not set.
+func serverEnv(name string, key string, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	if value, ok := os.LookupEnv(serverEnvPrefix(name) + key); ok {
+		return value
+	}
+	return fallback
+}
+
+// serverEnvPrefix returns the prefix, TM1_<NAME>_, of the environment variables of the named server.
+func serverEnvPrefix(name string) string {
+	return "TM1_" + strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name)) + "_"
+}
+
+// String returns the name of the server, or its service root URL if it doesn't have a name.
+func (s *Server) String() string {
+	if s.Name == "" {
+		return s.ServiceRootURL
+	}
+	return s.Name
+}
+
+// newAuthenticator returns the authenticator matching the authentication mode of the server, which
+// is either "TM1", for standard TM1 authentication, "CAM", to use the credentials of a user in a CAM
+// namespace, "CAMPassport", to use a CAM passport acquired beforehand, "Negotiate", to use
+// Kerberos for servers configured for integrated security, or, for Planning Analytics as a
+// Service, "IBMCloud", to use an IBM Cloud IAM access token, or "APIKey", to use the PA Engine API
+// key scheme, or, for a Planning Analytics Engine deployed on Cloud Pak for Data, "CPD", to use a
+// bearer token issued by the platform. If no mode is specified it defaults to standard TM1
+// authentication.
+// Note: One could get fancy and issue a request against the server and respond to a 401 by checking
+// the WWW-Authenticate header to find out what security is supported by the server if one wanted.
+func (s *Server) newAuthenticator() (odata.Authenticator, error) {
+	switch s.Authentication {
+	case "CAM":
+		return &odata.CAMAuthenticator{User: s.User, Password: s.Password, Namespace: s.CAMNamespace}, nil
+
+	case "CAMPassport":
+		return &odata.CAMPassportAuthenticator{Passport: serverEnv(s.Name, "CAM_PASSPORT", os.Getenv("TM1_CAM_PASSPORT"))}, nil
+
+	case "Negotiate", "IntegratedSecurity":
+		configFile := serverEnv(s.Name, "KRB5_CONFIG", os.Getenv("TM1_KRB5_CONFIG"))
+		if configFile == "" {
+			configFile = "/etc/krb5.conf"
+		}
+		ccacheFile := os.Getenv("KRB5CCNAME")
+		if ccacheFile == "" {
+			ccacheFile = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+		}
+		ccacheFile = strings.TrimPrefix(ccacheFile, "FILE:")
+		spn := serverEnv(s.Name, "KRB5_SPN", os.Getenv("TM1_KRB5_SPN"))
+		if spn == "" {
+			if u, err := url.Parse(s.ServiceRootURL); err == nil {
+				spn = "HTTP/" + u.Hostname()
+			}
+		}
+		return odata.NewNegotiateAuthenticator(configFile, s.User, serverEnv(s.Name, "KRB5_REALM", os.Getenv("TM1_KRB5_REALM")),
+			serverEnv(s.Name, "KRB5_KEYTAB", os.Getenv("TM1_KRB5_KEYTAB")), ccacheFile, spn)
+
+	case "IBMCloud":
+		return odata.NewIAMAuthenticator(serverEnv(s.Name, "API_KEY", os.Getenv("TM1_API_KEY")), os.Getenv("TM1_IAM_TOKEN_URL")), nil
+
+	case "APIKey":
+		// The PA Engine API key scheme maps to basic HTTP authentication using the apikey user
+		return &odata.BasicAuthenticator{User: "apikey", Password: serverEnv(s.Name, "API_KEY", os.Getenv("TM1_API_KEY"))}, nil
+
+	case "CPD":
+		cpdURL := serverEnv(s.Name, "CPD_URL", os.Getenv("TM1_CPD_URL"))
+		if cpdURL == "" {
+			u, err := url.Parse(s.ServiceRootURL)
+			if err != nil {
+				return nil, err
+			}
+			cpdURL = u.Scheme + "://" + u.Host
+		}
+		return odata.NewCPDAuthenticator(cpdURL, s.User, s.Password, serverEnv(s.Name, "API_KEY", os.Getenv("TM1_API_KEY"))), nil
+
+	case "TM1", "Basic", "":
+		return &odata.BasicAuthenticator{User: s.User, Password: s.Password}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported authentication mode: %s", s.Authentication)
+	}
+}
+
+// connect creates the client, using the processor to process responses of tracked collections,
+// and validates that the TM1 server is accessible, authenticating while doing so. If a database is
+// specified, the service root URL becomes the one of that database.
+func (s *Server) connect(processor odata.ResponseProcessorFunc) {
+	s.newClient(processor)
+	if err := s.open(); err != nil {
+		fatal("Unable to connect to server", "server", s.String(), "error", err)
+	}
+}
+
+// open validates that the TM1 server is accessible, using the client, authenticating while doing
+// so, and supports tracking changes. If a database is specified, the service root URL becomes the
+// one of that database.
+func (s *Server) open() error {
+	client := s.Client
+
+	// A Planning Analytics Engine hosts multiple databases, make sure the one specified exists
+	if s.Database != "" {
+		databases, err := client.Databases(s.ServiceRootURL)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve the databases of the server: %s", err)
+		}
+		found := false
+		for _, database := range databases {
+			found = found || database == s.Database
+		}
+		if !found {
+			return fmt.Errorf("database %s not found on server, which hosts %s", s.Database, strings.Join(databases, ", "))
+		}
+		s.ServiceRootURL = odata.DatabaseURL(s.ServiceRootURL, s.Database)
+	}
+
+	// Validate that the TM1 server is accessable by requesting the version of the server
+	version, err := client.Login(s.ServiceRootURL)
+	if err != nil {
+		return err
+	}
+	s.Version, err = odata.ParseVersion(version)
+	if err != nil {
+		return fmt.Errorf("unable to determine the version of the server: %s", err)
+	}
+
+	// We need at least version 10.2.20500 (read: 10.2.2 FP5) to implement a tracker as it takes
+	// advantage of Deltas, using the track-changes preference, implemented in that version for
+	// both message log and transaction logs.
+	if !s.Version.SupportsDeltas() {
+		return fmt.Errorf("minimal required version to use a tracker is 10.2.2 FP5, the server's version is %s", s.Version.String())
+	}
+	return nil
+}
+
+// newTransportConfigFromEnv returns the timeouts, keep-alive, connection pool and proxy settings of
+// the transport, using the defaults for any setting not specified.
+func newTransportConfigFromEnv() *odata.TransportConfig {
+	config := odata.DefaultTransportConfig()
+	durations := map[string]*time.Duration{
+		"TM1_HTTP_DIAL_TIMEOUT":            &config.DialTimeout,
+		"TM1_HTTP_TLS_HANDSHAKE_TIMEOUT":   &config.TLSHandshakeTimeout,
+		"TM1_HTTP_RESPONSE_HEADER_TIMEOUT": &config.ResponseHeaderTimeout,
+		"TM1_HTTP_KEEP_ALIVE":              &config.KeepAlive,
+		"TM1_HTTP_IDLE_CONN_TIMEOUT":       &config.IdleConnTimeout,
+	}
+	for name, duration := range durations {
+		if value, err := time.ParseDuration(os.Getenv(name)); err == nil {
+			*duration = value
+		}
+	}
+	if maxIdleConns, err := strconv.Atoi(os.Getenv("TM1_HTTP_MAX_IDLE_CONNS")); err == nil {
+		config.MaxIdleConns = maxIdleConns
+	}
+	if maxIdleConnsPerHost, err := strconv.Atoi(os.Getenv("TM1_HTTP_MAX_IDLE_CONNS_PER_HOST")); err == nil {
+		config.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+	config.DisableKeepAlives, _ = strconv.ParseBool(os.Getenv("TM1_HTTP_DISABLE_KEEP_ALIVES"))
+	config.Proxy = odata.ProxyConfig{
+		URL:      os.Getenv("TM1_PROXY_URL"),
+		User:     os.Getenv("TM1_PROXY_USER"),
+		Password: os.Getenv("TM1_PROXY_PASSWORD"),
+		NTLM:     strings.EqualFold(os.Getenv("TM1_PROXY_AUTH"), "ntlm"),
+	}
+	return config
+}
+
+// newClient creates the client, using the processor to process responses of tracked collections,
+// without connecting to the server yet.
+func (s *Server) newClient(processor odata.ResponseProcessorFunc) {
+	if err := s.createClient(processor); err != nil {
+		fatal("Invalid client configuration", "server", s.String(), "error", err)
+	}
+}
+
+// createClient creates the client, as newClient does, returning an error if the configuration of the
+// client is invalid.
+func (s *Server) createClient(processor odata.ResponseProcessorFunc) error {
+	// Create the http client we'll be using for this server, with a cookie jar enabled to keep reusing our session
+	// Note: The TM1 server's certificate is verified unless explicitly asked not to
+	skipVerify, _ := strconv.ParseBool(os.Getenv("TM1_TLS_SKIP_VERIFY"))
+	tlsConfig, err := odata.NewTLSConfig(os.Getenv("TM1_TLS_CA_FILE"), os.Getenv("TM1_TLS_CLIENT_CERT"), os.Getenv("TM1_TLS_CLIENT_KEY"), skipVerify)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration: %s", err)
+	}
+	tr, err := odata.NewTransport(newTransportConfigFromEnv(), tlsConfig)
+	if err != nil {
+		return fmt.Errorf("invalid proxy configuration: %s", err)
+	}
+	var transport http.RoundTripper = &metricsTransport{next: tr}
+	if traceHTTP {
+		transport = odata.NewTraceTransport(transport)
+	}
+	requestTimeout, _ := time.ParseDuration(os.Getenv("TM1_HTTP_REQUEST_TIMEOUT"))
+	client := odata.NewClient(http.Client{Transport: transport, Timeout: requestTimeout}, processor)
+	cookieJar, _ := cookiejar.New(nil)
+	client.Jar = cookieJar
+	s.Client = client
+
+	// Retry requests failing due to transient failures, like the server being restarted, using the
+	// default retry policy unless specified otherwise
+	client.RetryPolicy = odata.DefaultRetryPolicy()
+	if maxAttempts, err := strconv.Atoi(os.Getenv("TM1_RETRY_MAX_ATTEMPTS")); err == nil {
+		client.RetryPolicy.MaxAttempts = maxAttempts
+	}
+	if baseDelay, err := time.ParseDuration(os.Getenv("TM1_RETRY_BASE_DELAY")); err == nil {
+		client.RetryPolicy.BaseDelay = baseDelay
+	}
+	if maxDelay, err := time.ParseDuration(os.Getenv("TM1_RETRY_MAX_DELAY")); err == nil {
+		client.RetryPolicy.MaxDelay = maxDelay
+	}
+	if statusCodes := os.Getenv("TM1_RETRY_STATUS_CODES"); statusCodes != "" {
+		client.RetryPolicy.RetryableStatusCodes = nil
+		for _, code := range strings.Split(statusCodes, ",") {
+			statusCode, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return fmt.Errorf("invalid status code specified in TM1_RETRY_STATUS_CODES: %s", code)
+			}
+			client.RetryPolicy.RetryableStatusCodes = append(client.RetryPolicy.RetryableStatusCodes, statusCode)
+		}
+	}
+	client.RetryPolicy.RetryableErrorCodes = splitList(os.Getenv("TM1_RETRY_ERROR_CODES"))
+
+	// Bound the size of the responses, if asked to, and pass any additional preferences along
+	if maxPageSize, err := strconv.Atoi(os.Getenv("TM1_MAX_PAGE_SIZE")); err == nil {
+		client.MaxPageSize = maxPageSize
+	}
+	client.Preferences = splitList(os.Getenv("TM1_PREFER"))
+	client.Compression, _ = strconv.ParseBool(os.Getenv("TM1_COMPRESSION"))
+
+	// Limit the rate of the requests sent to the server, if asked to, so a misconfigured tracker
+	// can't degrade the server
+	if limit, err := strconv.ParseFloat(serverEnv(s.Name, "RATE_LIMIT", os.Getenv("TM1_RATE_LIMIT")), 64); err == nil && limit > 0 {
+		burst, _ := strconv.Atoi(serverEnv(s.Name, "RATE_BURST", os.Getenv("TM1_RATE_BURST")))
+		client.Limiter = odata.NewLimiter(limit, burst)
+	}
+
+	// Identify the tracker, and name its session as shown by TM1 monitoring tools, passing any
+	// additional headers along
+	client.UserAgent = os.Getenv("TM1_USER_AGENT")
+	if client.UserAgent == "" {
+		client.UserAgent = "blackhawk/" + trackerVersion()
+	}
+	client.SessionContext = serverEnv(s.Name, "SESSION_CONTEXT", os.Getenv("TM1_SESSION_CONTEXT"))
+	if client.SessionContext == "" {
+		client.SessionContext = "tm1-blackhawk"
+	}
+	client.Headers = splitPairs(serverEnv(s.Name, "HTTP_HEADERS", os.Getenv("TM1_HTTP_HEADERS")))
+
+	// Bundle lookups, like the attributes of the elements of an entry, in $batch requests if asked to
+	switch client.BatchFormat = serverEnv(s.Name, "ODATA_BATCH", os.Getenv("TM1_ODATA_BATCH")); client.BatchFormat {
+	case "", "json", "multipart":
+	default:
+		return fmt.Errorf("invalid batch format specified in TM1_ODATA_BATCH: %s", client.BatchFormat)
+	}
+
+	// Since the initial request has to provide credentials to be able to authenticate, the client
+	// authenticates using the authenticator matching the authentication mode of the server.
+	client.Authenticator, err = s.newAuthenticator()
+	if err != nil {
+		return fmt.Errorf("invalid authentication configuration: %s", err)
+	}
+	return nil
+}
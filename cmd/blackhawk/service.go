@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+// daemon runs a command of the tracker as a service, managed by the Windows service manager or
+// systemd, stopping it gracefully, like when interrupted, when the service gets stopped.
+type daemon struct {
+	args []string
+	done chan struct{}
+}
+
+// Start runs the command in the background, as expected by the service manager.
+func (d *daemon) Start(s service.Service) error {
+	d.done = make(chan struct{})
+	go func() {
+		defer close(d.done)
+		runCommand(d.args)
+	}()
+	return nil
+}
+
+// Stop stops the command, which delivers whatever is still pending and, as the checkpoint holds the
+// position of every entry delivered, allows tracking to resume where it left off.
+func (d *daemon) Stop(s service.Service) error {
+	requestShutdown()
+	select {
+	case <-d.done:
+	case <-time.After(time.Minute):
+		logger.Warn("Service didn't stop in time")
+	}
+	return nil
+}
+
+// serviceLogWriter writes the log output, one record at a time, to the system logger, as in the
+// Windows event log or the journal.
+type serviceLogWriter struct {
+	logger service.Logger
+}
+
+func (w serviceLogWriter) Write(p []byte) (int, error) {
+	line := string(bytes.TrimSpace(p))
+	switch {
+	case bytes.Contains(p, []byte("level=ERROR")) || bytes.Contains(p, []byte(`"level":"ERROR"`)):
+		w.logger.Error(line)
+	case bytes.Contains(p, []byte("level=WARN")) || bytes.Contains(p, []byte(`"level":"WARN"`)):
+		w.logger.Warning(line)
+	default:
+		w.logger.Info(line)
+	}
+	return len(p), nil
+}
+
+// newService returns the blackhawk service running the command.
+func newService(args []string) (service.Service, *daemon, error) {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	name := os.Getenv("TM1_SERVICE_NAME")
+	if name == "" {
+		name = "blackhawk"
+	}
+	d := &daemon{args: args}
+	s, err := service.New(d, &service.Config{
+		Name:        name,
+		DisplayName: "TM1 Blackhawk",
+		Description: "Tracks the transaction and message logs of TM1 servers.",
+		Arguments:   append([]string{"service", "run"}, args...),
+		// The .env and configuration files are read from the directory the service got installed from
+		WorkingDirectory: workingDirectory,
+	})
+	return s, d, err
+}
+
+// runService installs, uninstalls, starts, stops or restarts the service running the command, or,
+// if asked to run, runs the command as the service.
+func runService(action string, args []string) {
+	s, _, err := newService(args)
+	if err != nil {
+		fatal("Unable to create service", "error", err)
+	}
+
+	switch action {
+	case "run":
+		// Log to the system logger, unless running from a console
+		if !service.Interactive() {
+			systemLogger, err := s.SystemLogger(nil)
+			if err != nil {
+				fatal("Unable to open system logger", "error", err)
+			}
+			logOutput = serviceLogWriter{logger: systemLogger}
+			if err := setupLogging(); err != nil {
+				fatal("Error setting up logging", "error", err)
+			}
+		}
+		if err := s.Run(); err != nil {
+			fatal("Service failed", "error", err)
+		}
+
+	case "status":
+		status, err := s.Status()
+		if err != nil {
+			fatal("Unable to determine the status of the service", "error", err)
+		}
+		switch status {
+		case service.StatusRunning:
+			fmt.Println("running")
+		case service.StatusStopped:
+			fmt.Println("stopped")
+		default:
+			fmt.Println("unknown")
+		}
+
+	default:
+		if err := service.Control(s, action); err != nil {
+			fatal("Unable to "+action+" service", "error", err)
+		}
+	}
+}
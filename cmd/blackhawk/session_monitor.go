@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// SessionMonitor polls the Sessions collection of the server, including the threads of every
+// session, and reports sessions being opened and closed, and sessions that have been idle, i.e.
+// without any running or waiting thread, for longer than a configured threshold. Optionally it
+// reports a summary of all sessions every summary interval.
+type SessionMonitor struct {
+	server          *Server
+	idleThreshold   time.Duration
+	summaryInterval time.Duration
+	sessions        map[int]*sessionState
+	lastSummary     time.Time
+	logger          *slog.Logger
+}
+
+// sessionState is what the SessionMonitor remembers about a session.
+type sessionState struct {
+	user       string
+	context    string
+	opened     time.Time // Time the session was first seen
+	lastActive time.Time // Time the session was last seen with a running or waiting thread
+	warned     bool
+}
+
+// NewSessionMonitor creates and returns a new SessionMonitor for the server. A summaryInterval of 0
+// disables the summary.
+func NewSessionMonitor(server *Server, idleThreshold time.Duration, summaryInterval time.Duration) *SessionMonitor {
+	m := new(SessionMonitor)
+	m.server = server
+	m.idleThreshold = idleThreshold
+	m.summaryInterval = summaryInterval
+	m.logger = newLogger("sessions").With("server", server.String())
+
+	return m
+}
+
+// Run polls the sessions every interval until the context is done.
+func (m *SessionMonitor) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		sessions, err := m.fetchSessions(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		m.check(sessions, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchSessions retrieves the sessions currently open on the server, including their user and threads.
+func (m *SessionMonitor) fetchSessions(ctx context.Context) ([]odata.Session, error) {
+	// Note: Servers no longer exposing their threads can't tell whether a session is busy
+	expand := "User($select=Name)"
+	if m.server.Version.SupportsThreads() {
+		expand += ",Threads"
+	}
+	resp, err := m.server.Client.ExecuteGETRequestEx(ctx, m.server.ServiceRootURL+"Sessions?$expand="+expand, func(*http.Request) {})
+	if err != nil {
+		return nil, err
+	}
+	err = odata.ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving its sessions."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := odata.SessionCollection{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res.Sessions, nil
+}
+
+// check updates the state of the sessions given the sessions currently open, reporting sessions
+// that have been opened, closed or have been idle for longer than the threshold. Sessions already
+// open when the monitor starts aren't reported as opened.
+func (m *SessionMonitor) check(sessions []odata.Session, now time.Time) {
+	first := m.sessions == nil
+	if first {
+		m.sessions = map[int]*sessionState{}
+		m.lastSummary = now
+	}
+
+	open := map[int]bool{}
+	for _, session := range sessions {
+		open[session.ID] = true
+
+		state, ok := m.sessions[session.ID]
+		if !ok {
+			state = &sessionState{context: session.Context, opened: now, lastActive: now}
+			if session.User != nil {
+				state.user = session.User.Name
+			}
+			m.sessions[session.ID] = state
+			if !first {
+				m.logger.Info("Session opened", "session", session.ID, "user", state.user, "context", state.context)
+			}
+		}
+
+		if sessionBusy(session) {
+			state.lastActive = now
+			state.warned = false
+		} else if idle := now.Sub(state.lastActive); m.idleThreshold > 0 && idle > m.idleThreshold && !state.warned {
+			m.logger.Warn("Session has been idle for longer than the threshold", "session", session.ID, "user", state.user,
+				"context", state.context, "idle", idle.Round(time.Second))
+			healthNotifier.Notify("Idle session on "+m.server.String(),
+				fmt.Sprintf("Session %d has been idle for %s", session.ID, idle.Round(time.Second)),
+				map[string]interface{}{"Server": m.server.String(), "User": state.user, "Context": state.context})
+			state.warned = true
+		}
+	}
+
+	// Report the sessions that have been closed since
+	for id, state := range m.sessions {
+		if !open[id] {
+			m.logger.Info("Session closed", "session", id, "user", state.user, "context", state.context,
+				"duration", now.Sub(state.opened).Round(time.Second))
+			delete(m.sessions, id)
+		}
+	}
+
+	if m.summaryInterval > 0 && now.Sub(m.lastSummary) >= m.summaryInterval {
+		m.summarize(now)
+		m.lastSummary = now
+	}
+}
+
+// summarize reports the number of sessions, how many of them are idle, and the users they belong to.
+func (m *SessionMonitor) summarize(now time.Time) {
+	idle := 0
+	users := map[string]bool{}
+	for _, state := range m.sessions {
+		if m.idleThreshold > 0 && now.Sub(state.lastActive) > m.idleThreshold {
+			idle++
+		}
+		users[state.user] = true
+	}
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m.logger.Info("Session summary", "sessions", len(m.sessions), "idle", idle, "users", names)
+}
+
+// sessionBusy returns true if any of the threads of the session is running or waiting.
+func sessionBusy(session odata.Session) bool {
+	for _, thread := range session.Threads {
+		if thread.State == "Run" || thread.State == "Wait" {
+			return true
+		}
+	}
+	return false
+}
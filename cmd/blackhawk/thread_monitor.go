@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// ThreadMonitor polls the Threads collection of the server and flags threads that have been busy,
+// either running or waiting, for longer than a configured threshold: the typical sign of a thread
+// that is stuck. If enforcement is enabled, runaway threads are cancelled as well.
+type ThreadMonitor struct {
+	server      *Server
+	threshold   time.Duration
+	enforcement *ThreadEnforcement
+	threadMap   map[int]*threadOperation // Operation each busy thread is executing, by thread ID
+	logger      *slog.Logger
+}
+
+// threadOperation is the operation a busy thread is executing. A thread executing another function,
+// or the same on another object, or reporting less time elapsed than before, has started another
+// operation, which is monitored anew.
+type threadOperation struct {
+	function   string
+	objectName string
+	since      time.Time     // Time first seen, in case the server doesn't report the elapsed time
+	elapsed    time.Duration // Elapsed time last reported by the server, if any
+	warned     bool
+	cancelled  bool
+}
+
+// ThreadEnforcement defines which threads get cancelled: threads that have been busy for longer
+// than the limit executing one of the functions, as in ExecuteMDX, matching the function of the
+// thread as a whole, ignoring case. In dry-run mode threads that would be cancelled are only
+// reported.
+type ThreadEnforcement struct {
+	Limit     time.Duration
+	Functions []string
+	DryRun    bool
+}
+
+// NewThreadMonitor creates and returns a new ThreadMonitor for the server, which, if enforcement
+// is passed, cancels runaway threads.
+func NewThreadMonitor(server *Server, threshold time.Duration, enforcement *ThreadEnforcement) *ThreadMonitor {
+	m := new(ThreadMonitor)
+	m.server = server
+	m.threshold = threshold
+	m.enforcement = enforcement
+	m.threadMap = map[int]*threadOperation{}
+	m.logger = newLogger("threads").With("server", server.String())
+
+	return m
+}
+
+// Run polls the threads every interval until the context is done.
+func (m *ThreadMonitor) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		threads, err := m.fetchThreads(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, thread := range m.check(threads, time.Now()) {
+			m.cancel(thread)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchThreads retrieves the threads currently active on the server.
+func (m *ThreadMonitor) fetchThreads(ctx context.Context) ([]odata.Thread, error) {
+	resp, err := m.server.Client.ExecuteGETRequestEx(ctx, m.server.ServiceRootURL+"Threads", func(*http.Request) {})
+	if err != nil {
+		return nil, err
+	}
+	err = odata.ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving its threads."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := odata.ThreadCollection{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res.Threads, nil
+}
+
+// check updates the threadMap given the current state of the threads and warns about any thread
+// that has been busy executing its operation for longer than the threshold. It returns the threads
+// to be cancelled, if any.
+func (m *ThreadMonitor) check(threads []odata.Thread, now time.Time) []odata.Thread {
+	var runaway []odata.Thread
+	busy := map[int]bool{}
+	for _, thread := range threads {
+		if thread.State != "Run" && thread.State != "Wait" {
+			continue
+		}
+		busy[thread.ID] = true
+
+		// The time the server reports the thread has been executing its operation covers, unlike the
+		// time it was first seen busy, threads which were busy already before the monitor started
+		reported, err := odata.ParseDuration(thread.ElapsedTime)
+		op, ok := m.threadMap[thread.ID]
+		if !ok || op.function != thread.Function || op.objectName != thread.ObjectName || (err == nil && reported < op.elapsed) {
+			op = &threadOperation{function: thread.Function, objectName: thread.ObjectName, since: now}
+			m.threadMap[thread.ID] = op
+		}
+		elapsed := now.Sub(op.since)
+		if err == nil {
+			elapsed = reported
+			op.elapsed = reported
+		}
+
+		if elapsed > m.threshold && !op.warned {
+			m.logger.Warn("Thread has been busy for longer than the threshold", "thread", thread.ID, "name", thread.Name,
+				"state", thread.State, "elapsed", elapsed.Round(time.Second), "function", thread.Function,
+				"object_type", thread.ObjectType, "object_name", thread.ObjectName)
+			healthNotifier.Notify("Hung thread on "+m.server.String(),
+				fmt.Sprintf("Thread %d has been in %s state for %s", thread.ID, thread.State, elapsed.Round(time.Second)),
+				map[string]interface{}{"Server": m.server.String(), "User": thread.Name, "Function": thread.Function, "ObjectType": thread.ObjectType, "Object": thread.ObjectName})
+			op.warned = true
+		}
+		if m.enforcement != nil && elapsed > m.enforcement.Limit && !op.cancelled && m.enforcement.matches(thread) {
+			runaway = append(runaway, thread)
+			op.cancelled = true
+		}
+	}
+
+	// Forget about threads that are no longer busy or have disappeared altogether
+	for id := range m.threadMap {
+		if !busy[id] {
+			delete(m.threadMap, id)
+		}
+	}
+	return runaway
+}
+
+// cancel cancels the operation the thread is executing, using the tm1.CancelOperation action, or,
+// in dry-run mode, only reports it would have.
+func (m *ThreadMonitor) cancel(thread odata.Thread) {
+	args := []interface{}{"thread", thread.ID, "name", thread.Name, "function", thread.Function,
+		"object_type", thread.ObjectType, "object_name", thread.ObjectName, "limit", m.enforcement.Limit}
+	if m.enforcement.DryRun {
+		m.logger.Warn("Dry-run: would cancel runaway thread", args...)
+		return
+	}
+
+	resp, err := m.server.Client.ExecutePOSTRequest(fmt.Sprintf("%sThreads('%d')/tm1.CancelOperation", m.server.ServiceRootURL, thread.ID), "application/json", nil)
+	if err == nil {
+		err = odata.ValidateStatusCode(resp, 204, func() string {
+			return "Server responded with an unexpected result while cancelling the thread."
+		})
+	}
+	if err != nil {
+		m.logger.Error("Unable to cancel runaway thread", append(args, "error", err)...)
+		return
+	}
+	resp.Body.Close()
+	m.logger.Warn("Cancelled runaway thread", args...)
+	healthNotifier.Notify("Cancelled runaway thread on "+m.server.String(),
+		fmt.Sprintf("Thread %d has been busy for longer than %s executing %s", thread.ID, m.enforcement.Limit, thread.Function),
+		map[string]interface{}{"Server": m.server.String(), "User": thread.Name, "Function": thread.Function, "ObjectType": thread.ObjectType, "Object": thread.ObjectName})
+}
+
+// matches returns true if the thread is executing one of the functions subject to enforcement.
+func (e *ThreadEnforcement) matches(thread odata.Thread) bool {
+	for _, f := range e.Functions {
+		if strings.EqualFold(thread.Function, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestThreadMonitorReportsThreadsBusyBeforeStarting(t *testing.T) {
+	m := NewThreadMonitor(&Server{Name: "dev"}, time.Minute, nil)
+	m.check([]odata.Thread{{ID: 1, State: "Run", Function: "ExecuteMDX", ElapsedTime: "P0DT00H05M00S"}}, time.Now())
+	if !m.threadMap[1].warned {
+		t.Error("expected a thread busy for longer than the threshold to be reported as soon as it's seen")
+	}
+	m.check([]odata.Thread{{ID: 2, State: "Wait", Function: "ExecuteMDX", ElapsedTime: "PT10S"}}, time.Now())
+	if m.threadMap[2].warned {
+		t.Error("expected a thread busy for less than the threshold not to be reported")
+	}
+}
+
+func TestThreadMonitorCancelsLongOperationsOnly(t *testing.T) {
+	m := NewThreadMonitor(&Server{Name: "dev"}, time.Hour, &ThreadEnforcement{Limit: time.Minute, Functions: []string{"ExecuteMDX"}})
+	start := time.Now()
+
+	// A thread running short operations back to back, busy at every poll, isn't a runaway
+	for i, thread := range []odata.Thread{
+		{ID: 1, State: "Run", Function: "ExecuteMDX", ObjectName: "Sales", ElapsedTime: "PT20S"},
+		{ID: 1, State: "Run", Function: "ExecuteMDX", ObjectName: "Sales", ElapsedTime: "PT5S"},
+		{ID: 1, State: "Run", Function: "ExecuteMDX", ObjectName: "Expenses", ElapsedTime: "PT30S"},
+		{ID: 1, State: "Run", Function: "ExecuteMDX", ObjectName: "Expenses", ElapsedTime: "PT10S"},
+	} {
+		if runaway := m.check([]odata.Thread{thread}, start.Add(time.Duration(i)*40*time.Second)); len(runaway) > 0 {
+			t.Fatalf("poll %d: cancelled a thread running short operations", i)
+		}
+	}
+
+	// Nor is it if the server doesn't report the elapsed time, as long as the operations differ
+	for i, objectName := range []string{"Sales", "Expenses", "Sales"} {
+		thread := odata.Thread{ID: 2, State: "Run", Function: "ExecuteMDX", ObjectName: objectName}
+		if runaway := m.check([]odata.Thread{thread}, start.Add(time.Duration(i)*40*time.Second)); len(runaway) > 0 {
+			t.Fatalf("poll %d: cancelled a thread running short operations", i)
+		}
+	}
+
+	// A single operation exceeding the limit is, once
+	thread := odata.Thread{ID: 3, State: "Run", Function: "ExecuteMDX", ObjectName: "Sales", ElapsedTime: "PT2M"}
+	if runaway := m.check([]odata.Thread{thread}, start); len(runaway) != 1 {
+		t.Fatalf("expected the runaway thread to be cancelled, got %d", len(runaway))
+	}
+	if runaway := m.check([]odata.Thread{thread}, start.Add(time.Second)); len(runaway) != 0 {
+		t.Fatal("expected the runaway thread to be cancelled only once")
+	}
+}
+
+func TestThreadEnforcementMatchesFunctionsExactly(t *testing.T) {
+	e := &ThreadEnforcement{Limit: time.Minute, Functions: []string{"executemdx", "Execute"}}
+	for function, want := range map[string]bool{
+		"ExecuteMDX":        true,
+		"Execute":           true,
+		"ExecuteMDXSetExpr": false,
+		"ProcessExecute":    false,
+		"MDX":               false,
+	} {
+		if got := e.matches(odata.Thread{Function: function}); got != want {
+			t.Errorf("%s: got %t, expected %t", function, got, want)
+		}
+	}
+}
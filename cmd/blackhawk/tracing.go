@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// The tracer provider exporting the spans, if tracing is enabled.
+var tracerProvider *sdktrace.TracerProvider
+
+// setupTracing registers, if the TM1_OTLP_ENDPOINT environment variable is set, the tracer provider
+// exporting the spans of the pipeline, from fetching the deltas to delivering the entries, using
+// OTLP over HTTP to that endpoint, at /v1/traces unless the URL specifies a path.
+// TM1_OTLP_SAMPLE_RATIO optionally specifies the fraction of the responses that get traced.
+func setupTracing() error {
+	endpoint := os.Getenv("TM1_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(u.String()))
+	if err != nil {
+		return err
+	}
+	ratio := 1.0
+	if value := os.Getenv("TM1_OTLP_SAMPLE_RATIO"); value != "" {
+		if ratio, err = strconv.ParseFloat(value, 64); err != nil {
+			return err
+		}
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "blackhawk"))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	return nil
+}
+
+// shutdownTracing exports any spans still pending, if tracing is enabled.
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logger.Warn("Unable to export pending spans", "error", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// sinkURLEnv maps the sinks delivering their entries to a URL, without connecting to it when they
+// get created, to the environment variable specifying that URL.
+var sinkURLEnv = map[string]string{
+	"http":          "TM1_SINK_URL",
+	"elasticsearch": "TM1_ES_URL",
+	"webhook":       "TM1_WEBHOOK_URL",
+	"splunk":        "TM1_SPLUNK_URL",
+	"influxdb":      "TM1_INFLUXDB_URL",
+}
+
+// validation keeps track of the outcome of the checks validating the configuration.
+type validation struct {
+	passed int
+	failed int
+}
+
+// check prints the outcome of the check, passed unless it failed with the error.
+func (v *validation) check(subject string, err error) bool {
+	if err != nil {
+		v.failed++
+		// Errors reporting the response of a server span multiple lines, print them on one line
+		fmt.Printf("FAIL  %s: %s\n", subject, strings.Join(strings.Fields(err.Error()), " "))
+		return false
+	}
+	v.passed++
+	fmt.Printf("PASS  %s\n", subject)
+	return true
+}
+
+// validate validates the configuration, without tracking anything: the filter, alert rules and other
+// settings of the tracker are parsed, every server is connected to, checking the credentials and
+// that the collections support tracking changes, and every sink is created, connecting to the
+// server it delivers its entries to. Prints the outcome of every check, and a summary, exiting with
+// a non-zero exit code if any of the checks failed.
+func validate(collections []string) {
+	v := new(validation)
+
+	// The settings of the tracker
+	_, err := NewFilterFromEnv()
+	v.check("filter", err)
+	if os.Getenv("TM1_RULES_FILE") != "" {
+		engine, err := rules.LoadEngine(os.Getenv("TM1_RULES_FILE"))
+		if v.check("rules "+os.Getenv("TM1_RULES_FILE"), err) {
+			engine.Close()
+		}
+	}
+	if os.Getenv("TM1_WATCH_FILE") != "" {
+		watchList, err := rules.LoadWatchList(os.Getenv("TM1_WATCH_FILE"))
+		if v.check("watch list "+os.Getenv("TM1_WATCH_FILE"), err) {
+			watchList.Close()
+		}
+	}
+	if os.Getenv("TM1_SCRIPT_FILE") != "" {
+		script, err := rules.LoadScript(os.Getenv("TM1_SCRIPT_FILE"))
+		if v.check("script "+os.Getenv("TM1_SCRIPT_FILE"), err) {
+			script.Close()
+		}
+	}
+	if store, err := newCheckpointStoreFromEnv(); err != nil || store != nil {
+		// Loading the state of any collection checks the store can be reached
+		if err == nil {
+			_, err = store.Load("")
+			store.Close()
+		}
+		v.check("checkpoint", err)
+	}
+	_, err = shardFromEnv()
+	v.check("shard", err)
+	_, err = newLeaderFromEnv()
+	v.check("leader election", err)
+	_, err = newPollingFromEnv()
+	v.check("polling interval", err)
+	_, _, err = recoveryFromEnv()
+	v.check("delta recovery", err)
+	_, _, err = gapDetectionFromEnv()
+	v.check("gap detection", err)
+	_, err = NewAggregatorFromEnv()
+	v.check("aggregation", err)
+	_, err = NewProfilerFromEnv()
+	v.check("user profiles", err)
+
+	// The servers, and whether the collections can be tracked on them
+	servers := serversFromEnv()
+	for _, server := range servers {
+		subject := "server " + server.String()
+		err := server.createClient(nil)
+		if err == nil {
+			err = server.open()
+		}
+		if !v.check(subject, err) {
+			continue
+		}
+		for _, collection := range collections {
+			tracks, err := server.Client.TracksChanges(server.ServiceRootURL, odata.AppendQueryOptions(collection, queryOptions))
+			if err == nil && !tracks {
+				err = fmt.Errorf("the server didn't apply the track-changes preference")
+			}
+			v.check(subject+" collection "+collection, err)
+		}
+	}
+
+	// The sinks, and the servers they deliver their entries to
+	names := splitList(os.Getenv("TM1_SINK"))
+	if len(names) == 0 {
+		names = []string{"http"}
+	}
+	for _, name := range names {
+		s, err := newRouteSink(name, servers)
+		if err == nil {
+			s.Close()
+			err = dialSink(name)
+		}
+		v.check("sink "+name, err)
+	}
+	closeDeadLetterSink()
+
+	fmt.Println()
+	if v.failed > 0 {
+		fmt.Printf("Validation failed: %d of %d checks failed\n", v.failed, v.passed+v.failed)
+		os.Exit(1)
+	}
+	fmt.Printf("Validation passed: all %d checks passed\n", v.passed)
+}
+
+// dialSink connects to the servers the sink delivers its entries to, if it doesn't connect to them
+// when it gets created, as the kafka sink and the sinks delivering their entries to a URL.
+func dialSink(name string) error {
+	var addresses []string
+	switch name {
+	case "kafka":
+		addresses = splitList(os.Getenv("TM1_KAFKA_BROKERS"))
+		if len(addresses) == 0 {
+			return fmt.Errorf("no brokers specified")
+		}
+	default:
+		key, ok := sinkURLEnv[name]
+		if !ok {
+			return nil
+		}
+		urlStr := os.Getenv(key)
+		if urlStr == "" && name == "http" {
+			urlStr = "http://localhost:12345"
+		}
+		address, err := urlAddress(urlStr)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", key, err)
+		}
+		addresses = []string{address}
+	}
+
+	for _, address := range addresses {
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// urlAddress returns the address, as in host:port, of the server at the URL, using the default port
+// of its scheme if it doesn't specify one.
+func urlAddress(urlStr string) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("no host specified in %s", urlStr)
+	}
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return "", fmt.Errorf("no port specified in %s", urlStr)
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// The number of recent entries the live tail replays to clients connecting, or changing their
+// filter, and the number of entries buffered for every client before entries get dropped.
+const (
+	liveTailRecent = 500
+	liveTailBuffer = 256
+)
+
+// webUI holds the files of the web UI.
+//
+//go:embed webui
+var webUI embed.FS
+
+// The live tail, if any, of the entries inspected, as shown by the web UI.
+var liveTail *LiveTail
+
+// LiveTail streams the entries inspected to the clients of the web UI, over websockets, every
+// client receiving the entries matching its filter only. Clients not keeping up miss entries
+// rather than holding up the tracker. The live tail is safe for concurrent use.
+type LiveTail struct {
+	mutex   sync.Mutex
+	recent  []*tailEntry
+	clients map[*tailClient]bool
+	total   int
+}
+
+// tailEntry is an entry, as JSON, with the fields it can be filtered on.
+type tailEntry struct {
+	kind string
+	cube string
+	user string
+	text string // The JSON, in lower case, to search in
+	data []byte
+}
+
+// tailFilter is the filter of a client, matching the entries of the cube and the user, if
+// specified, holding the text, case insensitive.
+type tailFilter struct {
+	Cube string `json:"cube"`
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+// tailClient is a client of the live tail.
+type tailClient struct {
+	filter  tailFilter
+	send    chan *tailEntry
+	dropped int
+}
+
+// NewLiveTail creates and returns a new LiveTail, without any clients.
+func NewLiveTail() *LiveTail {
+	t := new(LiveTail)
+	t.clients = map[*tailClient]bool{}
+
+	return t
+}
+
+// Add streams the entry to the clients whose filter it matches.
+func (t *LiveTail) Add(entry interface{}) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	e := &tailEntry{data: data, text: strings.ToLower(string(data))}
+	switch entry := entry.(type) {
+	case *odata.TransactionLogEntry:
+		e.kind, e.cube, e.user = "transaction", entry.Cube, entry.User
+	case *odata.MessageLogEntry:
+		e.kind = "message"
+	case *odata.AuditLogEntry:
+		e.kind, e.user = "audit", entry.UserName
+	default:
+		e.kind = "entity"
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.total++
+	t.recent = append(t.recent, e)
+	if len(t.recent) > liveTailRecent {
+		t.recent = t.recent[len(t.recent)-liveTailRecent:]
+	}
+	for client := range t.clients {
+		if client.filter.matches(e) {
+			client.push(e)
+		}
+	}
+}
+
+// push sends the entry to the client, dropping it if the client doesn't keep up.
+func (c *tailClient) push(e *tailEntry) {
+	select {
+	case c.send <- e:
+	default:
+		c.dropped++
+	}
+}
+
+// matches returns whether the entry matches the filter.
+func (f tailFilter) matches(e *tailEntry) bool {
+	if f.Cube != "" && !strings.EqualFold(f.Cube, e.cube) {
+		return false
+	}
+	if f.User != "" && !strings.EqualFold(f.User, e.user) {
+		return false
+	}
+	return f.Text == "" || strings.Contains(e.text, strings.ToLower(f.Text))
+}
+
+// setFilter sets the filter of the client, replaying the recent entries matching it.
+func (t *LiveTail) setFilter(client *tailClient, filter tailFilter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	client.filter = filter
+	for _, e := range t.recent {
+		if filter.matches(e) {
+			client.push(e)
+		}
+	}
+}
+
+// register adds the client to the live tail.
+func (t *LiveTail) register(client *tailClient) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.clients[client] = true
+}
+
+// unregister removes the client from the live tail.
+func (t *LiveTail) unregister(client *tailClient) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.clients, client)
+}
+
+// takeDropped returns, and resets, the number of entries the client missed.
+func (t *LiveTail) takeDropped(client *tailClient) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	dropped := client.dropped
+	client.dropped = 0
+	return dropped
+}
+
+// stats returns the number of clients connected and the number of entries added so far.
+func (t *LiveTail) stats() (int, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.clients), t.total
+}
+
+// upgrader upgrades the requests of the web UI to websockets, from the same origin only.
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// ServeStream streams the entries to the client over a websocket. The client sets, and changes, its
+// filter by sending it as JSON, as in {"cube": "Sales", "user": "", "text": "actual"}, after which
+// the recent entries matching it are sent first. Every entry is sent as a message of its own, as
+// in {"type": "transaction", "entry": {...}}, preceded by a {"type": "dropped", "count": n} message
+// if the client missed any entries since.
+func (t *LiveTail) ServeStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	client := &tailClient{send: make(chan *tailEntry, liveTailBuffer)}
+	query := r.URL.Query()
+	t.setFilter(client, tailFilter{Cube: query.Get("cube"), User: query.Get("user"), Text: query.Get("text")})
+	t.register(client)
+	defer t.unregister(client)
+
+	// Read the filters sent by the client until it disconnects
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var filter tailFilter
+			if err := conn.ReadJSON(&filter); err != nil {
+				if _, ok := err.(*json.SyntaxError); ok {
+					continue
+				}
+				return
+			}
+			t.setFilter(client, filter)
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		var message []byte
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+			continue
+		case e := <-client.send:
+			if dropped := t.takeDropped(client); dropped > 0 {
+				message, _ = json.Marshal(map[string]interface{}{"type": "dropped", "count": dropped})
+				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					return
+				}
+			}
+			var b bytes.Buffer
+			b.WriteString(`{"type":"` + e.kind + `","entry":`)
+			b.Write(e.data)
+			b.WriteString("}")
+			message = b.Bytes()
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			logger.Debug("Web UI client disconnected", "remote", r.RemoteAddr, "error", err)
+			return
+		}
+	}
+}
+
+// ServeHealth serves the status of the tracker, as for the /healthz and /readyz endpoints, along
+// with whether it's alive and ready, the number of entries streamed and clients connected.
+func (t *LiveTail) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	status, alive, ready := health.status()
+	status["alive"], status["ready"] = alive, ready
+	status["clients"], status["entries"] = t.stats()
+	writeStatus(w, status, true)
+}
+
+// serveUI serves the web UI, tailing the entries inspected, on the address.
+func serveUI(addr string) {
+	liveTail = NewLiveTail()
+	files, _ := fs.Sub(webUI, "webui")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/stream", liveTail.ServeStream)
+	mux.HandleFunc("/health", liveTail.ServeHealth)
+	go func() {
+		fatal("Unable to serve the web UI", "addr", addr, "error", http.ListenAndServe(addr, mux))
+	}()
+}
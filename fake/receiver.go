@@ -0,0 +1,69 @@
+package fake
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Receiver is a fake target server for the http sink, receiving the documents, holding the
+// entries in their value array, posted to it. Receiver is an http.Handler and is safe for
+// concurrent use.
+type Receiver struct {
+	// OnReceive, if set, is called for every document received.
+	OnReceive func(entries []json.RawMessage)
+
+	mutex   sync.Mutex
+	entries []json.RawMessage
+}
+
+// NewReceiver creates and returns a new Receiver.
+func NewReceiver() *Receiver {
+	return new(Receiver)
+}
+
+// Entries returns all entries received so far.
+func (rc *Receiver) Entries() []json.RawMessage {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return append([]json.RawMessage(nil), rc.entries...)
+}
+
+// ServeHTTP receives the document posted, which may be gzip compressed, as advertised using the
+// Accept-Encoding header.
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Encoding", "gzip")
+	if r.Method != "POST" {
+		http.Error(w, "Method not supported on this endpoint!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	var doc struct {
+		Value []json.RawMessage `json:"value"`
+	}
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.mutex.Lock()
+	rc.entries = append(rc.entries, doc.Value...)
+	rc.mutex.Unlock()
+	if rc.OnReceive != nil {
+		rc.OnReceive(doc.Value)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
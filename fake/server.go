@@ -0,0 +1,297 @@
+// Package fake implements a fake TM1 server, serving the transaction, message and audit logs through
+// the same OData endpoints, including delta links, as a real TM1 server, allowing the tracker to be
+// exercised without a live TM1 server.
+package fake
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Server is a fake TM1 server. Its log entries are served, in pages of PageSize entries if set,
+// with a delta link pointing at the entries added since. If credentials are set, requests need to
+// authenticate, using basic authentication, or carry the cookie of an established session. Server
+// is an http.Handler, typically served using httptest.NewServer, and is safe for concurrent use.
+type Server struct {
+	// Version is the version of the server.
+	Version string
+	// PageSize, if set, is the maximum number of entries in a response, which ends with a nextLink
+	// if there are more entries to be served.
+	PageSize int
+	// User and Password, if set, are the credentials clients need to authenticate with.
+	User     string
+	Password string
+	// Database, if set, makes the server behave like a Planning Analytics Engine, version 12 or
+	// later, serving the logs of the database with this name under Databases('name')/.
+	Database string
+
+	mutex        sync.Mutex
+	transactions []odata.TransactionLogEntry
+	messages     []odata.MessageLogEntry
+	audits       []odata.AuditLogEntry
+	sessions     map[string]bool
+	malformed    int
+	requests     int
+	restarts     int          // Number of restarts, invalidating the delta links served before
+	withheld     map[int]bool // IDs of the transaction log entries left out, unless asked for by ID
+}
+
+// NewServer creates and returns a new, empty, fake Server.
+func NewServer() *Server {
+	s := new(Server)
+	s.Version = "11.8.02000.1"
+	s.sessions = map[string]bool{}
+	s.withheld = map[int]bool{}
+
+	return s
+}
+
+// AddTransactionLogEntries appends the entries to the transaction log, assigning their IDs.
+func (s *Server) AddTransactionLogEntries(entries ...odata.TransactionLogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range entries {
+		entry.ID = len(s.transactions) + 1
+		s.transactions = append(s.transactions, entry)
+	}
+}
+
+// WithholdTransactionLogEntries appends the entries to the transaction log, assigning their IDs,
+// but leaves them out of the responses, unless asked for by their ID, as in $filter=ID ge 5 and
+// ID le 7, simulating entries the server skipped while tracking changes.
+func (s *Server) WithholdTransactionLogEntries(entries ...odata.TransactionLogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range entries {
+		entry.ID = len(s.transactions) + 1
+		s.transactions = append(s.transactions, entry)
+		s.withheld[entry.ID] = true
+	}
+}
+
+// AddMessageLogEntries appends the entries to the message log, assigning their IDs.
+func (s *Server) AddMessageLogEntries(entries ...odata.MessageLogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range entries {
+		entry.ID = len(s.messages) + 1
+		s.messages = append(s.messages, entry)
+	}
+}
+
+// AddAuditLogEntries appends the entries to the audit log, assigning their IDs.
+func (s *Server) AddAuditLogEntries(entries ...odata.AuditLogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range entries {
+		entry.ID = len(s.audits) + 1
+		s.audits = append(s.audits, entry)
+	}
+}
+
+// ExpireSessions expires all sessions, forcing clients to authenticate again.
+func (s *Server) ExpireSessions() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions = map[string]bool{}
+}
+
+// Restart simulates a restart of the server, which, like a real TM1 server, forgets the delta
+// links it served, responding to requests following them with 410 Gone, and ends all sessions.
+func (s *Server) Restart() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.restarts++
+	s.sessions = map[string]bool{}
+}
+
+// ServeMalformed makes the server respond to the next n requests for a log with a malformed,
+// truncated, payload.
+func (s *Server) ServeMalformed(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.malformed = n
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+// ServeHTTP serves the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests++
+
+	if !s.authenticate(w, r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="TM1"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path[strings.LastIndex(r.URL.Path, "/api/v1/")+len("/api/v1/"):]
+	if s.Database != "" {
+		if path == "Databases" {
+			writeJSON(w, map[string]interface{}{"value": []interface{}{map[string]string{"Name": s.Database}}})
+			return
+		}
+		prefix := "Databases('" + strings.Replace(s.Database, "'", "''", -1) + "')/"
+		if !strings.HasPrefix(path, prefix) {
+			http.Error(w, "Resource not found", http.StatusNotFound)
+			return
+		}
+		path = strings.TrimPrefix(path, prefix)
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/Configuration/ProductVersion/$value"):
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, s.Version)
+	case path == "TransactionLogEntries":
+		from, to, byID := idRange(r.URL.Query().Get("$filter"))
+		entries := []interface{}{}
+		for i := range s.transactions {
+			if id := s.transactions[i].ID; (byID && id >= from && id <= to) || (!byID && !s.withheld[id]) {
+				entries = append(entries, &s.transactions[i])
+			}
+		}
+		s.serveLog(w, r, path, entries)
+	case path == "MessageLogEntries":
+		entries := make([]interface{}, len(s.messages))
+		for i := range s.messages {
+			entries[i] = &s.messages[i]
+		}
+		s.serveLog(w, r, path, entries)
+	case path == "AuditLogEntries":
+		entries := make([]interface{}, len(s.audits))
+		for i := range s.audits {
+			entries[i] = &s.audits[i]
+		}
+		s.serveLog(w, r, path, entries)
+	case path == "Threads" || path == "Sessions":
+		writeJSON(w, map[string]interface{}{"value": []interface{}{}})
+	default:
+		http.Error(w, "Resource not found", http.StatusNotFound)
+	}
+}
+
+// authenticate returns true if the request carries the cookie of an established session or valid
+// credentials, in which case a new session is established.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if s.User == "" && s.Password == "" {
+		return true
+	}
+	if cookie, err := r.Cookie("TM1SessionId"); err == nil && s.sessions[cookie.Value] {
+		return true
+	}
+	if user, password, ok := r.BasicAuth(); !ok || user != s.User || password != s.Password {
+		return false
+	}
+	id := strconv.Itoa(len(s.sessions)+1) + "-" + strconv.Itoa(s.requests)
+	s.sessions[id] = true
+	http.SetCookie(w, &http.Cookie{Name: "TM1SessionId", Value: id, Path: "/"})
+	return true
+}
+
+// serveLog serves the entries of the log, starting at the position identified by the skip or delta
+// token, if any, followed by a nextLink if there are more entries to be served than fit in a page,
+// or, if the client asked to track changes, a deltaLink.
+func (s *Server) serveLog(w http.ResponseWriter, r *http.Request, collection string, entries []interface{}) {
+	start := 0
+	if token := r.URL.Query().Get("$deltatoken"); token != "" {
+		restarts, position, _ := strings.Cut(token, "-")
+		if restarts != strconv.Itoa(s.restarts) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "Delta token is no longer valid"}})
+			return
+		}
+		start, _ = strconv.Atoi(position)
+	}
+	if token := r.URL.Query().Get("$skiptoken"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	if start > len(entries) {
+		start = len(entries)
+	}
+	// The client can ask for smaller pages using the odata.maxpagesize preference
+	pageSize := s.PageSize
+	var applied []string
+	trackChanges := false
+	for _, preference := range strings.Split(r.Header.Get("Prefer"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+		switch name {
+		case "odata.track-changes":
+			trackChanges = true
+			applied = append(applied, name)
+		case "odata.maxpagesize":
+			if maxPageSize, err := strconv.Atoi(value); err == nil && maxPageSize > 0 && (pageSize == 0 || maxPageSize < pageSize) {
+				pageSize = maxPageSize
+				applied = append(applied, "odata.maxpagesize="+value)
+			}
+		}
+	}
+	if len(applied) > 0 {
+		w.Header().Set("Preference-Applied", strings.Join(applied, ", "))
+	}
+
+	end := len(entries)
+	if pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+	}
+
+	res := map[string]interface{}{
+		"@odata.context": "$metadata#" + collection,
+		"value":          entries[start:end],
+	}
+	if end < len(entries) {
+		res["@odata.nextLink"] = collection + "?$skiptoken=" + strconv.Itoa(end)
+		if filter := r.URL.Query().Get("$filter"); filter != "" {
+			res["@odata.nextLink"] = collection + "?$filter=" + url.QueryEscape(filter) + "&$skiptoken=" + strconv.Itoa(end)
+		}
+	} else if trackChanges {
+		res["@odata.deltaLink"] = collection + "?$deltatoken=" + strconv.Itoa(s.restarts) + "-" + strconv.Itoa(end)
+	}
+
+	if s.malformed > 0 {
+		s.malformed--
+		data, _ := json.Marshal(res)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data[:len(data)/2])
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		json.NewEncoder(writer).Encode(res)
+		writer.Close()
+		return
+	}
+	writeJSON(w, res)
+}
+
+// idRange returns the range of IDs the filter asks for, if it's of the form ID ge 5 and ID le 7.
+func idRange(filter string) (int, int, bool) {
+	var from, to int
+	if _, err := fmt.Sscanf(filter, "ID ge %d and ID le %d", &from, &to); err != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// writeJSON writes the value as the JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
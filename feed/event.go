@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// NewEvent returns the event holding the entry. Entries other than transaction, message and audit
+// log entries are held as the fields of their JSON representation.
+func NewEvent(entry interface{}) (*Event, error) {
+	switch e := entry.(type) {
+	case *odata.TransactionLogEntry:
+		return newTransactionEvent(e)
+	case *odata.MessageLogEntry:
+		return &Event{Entry: &Event_Message{Message: &MessageLogEntry{
+			Id:              int64(e.ID),
+			ThreadId:        int64(e.ThreadID),
+			SessionId:       int64(e.SessionID),
+			Level:           e.Level,
+			TimeStamp:       e.TimeStamp,
+			Logger:          e.Logger,
+			Message:         e.Message,
+			Server:          e.Server,
+			SchemaVersion:   int32(e.SchemaVersion),
+			FutureTimeStamp: e.FutureTimeStamp,
+		}}}, nil
+	case *odata.AuditLogEntry:
+		audit := &AuditLogEntry{
+			Id:              int64(e.ID),
+			TimeStamp:       e.TimeStamp,
+			UserName:        e.UserName,
+			Description:     e.Description,
+			ObjectType:      e.ObjectType,
+			ObjectName:      e.ObjectName,
+			Server:          e.Server,
+			SchemaVersion:   int32(e.SchemaVersion),
+			FutureTimeStamp: e.FutureTimeStamp,
+		}
+		for _, detail := range e.AuditDetails {
+			audit.AuditDetails = append(audit.AuditDetails, &AuditDetail{
+				Id:         int64(detail.ID),
+				TimeStamp:  detail.TimeStamp,
+				ObjectType: detail.ObjectType,
+				ObjectName: detail.ObjectName,
+			})
+		}
+		return &Event{Entry: &Event_Audit{Audit: audit}}, nil
+	}
+
+	fields, err := jsonStruct(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Entry: &Event_Other{Other: fields}}, nil
+}
+
+// Type returns the type of the entry held by the event.
+func (e *Event) Type() EventType {
+	switch e.Entry.(type) {
+	case *Event_Transaction:
+		return EventType_EVENT_TYPE_TRANSACTION
+	case *Event_Message:
+		return EventType_EVENT_TYPE_MESSAGE
+	case *Event_Audit:
+		return EventType_EVENT_TYPE_AUDIT
+	case *Event_Other:
+		return EventType_EVENT_TYPE_OTHER
+	}
+	return EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+// newTransactionEvent returns the event holding the transaction log entry.
+func newTransactionEvent(e *odata.TransactionLogEntry) (*Event, error) {
+	txn := &TransactionLogEntry{
+		Id:              int64(e.ID),
+		ChangeSetId:     e.ChangeSetID,
+		TimeStamp:       e.TimeStamp,
+		ReplicationTime: e.ReplicationTime,
+		User:            e.User,
+		Cube:            e.Cube,
+		Tuple:           e.Tuple,
+		Server:          e.Server,
+		SchemaVersion:   int32(e.SchemaVersion),
+		Elements:        e.Elements,
+		FutureTimeStamp: e.FutureTimeStamp,
+	}
+	var err error
+	if txn.OldValue, err = structpb.NewValue(e.OldValue); err != nil {
+		return nil, err
+	}
+	if txn.NewValue, err = structpb.NewValue(e.NewValue); err != nil {
+		return nil, err
+	}
+	if txn.StatusMessage, err = structpb.NewValue(e.StatusMessage); err != nil {
+		return nil, err
+	}
+	if len(e.Attributes) > 0 {
+		txn.Attributes = map[string]*structpb.Struct{}
+		for dimension, attributes := range e.Attributes {
+			if txn.Attributes[dimension], err = jsonStruct(attributes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if e.Values != nil {
+		txn.Values = &TypedValues{
+			ValueType: string(e.Values.ValueType),
+			OldNumber: e.Values.OldNumber,
+			NewNumber: e.Values.NewNumber,
+			OldString: e.Values.OldString,
+			NewString: e.Values.NewString,
+		}
+	}
+	return &Event{Entry: &Event_Transaction{Transaction: txn}}, nil
+}
+
+// jsonStruct returns the fields of the JSON representation of the value.
+func jsonStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := new(structpb.Struct)
+	if err := fields.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
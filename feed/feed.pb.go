@@ -0,0 +1,1024 @@
+// The feed of the entries tracked by tm1-blackhawk, as served by its grpc sink.
+//
+// Regenerate the Go code, using protoc-gen-go and protoc-gen-go-grpc, from the root of the
+// repository, using:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative feed/feed.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: feed/feed.proto
+
+package feed
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// EventType is the type of an entry.
+type EventType int32
+
+const (
+	EventType_EVENT_TYPE_UNSPECIFIED EventType = 0
+	EventType_EVENT_TYPE_TRANSACTION EventType = 1
+	EventType_EVENT_TYPE_MESSAGE     EventType = 2
+	EventType_EVENT_TYPE_AUDIT       EventType = 3
+	// Any other entry, like a change set or an entry reshaped by a transform.
+	EventType_EVENT_TYPE_OTHER EventType = 4
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "EVENT_TYPE_UNSPECIFIED",
+		1: "EVENT_TYPE_TRANSACTION",
+		2: "EVENT_TYPE_MESSAGE",
+		3: "EVENT_TYPE_AUDIT",
+		4: "EVENT_TYPE_OTHER",
+	}
+	EventType_value = map[string]int32{
+		"EVENT_TYPE_UNSPECIFIED": 0,
+		"EVENT_TYPE_TRANSACTION": 1,
+		"EVENT_TYPE_MESSAGE":     2,
+		"EVENT_TYPE_AUDIT":       3,
+		"EVENT_TYPE_OTHER":       4,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_feed_feed_proto_enumTypes[0].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_feed_feed_proto_enumTypes[0]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{0}
+}
+
+// SubscribeRequest specifies the entries to stream. Every filter specified has to match, an empty
+// request matches all entries.
+type SubscribeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The types of entries, any type if none are specified.
+	Types []EventType `protobuf:"varint,1,rep,packed,name=types,proto3,enum=tm1.blackhawk.v1.EventType" json:"types,omitempty"`
+	// The cubes, matched case-insensitively, the entries were written to.
+	Cubes []string `protobuf:"bytes,2,rep,name=cubes,proto3" json:"cubes,omitempty"`
+	// The users, matched case-insensitively, who wrote the entries, as in the User of transaction log
+	// entries or the UserName of audit log entries.
+	Users []string `protobuf:"bytes,3,rep,name=users,proto3" json:"users,omitempty"`
+	// The names of the servers the entries originate from.
+	Servers []string `protobuf:"bytes,4,rep,name=servers,proto3" json:"servers,omitempty"`
+	// An expression, in the expression language of the alerting rules, as in `Change > 10000`.
+	Filter        string `protobuf:"bytes,5,opt,name=filter,proto3" json:"filter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_feed_feed_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubscribeRequest) GetTypes() []EventType {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetCubes() []string {
+	if x != nil {
+		return x.Cubes
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetUsers() []string {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetServers() []string {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+// Event is an entry tracked.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Entry:
+	//
+	//	*Event_Transaction
+	//	*Event_Message
+	//	*Event_Audit
+	//	*Event_Other
+	Entry         isEvent_Entry `protobuf_oneof:"entry"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_feed_feed_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Event) GetEntry() isEvent_Entry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+func (x *Event) GetTransaction() *TransactionLogEntry {
+	if x != nil {
+		if x, ok := x.Entry.(*Event_Transaction); ok {
+			return x.Transaction
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetMessage() *MessageLogEntry {
+	if x != nil {
+		if x, ok := x.Entry.(*Event_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetAudit() *AuditLogEntry {
+	if x != nil {
+		if x, ok := x.Entry.(*Event_Audit); ok {
+			return x.Audit
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetOther() *structpb.Struct {
+	if x != nil {
+		if x, ok := x.Entry.(*Event_Other); ok {
+			return x.Other
+		}
+	}
+	return nil
+}
+
+type isEvent_Entry interface {
+	isEvent_Entry()
+}
+
+type Event_Transaction struct {
+	Transaction *TransactionLogEntry `protobuf:"bytes,1,opt,name=transaction,proto3,oneof"`
+}
+
+type Event_Message struct {
+	Message *MessageLogEntry `protobuf:"bytes,2,opt,name=message,proto3,oneof"`
+}
+
+type Event_Audit struct {
+	Audit *AuditLogEntry `protobuf:"bytes,3,opt,name=audit,proto3,oneof"`
+}
+
+type Event_Other struct {
+	// Any other entry, holding the fields of its JSON representation.
+	Other *structpb.Struct `protobuf:"bytes,4,opt,name=other,proto3,oneof"`
+}
+
+func (*Event_Transaction) isEvent_Entry() {}
+
+func (*Event_Message) isEvent_Entry() {}
+
+func (*Event_Audit) isEvent_Entry() {}
+
+func (*Event_Other) isEvent_Entry() {}
+
+// TransactionLogEntry is a write to a cell.
+type TransactionLogEntry struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	ChangeSetId     string                 `protobuf:"bytes,2,opt,name=change_set_id,json=changeSetId,proto3" json:"change_set_id,omitempty"`
+	TimeStamp       string                 `protobuf:"bytes,3,opt,name=time_stamp,json=timeStamp,proto3" json:"time_stamp,omitempty"`
+	ReplicationTime string                 `protobuf:"bytes,4,opt,name=replication_time,json=replicationTime,proto3" json:"replication_time,omitempty"`
+	User            string                 `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`
+	Cube            string                 `protobuf:"bytes,6,opt,name=cube,proto3" json:"cube,omitempty"`
+	Tuple           []string               `protobuf:"bytes,7,rep,name=tuple,proto3" json:"tuple,omitempty"`
+	OldValue        *structpb.Value        `protobuf:"bytes,8,opt,name=old_value,json=oldValue,proto3" json:"old_value,omitempty"`
+	NewValue        *structpb.Value        `protobuf:"bytes,9,opt,name=new_value,json=newValue,proto3" json:"new_value,omitempty"`
+	StatusMessage   *structpb.Value        `protobuf:"bytes,10,opt,name=status_message,json=statusMessage,proto3" json:"status_message,omitempty"`
+	Server          string                 `protobuf:"bytes,11,opt,name=server,proto3" json:"server,omitempty"`
+	SchemaVersion   int32                  `protobuf:"varint,12,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// The elements, by dimension, if the entry has been enriched.
+	Elements map[string]string `protobuf:"bytes,13,rep,name=elements,proto3" json:"elements,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// The values of the attributes of the elements, by dimension, if the entry has been enriched.
+	Attributes map[string]*structpb.Struct `protobuf:"bytes,14,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// The old and new value according to their type, if the values have been parsed.
+	Values          *TypedValues `protobuf:"bytes,15,opt,name=values,proto3" json:"values,omitempty"`
+	FutureTimeStamp bool         `protobuf:"varint,16,opt,name=future_time_stamp,json=futureTimeStamp,proto3" json:"future_time_stamp,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *TransactionLogEntry) Reset() {
+	*x = TransactionLogEntry{}
+	mi := &file_feed_feed_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransactionLogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransactionLogEntry) ProtoMessage() {}
+
+func (x *TransactionLogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransactionLogEntry.ProtoReflect.Descriptor instead.
+func (*TransactionLogEntry) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TransactionLogEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TransactionLogEntry) GetChangeSetId() string {
+	if x != nil {
+		return x.ChangeSetId
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetTimeStamp() string {
+	if x != nil {
+		return x.TimeStamp
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetReplicationTime() string {
+	if x != nil {
+		return x.ReplicationTime
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetCube() string {
+	if x != nil {
+		return x.Cube
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetTuple() []string {
+	if x != nil {
+		return x.Tuple
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetOldValue() *structpb.Value {
+	if x != nil {
+		return x.OldValue
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetNewValue() *structpb.Value {
+	if x != nil {
+		return x.NewValue
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetStatusMessage() *structpb.Value {
+	if x != nil {
+		return x.StatusMessage
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *TransactionLogEntry) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *TransactionLogEntry) GetElements() map[string]string {
+	if x != nil {
+		return x.Elements
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetAttributes() map[string]*structpb.Struct {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetValues() *TypedValues {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+func (x *TransactionLogEntry) GetFutureTimeStamp() bool {
+	if x != nil {
+		return x.FutureTimeStamp
+	}
+	return false
+}
+
+// TypedValues are the old and new value of a cell, the numbers being set for numeric values, the
+// strings for string values.
+type TypedValues struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ValueType     string                 `protobuf:"bytes,1,opt,name=value_type,json=valueType,proto3" json:"value_type,omitempty"`
+	OldNumber     *float64               `protobuf:"fixed64,2,opt,name=old_number,json=oldNumber,proto3,oneof" json:"old_number,omitempty"`
+	NewNumber     *float64               `protobuf:"fixed64,3,opt,name=new_number,json=newNumber,proto3,oneof" json:"new_number,omitempty"`
+	OldString     *string                `protobuf:"bytes,4,opt,name=old_string,json=oldString,proto3,oneof" json:"old_string,omitempty"`
+	NewString     *string                `protobuf:"bytes,5,opt,name=new_string,json=newString,proto3,oneof" json:"new_string,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TypedValues) Reset() {
+	*x = TypedValues{}
+	mi := &file_feed_feed_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TypedValues) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TypedValues) ProtoMessage() {}
+
+func (x *TypedValues) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TypedValues.ProtoReflect.Descriptor instead.
+func (*TypedValues) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TypedValues) GetValueType() string {
+	if x != nil {
+		return x.ValueType
+	}
+	return ""
+}
+
+func (x *TypedValues) GetOldNumber() float64 {
+	if x != nil && x.OldNumber != nil {
+		return *x.OldNumber
+	}
+	return 0
+}
+
+func (x *TypedValues) GetNewNumber() float64 {
+	if x != nil && x.NewNumber != nil {
+		return *x.NewNumber
+	}
+	return 0
+}
+
+func (x *TypedValues) GetOldString() string {
+	if x != nil && x.OldString != nil {
+		return *x.OldString
+	}
+	return ""
+}
+
+func (x *TypedValues) GetNewString() string {
+	if x != nil && x.NewString != nil {
+		return *x.NewString
+	}
+	return ""
+}
+
+// MessageLogEntry is an entry of the message log.
+type MessageLogEntry struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	ThreadId        int64                  `protobuf:"varint,2,opt,name=thread_id,json=threadId,proto3" json:"thread_id,omitempty"`
+	SessionId       int64                  `protobuf:"varint,3,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Level           string                 `protobuf:"bytes,4,opt,name=level,proto3" json:"level,omitempty"`
+	TimeStamp       string                 `protobuf:"bytes,5,opt,name=time_stamp,json=timeStamp,proto3" json:"time_stamp,omitempty"`
+	Logger          string                 `protobuf:"bytes,6,opt,name=logger,proto3" json:"logger,omitempty"`
+	Message         string                 `protobuf:"bytes,7,opt,name=message,proto3" json:"message,omitempty"`
+	Server          string                 `protobuf:"bytes,8,opt,name=server,proto3" json:"server,omitempty"`
+	SchemaVersion   int32                  `protobuf:"varint,9,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	FutureTimeStamp bool                   `protobuf:"varint,10,opt,name=future_time_stamp,json=futureTimeStamp,proto3" json:"future_time_stamp,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *MessageLogEntry) Reset() {
+	*x = MessageLogEntry{}
+	mi := &file_feed_feed_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageLogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageLogEntry) ProtoMessage() {}
+
+func (x *MessageLogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageLogEntry.ProtoReflect.Descriptor instead.
+func (*MessageLogEntry) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MessageLogEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *MessageLogEntry) GetThreadId() int64 {
+	if x != nil {
+		return x.ThreadId
+	}
+	return 0
+}
+
+func (x *MessageLogEntry) GetSessionId() int64 {
+	if x != nil {
+		return x.SessionId
+	}
+	return 0
+}
+
+func (x *MessageLogEntry) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *MessageLogEntry) GetTimeStamp() string {
+	if x != nil {
+		return x.TimeStamp
+	}
+	return ""
+}
+
+func (x *MessageLogEntry) GetLogger() string {
+	if x != nil {
+		return x.Logger
+	}
+	return ""
+}
+
+func (x *MessageLogEntry) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *MessageLogEntry) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *MessageLogEntry) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *MessageLogEntry) GetFutureTimeStamp() bool {
+	if x != nil {
+		return x.FutureTimeStamp
+	}
+	return false
+}
+
+// AuditLogEntry is a change to an object.
+type AuditLogEntry struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TimeStamp       string                 `protobuf:"bytes,2,opt,name=time_stamp,json=timeStamp,proto3" json:"time_stamp,omitempty"`
+	UserName        string                 `protobuf:"bytes,3,opt,name=user_name,json=userName,proto3" json:"user_name,omitempty"`
+	Description     string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	ObjectType      string                 `protobuf:"bytes,5,opt,name=object_type,json=objectType,proto3" json:"object_type,omitempty"`
+	ObjectName      string                 `protobuf:"bytes,6,opt,name=object_name,json=objectName,proto3" json:"object_name,omitempty"`
+	AuditDetails    []*AuditDetail         `protobuf:"bytes,7,rep,name=audit_details,json=auditDetails,proto3" json:"audit_details,omitempty"`
+	Server          string                 `protobuf:"bytes,8,opt,name=server,proto3" json:"server,omitempty"`
+	SchemaVersion   int32                  `protobuf:"varint,9,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	FutureTimeStamp bool                   `protobuf:"varint,10,opt,name=future_time_stamp,json=futureTimeStamp,proto3" json:"future_time_stamp,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *AuditLogEntry) Reset() {
+	*x = AuditLogEntry{}
+	mi := &file_feed_feed_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditLogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditLogEntry) ProtoMessage() {}
+
+func (x *AuditLogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditLogEntry.ProtoReflect.Descriptor instead.
+func (*AuditLogEntry) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AuditLogEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuditLogEntry) GetTimeStamp() string {
+	if x != nil {
+		return x.TimeStamp
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetUserName() string {
+	if x != nil {
+		return x.UserName
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetObjectType() string {
+	if x != nil {
+		return x.ObjectType
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetObjectName() string {
+	if x != nil {
+		return x.ObjectName
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetAuditDetails() []*AuditDetail {
+	if x != nil {
+		return x.AuditDetails
+	}
+	return nil
+}
+
+func (x *AuditLogEntry) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *AuditLogEntry) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *AuditLogEntry) GetFutureTimeStamp() bool {
+	if x != nil {
+		return x.FutureTimeStamp
+	}
+	return false
+}
+
+// AuditDetail is one of the objects affected by an audited change.
+type AuditDetail struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TimeStamp     string                 `protobuf:"bytes,2,opt,name=time_stamp,json=timeStamp,proto3" json:"time_stamp,omitempty"`
+	ObjectType    string                 `protobuf:"bytes,3,opt,name=object_type,json=objectType,proto3" json:"object_type,omitempty"`
+	ObjectName    string                 `protobuf:"bytes,4,opt,name=object_name,json=objectName,proto3" json:"object_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditDetail) Reset() {
+	*x = AuditDetail{}
+	mi := &file_feed_feed_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditDetail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditDetail) ProtoMessage() {}
+
+func (x *AuditDetail) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_feed_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditDetail.ProtoReflect.Descriptor instead.
+func (*AuditDetail) Descriptor() ([]byte, []int) {
+	return file_feed_feed_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AuditDetail) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuditDetail) GetTimeStamp() string {
+	if x != nil {
+		return x.TimeStamp
+	}
+	return ""
+}
+
+func (x *AuditDetail) GetObjectType() string {
+	if x != nil {
+		return x.ObjectType
+	}
+	return ""
+}
+
+func (x *AuditDetail) GetObjectName() string {
+	if x != nil {
+		return x.ObjectName
+	}
+	return ""
+}
+
+var File_feed_feed_proto protoreflect.FileDescriptor
+
+const file_feed_feed_proto_rawDesc = "" +
+	"\n" +
+	"\x0ffeed/feed.proto\x12\x10tm1.blackhawk.v1\x1a\x1cgoogle/protobuf/struct.proto\"\xa3\x01\n" +
+	"\x10SubscribeRequest\x121\n" +
+	"\x05types\x18\x01 \x03(\x0e2\x1b.tm1.blackhawk.v1.EventTypeR\x05types\x12\x14\n" +
+	"\x05cubes\x18\x02 \x03(\tR\x05cubes\x12\x14\n" +
+	"\x05users\x18\x03 \x03(\tR\x05users\x12\x18\n" +
+	"\aservers\x18\x04 \x03(\tR\aservers\x12\x16\n" +
+	"\x06filter\x18\x05 \x01(\tR\x06filter\"\x84\x02\n" +
+	"\x05Event\x12I\n" +
+	"\vtransaction\x18\x01 \x01(\v2%.tm1.blackhawk.v1.TransactionLogEntryH\x00R\vtransaction\x12=\n" +
+	"\amessage\x18\x02 \x01(\v2!.tm1.blackhawk.v1.MessageLogEntryH\x00R\amessage\x127\n" +
+	"\x05audit\x18\x03 \x01(\v2\x1f.tm1.blackhawk.v1.AuditLogEntryH\x00R\x05audit\x12/\n" +
+	"\x05other\x18\x04 \x01(\v2\x17.google.protobuf.StructH\x00R\x05otherB\a\n" +
+	"\x05entry\"\xd9\x06\n" +
+	"\x13TransactionLogEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\"\n" +
+	"\rchange_set_id\x18\x02 \x01(\tR\vchangeSetId\x12\x1d\n" +
+	"\n" +
+	"time_stamp\x18\x03 \x01(\tR\ttimeStamp\x12)\n" +
+	"\x10replication_time\x18\x04 \x01(\tR\x0freplicationTime\x12\x12\n" +
+	"\x04user\x18\x05 \x01(\tR\x04user\x12\x12\n" +
+	"\x04cube\x18\x06 \x01(\tR\x04cube\x12\x14\n" +
+	"\x05tuple\x18\a \x03(\tR\x05tuple\x123\n" +
+	"\told_value\x18\b \x01(\v2\x16.google.protobuf.ValueR\boldValue\x123\n" +
+	"\tnew_value\x18\t \x01(\v2\x16.google.protobuf.ValueR\bnewValue\x12=\n" +
+	"\x0estatus_message\x18\n" +
+	" \x01(\v2\x16.google.protobuf.ValueR\rstatusMessage\x12\x16\n" +
+	"\x06server\x18\v \x01(\tR\x06server\x12%\n" +
+	"\x0eschema_version\x18\f \x01(\x05R\rschemaVersion\x12O\n" +
+	"\belements\x18\r \x03(\v23.tm1.blackhawk.v1.TransactionLogEntry.ElementsEntryR\belements\x12U\n" +
+	"\n" +
+	"attributes\x18\x0e \x03(\v25.tm1.blackhawk.v1.TransactionLogEntry.AttributesEntryR\n" +
+	"attributes\x125\n" +
+	"\x06values\x18\x0f \x01(\v2\x1d.tm1.blackhawk.v1.TypedValuesR\x06values\x12*\n" +
+	"\x11future_time_stamp\x18\x10 \x01(\bR\x0ffutureTimeStamp\x1a;\n" +
+	"\rElementsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1aV\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x05value:\x028\x01\"\xf8\x01\n" +
+	"\vTypedValues\x12\x1d\n" +
+	"\n" +
+	"value_type\x18\x01 \x01(\tR\tvalueType\x12\"\n" +
+	"\n" +
+	"old_number\x18\x02 \x01(\x01H\x00R\toldNumber\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"new_number\x18\x03 \x01(\x01H\x01R\tnewNumber\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"old_string\x18\x04 \x01(\tH\x02R\toldString\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"new_string\x18\x05 \x01(\tH\x03R\tnewString\x88\x01\x01B\r\n" +
+	"\v_old_numberB\r\n" +
+	"\v_new_numberB\r\n" +
+	"\v_old_stringB\r\n" +
+	"\v_new_string\"\xaf\x02\n" +
+	"\x0fMessageLogEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1b\n" +
+	"\tthread_id\x18\x02 \x01(\x03R\bthreadId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x03 \x01(\x03R\tsessionId\x12\x14\n" +
+	"\x05level\x18\x04 \x01(\tR\x05level\x12\x1d\n" +
+	"\n" +
+	"time_stamp\x18\x05 \x01(\tR\ttimeStamp\x12\x16\n" +
+	"\x06logger\x18\x06 \x01(\tR\x06logger\x12\x18\n" +
+	"\amessage\x18\a \x01(\tR\amessage\x12\x16\n" +
+	"\x06server\x18\b \x01(\tR\x06server\x12%\n" +
+	"\x0eschema_version\x18\t \x01(\x05R\rschemaVersion\x12*\n" +
+	"\x11future_time_stamp\x18\n" +
+	" \x01(\bR\x0ffutureTimeStamp\"\xee\x02\n" +
+	"\rAuditLogEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1d\n" +
+	"\n" +
+	"time_stamp\x18\x02 \x01(\tR\ttimeStamp\x12\x1b\n" +
+	"\tuser_name\x18\x03 \x01(\tR\buserName\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x1f\n" +
+	"\vobject_type\x18\x05 \x01(\tR\n" +
+	"objectType\x12\x1f\n" +
+	"\vobject_name\x18\x06 \x01(\tR\n" +
+	"objectName\x12B\n" +
+	"\raudit_details\x18\a \x03(\v2\x1d.tm1.blackhawk.v1.AuditDetailR\fauditDetails\x12\x16\n" +
+	"\x06server\x18\b \x01(\tR\x06server\x12%\n" +
+	"\x0eschema_version\x18\t \x01(\x05R\rschemaVersion\x12*\n" +
+	"\x11future_time_stamp\x18\n" +
+	" \x01(\bR\x0ffutureTimeStamp\"~\n" +
+	"\vAuditDetail\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1d\n" +
+	"\n" +
+	"time_stamp\x18\x02 \x01(\tR\ttimeStamp\x12\x1f\n" +
+	"\vobject_type\x18\x03 \x01(\tR\n" +
+	"objectType\x12\x1f\n" +
+	"\vobject_name\x18\x04 \x01(\tR\n" +
+	"objectName*\x87\x01\n" +
+	"\tEventType\x12\x1a\n" +
+	"\x16EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x1a\n" +
+	"\x16EVENT_TYPE_TRANSACTION\x10\x01\x12\x16\n" +
+	"\x12EVENT_TYPE_MESSAGE\x10\x02\x12\x14\n" +
+	"\x10EVENT_TYPE_AUDIT\x10\x03\x12\x14\n" +
+	"\x10EVENT_TYPE_OTHER\x10\x042R\n" +
+	"\x04Feed\x12J\n" +
+	"\tSubscribe\x12\".tm1.blackhawk.v1.SubscribeRequest\x1a\x17.tm1.blackhawk.v1.Event0\x01B/Z-github.com/hubert-heijkers/tm1-blackhawk/feedb\x06proto3"
+
+var (
+	file_feed_feed_proto_rawDescOnce sync.Once
+	file_feed_feed_proto_rawDescData []byte
+)
+
+func file_feed_feed_proto_rawDescGZIP() []byte {
+	file_feed_feed_proto_rawDescOnce.Do(func() {
+		file_feed_feed_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_feed_feed_proto_rawDesc), len(file_feed_feed_proto_rawDesc)))
+	})
+	return file_feed_feed_proto_rawDescData
+}
+
+var file_feed_feed_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_feed_feed_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_feed_feed_proto_goTypes = []any{
+	(EventType)(0),              // 0: tm1.blackhawk.v1.EventType
+	(*SubscribeRequest)(nil),    // 1: tm1.blackhawk.v1.SubscribeRequest
+	(*Event)(nil),               // 2: tm1.blackhawk.v1.Event
+	(*TransactionLogEntry)(nil), // 3: tm1.blackhawk.v1.TransactionLogEntry
+	(*TypedValues)(nil),         // 4: tm1.blackhawk.v1.TypedValues
+	(*MessageLogEntry)(nil),     // 5: tm1.blackhawk.v1.MessageLogEntry
+	(*AuditLogEntry)(nil),       // 6: tm1.blackhawk.v1.AuditLogEntry
+	(*AuditDetail)(nil),         // 7: tm1.blackhawk.v1.AuditDetail
+	nil,                         // 8: tm1.blackhawk.v1.TransactionLogEntry.ElementsEntry
+	nil,                         // 9: tm1.blackhawk.v1.TransactionLogEntry.AttributesEntry
+	(*structpb.Struct)(nil),     // 10: google.protobuf.Struct
+	(*structpb.Value)(nil),      // 11: google.protobuf.Value
+}
+var file_feed_feed_proto_depIdxs = []int32{
+	0,  // 0: tm1.blackhawk.v1.SubscribeRequest.types:type_name -> tm1.blackhawk.v1.EventType
+	3,  // 1: tm1.blackhawk.v1.Event.transaction:type_name -> tm1.blackhawk.v1.TransactionLogEntry
+	5,  // 2: tm1.blackhawk.v1.Event.message:type_name -> tm1.blackhawk.v1.MessageLogEntry
+	6,  // 3: tm1.blackhawk.v1.Event.audit:type_name -> tm1.blackhawk.v1.AuditLogEntry
+	10, // 4: tm1.blackhawk.v1.Event.other:type_name -> google.protobuf.Struct
+	11, // 5: tm1.blackhawk.v1.TransactionLogEntry.old_value:type_name -> google.protobuf.Value
+	11, // 6: tm1.blackhawk.v1.TransactionLogEntry.new_value:type_name -> google.protobuf.Value
+	11, // 7: tm1.blackhawk.v1.TransactionLogEntry.status_message:type_name -> google.protobuf.Value
+	8,  // 8: tm1.blackhawk.v1.TransactionLogEntry.elements:type_name -> tm1.blackhawk.v1.TransactionLogEntry.ElementsEntry
+	9,  // 9: tm1.blackhawk.v1.TransactionLogEntry.attributes:type_name -> tm1.blackhawk.v1.TransactionLogEntry.AttributesEntry
+	4,  // 10: tm1.blackhawk.v1.TransactionLogEntry.values:type_name -> tm1.blackhawk.v1.TypedValues
+	7,  // 11: tm1.blackhawk.v1.AuditLogEntry.audit_details:type_name -> tm1.blackhawk.v1.AuditDetail
+	10, // 12: tm1.blackhawk.v1.TransactionLogEntry.AttributesEntry.value:type_name -> google.protobuf.Struct
+	1,  // 13: tm1.blackhawk.v1.Feed.Subscribe:input_type -> tm1.blackhawk.v1.SubscribeRequest
+	2,  // 14: tm1.blackhawk.v1.Feed.Subscribe:output_type -> tm1.blackhawk.v1.Event
+	14, // [14:15] is the sub-list for method output_type
+	13, // [13:14] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_feed_feed_proto_init() }
+func file_feed_feed_proto_init() {
+	if File_feed_feed_proto != nil {
+		return
+	}
+	file_feed_feed_proto_msgTypes[1].OneofWrappers = []any{
+		(*Event_Transaction)(nil),
+		(*Event_Message)(nil),
+		(*Event_Audit)(nil),
+		(*Event_Other)(nil),
+	}
+	file_feed_feed_proto_msgTypes[3].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_feed_feed_proto_rawDesc), len(file_feed_feed_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_feed_feed_proto_goTypes,
+		DependencyIndexes: file_feed_feed_proto_depIdxs,
+		EnumInfos:         file_feed_feed_proto_enumTypes,
+		MessageInfos:      file_feed_feed_proto_msgTypes,
+	}.Build()
+	File_feed_feed_proto = out.File
+	file_feed_feed_proto_goTypes = nil
+	file_feed_feed_proto_depIdxs = nil
+}
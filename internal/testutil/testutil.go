@@ -0,0 +1,96 @@
+// Package testutil holds the helpers shared by the tests of the packages of the tracker.
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+)
+
+// RecordingSink is a sink keeping the entries written to it, or, if failing, rejecting them. It's
+// safe for concurrent use.
+type RecordingSink struct {
+	Failing bool
+
+	mutex   sync.Mutex
+	entries []interface{}
+}
+
+// Write keeps the entry, unless the sink is failing.
+func (s *RecordingSink) Write(entry interface{}) error {
+	if s.Failing {
+		return errors.New("sink unavailable")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush does nothing.
+func (s *RecordingSink) Flush() error { return nil }
+
+// Close does nothing.
+func (s *RecordingSink) Close() error { return nil }
+
+// Entries returns the entries written to the sink so far.
+func (s *RecordingSink) Entries() []interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]interface{}(nil), s.entries...)
+}
+
+// BufferedReplay queues the records in a buffered sink while the sink it wraps is unavailable, and
+// checks every one of them is replayed, as the same type and with the same content, once the queue
+// is reopened for a sink which is available.
+func BufferedReplay(t *testing.T, records []interface{}) {
+	t.Helper()
+	dir := t.TempDir()
+
+	unavailable, err := sinks.NewBufferedSink(&RecordingSink{Failing: true}, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := 0
+	unavailable.OnError = func(err error) { failures++ }
+	for _, record := range records {
+		if err := unavailable.Write(record); err != nil {
+			t.Fatalf("writing %T: %v", record, err)
+		}
+	}
+	if err := unavailable.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if failures == 0 {
+		t.Fatal("expected the unavailable sink to be reported")
+	}
+
+	sink := new(RecordingSink)
+	available, err := sinks.NewBufferedSink(sink, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := available.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries := sink.Entries()
+	if len(entries) != len(records) {
+		t.Fatalf("replayed %d records, expected %d", len(entries), len(records))
+	}
+	for i, record := range records {
+		got := entries[i]
+		if reflect.TypeOf(got) != reflect.TypeOf(record) {
+			t.Errorf("record %d replayed as %T, expected %T", i, got, record)
+			continue
+		}
+		want, _ := json.Marshal(record)
+		data, _ := json.Marshal(got)
+		if string(data) != string(want) {
+			t.Errorf("record %d replayed as %s, expected %s", i, data, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package notify implements notifiers posting notifications to chat channels using incoming webhooks.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Notification is a message, with its context, as in the cube, user and values involved, posted
+// to a channel.
+type Notification struct {
+	Title  string
+	Text   string
+	Fields map[string]interface{}
+}
+
+// Notifier posts notifications to a channel.
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	URL string
+}
+
+// Notify posts the notification, with its fields as attachment, to Slack.
+func (s *SlackNotifier) Notify(n *Notification) error {
+	fields := []map[string]interface{}{}
+	for _, name := range fieldNames(n) {
+		fields = append(fields, map[string]interface{}{
+			"title": name,
+			"value": fmt.Sprint(n.Fields[name]),
+			"short": true,
+		})
+	}
+	payload := map[string]interface{}{
+		"text": "*" + n.Title + "*\n" + n.Text,
+	}
+	if len(fields) > 0 {
+		payload["attachments"] = []map[string]interface{}{{"fields": fields}}
+	}
+	return postJSON(s.URL, payload)
+}
+
+// TeamsNotifier posts notifications to a Microsoft Teams incoming webhook.
+type TeamsNotifier struct {
+	URL string
+}
+
+// Notify posts the notification, as a message card with its fields as facts, to Teams.
+func (t *TeamsNotifier) Notify(n *Notification) error {
+	facts := []map[string]string{}
+	for _, name := range fieldNames(n) {
+		facts = append(facts, map[string]string{"name": name, "value": fmt.Sprint(n.Fields[name])})
+	}
+	return postJSON(t.URL, map[string]interface{}{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  n.Title,
+		"title":    n.Title,
+		"text":     n.Text,
+		"sections": []map[string]interface{}{{"facts": facts}},
+	})
+}
+
+// MultiNotifier posts notifications using all of its notifiers.
+type MultiNotifier []Notifier
+
+// Notify posts the notification using every notifier, returning the first error, if any.
+func (m MultiNotifier) Notify(n *Notification) error {
+	var err error
+	for _, notifier := range m {
+		if nerr := notifier.Notify(n); err == nil {
+			err = nerr
+		}
+	}
+	return err
+}
+
+// fieldNames returns the names, sorted, of the fields of the notification that have a value.
+func fieldNames(n *Notification) []string {
+	names := []string{}
+	for name, value := range n.Fields {
+		if value != nil && value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// postJSON posts the payload, as JSON, to the URL.
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded with: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package plugins defines the API of the custom processing stages, filters, transformers and sinks,
+// which get loaded from Go plugins at startup, allowing bespoke logic to be added to the tracker
+// without forking it.
+//
+// A plugin is a main package, built using go build -buildmode=plugin, exporting:
+//
+//	var APIVersion = plugins.APIVersion
+//
+//	func New(config map[string]string) (interface{}, error)
+//
+// New creates the stage, configured by the config, which implements any of Filter, Transformer and
+// Sink. It's called once loading the plugin, to find out which of them the stage implements, after
+// which that stage is used the first time the stage is set up, and once more every other time the
+// stage is set up, as in for every sink it applies to, and whenever the sinks are set up again as
+// the configuration got reloaded. Go plugins have to be
+// built using the same version of Go, and of this module, as the tracker loading them.
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// APIVersion is the version of the API, which changes whenever Entry, or any of the interfaces,
+// change in a way plugins have to be adapted to.
+const APIVersion = 1
+
+// Entry is an entry, or a record derived from the entries, like a Gap or an AuditEvent, as passed to
+// the stages, represented by the fields of its JSON representation, as written to the sinks and
+// described by the published schemas. Numbers are represented by a json.Number.
+type Entry struct {
+	// Type is the type of the entry, txn, msg or audit for transaction, message and audit log
+	// entries, or, for any other entry, the value of its Type field, or entry if it doesn't have one.
+	Type   string
+	Fields map[string]interface{}
+}
+
+// Filter decides which entries get written to the sinks.
+type Filter interface {
+	// Match returns true if the entry is to be written to the sinks.
+	Match(entry *Entry) bool
+}
+
+// Transformer reshapes the entries before they get written to the sinks.
+type Transformer interface {
+	// Transform returns the transformed entry, which may be the entry itself, or nil if the entry
+	// is to be dropped.
+	Transform(entry *Entry) (*Entry, error)
+}
+
+// Sink is a destination the entries get written to, following the contract of the sinks of the
+// tracker.
+type Sink interface {
+	// Write hands a single entry to the sink, which is free to buffer entries until Flush is called.
+	Write(entry *Entry) error
+	// Flush makes sure that all entries written so far have been delivered.
+	Flush() error
+	// Close flushes any outstanding entries and releases any resources held by the sink.
+	Close() error
+}
+
+// NewEntry returns the entry as passed to the stages.
+func NewEntry(entry interface{}) (*Entry, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as is, rather than converted to floats, so large IDs don't lose precision
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	e := &Entry{Fields: map[string]interface{}{}}
+	if err := decoder.Decode(&e.Fields); err != nil {
+		return nil, err
+	}
+	switch entry.(type) {
+	case *odata.TransactionLogEntry:
+		e.Type = "txn"
+	case *odata.MessageLogEntry:
+		e.Type = "msg"
+	case *odata.AuditLogEntry:
+		e.Type = "audit"
+	default:
+		e.Type, _ = e.Fields["Type"].(string)
+		if e.Type == "" {
+			e.Type = "entry"
+		}
+	}
+	return e, nil
+}
+
+// Plugin is a plugin loaded from a file, creating its stages, configured by its configuration, when
+// asked to.
+type Plugin struct {
+	Name   string            // Name of the plugin, the name of its file without extension
+	Config map[string]string // Configuration passed to New
+
+	newStage func(config map[string]string) (interface{}, error)
+
+	mutex       sync.Mutex
+	loaded      interface{} // Stage created loading the plugin, if not handed out yet
+	filter      bool        // Whether the stage is a Filter
+	transformer bool        // Whether the stage is a Transformer
+	sink        bool        // Whether the stage is a Sink
+}
+
+// Name returns the name of the plugin loaded from the file at the path.
+func Name(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// Load loads the plugin from the file at the path, which is to export APIVersion, matching the
+// APIVersion of the tracker, and New, and creates its stage, configured by the config, to find out
+// which of the interfaces it implements.
+func Load(path string, config map[string]string) (*Plugin, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("APIVersion")
+	if err != nil {
+		return nil, err
+	}
+	version, ok := symbol.(*int)
+	if !ok {
+		return nil, fmt.Errorf("APIVersion of plugin %s is not an int", path)
+	}
+	if *version != APIVersion {
+		return nil, fmt.Errorf("plugin %s implements API version %d, while version %d is required", path, *version, APIVersion)
+	}
+	symbol, err = p.Lookup("New")
+	if err != nil {
+		return nil, err
+	}
+	newStage, ok := symbol.(func(map[string]string) (interface{}, error))
+	if !ok {
+		return nil, fmt.Errorf("New of plugin %s is not a func(map[string]string) (interface{}, error)", path)
+	}
+
+	l := new(Plugin)
+	l.Name = Name(path)
+	l.Config = config
+	l.newStage = newStage
+	if l.loaded, err = l.newStage(config); err != nil {
+		return nil, fmt.Errorf("plugin %s: %s", l.Name, err)
+	}
+	_, l.filter = l.loaded.(Filter)
+	_, l.transformer = l.loaded.(Transformer)
+	_, l.sink = l.loaded.(Sink)
+	if !l.filter && !l.transformer && !l.sink {
+		return nil, fmt.Errorf("plugin %s implements neither a filter, transformer or sink", l.Name)
+	}
+	return l, nil
+}
+
+// NewFilter creates the stage of the plugin as a Filter, or returns nil if it isn't a filter.
+func (p *Plugin) NewFilter() (Filter, error) {
+	if !p.filter {
+		return nil, nil
+	}
+	stage, err := p.stage()
+	if err != nil {
+		return nil, err
+	}
+	return stage.(Filter), nil
+}
+
+// NewTransformer creates the stage of the plugin as a Transformer, or returns nil if it isn't a
+// transformer.
+func (p *Plugin) NewTransformer() (Transformer, error) {
+	if !p.transformer {
+		return nil, nil
+	}
+	stage, err := p.stage()
+	if err != nil {
+		return nil, err
+	}
+	return stage.(Transformer), nil
+}
+
+// NewSink creates the stage of the plugin as a Sink, or returns nil if it isn't a sink.
+func (p *Plugin) NewSink() (Sink, error) {
+	if !p.sink {
+		return nil, nil
+	}
+	stage, err := p.stage()
+	if err != nil {
+		return nil, err
+	}
+	return stage.(Sink), nil
+}
+
+// stage returns the stage created loading the plugin, if not handed out yet, or creates a new one.
+func (p *Plugin) stage() (interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if stage := p.loaded; stage != nil {
+		p.loaded = nil
+		return stage, nil
+	}
+	stage, err := p.newStage(p.Config)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %s", p.Name, err)
+	}
+	return stage, nil
+}
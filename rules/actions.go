@@ -0,0 +1,255 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/notify"
+)
+
+// Action is fired for every alert raised by the rules referring to it.
+type Action interface {
+	Fire(alert *Alert) error
+}
+
+// ActionConfig is the definition of an action. Which settings apply depends on its type.
+type ActionConfig struct {
+	Type string `yaml:"type"`
+
+	// Slack and Teams: the URL of the incoming webhook.
+	URL string `yaml:"url"`
+
+	// PagerDuty: the routing key of the integration and the severity of the events.
+	RoutingKey string `yaml:"routing_key"`
+	Severity   string `yaml:"severity"`
+
+	// Email: the address, host:port, of the SMTP server, the credentials, if any, and the sender and
+	// recipients of the emails.
+	SMTP     string   `yaml:"smtp"`
+	User     string   `yaml:"user"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+
+	// Process: the name of the TurboIntegrator process, its parameters, by name, each a Go template
+	// executed with the properties of the entry, and the server to execute it on, defaulting to the
+	// server the entry originates from.
+	Process    string            `yaml:"process"`
+	Parameters map[string]string `yaml:"parameters"`
+	Server     string            `yaml:"server"`
+}
+
+// dispatcher fires the actions of the alerts raised, one at a time, in the background, reporting any
+// action failing to fire to onError.
+type dispatcher struct {
+	alerts  chan firing
+	done    chan struct{}
+	onError func(rule string, err error)
+}
+
+// firing is the action to be fired for an alert.
+type firing struct {
+	action Action
+	alert  *Alert
+}
+
+// newDispatcher creates and returns a new dispatcher, firing the actions until it gets closed.
+func newDispatcher(onError func(rule string, err error)) *dispatcher {
+	d := new(dispatcher)
+	d.alerts = make(chan firing, 1000)
+	d.done = make(chan struct{})
+	d.onError = onError
+	go d.fire()
+
+	return d
+}
+
+// raise raises the alert, firing the actions in the background.
+func (d *dispatcher) raise(alert *Alert, actions []Action) {
+	for _, action := range actions {
+		select {
+		case d.alerts <- firing{action: action, alert: alert}:
+		default:
+			d.onError(alert.Rule, fmt.Errorf("too many alerts pending, alert dropped"))
+		}
+	}
+}
+
+// fire fires the actions of the raised alerts, one at a time, until the dispatcher gets closed.
+func (d *dispatcher) fire() {
+	for f := range d.alerts {
+		if err := f.action.Fire(f.alert); err != nil {
+			d.onError(f.alert.Rule, err)
+		}
+	}
+	close(d.done)
+}
+
+// close waits for all pending actions to be fired.
+func (d *dispatcher) close() {
+	close(d.alerts)
+	<-d.done
+}
+
+// ProcessExecutor executes the TurboIntegrator process, passing the parameters, on the named server.
+type ProcessExecutor func(server string, process string, parameters map[string]string) error
+
+// NewAction creates and returns the action defined by the config.
+func NewAction(config ActionConfig) (Action, error) {
+	switch config.Type {
+	case "slack":
+		if config.URL == "" {
+			return nil, fmt.Errorf("slack action requires a url")
+		}
+		return &NotifierAction{&notify.SlackNotifier{URL: config.URL}}, nil
+	case "teams":
+		if config.URL == "" {
+			return nil, fmt.Errorf("teams action requires a url")
+		}
+		return &NotifierAction{&notify.TeamsNotifier{URL: config.URL}}, nil
+	case "pagerduty":
+		if config.RoutingKey == "" {
+			return nil, fmt.Errorf("pagerduty action requires a routing_key")
+		}
+		severity := config.Severity
+		if severity == "" {
+			severity = "warning"
+		}
+		return &PagerDutyAction{RoutingKey: config.RoutingKey, Severity: severity}, nil
+	case "email":
+		if config.SMTP == "" || config.From == "" || len(config.To) == 0 {
+			return nil, fmt.Errorf("email action requires smtp, from and to")
+		}
+		return &EmailAction{Addr: config.SMTP, User: config.User, Password: config.Password, From: config.From, To: config.To}, nil
+	case "process":
+		if config.Process == "" {
+			return nil, fmt.Errorf("process action requires a process")
+		}
+		a := &ProcessAction{Process: config.Process, Server: config.Server, Parameters: map[string]*template.Template{}}
+		for name, value := range config.Parameters {
+			parameter, err := template.New(name).Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s: %s", name, err)
+			}
+			a.Parameters[name] = parameter
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unsupported action type: %s", config.Type)
+	}
+}
+
+// NotifierAction posts the alert, including the cube, user and values of the entry, to a channel
+// using a notifier.
+type NotifierAction struct {
+	Notifier notify.Notifier
+}
+
+// Fire posts the alert to the channel.
+func (a *NotifierAction) Fire(alert *Alert) error {
+	fields := map[string]interface{}{}
+	for _, name := range []string{"Server", "Cube", "User", "Tuple", "OldValue", "NewValue", "StatusMessage", "Level", "Logger", "TimeStamp"} {
+		if value, ok := alert.Entry[name]; ok {
+			fields[name] = value
+		}
+	}
+	return a.Notifier.Notify(&notify.Notification{Title: "TM1 alert: " + alert.Rule, Text: alert.Message, Fields: fields})
+}
+
+// pagerDutyEventsURL is the endpoint of version 2 of the PagerDuty Events API.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyAction triggers a PagerDuty event for the alert.
+type PagerDutyAction struct {
+	RoutingKey string
+	Severity   string
+}
+
+// Fire triggers the PagerDuty event.
+func (a *PagerDutyAction) Fire(alert *Alert) error {
+	return postJSON(pagerDutyEventsURL, map[string]interface{}{
+		"routing_key":  a.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]interface{}{
+			"summary":        alert.Message,
+			"source":         "tm1-blackhawk",
+			"severity":       a.Severity,
+			"component":      alert.Entry["Cube"],
+			"group":          alert.Rule,
+			"custom_details": alert.Entry,
+		},
+	})
+}
+
+// EmailAction sends the message of the alert by email.
+type EmailAction struct {
+	Addr     string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// Fire sends the email.
+func (a *EmailAction) Fire(alert *Alert) error {
+	var auth smtp.Auth
+	if a.User != "" {
+		auth = smtp.PlainAuth("", a.User, a.Password, strings.Split(a.Addr, ":")[0])
+	}
+	msg := "From: " + a.From + "\r\n" +
+		"To: " + strings.Join(a.To, ", ") + "\r\n" +
+		"Subject: TM1 alert: " + alert.Rule + "\r\n" +
+		"\r\n" + alert.Message + "\r\n"
+	return smtp.SendMail(a.Addr, auth, a.From, a.To, []byte(msg))
+}
+
+// ProcessAction executes a TurboIntegrator process, with parameters built from the entry, as in
+// snapshotting a cube after a suspicious write, using the ProcessExecutor set on the engine.
+type ProcessAction struct {
+	Process    string
+	Parameters map[string]*template.Template
+	Server     string
+	Execute    ProcessExecutor
+}
+
+// Fire executes the process and waits for it to complete.
+func (a *ProcessAction) Fire(alert *Alert) error {
+	if a.Execute == nil {
+		return fmt.Errorf("unable to execute process %s, no servers to execute it on", a.Process)
+	}
+	parameters := map[string]string{}
+	for name, parameter := range a.Parameters {
+		var buf bytes.Buffer
+		if err := parameter.Execute(&buf, alert.Entry); err != nil {
+			return fmt.Errorf("parameter %s of process %s: %s", name, a.Process, err)
+		}
+		parameters[name] = buf.String()
+	}
+	server := a.Server
+	if server == "" {
+		server, _ = alert.Entry["Server"].(string)
+	}
+	return a.Execute(server, a.Process, parameters)
+}
+
+// postJSON posts the payload, as JSON, to the URL.
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded with: %s", url, resp.Status)
+	}
+	return nil
+}
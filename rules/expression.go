@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Expression is a condition, written in the same expression language as the conditions of rules,
+// evaluated against the properties of entries, used to filter and route entries.
+type Expression struct {
+	program *vm.Program
+}
+
+// CompileExpression compiles the expression, as in `Cube == "Sales" && Change > 10000`. Next to the
+// properties of the entry, the expression can refer to the entry as a whole as entry, and convert
+// numbers, and numeric strings, using double, as in `double(entry.NewValue) > 10000`.
+func CompileExpression(expression string) (*Expression, error) {
+	program, err := expr.Compile(expression, expr.AsBool(), expr.AllowUndefinedVariables(),
+		expr.Function("double", double, new(func(interface{}) float64)))
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{program: program}, nil
+}
+
+// Match returns true if the expression evaluates to true for the entry. An entry for which the
+// expression can't be evaluated, for example because it doesn't have the properties the expression
+// refers to, doesn't match.
+func (e *Expression) Match(entry interface{}) bool {
+	properties := entryProperties(entry)
+	env := make(map[string]interface{}, len(properties)+1)
+	for key, value := range properties {
+		env[key] = value
+	}
+	env["entry"] = properties
+
+	matched, err := expr.Run(e.program, env)
+	return err == nil && matched == true
+}
+
+// double converts a number, or a string holding a number, into a float.
+func double(params ...interface{}) (interface{}, error) {
+	switch v := params[0].(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return nil, fmt.Errorf("unable to convert %T to double", v)
+	}
+}
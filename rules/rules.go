@@ -0,0 +1,205 @@
+// Package rules implements the alerting engine, evaluating rules against the entries as they are
+// being processed and firing the actions of the rules matching an entry.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the definition of the rules, and the actions they fire, as read from the rules file.
+type Config struct {
+	Actions map[string]ActionConfig `yaml:"actions"`
+	Rules   []RuleConfig            `yaml:"rules"`
+}
+
+// RuleConfig is the definition of a rule. The condition is an expression, evaluated against the
+// properties of an entry, as in `Cube == "Revenue" && abs(Change) > 1000000`. The message is a
+// Go template, executed with the properties of the entry as data.
+type RuleConfig struct {
+	Name      string   `yaml:"name"`
+	Condition string   `yaml:"when"`
+	Message   string   `yaml:"message"`
+	Actions   []string `yaml:"actions"`
+}
+
+// Alert is raised for every entry matching a rule.
+type Alert struct {
+	Rule    string
+	Message string
+	Entry   map[string]interface{}
+}
+
+// rule is a rule, with its condition compiled, ready to be evaluated.
+type rule struct {
+	name      string
+	condition *vm.Program
+	message   *template.Template
+	actions   []Action
+}
+
+// Engine evaluates the rules against every entry passed to it, firing the actions of the rules
+// matching the entry. Actions are fired in the background, so evaluating entries never waits for
+// them. The engine is safe for concurrent use.
+type Engine struct {
+	rules      []*rule
+	dispatcher *dispatcher
+
+	// OnError, if set, is called for every action that failed to fire.
+	OnError func(rule string, err error)
+	// OnAlert, if set, is called for every alert raised, before its actions are fired.
+	OnAlert func(alert *Alert)
+}
+
+// LoadEngine reads the rules file at the given path and returns the engine evaluating its rules.
+func LoadEngine(path string) (*Engine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %s", path, err)
+	}
+	return NewEngine(config)
+}
+
+// NewEngine creates and returns a new Engine evaluating the rules as defined by the config.
+func NewEngine(config Config) (*Engine, error) {
+	actions := map[string]Action{}
+	for name, actionConfig := range config.Actions {
+		action, err := NewAction(actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("action %s: %s", name, err)
+		}
+		actions[name] = action
+	}
+
+	e := new(Engine)
+	for _, ruleConfig := range config.Rules {
+		r := &rule{name: ruleConfig.Name}
+		var err error
+		r.condition, err = expr.Compile(ruleConfig.Condition, expr.AsBool(), expr.AllowUndefinedVariables())
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %s", ruleConfig.Name, err)
+		}
+		if ruleConfig.Message != "" {
+			r.message, err = template.New(ruleConfig.Name).Parse(ruleConfig.Message)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %s", ruleConfig.Name, err)
+			}
+		}
+		for _, name := range ruleConfig.Actions {
+			action, ok := actions[name]
+			if !ok {
+				return nil, fmt.Errorf("rule %s: unknown action %s", ruleConfig.Name, name)
+			}
+			r.actions = append(r.actions, action)
+		}
+		e.rules = append(e.rules, r)
+	}
+	e.dispatcher = newDispatcher(e.fail)
+
+	return e, nil
+}
+
+// Evaluate evaluates all rules against the entry and raises an alert for every rule it matches. An
+// entry for which the condition of a rule can't be evaluated, for example because it doesn't have
+// the properties the condition refers to, doesn't match that rule.
+func (e *Engine) Evaluate(entry interface{}) {
+	var env map[string]interface{}
+	for _, r := range e.rules {
+		if env == nil {
+			env = entryProperties(entry)
+		}
+		matched, err := expr.Run(r.condition, env)
+		if err != nil || matched != true {
+			continue
+		}
+
+		e.raise(&Alert{Rule: r.name, Message: r.render(env), Entry: env}, r.actions)
+	}
+}
+
+// raise raises the alert, firing the actions in the background.
+func (e *Engine) raise(alert *Alert, actions []Action) {
+	if e.OnAlert != nil {
+		e.OnAlert(alert)
+	}
+	e.dispatcher.raise(alert, actions)
+}
+
+// Close waits for all pending actions to be fired.
+func (e *Engine) Close() {
+	e.dispatcher.close()
+}
+
+// SetProcessExecutor sets the executor used by the process actions to execute their processes. It
+// has to be set before any entries are evaluated.
+func (e *Engine) SetProcessExecutor(execute ProcessExecutor) {
+	for _, r := range e.rules {
+		for _, action := range r.actions {
+			if a, ok := action.(*ProcessAction); ok {
+				a.Execute = execute
+			}
+		}
+	}
+}
+
+// fail reports the error for the rule.
+func (e *Engine) fail(rule string, err error) {
+	if e.OnError != nil {
+		e.OnError(rule, err)
+	}
+}
+
+// render returns the message of the alert raised by the rule for the entry.
+func (r *rule) render(env map[string]interface{}) string {
+	if r.message == nil {
+		data, _ := json.Marshal(env)
+		return fmt.Sprintf("Rule %s matched: %s", r.name, data)
+	}
+	var buf bytes.Buffer
+	if err := r.message.Execute(&buf, env); err != nil {
+		return fmt.Sprintf("Rule %s matched, but its message failed to render: %s", r.name, err)
+	}
+	return buf.String()
+}
+
+// entryProperties returns the properties of the entry, which conditions and messages refer to. For
+// entries having both an old and a new numeric value the difference is available as Change.
+func entryProperties(entry interface{}) map[string]interface{} {
+	env, ok := entry.(map[string]interface{})
+	if !ok {
+		env = map[string]interface{}{}
+		data, _ := json.Marshal(entry)
+		json.Unmarshal(data, &env)
+	} else {
+		copied := make(map[string]interface{}, len(env)+1)
+		for key, value := range env {
+			copied[key] = value
+		}
+		env = copied
+	}
+
+	if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok {
+		if oldValue, newValue, ok := txnLogEntry.NumericValues(); ok {
+			env["Change"] = newValue - oldValue
+		}
+		return env
+	}
+	oldValue, oldOk := env["OldValue"].(float64)
+	newValue, newOk := env["NewValue"].(float64)
+	if oldOk && newOk {
+		env["Change"] = newValue - oldValue
+	}
+	return env
+}
@@ -0,0 +1,298 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v3"
+)
+
+// ScriptConfig is the definition of a script, and the actions it fires, as read from a script file.
+// The actions are defined as in the rules file. The timeout, as in 500ms, is the time the script may
+// run for every entry, DefaultScriptTimeout if not specified.
+type ScriptConfig struct {
+	Actions map[string]ActionConfig `yaml:"actions"`
+	Script  string                  `yaml:"script"`
+	Timeout string                  `yaml:"timeout"`
+}
+
+// DefaultScriptTimeout is the time a script may run for every entry, unless specified otherwise.
+const DefaultScriptTimeout = time.Second
+
+// Script is a Lua script run against every entry, allowing the entry to be inspected, annotated,
+// changed or dropped, and actions to be fired. The entry is passed as the table entry, holding the
+// properties of the entry, plus Change, of which any field set, or set to nil, by the script is set
+// on, or removed from, the entry. The script returns false to drop the entry, or nothing, or true, to
+// keep it. Calling fire, as in fire("ops", "Large change in " .. entry.Cube), fires the action, as an
+// alert raised by the rule named script, in the background. Only the base, string, table and math
+// libraries are available, and globals set by the script are kept from one entry to the next. A
+// script running for longer than its timeout fails for the entry. The script is safe for concurrent
+// use, entries being run one at a time.
+type Script struct {
+	mutex      sync.Mutex
+	state      *lua.LState
+	chunk      *lua.LFunction
+	timeout    time.Duration
+	actions    map[string]Action
+	dispatcher *dispatcher // Firing the actions
+	onError    func(err error)
+
+	properties map[string]interface{} // Properties of the entry being run, passed with the alerts fired
+}
+
+// scriptLibraries are the Lua libraries available to scripts, leaving out those accessing the file
+// system, the operating system or loading other code.
+var scriptLibraries = map[string]lua.LGFunction{
+	lua.BaseLibName:   lua.OpenBase,
+	lua.TabLibName:    lua.OpenTable,
+	lua.StringLibName: lua.OpenString,
+	lua.MathLibName:   lua.OpenMath,
+}
+
+// LoadScript reads the script file at the given path and returns the script defined by it.
+func LoadScript(path string) (*Script, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ScriptConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid script file %s: %s", path, err)
+	}
+	return NewScript(config)
+}
+
+// NewScript creates and returns a new Script as defined by the config.
+func NewScript(config ScriptConfig) (*Script, error) {
+	s := new(Script)
+	s.timeout = DefaultScriptTimeout
+	if config.Timeout != "" {
+		var err error
+		if s.timeout, err = time.ParseDuration(config.Timeout); err != nil || s.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %s", config.Timeout)
+		}
+	}
+	s.actions = map[string]Action{}
+	for name, actionConfig := range config.Actions {
+		action, err := NewAction(actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("action %s: %s", name, err)
+		}
+		s.actions[name] = action
+	}
+
+	s.state = lua.NewState(lua.Options{SkipOpenLibs: true})
+	for name, open := range scriptLibraries {
+		if err := s.state.CallByParam(lua.P{Fn: s.state.NewFunction(open), Protect: true}, lua.LString(name)); err != nil {
+			s.state.Close()
+			return nil, err
+		}
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		s.state.SetGlobal(name, lua.LNil)
+	}
+	s.state.SetGlobal("fire", s.state.NewFunction(s.fire))
+	var err error
+	if s.chunk, err = s.state.LoadString(config.Script); err != nil {
+		s.state.Close()
+		return nil, fmt.Errorf("invalid script: %s", err)
+	}
+	s.dispatcher = newDispatcher(func(rule string, err error) {
+		if s.onError != nil {
+			s.onError(err)
+		}
+	})
+
+	return s, nil
+}
+
+// Run runs the script against the entry, returning the entry, represented by a map of its fields,
+// with the fields set by the script, or nil if the script dropped it.
+func (s *Script) Run(entry interface{}) (map[string]interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.properties = entryProperties(entry)
+	table := s.state.NewTable()
+	values := make(map[string]lua.LValue, len(s.properties))
+	for key, value := range s.properties {
+		values[key] = toLua(s.state, value)
+		table.RawSetString(key, values[key])
+	}
+	s.state.SetGlobal("entry", table)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	s.state.SetContext(ctx)
+	err := s.state.CallByParam(lua.P{Fn: s.chunk, NRet: 1, Protect: true})
+	s.state.RemoveContext()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("script failed: timed out after %s", s.timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("script failed: %s", err)
+	}
+	result := s.state.Get(-1)
+	s.state.Pop(1)
+	switch result {
+	case lua.LNil, lua.LTrue:
+	case lua.LFalse:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("script returned %s, rather than a boolean or nothing", result.Type())
+	}
+
+	// Numbers are kept as is, rather than converted to Lua numbers and back, so large IDs don't lose
+	// precision, unless set by the script
+	fields, ok := entry.(map[string]interface{})
+	if ok {
+		copied := make(map[string]interface{}, len(fields))
+		for key, value := range fields {
+			copied[key] = value
+		}
+		fields = copied
+	} else {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range values {
+		current := table.RawGetString(key)
+		if current == lua.LNil && value != lua.LNil {
+			delete(fields, key)
+		}
+		// Tables, as in the tuple, can be changed in place
+		if current == value && value.Type() == lua.LTTable && !unchanged(s.properties[key], value) {
+			fields[key] = fromLua(value)
+		}
+	}
+	table.ForEach(func(key lua.LValue, value lua.LValue) {
+		if name, ok := key.(lua.LString); ok && value != values[string(name)] {
+			fields[string(name)] = fromLua(value)
+		}
+	})
+	return fields, nil
+}
+
+// fire fires the action, named by the first argument, with the message, passed as the second, for
+// the entry being run.
+func (s *Script) fire(state *lua.LState) int {
+	name := state.CheckString(1)
+	message := state.CheckString(2)
+	action, ok := s.actions[name]
+	if !ok {
+		state.RaiseError("unknown action %s", name)
+		return 0
+	}
+	s.dispatcher.raise(&Alert{Rule: "script", Message: message, Entry: s.properties}, []Action{action})
+	state.Push(lua.LTrue)
+	return 1
+}
+
+// toLua returns the value, as decoded from JSON, as a Lua value.
+func toLua(state *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		table := state.CreateTable(len(v), 0)
+		for _, element := range v {
+			table.Append(toLua(state, element))
+		}
+		return table
+	case map[string]interface{}:
+		table := state.CreateTable(0, len(v))
+		for key, element := range v {
+			table.RawSetString(key, toLua(state, element))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua returns the Lua value as the value it would be decoded as from JSON, a table holding a
+// sequence being an array.
+func fromLua(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.Len(); n > 0 {
+			elements := make([]interface{}, n)
+			for i := range elements {
+				elements[i] = fromLua(v.RawGetInt(i + 1))
+			}
+			return elements
+		}
+		fields := map[string]interface{}{}
+		v.ForEach(func(key lua.LValue, element lua.LValue) {
+			fields[key.String()] = fromLua(element)
+		})
+		return fields
+	default:
+		return nil
+	}
+}
+
+// unchanged returns whether the Lua value still holds the value it was created from, an empty table
+// holding an empty array as well.
+func unchanged(original interface{}, value lua.LValue) bool {
+	if elements, ok := original.([]interface{}); ok && len(elements) == 0 {
+		if table, ok := value.(*lua.LTable); ok {
+			key, _ := table.Next(lua.LNil)
+			return key == lua.LNil
+		}
+	}
+	return reflect.DeepEqual(original, fromLua(value))
+}
+
+// SetOnError sets the function called for every action that failed to fire.
+func (s *Script) SetOnError(onError func(err error)) {
+	s.onError = onError
+}
+
+// SetProcessExecutor sets the executor used by the process actions to execute their processes. It
+// has to be set before the script is run.
+func (s *Script) SetProcessExecutor(execute ProcessExecutor) {
+	for _, action := range s.actions {
+		if a, ok := action.(*ProcessAction); ok {
+			a.Execute = execute
+		}
+	}
+}
+
+// Close waits for all pending actions to be fired.
+func (s *Script) Close() {
+	s.dispatcher.close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state.Close()
+}
@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func newTestScript(t *testing.T, script string) *Script {
+	t.Helper()
+	s, err := NewScript(ScriptConfig{Script: script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestScriptChangesEntries(t *testing.T) {
+	s := newTestScript(t, `
+		if entry.Cube == "}Stats" then
+			return false
+		end
+		entry.Region = "EMEA"
+		entry.Big = math.abs(entry.Change) > 100
+		entry.User = nil
+		entry.Tuple[2] = string.upper(entry.Tuple[2])
+	`)
+
+	fields, err := s.Run(&odata.TransactionLogEntry{ID: 9007199254740993, User: "Admin", Cube: "Sales",
+		Tuple: []string{"2024", "jan"}, OldValue: 100.0, NewValue: 250.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["Region"] != "EMEA" || fields["Big"] != true {
+		t.Errorf("expected the entry to be annotated, got %v", fields)
+	}
+	if _, ok := fields["User"]; ok {
+		t.Errorf("expected User to be removed, got %v", fields["User"])
+	}
+	if !reflect.DeepEqual(fields["Tuple"], []interface{}{"2024", "JAN"}) {
+		t.Errorf("expected the tuple to be changed, got %v", fields["Tuple"])
+	}
+	// Fields left alone are kept as is, numbers without losing precision
+	if fields["ID"] != json.Number("9007199254740993") {
+		t.Errorf("expected the ID to be kept, got %v", fields["ID"])
+	}
+	if value, ok := fields["StatusMessage"]; !ok || value != nil {
+		t.Errorf("expected StatusMessage to be kept, got %v", fields)
+	}
+	if _, ok := fields["Change"]; ok {
+		t.Errorf("expected Change not to be added, got %v", fields["Change"])
+	}
+
+	fields, err = s.Run(map[string]interface{}{"Cube": "}Stats", "Change": 1.0})
+	if err != nil || fields != nil {
+		t.Errorf("expected the entry to be dropped, got %v, %v", fields, err)
+	}
+}
+
+func TestScriptKeepsGlobals(t *testing.T) {
+	s := newTestScript(t, `
+		count = (count or 0) + 1
+		entry.Count = count
+		entry.Tags = {}
+	`)
+	for i := 1; i <= 2; i++ {
+		fields, err := s.Run(map[string]interface{}{"Tags": []interface{}{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields["Count"] != float64(i) {
+			t.Errorf("got count %v, expected %d", fields["Count"], i)
+		}
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	if _, err := NewScript(ScriptConfig{Script: "entry.Cube ="}); err == nil {
+		t.Error("expected an invalid script to be rejected")
+	}
+	for name, script := range map[string]string{
+		"unknown action": `fire("ops", "message")`,
+		"runtime error":  `error("failed")`,
+		"result":         `return "keep"`,
+		"sandbox":        `return os.exit(1)`,
+	} {
+		if _, err := newTestScript(t, script).Run(map[string]interface{}{}); err == nil {
+			t.Errorf("%s: expected the script to fail", name)
+		}
+	}
+}
+
+func TestScriptExample(t *testing.T) {
+	s, err := LoadScript("../script.yaml.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	fields, err := s.Run(&odata.TransactionLogEntry{Cube: "Sales", Tuple: []string{"2024", "Jan"}, OldValue: 1.0, NewValue: 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["Region"] != "EMEA" {
+		t.Errorf("expected the entry to be annotated, got %v", fields)
+	}
+}
+
+func TestScriptTimesOut(t *testing.T) {
+	s, err := NewScript(ScriptConfig{Timeout: "50ms", Script: `
+		if entry.Loop then
+			while true do end
+		end
+		entry.Done = true
+	`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	if _, err := s.Run(map[string]interface{}{"Loop": true}); err == nil {
+		t.Fatal("expected a script running for longer than its timeout to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("script ran for %s, expected it to be stopped after 50ms", elapsed)
+	}
+	// The script keeps running for the entries thereafter
+	fields, err := s.Run(map[string]interface{}{"Loop": false})
+	if err != nil || fields["Done"] != true {
+		t.Errorf("expected the next entry to be run, got %v, %v", fields, err)
+	}
+
+	if _, err := NewScript(ScriptConfig{Timeout: "soon"}); err == nil {
+		t.Error("expected an invalid timeout to be rejected")
+	}
+}
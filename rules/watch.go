@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"text/template"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// WatchListConfig is the definition of the watches, and the actions they fire, as read from the
+// watch list file. The actions are defined as in the rules file.
+type WatchListConfig struct {
+	Actions map[string]ActionConfig `yaml:"actions"`
+	Watches []WatchConfig           `yaml:"watches"`
+}
+
+// WatchConfig is the definition of a watch on the cells of a cube identified by the tuple, holding
+// an element per dimension, in the order of the dimensions of the cube. An empty element, or *,
+// matches any element of its dimension, as do the dimensions beyond the end of the tuple, allowing
+// partial tuples to watch a slice of the cube. Elements are matched ignoring case and spaces, as
+// TM1 does. Only changes of numeric values by at least the threshold, if specified, match. The
+// message is a Go template, executed with the properties of the entry as data.
+type WatchConfig struct {
+	Name      string   `yaml:"name"`
+	Cube      string   `yaml:"cube"`
+	Tuple     []string `yaml:"tuple"`
+	Threshold float64  `yaml:"threshold"`
+	Message   string   `yaml:"message"`
+	Actions   []string `yaml:"actions"`
+}
+
+// CellChangeEvent is a change to a watched cell, derived from the transaction log entry that wrote it.
+type CellChangeEvent struct {
+	Type      string      `json:"Type"` // Always CellChangeEvent
+	Watch     string      `json:"Watch"`
+	Server    string      `json:"Server,omitempty"`
+	TimeStamp string      `json:"TimeStamp"`
+	User      string      `json:"User"`
+	Cube      string      `json:"Cube"`
+	Tuple     []string    `json:"Tuple"`
+	OldValue  interface{} `json:"OldValue"`
+	NewValue  interface{} `json:"NewValue"`
+	Change    *float64    `json:"Change,omitempty"` // If both values are numeric
+	Message   string      `json:"Message"`
+}
+
+// watch is a watch, with its tuple normalized, ready to be matched.
+type watch struct {
+	name      string
+	cube      string
+	tuple     []string
+	threshold float64
+	message   *template.Template
+	actions   []Action
+}
+
+// WatchList matches every transaction log entry against the watches, deriving a cell change event
+// from the entry for every watch it matches and firing the actions of the watch, as an alert raised
+// by the rule named after the watch, in the background. The watch list is safe for concurrent use.
+type WatchList struct {
+	watches []*watch
+	engine  *Engine // Firing the actions
+}
+
+// LoadWatchList reads the watch list file at the given path and returns the watch list defined by it.
+func LoadWatchList(path string) (*WatchList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config WatchListConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid watch list file %s: %s", path, err)
+	}
+	return NewWatchList(config)
+}
+
+// NewWatchList creates and returns a new WatchList as defined by the config.
+func NewWatchList(config WatchListConfig) (*WatchList, error) {
+	actions := map[string]Action{}
+	for name, actionConfig := range config.Actions {
+		action, err := NewAction(actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("action %s: %s", name, err)
+		}
+		actions[name] = action
+	}
+
+	l := new(WatchList)
+	for _, watchConfig := range config.Watches {
+		if watchConfig.Cube == "" {
+			return nil, fmt.Errorf("watch %s: no cube specified", watchConfig.Name)
+		}
+		w := &watch{name: watchConfig.Name, cube: normalizeName(watchConfig.Cube), threshold: watchConfig.Threshold}
+		for _, element := range watchConfig.Tuple {
+			w.tuple = append(w.tuple, normalizeName(element))
+		}
+		if watchConfig.Message != "" {
+			var err error
+			w.message, err = template.New(watchConfig.Name).Parse(watchConfig.Message)
+			if err != nil {
+				return nil, fmt.Errorf("watch %s: %s", watchConfig.Name, err)
+			}
+		}
+		for _, name := range watchConfig.Actions {
+			action, ok := actions[name]
+			if !ok {
+				return nil, fmt.Errorf("watch %s: unknown action %s", watchConfig.Name, name)
+			}
+			w.actions = append(w.actions, action)
+		}
+		l.watches = append(l.watches, w)
+	}
+	var err error
+	if l.engine, err = NewEngine(Config{}); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Match matches the entry against the watches, returning a cell change event for every watch it
+// matches and firing the actions of those.
+func (l *WatchList) Match(entry *odata.TransactionLogEntry) []*CellChangeEvent {
+	var events []*CellChangeEvent
+	var env map[string]interface{}
+	for _, w := range l.watches {
+		if !w.matches(entry) {
+			continue
+		}
+		if env == nil {
+			env = entryProperties(entry)
+		}
+		event := &CellChangeEvent{
+			Type:      "CellChangeEvent",
+			Watch:     w.name,
+			Server:    entry.Server,
+			TimeStamp: entry.TimeStamp,
+			User:      entry.User,
+			Cube:      entry.Cube,
+			Tuple:     entry.Tuple,
+			OldValue:  entry.OldValue,
+			NewValue:  entry.NewValue,
+			Message:   w.render(env),
+		}
+		if oldValue, newValue, ok := entry.NumericValues(); ok {
+			change := newValue - oldValue
+			event.Change = &change
+		}
+		events = append(events, event)
+		l.engine.raise(&Alert{Rule: w.name, Message: event.Message, Entry: env}, w.actions)
+	}
+	return events
+}
+
+// SetOnError sets the function called for every action that failed to fire, by the watch firing it.
+func (l *WatchList) SetOnError(onError func(watch string, err error)) {
+	l.engine.OnError = onError
+}
+
+// SetProcessExecutor sets the executor used by the process actions to execute their processes. It
+// has to be set before any entries are matched.
+func (l *WatchList) SetProcessExecutor(execute ProcessExecutor) {
+	for _, w := range l.watches {
+		for _, action := range w.actions {
+			if a, ok := action.(*ProcessAction); ok {
+				a.Execute = execute
+			}
+		}
+	}
+}
+
+// Close waits for all pending actions to be fired.
+func (l *WatchList) Close() {
+	l.engine.Close()
+}
+
+// matches returns true if the entry wrote a cell watched by the watch.
+func (w *watch) matches(entry *odata.TransactionLogEntry) bool {
+	if normalizeName(entry.Cube) != w.cube || len(w.tuple) > len(entry.Tuple) {
+		return false
+	}
+	for i, element := range w.tuple {
+		if element != "" && element != "*" && element != normalizeName(entry.Tuple[i]) {
+			return false
+		}
+	}
+	if w.threshold > 0 {
+		oldValue, newValue, ok := entry.NumericValues()
+		if !ok || math.Abs(newValue-oldValue) < w.threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// render returns the message of the event derived from the entry.
+func (w *watch) render(env map[string]interface{}) string {
+	if w.message == nil {
+		return fmt.Sprintf("%v changed %v in %v from %v to %v", env["User"], env["Tuple"], env["Cube"], env["OldValue"], env["NewValue"])
+	}
+	var buf bytes.Buffer
+	if err := w.message.Execute(&buf, env); err != nil {
+		return fmt.Sprintf("Watch %s matched, but its message failed to render: %s", w.name, err)
+	}
+	return buf.String()
+}
+
+// normalizeName returns the name, of a cube or element, in lower case and without spaces, as TM1
+// compares names.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", ""))
+}
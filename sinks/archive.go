@@ -0,0 +1,215 @@
+package sinks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ObjectStore is an object storage service, like AWS S3, Azure Blob Storage or Google Cloud
+// Storage, archived segments are uploaded to.
+type ObjectStore interface {
+	// Upload uploads the file, of the given size, as the object with the given key.
+	Upload(key string, file *os.File, size int64, contentType string) error
+}
+
+// ArchiveConfig defines how an ArchiveSink archives entries.
+type ArchiveConfig struct {
+	// Store is the object store the segments are uploaded to.
+	Store ObjectStore
+	// Format is the format of the segments, jsonl, for gzip compressed JSON lines holding entries of
+	// any type, or parquet, for Parquet files, partitioned by cube and date, holding transaction log
+	// entries.
+	Format string
+	// Dir is the directory the segments are written into before they are uploaded.
+	Dir string
+	// KeyLayout is the template of the key of every uploaded segment, in which {dir} is replaced by
+	// the partition of the segment, if any, {name} by its file name, {host} by the host name, and any
+	// Go time layout, like {2006/01/02}, by the time the segment got completed. Defaults to
+	// tm1-blackhawk/{2006/01/02}/{name} for jsonl and tm1-blackhawk/{dir}/{20060102T150405}-{name}
+	// for parquet segments, whose names are only unique within the staging directory.
+	KeyLayout string
+	// MaxSegmentSize, for jsonl, or MaxSegmentRows, for parquet, and MaxSegmentAge, are the size, the
+	// number of rows, respectively the time since it got started, after which a segment is completed
+	// and uploaded. Default to 128MB, 1000000 rows and 1 hour.
+	MaxSegmentSize int64
+	MaxSegmentRows int
+	MaxSegmentAge  time.Duration
+}
+
+// ArchiveSink archives entries, in an object store, for cheap long-term retention. Entries are
+// written into segments in a local staging directory, which are uploaded, and removed, once they
+// are completed. Segments failing to upload remain in the staging directory, and are uploaded on
+// any subsequent flush, even after a restart.
+type ArchiveSink struct {
+	config ArchiveConfig
+	sink   Sink
+	file   *FileSink
+	host   string
+}
+
+// NewArchiveSink creates and returns a new ArchiveSink.
+func NewArchiveSink(config ArchiveConfig) (*ArchiveSink, error) {
+	if config.MaxSegmentSize <= 0 {
+		config.MaxSegmentSize = 128 * 1024 * 1024
+	}
+	if config.MaxSegmentAge <= 0 {
+		config.MaxSegmentAge = time.Hour
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := new(ArchiveSink)
+	s.host, _ = os.Hostname()
+	switch config.Format {
+	case "", "jsonl":
+		if config.KeyLayout == "" {
+			config.KeyLayout = "tm1-blackhawk/{2006/01/02}/{name}"
+		}
+		file, err := NewFileSink(filepath.Join(config.Dir, "entries.jsonl"), FileRotation{MaxSize: config.MaxSegmentSize, MaxAge: config.MaxSegmentAge, Compress: true})
+		if err != nil {
+			return nil, err
+		}
+		s.file, s.sink = file, file
+	case "parquet":
+		if config.KeyLayout == "" {
+			config.KeyLayout = "tm1-blackhawk/{dir}/{20060102T150405}-{name}"
+		}
+		s.sink = NewParquetSink(ParquetConfig{Dir: config.Dir, MaxFileRows: config.MaxSegmentRows, MaxFileAge: config.MaxSegmentAge})
+	default:
+		return nil, fmt.Errorf("unknown archive format: %s", config.Format)
+	}
+	s.config = config
+
+	return s, nil
+}
+
+// Write writes the entry to the current segment.
+func (s *ArchiveSink) Write(entry interface{}) error {
+	return s.sink.Write(entry)
+}
+
+// Flush flushes the current segments, completing those which reached their limits, and uploads
+// all completed segments.
+func (s *ArchiveSink) Flush() error {
+	// The file sink only rotates on writing, so complete a segment which grew old in the meantime
+	if s.file != nil && s.file.rotationDue() {
+		if err := s.file.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := s.sink.Flush(); err != nil {
+		return err
+	}
+	return s.upload()
+}
+
+// upload uploads, and removes, all completed segments in the staging directory.
+func (s *ArchiveSink) upload() error {
+	var segments []string
+	err := filepath.Walk(s.config.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Segments still being written are hidden, or, for jsonl, the file being appended to
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") || info.Name() == "entries.jsonl" {
+			return nil
+		}
+		segments = append(segments, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if err := s.uploadSegment(segment); err != nil {
+			return fmt.Errorf("unable to upload %s: %w", segment, err)
+		}
+	}
+	return nil
+}
+
+// uploadSegment uploads the segment and removes it once uploaded.
+func (s *ArchiveSink) uploadSegment(segment string) error {
+	file, err := os.Open(segment)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/x-ndjson"
+	if strings.HasSuffix(segment, ".gz") {
+		contentType = "application/gzip"
+	} else if strings.HasSuffix(segment, ".parquet") {
+		contentType = "application/vnd.apache.parquet"
+	}
+	if err := s.config.Store.Upload(s.key(segment, info.ModTime()), file, info.Size(), contentType); err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(segment)
+}
+
+// key returns the key the segment, completed at the given time, is uploaded as.
+func (s *ArchiveSink) key(segment string, completed time.Time) string {
+	rel, _ := filepath.Rel(s.config.Dir, segment)
+	dir, name := path.Split(filepath.ToSlash(rel))
+	key := indexPatternPlaceholder.ReplaceAllStringFunc(s.config.KeyLayout, func(placeholder string) string {
+		switch layout := placeholder[1 : len(placeholder)-1]; layout {
+		case "dir":
+			return dir
+		case "name":
+			return name
+		case "host":
+			return s.host
+		default:
+			return completed.UTC().Format(layout)
+		}
+	})
+	// Remove the empty levels left by an empty {dir}
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+// Close closes the current segments, completing the parquet segments, and uploads all completed
+// segments. The current jsonl segment is continued after a restart.
+func (s *ArchiveSink) Close() error {
+	if err := s.sink.Close(); err != nil {
+		return err
+	}
+	return s.upload()
+}
+
+// putObject sends the file, of the given size, as the body of the request, with the given headers,
+// returning an error unless the object got created.
+func putObject(client *http.Client, method string, url string, header http.Header, file *os.File, size int64) error {
+	req, err := http.NewRequest(method, url, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("object store responded with: %s\r\n%s", resp.Status, msg)
+	}
+	return nil
+}
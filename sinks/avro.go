@@ -0,0 +1,488 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// avroNamespace is the namespace of the records of the schemas derived from the types of the entries.
+const avroNamespace = "tm1.blackhawk"
+
+// avroEmptyFingerprint is the initial value, and polynomial, of the CRC-64-AVRO fingerprint.
+const avroEmptyFingerprint = 0xc15d213aa4d7a795
+
+// avroFingerprintTable is the lookup table used to compute CRC-64-AVRO fingerprints.
+var avroFingerprintTable = func() (table [256]uint64) {
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (avroEmptyFingerprint & -(fp & 1))
+		}
+		table[i] = fp
+	}
+	return table
+}()
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// AvroEncoder encodes entries as Avro binary, using a schema derived from the type of the entry:
+// a record holding the fields of its JSON encoding, with entries of any other type than a struct,
+// as written by a transform, encoded as a map. Fields holding a value of any type are encoded as a
+// union of null, boolean, long, double and string, any other values as their JSON encoding.
+//
+// Without a schema registry entries are encoded using the Avro single object encoding, identifying
+// the schema by its fingerprint. With a schema registry the schema is registered under the subject
+// <prefix>-<record name>, as in tm1.txn-tm1.blackhawk.TransactionLogEntry, and entries are encoded
+// using the Confluent wire format, identifying the schema by its ID.
+type AvroEncoder struct {
+	registry *SchemaRegistry // nil if none
+	prefix   string
+
+	mu      sync.Mutex
+	schemas map[reflect.Type]*avroSchema
+}
+
+// avroSchema is the schema derived from a type of entry, with the header identifying it in every
+// encoded entry, once known.
+type avroSchema struct {
+	name   string // Full name of the record, empty if not a record
+	schema string // Parsing canonical form of the schema
+	header []byte
+	encode avroEncodeFunc
+}
+
+// avroEncodeFunc appends the Avro binary encoding of the value to the buffer.
+type avroEncodeFunc func(buf *bytes.Buffer, v reflect.Value)
+
+// Schemas, as marshalled into their parsing canonical form, their fields in the prescribed order.
+type avroRecord struct {
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Fields []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name string      `json:"name"`
+	Type interface{} `json:"type"`
+}
+
+type avroArray struct {
+	Type  string      `json:"type"`
+	Items interface{} `json:"items"`
+}
+
+type avroMap struct {
+	Type   string      `json:"type"`
+	Values interface{} `json:"values"`
+}
+
+// avroAnyValue is the union values of any type are encoded as.
+var avroAnyValue = []interface{}{"null", "boolean", "long", "double", "string"}
+
+// NewAvroEncoder creates and returns a new AvroEncoder registering its schemas with the schema
+// registry at the URL, if any, using the prefix, typically the topic, for the subjects.
+func NewAvroEncoder(registryURL string, prefix string) *AvroEncoder {
+	e := new(AvroEncoder)
+	if registryURL != "" {
+		e.registry = NewSchemaRegistry(registryURL)
+	}
+	e.prefix = prefix
+	e.schemas = map[reflect.Type]*avroSchema{}
+
+	return e
+}
+
+// Encode returns the entry encoded as Avro binary, preceded by the header identifying its schema,
+// registering the schema if it's the first entry of its type.
+func (e *AvroEncoder) Encode(entry interface{}) ([]byte, error) {
+	v := reflect.ValueOf(entry)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Ptr {
+		return nil, &PermanentError{Err: fmt.Errorf("unable to encode a nil entry as Avro")}
+	}
+
+	e.mu.Lock()
+	schema, err := e.schema(v.Type())
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(schema.header)
+	schema.encode(&buf, v)
+	return buf.Bytes(), nil
+}
+
+// ContentType returns the media type of Avro binary encoded entries.
+func (e *AvroEncoder) ContentType() string {
+	return "avro/binary"
+}
+
+// schema returns the schema of the type of entry, deriving, and registering, it the first time.
+func (e *AvroEncoder) schema(t reflect.Type) (*avroSchema, error) {
+	schema, ok := e.schemas[t]
+	if ok && schema.header != nil {
+		return schema, nil
+	}
+	if !ok {
+		var err error
+		if schema, err = newAvroSchema(t); err != nil {
+			return nil, err
+		}
+		e.schemas[t] = schema
+	}
+
+	if e.registry == nil {
+		// Single object encoding, identifying the schema by its fingerprint
+		header := []byte{0xc3, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint64(header[2:], avroFingerprint([]byte(schema.schema)))
+		schema.header = header
+		return schema, nil
+	}
+	id, err := e.registry.Register(registrySubject(e.prefix, schema.name), "AVRO", schema.schema)
+	if err != nil {
+		return nil, err
+	}
+	// Confluent wire format, identifying the schema by its ID
+	schema.header = confluentHeader(id)
+	return schema, nil
+}
+
+// AvroSchema returns the Avro schema, in its parsing canonical form, of entries of the type of the
+// entry, as used by the AvroEncoder.
+func AvroSchema(entry interface{}) (string, error) {
+	schema, err := newAvroSchema(indirectType(reflect.TypeOf(entry)))
+	if err != nil {
+		return "", err
+	}
+	return schema.schema, nil
+}
+
+// newAvroSchema derives the schema, and the encoder, of the type of entry.
+func newAvroSchema(t reflect.Type) (*avroSchema, error) {
+	b := &avroBuilder{defined: map[string]bool{}}
+	var definition interface{}
+	schema := new(avroSchema)
+	if t.Kind() == reflect.Struct && !isTextMarshaler(t) {
+		definition, schema.name = b.record(t, t.Name()), b.fullName(t.Name())
+	} else {
+		definition = b.build(t)
+	}
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, err
+	}
+	schema.schema = string(data)
+	schema.encode = b.encoder(t)
+	return schema, nil
+}
+
+// avroFingerprint returns the CRC-64-AVRO fingerprint of the schema.
+func avroFingerprint(data []byte) uint64 {
+	fp := uint64(avroEmptyFingerprint)
+	for _, b := range data {
+		fp = (fp >> 8) ^ avroFingerprintTable[(fp^uint64(b))&0xff]
+	}
+	return fp
+}
+
+// avroBuilder derives the schema, and the encoder, of a type, defining every record only once.
+type avroBuilder struct {
+	defined map[string]bool
+}
+
+// build returns the schema of the type.
+func (b *avroBuilder) build(t reflect.Type) interface{} {
+	if isTextMarshaler(t) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "long"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Interface {
+			return avroAnyValue
+		}
+		return []interface{}{"null", b.build(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return avroArray{Type: "array", Items: b.build(t.Elem())}
+	case reflect.Map:
+		return avroMap{Type: "map", Values: b.build(t.Elem())}
+	case reflect.Struct:
+		return b.record(t, t.Name())
+	}
+	return avroAnyValue
+}
+
+// record returns the schema of the struct, a record holding the fields of its JSON encoding, or,
+// if the record is defined already, its name.
+func (b *avroBuilder) record(t reflect.Type, name string) interface{} {
+	fullName := b.fullName(name)
+	if b.defined[fullName] {
+		return fullName
+	}
+	b.defined[fullName] = true
+	record := avroRecord{Name: fullName, Type: "record", Fields: []avroField{}}
+	for _, field := range avroFields(t) {
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Struct && fieldType.Name() == "" {
+			record.Fields = append(record.Fields, avroField{Name: field.name, Type: b.record(fieldType, name+"_"+field.name)})
+			continue
+		}
+		record.Fields = append(record.Fields, avroField{Name: field.name, Type: b.build(fieldType)})
+	}
+	return record
+}
+
+// fullName returns the full name of the record, its name made valid and prefixed by the namespace.
+func (b *avroBuilder) fullName(name string) string {
+	if name == "" {
+		name = "Entry"
+	}
+	return avroNamespace + "." + avroName(name)
+}
+
+// encoder returns the function encoding values of the type according to its schema.
+func (b *avroBuilder) encoder(t reflect.Type) avroEncodeFunc {
+	if isTextMarshaler(t) {
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			text, _ := v.Interface().(encoding.TextMarshaler).MarshalText()
+			avroWriteBytes(buf, text)
+		}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			if v.Bool() {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			avroWriteLong(buf, v.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			avroWriteLong(buf, int64(v.Uint()))
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			avroWriteDouble(buf, v.Float())
+		}
+	case reflect.String:
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			avroWriteBytes(buf, []byte(v.String()))
+		}
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Interface {
+			return func(buf *bytes.Buffer, v reflect.Value) {
+				if v.IsNil() {
+					avroWriteLong(buf, 0)
+					return
+				}
+				avroWriteAny(buf, v.Elem().Interface())
+			}
+		}
+		elem := b.encoder(t.Elem())
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			if v.IsNil() {
+				avroWriteLong(buf, 0)
+				return
+			}
+			avroWriteLong(buf, 1)
+			elem(buf, v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(buf *bytes.Buffer, v reflect.Value) {
+				data := make([]byte, v.Len())
+				reflect.Copy(reflect.ValueOf(data), v)
+				avroWriteBytes(buf, data)
+			}
+		}
+		elem := b.encoder(t.Elem())
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			if n := v.Len(); n > 0 {
+				avroWriteLong(buf, int64(n))
+				for i := 0; i < n; i++ {
+					elem(buf, v.Index(i))
+				}
+			}
+			avroWriteLong(buf, 0)
+		}
+	case reflect.Map:
+		elem := b.encoder(t.Elem())
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			if n := v.Len(); n > 0 {
+				avroWriteLong(buf, int64(n))
+				iter := v.MapRange()
+				for iter.Next() {
+					avroWriteBytes(buf, []byte(fmt.Sprint(iter.Key().Interface())))
+					elem(buf, iter.Value())
+				}
+			}
+			avroWriteLong(buf, 0)
+		}
+	case reflect.Struct:
+		var indexes [][]int
+		var encoders []avroEncodeFunc
+		for _, field := range avroFields(t) {
+			indexes = append(indexes, field.Index)
+			encoders = append(encoders, b.encoder(field.Type))
+		}
+		return func(buf *bytes.Buffer, v reflect.Value) {
+			for i, index := range indexes {
+				encoders[i](buf, v.FieldByIndex(index))
+			}
+		}
+	}
+	return func(buf *bytes.Buffer, v reflect.Value) {
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			avroWriteLong(buf, 0)
+			return
+		}
+		avroWriteAny(buf, v.Interface())
+	}
+}
+
+// avroStructField is a field of a struct as encoded in JSON, by the name it has in the record.
+type avroStructField struct {
+	reflect.StructField
+	name string
+}
+
+// avroFields returns the fields of the struct as encoded in JSON, embedded structs inlined, by the
+// name they have in the record.
+func avroFields(t reflect.Type) []avroStructField {
+	var fields []avroStructField
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			// Inlined, its fields are visible fields themselves
+			continue
+		}
+		if viaPointer(t, field.Index) {
+			// Promoted from an embedded pointer, which may be nil
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, avroStructField{StructField: field, name: avroName(name)})
+	}
+	return fields
+}
+
+// viaPointer tells whether the field at the index, promoted from an embedded struct, is reached
+// through a pointer.
+func viaPointer(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		if t.FieldByIndex(index[:i]).Type.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// indirectType returns the type pointed to, if the type is a pointer, or the type itself.
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// isTextMarshaler tells whether values of the type, other than pointers, marshal themselves to text.
+func isTextMarshaler(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t.Implements(textMarshalerType)
+}
+
+// avroName returns the name with every character not allowed in an Avro name replaced by an
+// underscore.
+func avroName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// avroWriteAny writes the value as a branch of the union values of any type are encoded as.
+func avroWriteAny(buf *bytes.Buffer, value interface{}) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		avroWriteLong(buf, 0)
+	case reflect.Bool:
+		avroWriteLong(buf, 1)
+		if v.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		avroWriteLong(buf, 2)
+		avroWriteLong(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		avroWriteLong(buf, 2)
+		avroWriteLong(buf, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		avroWriteLong(buf, 3)
+		avroWriteDouble(buf, v.Float())
+	case reflect.String:
+		avroWriteLong(buf, 4)
+		avroWriteBytes(buf, []byte(v.String()))
+	default:
+		data, _ := json.Marshal(value)
+		avroWriteLong(buf, 4)
+		avroWriteBytes(buf, data)
+	}
+}
+
+// avroWriteLong writes the value as a zig-zag encoded variable-length integer.
+func avroWriteLong(buf *bytes.Buffer, value int64) {
+	var data [binary.MaxVarintLen64]byte
+	buf.Write(data[:binary.PutVarint(data[:], value)])
+}
+
+// avroWriteDouble writes the value as 8 bytes, little-endian.
+func avroWriteDouble(buf *bytes.Buffer, value float64) {
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], math.Float64bits(value))
+	buf.Write(data[:])
+}
+
+// avroWriteBytes writes the data preceded by its length.
+func avroWriteBytes(buf *bytes.Buffer, data []byte) {
+	avroWriteLong(buf, int64(len(data)))
+	buf.Write(data)
+}
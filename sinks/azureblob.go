@@ -0,0 +1,64 @@
+package sinks
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AzureBlobStore is an ObjectStore uploading objects, as block blobs, to an Azure Blob Storage
+// container.
+type AzureBlobStore struct {
+	client *http.Client
+	url    *url.URL
+	header http.Header
+}
+
+// NewAzureBlobStore creates and returns a new AzureBlobStore uploading blobs to the container with
+// the given URL, which includes a shared access signature (SAS) allowing blobs to be created, as in
+// https://account.blob.core.windows.net/container?sv=...&sig=.... Blobs are encrypted using the
+// encryption scope, if specified, or the customer-provided key, a base64 encoded AES-256 key, if
+// specified, instead of the default encryption of the account.
+func NewAzureBlobStore(containerURL string, encryptionScope string, encryptionKey string) (*AzureBlobStore, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(AzureBlobStore)
+	s.client = &http.Client{Timeout: 30 * time.Minute}
+	s.url = u
+	s.header = http.Header{}
+	s.header.Set("x-ms-version", "2021-08-06")
+	s.header.Set("x-ms-blob-type", "BlockBlob")
+	if encryptionScope != "" {
+		s.header.Set("x-ms-encryption-scope", encryptionScope)
+	}
+	if encryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(encryptionKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be a base64 encoded 256-bit key")
+		}
+		hash := sha256.Sum256(key)
+		s.header.Set("x-ms-encryption-key", encryptionKey)
+		s.header.Set("x-ms-encryption-key-sha256", base64.StdEncoding.EncodeToString(hash[:]))
+		s.header.Set("x-ms-encryption-algorithm", "AES256")
+	}
+
+	return s, nil
+}
+
+// Upload puts the file as the blob with the given key into the container.
+func (s *AzureBlobStore) Upload(key string, file *os.File, size int64, contentType string) error {
+	u := *s.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = ""
+	header := s.header.Clone()
+	header.Set("Content-Type", contentType)
+	return putObject(s.client, "PUT", u.String(), header, file, size)
+}
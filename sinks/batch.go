@@ -0,0 +1,127 @@
+package sinks
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// BatchLimits are the limits of a batch of entries, once any of which is reached the batch is
+// delivered. Limits which aren't set don't apply.
+type BatchLimits struct {
+	MaxEntries int           // Maximum number of entries in a batch
+	MaxBytes   int           // Maximum size, in bytes, of the JSON encoded entries in a batch
+	MaxLatency time.Duration // Maximum time an entry waits before its batch is delivered
+}
+
+// BatchSink wraps a sink, flushing it whenever the entries written to it since the last flush
+// reach any of the limits, so the sink delivers right-sized payloads rather than all entries of a
+// delta response at once. Batches are, next to when Flush or Close are called, delivered from a
+// goroutine of its own once their maximum latency passed, in which case any failure to deliver the
+// batch is reported by a subsequent Write or Flush.
+type BatchSink struct {
+	mutex   sync.Mutex
+	sink    Sink
+	limits  BatchLimits
+	entries int
+	bytes   int
+	timer   *time.Timer
+	err     error
+}
+
+// NewBatchSink creates and returns a new BatchSink wrapping the sink.
+func NewBatchSink(sink Sink, limits BatchLimits) *BatchSink {
+	s := new(BatchSink)
+	s.sink = sink
+	s.limits = limits
+
+	return s
+}
+
+// Write writes the entry to the wrapped sink, flushing it if the batch reached any of its limits.
+func (s *BatchSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.err; err != nil {
+		s.err = nil
+		return err
+	}
+
+	if s.limits.MaxBytes > 0 {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		// Deliver the batch first if this entry would make it exceed its maximum size
+		if s.entries > 0 && s.bytes+len(data) > s.limits.MaxBytes {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+		s.bytes += len(data)
+	}
+	if err := s.sink.Write(entry); err != nil {
+		return err
+	}
+	s.entries++
+	if s.entries == 1 && s.limits.MaxLatency > 0 {
+		s.timer = time.AfterFunc(s.limits.MaxLatency, s.expire)
+	}
+
+	if (s.limits.MaxEntries > 0 && s.entries >= s.limits.MaxEntries) || (s.limits.MaxBytes > 0 && s.bytes >= s.limits.MaxBytes) {
+		return s.flush()
+	}
+	return nil
+}
+
+// Flush delivers the current batch.
+func (s *BatchSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.flush()
+	if err == nil {
+		err = s.err
+	}
+	s.err = nil
+	return err
+}
+
+// Close delivers the current batch and closes the wrapped sink.
+func (s *BatchSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.resetBatch()
+	err := s.sink.Close()
+	if err == nil {
+		err = s.err
+	}
+	return err
+}
+
+// expire delivers the current batch once its maximum latency passed.
+func (s *BatchSink) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.entries == 0 {
+		return
+	}
+	if err := s.flush(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// flush flushes the wrapped sink and starts a new batch. The caller is expected to hold the lock.
+func (s *BatchSink) flush() error {
+	s.resetBatch()
+	return s.sink.Flush()
+}
+
+// resetBatch starts a new batch. The caller is expected to hold the lock.
+func (s *BatchSink) resetBatch() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.entries = 0
+	s.bytes = 0
+}
@@ -0,0 +1,182 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// bigQueryMaxRows is the maximum number of rows inserted using a single streaming insert request.
+const bigQueryMaxRows = 500
+
+// bigQuerySchema is the schema of the table transaction log entries are inserted into.
+var bigQuerySchema = []map[string]string{
+	{"name": "ID", "type": "INTEGER", "mode": "REQUIRED"},
+	{"name": "ChangeSetID", "type": "STRING"},
+	{"name": "TimeStamp", "type": "TIMESTAMP"},
+	{"name": "ReplicationTime", "type": "STRING"},
+	{"name": "User", "type": "STRING"},
+	{"name": "Cube", "type": "STRING"},
+	{"name": "Tuple", "type": "STRING", "mode": "REPEATED"},
+	{"name": "ValueType", "type": "STRING"},
+	{"name": "OldValue", "type": "STRING"},
+	{"name": "NewValue", "type": "STRING"},
+	{"name": "OldNumber", "type": "FLOAT"},
+	{"name": "NewNumber", "type": "FLOAT"},
+	{"name": "StatusMessage", "type": "STRING"},
+	{"name": "Server", "type": "STRING"},
+}
+
+// BigQuerySink inserts every transaction log entry written to it as a row into a Google BigQuery
+// table, using streaming inserts, creating the table if it doesn't exist yet. Rows carry an insert
+// ID identifying the entry, so BigQuery discards, on a best effort basis, entries inserted again.
+type BigQuerySink struct {
+	client  *http.Client
+	url     string
+	rows    []bigQueryRow
+	entries []interface{}
+}
+
+// bigQueryRow is a row as inserted using the streaming insert API.
+type bigQueryRow struct {
+	InsertID string                 `json:"insertId"`
+	JSON     map[string]interface{} `json:"json"`
+}
+
+// NewBigQuerySink creates and returns a new BigQuerySink inserting into the table of the dataset of
+// the project, which is created if it doesn't exist yet. The endpoint defaults to
+// https://bigquery.googleapis.com/bigquery/v2.
+func NewBigQuerySink(project string, dataset string, table string, endpoint string) (*BigQuerySink, error) {
+	if endpoint == "" {
+		endpoint = "https://bigquery.googleapis.com/bigquery/v2"
+	}
+	client, err := newGoogleClient(endpoint, "https://www.googleapis.com/auth/bigquery")
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(BigQuerySink)
+	s.client = client
+	tables := strings.TrimSuffix(endpoint, "/") + "/projects/" + url.PathEscape(project) + "/datasets/" + url.PathEscape(dataset) + "/tables"
+	if err := s.ensureTable(tables, project, dataset, table); err != nil {
+		return nil, err
+	}
+	s.url = tables + "/" + url.PathEscape(table) + "/insertAll"
+
+	return s, nil
+}
+
+// ensureTable creates the table, using the schema for transaction log entries, if it doesn't exist.
+func (s *BigQuerySink) ensureTable(tables string, project string, dataset string, table string) error {
+	err := googleRequest(s.client, "GET", tables+"/"+url.PathEscape(table), nil, nil)
+	var googleErr *googleError
+	if !errors.As(err, &googleErr) || googleErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+	return googleRequest(s.client, "POST", tables, map[string]interface{}{
+		"tableReference": map[string]string{"projectId": project, "datasetId": dataset, "tableId": table},
+		"schema":         map[string]interface{}{"fields": bigQuerySchema},
+	}, nil)
+}
+
+// Write queues the transaction log entry as a row to be inserted on the next flush.
+func (s *BigQuerySink) Write(entry interface{}) error {
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return errors.New("bigquery sink only supports transaction log entries")
+	}
+
+	oldValue, newValue := txnLogEntry.StringValues()
+	row := map[string]interface{}{
+		"ID":              txnLogEntry.ID,
+		"ChangeSetID":     txnLogEntry.ChangeSetID,
+		"ReplicationTime": txnLogEntry.ReplicationTime,
+		"User":            txnLogEntry.User,
+		"Cube":            txnLogEntry.Cube,
+		"Tuple":           txnLogEntry.Tuple,
+		"ValueType":       txnLogEntry.ValueType(),
+		"OldValue":        oldValue,
+		"NewValue":        newValue,
+		"Server":          txnLogEntry.Server,
+	}
+	if oldNumber, newNumber, ok := txnLogEntry.NumericValues(); ok {
+		row["OldNumber"], row["NewNumber"] = oldNumber, newNumber
+	}
+	if txnLogEntry.TimeStamp != "" {
+		row["TimeStamp"] = txnLogEntry.TimeStamp
+	}
+	if txnLogEntry.StatusMessage != nil {
+		row["StatusMessage"] = fmt.Sprint(txnLogEntry.StatusMessage)
+	}
+	s.rows = append(s.rows, bigQueryRow{
+		InsertID: txnLogEntry.Server + ":" + strconv.Itoa(txnLogEntry.ID) + ":" + txnLogEntry.TimeStamp,
+		JSON:     row,
+	})
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush inserts all queued rows, in batches. Invalid rows are skipped, while the valid rows of the
+// same batch are inserted, and their entries returned in a PermanentError.
+func (s *BigQuerySink) Flush() error {
+	var rejected *PermanentError
+	for len(s.rows) > 0 {
+		n := len(s.rows)
+		if n > bigQueryMaxRows {
+			n = bigQueryMaxRows
+		}
+		var res struct {
+			InsertErrors []struct {
+				Index  int `json:"index"`
+				Errors []struct {
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"errors"`
+			} `json:"insertErrors"`
+		}
+		err := googleRequest(s.client, "POST", s.url, map[string]interface{}{
+			"skipInvalidRows": true,
+			"rows":            s.rows[:n],
+		}, &res)
+		if err != nil && !IsPermanent(err) {
+			return err
+		}
+		if err != nil {
+			// The whole batch got rejected
+			if rejected == nil {
+				rejected = &PermanentError{Err: err}
+			}
+			rejected.Entries = append(rejected.Entries, s.entries[:n]...)
+		}
+		for _, insertError := range res.InsertErrors {
+			if insertError.Index < 0 || insertError.Index >= n {
+				continue
+			}
+			if rejected == nil {
+				reason := ""
+				if len(insertError.Errors) > 0 {
+					reason = insertError.Errors[0].Reason + ": " + insertError.Errors[0].Message
+				}
+				rejected = &PermanentError{Err: fmt.Errorf("BigQuery rejected rows: %s", reason)}
+			}
+			rejected.Entries = append(rejected.Entries, s.entries[insertError.Index])
+		}
+		s.rows, s.entries = s.rows[n:], s.entries[n:]
+	}
+	s.rows, s.entries = nil, nil
+
+	if rejected != nil {
+		return rejected
+	}
+	return nil
+}
+
+// Close inserts any queued rows.
+func (s *BigQuerySink) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,347 @@
+package sinks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// BroadcastConfig defines how a BroadcastSink serves its subscribers.
+type BroadcastConfig struct {
+	// Addr is the address, as in :8081, the endpoints are served on.
+	Addr string
+	// Buffer is the number of entries buffered for every subscriber, 256 if not specified. Subscribers
+	// not keeping up get disconnected once their buffer is full, rather than holding up the tracker.
+	Buffer int
+	// Compile, if set, compiles the filter expressions subscribers pass using the filter parameter.
+	// If not set, subscribers can only filter by the type, cube and user of the entries.
+	Compile func(filter string) (func(entry interface{}) bool, error)
+	// AllowedOrigins are the origins, as in https://dashboard.example.com, of the web pages allowed to
+	// subscribe next to the pages served by the host of the endpoints, * allowing any web page.
+	// Requests not sent by a browser, without an Origin header, are always allowed.
+	AllowedOrigins []string
+	// Token, if set, is the token subscribers have to pass, as a bearer token in the Authorization
+	// header or, as browsers can't set headers on WebSocket and EventSource requests, using the token
+	// parameter.
+	Token string
+}
+
+// BroadcastSink re-broadcasts the entries written to it, as JSON, to any number of subscribers,
+// connecting over a WebSocket, at /ws, or using Server-Sent Events, at /events, letting multiple
+// downstream consumers follow the entries live without each of them querying the server. Every
+// subscriber receives the entries matching its own filter, specified by the parameters of its
+// request: type, a comma-separated list of entry types, txn, msg and/or audit, cube and user, a
+// comma-separated list of cubes, respectively users, and filter, an expression. Entries are
+// broadcast as they are written, subscribers only receive the entries written while connected.
+// Only web pages of the allowed origins can subscribe and, if a token is set, only subscribers
+// passing the token.
+type BroadcastSink struct {
+	config   BroadcastConfig
+	server   *http.Server
+	upgrader websocket.Upgrader
+	closed   chan struct{} // Closed once the sink is closed
+
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+// subscriber is a connection, over a WebSocket or using Server-Sent Events, to a BroadcastSink.
+type subscriber struct {
+	match   func(entry interface{}) bool
+	entries chan broadcastEntry
+	slow    chan struct{} // Closed once the subscriber didn't keep up
+}
+
+// broadcastEntry is an entry, as JSON, along with its type.
+type broadcastEntry struct {
+	kind string
+	data []byte
+}
+
+// NewBroadcastSink creates and returns a new BroadcastSink, serving its endpoints on the address.
+func NewBroadcastSink(config BroadcastConfig) (*BroadcastSink, error) {
+	if config.Buffer <= 0 {
+		config.Buffer = 256
+	}
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(BroadcastSink)
+	s.config = config
+	s.closed = make(chan struct{})
+	s.subscribers = map[*subscriber]bool{}
+	s.upgrader = websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	mux.HandleFunc("/events", s.serveEvents)
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// Write broadcasts the entry to the subscribers whose filter it matches.
+func (s *BroadcastSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.subscribers) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	e := broadcastEntry{kind: entryType(entry), data: data}
+	for sub := range s.subscribers {
+		if !sub.match(entry) {
+			continue
+		}
+		select {
+		case sub.entries <- e:
+		default:
+			// Disconnect the subscriber, which can reconnect, rather than silently skipping entries
+			delete(s.subscribers, sub)
+			close(sub.slow)
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, entries are broadcast as they are written.
+func (s *BroadcastSink) Flush() error {
+	return nil
+}
+
+// Close stops serving the endpoints, disconnecting all subscribers.
+func (s *BroadcastSink) Close() error {
+	close(s.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+	return s.server.Close()
+}
+
+// Subscribers returns the number of subscribers connected.
+func (s *BroadcastSink) Subscribers() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subscribers)
+}
+
+// checkOrigin returns true if the request isn't sent by a browser, or by a web page served by the
+// host of the endpoints or of one of the allowed origins.
+func (s *BroadcastSink) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize returns true if the request passes the token, if one is set, and is allowed by its
+// origin, responding with 401 Unauthorized, respectively 403 Forbidden, if not.
+func (s *BroadcastSink) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.config.Token != "" {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return false
+		}
+	}
+	if !s.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// subscribe creates, and adds, the subscriber for the request, with the filter it specifies.
+func (s *BroadcastSink) subscribe(r *http.Request) (*subscriber, error) {
+	match, err := s.filter(r)
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscriber{match: match, entries: make(chan broadcastEntry, s.config.Buffer), slow: make(chan struct{})}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscribers[sub] = true
+	return sub, nil
+}
+
+// unsubscribe removes the subscriber, if it wasn't removed already.
+func (s *BroadcastSink) unsubscribe(sub *subscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// filter returns the function matching the entries as specified by the parameters of the request.
+func (s *BroadcastSink) filter(r *http.Request) (func(entry interface{}) bool, error) {
+	query := r.URL.Query()
+	types := listSet(query.Get("type"))
+	cubes := listSet(query.Get("cube"))
+	users := listSet(query.Get("user"))
+	expression := func(entry interface{}) bool { return true }
+	if filter := query.Get("filter"); filter != "" {
+		if s.config.Compile == nil {
+			return nil, fmt.Errorf("filter expressions are not supported")
+		}
+		var err error
+		if expression, err = s.config.Compile(filter); err != nil {
+			return nil, fmt.Errorf("invalid filter: %s", err)
+		}
+	}
+
+	return func(entry interface{}) bool {
+		if len(types) > 0 && !types[entryType(entry)] {
+			return false
+		}
+		if len(cubes) > 0 && !cubes[strings.ToLower(entryField(entry, "Cube"))] {
+			return false
+		}
+		if len(users) > 0 && !users[strings.ToLower(entryField(entry, "User"))] && !users[strings.ToLower(entryField(entry, "UserName"))] {
+			return false
+		}
+		return expression(entry)
+	}, nil
+}
+
+// listSet returns the items of the comma-separated list, in lower case, as a set.
+func listSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			set[strings.ToLower(item)] = true
+		}
+	}
+	return set
+}
+
+// serveWebSocket streams the entries to the subscriber over a WebSocket, every entry as a text
+// message of its own.
+func (s *BroadcastSink) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+	sub, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer s.unsubscribe(sub)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Discard anything the subscriber sends, noticing it disconnecting
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.closed:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			return
+		case <-sub.slow:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case e := <-sub.entries:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, e.data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveEvents streams the entries to the subscriber as Server-Sent Events, every entry as an event
+// named after its type, txn, msg, audit or entry.
+func (s *BroadcastSink) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+	sub, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer s.unsubscribe(sub)
+
+	// Let the web pages of the allowed origins read the events
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-sub.slow:
+			fmt.Fprint(w, "event: error\ndata: too slow\n\n")
+			flusher.Flush()
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-sub.entries:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.kind, e.data)
+		}
+		flusher.Flush()
+	}
+}
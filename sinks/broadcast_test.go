@@ -0,0 +1,52 @@
+package sinks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBroadcastSinkAuthorizesSubscribers(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config BroadcastConfig
+		origin string
+		auth   string
+		query  string
+		status int
+	}{
+		{name: "no browser", status: http.StatusOK},
+		{name: "same origin", origin: "http://tracker:8081", status: http.StatusOK},
+		{name: "other origin", origin: "https://evil.example.com", status: http.StatusForbidden},
+		{name: "allowed origin", config: BroadcastConfig{AllowedOrigins: []string{"https://dashboard.example.com/"}},
+			origin: "https://dashboard.example.com", status: http.StatusOK},
+		{name: "any origin", config: BroadcastConfig{AllowedOrigins: []string{"*"}}, origin: "https://evil.example.com", status: http.StatusOK},
+		{name: "missing token", config: BroadcastConfig{Token: "s3cr3t"}, status: http.StatusUnauthorized},
+		{name: "invalid token", config: BroadcastConfig{Token: "s3cr3t"}, auth: "Bearer guess", status: http.StatusUnauthorized},
+		{name: "bearer token", config: BroadcastConfig{Token: "s3cr3t"}, auth: "Bearer s3cr3t", status: http.StatusOK},
+		{name: "token parameter", config: BroadcastConfig{Token: "s3cr3t"}, query: "?token=s3cr3t", status: http.StatusOK},
+		{name: "token from other origin", config: BroadcastConfig{Token: "s3cr3t"}, query: "?token=s3cr3t",
+			origin: "https://evil.example.com", status: http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.Addr = "127.0.0.1:0"
+			s, err := NewBroadcastSink(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			r := httptest.NewRequest("GET", "http://tracker:8081/events"+test.query, nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.auth != "" {
+				r.Header.Set("Authorization", test.auth)
+			}
+			w := httptest.NewRecorder()
+			if ok := s.authorize(w, r); ok != (test.status == http.StatusOK) || (!ok && w.Code != test.status) {
+				t.Errorf("got %t, status %d, expected status %d", ok, w.Code, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// bufferedReplayBatch is the number of entries replayed before the wrapped sink gets flushed and
+// the progress is saved.
+const bufferedReplayBatch = 1000
+
+// ErrBufferFull is returned when an entry can't be written as the buffer reached its maximum size.
+var ErrBufferFull = errors.New("buffer is full")
+
+// BufferedSink queues the entries written to it on disk before delivering them to the sink it
+// wraps, giving at-least-once delivery. If the wrapped sink is unavailable, the entries remain
+// queued, reported through OnError, and are replayed, in order, with every subsequent flush until
+// the sink recovers. Entries still queued when the sink gets closed are replayed once reopened.
+// Queued entries which can't be replayed, as they can't be read or are of a type no longer
+// registered, are moved to the dead-letter file, deadletter.jsonl, next to the queue, reported
+// through OnError, rather than holding up the entries queued after them.
+type BufferedSink struct {
+	sink    Sink
+	dir     string
+	maxSize int64
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	offset  int64
+
+	// OnError, if set, is called for every failed attempt to deliver the queued entries, and every
+	// queued entry moved to the dead-letter file.
+	OnError func(err error)
+}
+
+// bufferedEntry is the representation of an entry in the queue, which retains its type so it can
+// be restored as such when replayed.
+type bufferedEntry struct {
+	Type  string          `json:"type"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// The types of the entries, and any other records, the BufferedSink can queue, by the name they are
+// tagged with in the queue, and the other way around.
+var (
+	bufferedTypesMutex sync.RWMutex
+	bufferedTypes      = map[string]reflect.Type{}
+	bufferedNames      = map[reflect.Type]string{}
+)
+
+// RegisterBufferedType registers the type of the record, as in (*ChangeSet)(nil), by the name the
+// records of that type are tagged with in the queue of a BufferedSink, so they can be queued, as
+// JSON, and restored as such when replayed. Any package writing records of its own types to the
+// sinks registers those types, typically from its init function.
+func RegisterBufferedType(name string, record interface{}) {
+	bufferedTypesMutex.Lock()
+	defer bufferedTypesMutex.Unlock()
+	bufferedTypes[name] = reflect.TypeOf(record)
+	bufferedNames[reflect.TypeOf(record)] = name
+}
+
+func init() {
+	// The entries keep the names they have always been tagged with, so existing queues can be replayed
+	RegisterBufferedType("txn", (*odata.TransactionLogEntry)(nil))
+	RegisterBufferedType("msg", (*odata.MessageLogEntry)(nil))
+	RegisterBufferedType("audit", (*odata.AuditLogEntry)(nil))
+	RegisterBufferedType("entity", map[string]interface{}(nil))
+}
+
+// NewBufferedSink creates and returns a new BufferedSink queueing the entries in the directory
+// before delivering them to the sink. Writing fails once the queue reaches maxSize bytes, 0 for
+// no limit.
+func NewBufferedSink(sink Sink, dir string, maxSize int64) (*BufferedSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "queue.jsonl"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// An entry which was only partially written, as the tracker stopped while writing it, gets ended
+	// so it doesn't run into the entries queued after it
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, size-1); err == nil && last[0] != '\n' {
+			_, err = file.Write([]byte{'\n'})
+		}
+		if err == nil {
+			info, err = file.Stat()
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	s := new(BufferedSink)
+	s.sink = sink
+	s.dir = dir
+	s.maxSize = maxSize
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.size = info.Size()
+
+	// Continue replaying from where we left off, if there is anything left to replay
+	data, err := ioutil.ReadFile(filepath.Join(dir, "queue.offset"))
+	if err == nil {
+		s.offset, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		file.Close()
+		return nil, err
+	}
+	if s.offset > s.size {
+		s.offset = s.size
+	}
+
+	return s, nil
+}
+
+// Write queues the entry.
+func (s *BufferedSink) Write(entry interface{}) error {
+	var b bufferedEntry
+	bufferedTypesMutex.RLock()
+	b.Type = bufferedNames[reflect.TypeOf(entry)]
+	bufferedTypesMutex.RUnlock()
+	if b.Type == "" {
+		return fmt.Errorf("buffered sink doesn't support entries of type %T", entry)
+	}
+	var err error
+	if b.Entry, err = json.Marshal(entry); err != nil {
+		return err
+	}
+	line, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if s.maxSize > 0 && s.size+int64(len(line)) > s.maxSize {
+		return ErrBufferFull
+	}
+	n, err := s.writer.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Flush persists the queued entries and then attempts to deliver them to the wrapped sink. Failing
+// to deliver the entries is reported through OnError but isn't an error, as they remain queued.
+func (s *BufferedSink) Flush() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	if err := s.replay(); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+	return nil
+}
+
+// Close flushes the queue and closes the wrapped sink.
+func (s *BufferedSink) Close() error {
+	err := s.Flush()
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// replay delivers the queued entries, in batches, to the wrapped sink, saving the progress after
+// every batch the sink flushed successfully. The queue is emptied once everything is delivered.
+func (s *BufferedSink) replay() error {
+	if s.offset >= s.size {
+		return nil
+	}
+
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+
+	offset := s.offset
+	count := 0
+	for offset < s.size {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		entry, err := decodeBufferedEntry(line)
+		if err != nil {
+			if err := s.deadLetter(line, err); err != nil {
+				return err
+			}
+		} else if err := s.sink.Write(entry); err != nil {
+			// Let the sink wrap up the failed batch, which gets replayed as a whole next time
+			s.sink.Flush()
+			return err
+		}
+
+		if count++; count == bufferedReplayBatch || offset == s.size {
+			if err := s.sink.Flush(); err != nil {
+				return err
+			}
+			if err := s.saveOffset(offset); err != nil {
+				return err
+			}
+			count = 0
+		}
+	}
+
+	// Everything has been delivered, start with an empty queue again
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	s.size = 0
+	return s.saveOffset(0)
+}
+
+// deadLetter moves the queued entry, which can't be replayed for the reason given, to the dead-letter
+// file, reporting it through OnError.
+func (s *BufferedSink) deadLetter(line []byte, reason error) error {
+	path := filepath.Join(s.dir, "deadletter.jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if s.OnError != nil {
+		s.OnError(fmt.Errorf("queued entry moved to %s: %w", path, reason))
+	}
+	return nil
+}
+
+// saveOffset saves the offset up to which the queued entries have been delivered.
+func (s *BufferedSink) saveOffset(offset int64) error {
+	path := filepath.Join(s.dir, "queue.offset")
+	if err := ioutil.WriteFile(path+".tmp", []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	s.offset = offset
+	return nil
+}
+
+// decodeBufferedEntry restores an entry, of its original type, from its representation in the queue.
+func decodeBufferedEntry(line []byte) (interface{}, error) {
+	var b bufferedEntry
+	if err := json.Unmarshal(line, &b); err != nil {
+		return nil, err
+	}
+	bufferedTypesMutex.RLock()
+	typ, ok := bufferedTypes[b.Type]
+	bufferedTypesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("buffered sink doesn't support entries of type %s", b.Type)
+	}
+
+	// Records are mostly pointers, to be restored as a pointer to a new value of the type pointed to
+	if typ.Kind() == reflect.Ptr {
+		entry := reflect.New(typ.Elem())
+		if err := json.Unmarshal(b.Entry, entry.Interface()); err != nil {
+			return nil, err
+		}
+		return entry.Interface(), nil
+	}
+	entry := reflect.New(typ)
+	if err := json.Unmarshal(b.Entry, entry.Interface()); err != nil {
+		return nil, err
+	}
+	return entry.Elem().Interface(), nil
+}
@@ -0,0 +1,91 @@
+package sinks_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/internal/testutil"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestBufferedSinkReplaysRecords(t *testing.T) {
+	txnLogEntry := &odata.TransactionLogEntry{ID: 1, ChangeSetID: "cs-1", TimeStamp: "2024-01-01T10:00:00Z", User: "Admin",
+		Cube: "Sales", Tuple: []string{"2024", "Jan"}, OldValue: 1.0, NewValue: 2.5}
+	testutil.BufferedReplay(t, []interface{}{
+		txnLogEntry,
+		&odata.MessageLogEntry{ID: 2, ThreadID: 10, Level: "Info", TimeStamp: "2024-01-01T10:00:01Z", Logger: "TM1.Server", Message: "Started"},
+		&odata.AuditLogEntry{ID: 3, TimeStamp: "2024-01-01T10:00:02Z", UserName: "Admin", Description: "Created", ObjectType: "Cube", ObjectName: "Sales"},
+		map[string]interface{}{"Name": "Sales", "Count": 3.0},
+		&sinks.ChangeSet{Type: "ChangeSet", ChangeSetID: "cs-1", User: "Admin", Cubes: []string{"Sales"}, CellCount: 1,
+			FirstChange: txnLogEntry.TimeStamp, TimeStamp: txnLogEntry.TimeStamp, Changes: []*odata.TransactionLogEntry{txnLogEntry}},
+		&sinks.Spread{Type: "Spread", ChangeSetID: "cs-1", User: "Admin", Cube: "Sales", CellCount: 12, TotalDelta: 1200,
+			Consolidation: map[string]string{"Month": "Year"}, FirstChange: txnLogEntry.TimeStamp, TimeStamp: txnLogEntry.TimeStamp},
+	})
+}
+
+func TestBufferedSinkRejectsUnregisteredTypes(t *testing.T) {
+	s, err := sinks.NewBufferedSink(new(testutil.RecordingSink), t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Write(struct{ Name string }{"Sales"}); err == nil {
+		t.Error("expected a record of an unregistered type to be rejected")
+	}
+}
+
+func TestBufferedSinkMovesUnreadableEntriesToDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	queue := func(sink sinks.Sink, entry interface{}) {
+		t.Helper()
+		s, err := sinks.NewBufferedSink(sink, dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queue(&testutil.RecordingSink{Failing: true}, &odata.TransactionLogEntry{ID: 1})
+
+	// Queue an entry of a type no longer known, and one only partially written, behind it
+	file, err := os.OpenFile(filepath.Join(dir, "queue.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"Type":"unknown","Entry":{}}` + "\n" + `{"Type":"txn","Entry":{"ID":`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	queue(&testutil.RecordingSink{Failing: true}, &odata.TransactionLogEntry{ID: 2})
+
+	sink := new(testutil.RecordingSink)
+	s, err := sinks.NewBufferedSink(sink, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	s.OnError = func(err error) { errs = append(errs, err) }
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries := sink.Entries()
+	if len(entries) != 2 || entries[0].(*odata.TransactionLogEntry).ID != 1 || entries[1].(*odata.TransactionLogEntry).ID != 2 {
+		t.Fatalf("replayed %v, expected the entries with ID 1 and 2", entries)
+	}
+	if len(errs) != 2 {
+		t.Errorf("got errors %v, expected both unreadable entries to be reported", errs)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "deadletter.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Type":"unknown","Entry":{}}` + "\n" + `{"Type":"txn","Entry":{"ID":` + "\n"; string(data) != want {
+		t.Errorf("got dead letters %q, expected %q", data, want)
+	}
+}
@@ -0,0 +1,203 @@
+package sinks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// ChangeSet is the logical write operation, as in a spreading, a TurboIntegrator process or a
+// sandbox being committed, which changed one or more cells, grouping the transaction log entries
+// sharing its ChangeSetID.
+type ChangeSet struct {
+	Type        string                       `json:"Type"` // Always ChangeSet
+	ChangeSetID string                       `json:"ChangeSetID"`
+	Server      string                       `json:"Server,omitempty"`
+	User        string                       `json:"User"`
+	Cubes       []string                     `json:"Cubes"`
+	CellCount   int                          `json:"CellCount"`
+	FirstChange string                       `json:"FirstChange"` // Time stamp of the first change
+	TimeStamp   string                       `json:"TimeStamp"`   // Time stamp of the last change
+	Part        int                          `json:"Part,omitempty"`
+	Changes     []*odata.TransactionLogEntry `json:"Changes"`
+
+	updated time.Time
+}
+
+func init() {
+	RegisterBufferedType("ChangeSet", (*ChangeSet)(nil))
+}
+
+// add adds the transaction log entry to the change set.
+func (c *ChangeSet) add(entry *odata.TransactionLogEntry) {
+	if len(c.Changes) == 0 {
+		c.FirstChange = entry.TimeStamp
+	}
+	found := false
+	for _, cube := range c.Cubes {
+		if cube == entry.Cube {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.Cubes = append(c.Cubes, entry.Cube)
+	}
+	c.TimeStamp = entry.TimeStamp
+	c.Changes = append(c.Changes, entry)
+	c.CellCount = len(c.Changes)
+	c.updated = time.Now()
+}
+
+// ChangeSetSink wraps a sink, writing a single ChangeSet to it for all transaction log entries
+// sharing the same ChangeSetID, instead of the entries themselves. A change set is written once no
+// entries were added to it for the timeout, which, as change sets are written from a goroutine of
+// its own, reports any failure to deliver the change set from a subsequent Write or Flush. Change
+// sets reaching the maximum number of changes are written in parts, numbered from 1. Entries
+// without a ChangeSetID, and entries of any other type, are written as is.
+type ChangeSetSink struct {
+	mutex      sync.Mutex
+	sink       Sink
+	timeout    time.Duration
+	maxChanges int
+	sets       []*ChangeSet // Open change sets, in the order they were opened
+	timer      *time.Timer
+	err        error
+}
+
+// NewChangeSetSink creates and returns a new ChangeSetSink wrapping the sink.
+func NewChangeSetSink(sink Sink, timeout time.Duration, maxChanges int) *ChangeSetSink {
+	s := new(ChangeSetSink)
+	s.sink = sink
+	s.timeout = timeout
+	s.maxChanges = maxChanges
+
+	return s
+}
+
+// Write adds the entry to its change set, writing the change set if it reached the maximum number
+// of changes.
+func (s *ChangeSetSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.err; err != nil {
+		s.err = nil
+		return err
+	}
+
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok || txnLogEntry.ChangeSetID == "" {
+		return s.sink.Write(entry)
+	}
+
+	var set *ChangeSet
+	for _, open := range s.sets {
+		if open.ChangeSetID == txnLogEntry.ChangeSetID && open.Server == txnLogEntry.Server {
+			set = open
+			break
+		}
+	}
+	if set == nil {
+		set = &ChangeSet{Type: "ChangeSet", ChangeSetID: txnLogEntry.ChangeSetID, Server: txnLogEntry.Server, User: txnLogEntry.User}
+		s.sets = append(s.sets, set)
+	}
+	set.add(txnLogEntry)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.timeout, s.expire)
+	}
+
+	if s.maxChanges > 0 && len(set.Changes) >= s.maxChanges {
+		// Write this part, continuing the change set in the next
+		s.remove(set)
+		if set.Part == 0 {
+			set.Part = 1
+		}
+		next := &ChangeSet{Type: set.Type, ChangeSetID: set.ChangeSetID, Server: set.Server, User: set.User, Part: set.Part + 1, updated: set.updated}
+		s.sets = append(s.sets, next)
+		return s.sink.Write(set)
+	}
+	return nil
+}
+
+// remove removes the change set from the open change sets. The caller is expected to hold the lock.
+func (s *ChangeSetSink) remove(set *ChangeSet) {
+	for i, open := range s.sets {
+		if open == set {
+			s.sets = append(s.sets[:i], s.sets[i+1:]...)
+			return
+		}
+	}
+}
+
+// expire writes, and delivers, the change sets which didn't change for the timeout, and schedules
+// itself for the next change set to expire, if any. Change sets failing to be written, unless
+// rejected permanently, remain open, to be written again once the timeout passed again.
+func (s *ChangeSetSink) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.timer = nil
+
+	var err error
+	next := s.timeout
+	open := s.sets[:0]
+	for _, set := range s.sets {
+		idle := time.Since(set.updated)
+		if idle < s.timeout {
+			open = append(open, set)
+			if s.timeout-idle < next {
+				next = s.timeout - idle
+			}
+			continue
+		}
+		if err == nil && len(set.Changes) > 0 {
+			err = s.sink.Write(set)
+		}
+		if err != nil && !IsPermanent(err) {
+			open = append(open, set)
+		}
+	}
+	s.sets = open
+	if err == nil {
+		err = s.sink.Flush()
+	}
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if len(s.sets) > 0 {
+		s.timer = time.AfterFunc(next, s.expire)
+	}
+}
+
+// Flush flushes the wrapped sink. Open change sets are written once they expire.
+func (s *ChangeSetSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.sink.Flush()
+	if err == nil {
+		err = s.err
+	}
+	s.err = nil
+	return err
+}
+
+// Close writes all open change sets and closes the wrapped sink.
+func (s *ChangeSetSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	err := s.err
+	for _, set := range s.sets {
+		if err == nil && len(set.Changes) > 0 {
+			err = s.sink.Write(set)
+		}
+	}
+	s.sets = nil
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// ANSI escape sequences used to color the pretty output.
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// ConsoleConfig defines how a ConsoleSink prints entries.
+type ConsoleConfig struct {
+	// Format is the format entries are printed in: pretty, a human-readable line per entry, json, a
+	// line of JSON per entry, or template, the output of the Template for every entry.
+	Format   string
+	Template *template.Template
+	// Color, if set, colors the pretty output.
+	Color bool
+}
+
+// ConsoleSink prints every entry written to it to the console, i.e. to stdout, for ad-hoc
+// debugging or to pipe the entries into another tool, like jq.
+type ConsoleSink struct {
+	writer *bufio.Writer
+	config ConsoleConfig
+}
+
+// NewConsoleSink creates and returns a new ConsoleSink printing to the writer.
+func NewConsoleSink(w io.Writer, config ConsoleConfig) (*ConsoleSink, error) {
+	switch config.Format {
+	case "":
+		config.Format = "pretty"
+	case "pretty", "json":
+	case "template":
+		if config.Template == nil {
+			return nil, fmt.Errorf("template format requires a template")
+		}
+	default:
+		return nil, fmt.Errorf("unknown console format: %s", config.Format)
+	}
+
+	s := new(ConsoleSink)
+	s.writer = bufio.NewWriter(w)
+	s.config = config
+
+	return s, nil
+}
+
+// Write prints the entry.
+func (s *ConsoleSink) Write(entry interface{}) error {
+	switch s.config.Format {
+	case "json":
+		return json.NewEncoder(s.writer).Encode(entry)
+	case "template":
+		var out strings.Builder
+		if err := s.config.Template.Execute(&out, entry); err != nil {
+			return &PermanentError{Err: err}
+		}
+		if !strings.HasSuffix(out.String(), "\n") {
+			out.WriteString("\n")
+		}
+		_, err := s.writer.WriteString(out.String())
+		return err
+	}
+	_, err := s.writer.WriteString(s.pretty(entry) + "\n")
+	return err
+}
+
+// pretty returns the human-readable representation of the entry.
+func (s *ConsoleSink) pretty(entry interface{}) string {
+	color := func(code string, text string) string {
+		if !s.config.Color || text == "" {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	line := color(colorDim, strings.Replace(entryTime(entry).Format("2006-01-02T15:04:05Z07:00"), "T", " ", 1))
+	if server := entryField(entry, "Server"); server != "" {
+		line += " " + color(colorDim, "["+server+"]")
+	}
+	switch e := entry.(type) {
+	case *odata.TransactionLogEntry:
+		return line + " " + color(colorCyan, e.User) + " " + color(colorBold, e.Cube) + "(" + strings.Join(e.Tuple, ", ") + ") " +
+			color(colorRed, csvValue(e.OldValue)) + " -> " + color(colorGreen, csvValue(e.NewValue))
+	case *odata.MessageLogEntry:
+		level := e.Level
+		switch entrySeverity(e) {
+		case severityCritical, severityError:
+			level = color(colorRed, level)
+		case severityWarning:
+			level = color(colorYellow, level)
+		}
+		return line + " " + level + " " + color(colorCyan, e.Logger) + " " + strings.Join(strings.Fields(e.Message), " ")
+	case *odata.AuditLogEntry:
+		return line + " " + color(colorCyan, e.UserName) + " " + strings.Join(strings.Fields(e.Description), " ") + " " + color(colorBold, e.ObjectType+" "+e.ObjectName)
+	}
+	kind := entryField(entry, "Type")
+	if kind == "" {
+		kind = entryType(entry)
+	}
+	return line + " " + color(colorBold, kind) + " " + entrySummary(entry)
+}
+
+// Flush prints any buffered output.
+func (s *ConsoleSink) Flush() error {
+	return s.writer.Flush()
+}
+
+// Close prints any buffered output.
+func (s *ConsoleSink) Close() error {
+	return s.Flush()
+}
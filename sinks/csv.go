@@ -0,0 +1,133 @@
+package sinks
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// CSVSink writes transaction log entries into CSV files, one per cube, in which the tuple has been
+// expanded into a column per dimension of the cube, making them easy to load into Excel or a
+// relational database. Entries originating from a named server are written into separate files.
+type CSVSink struct {
+	dir        string
+	dimensions func(server string, cube string) ([]string, error)
+	files      map[string]*csvFile
+}
+
+// csvFile is the CSV file, and the writer writing into it, for a single cube.
+type csvFile struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// NewCSVSink creates and returns a new CSVSink writing files, named after the cube, prefixed by the
+// server's name if it has one, into the given directory. The dimensions function is used to resolve
+// the dimensions, in order, of a cube on a server.
+func NewCSVSink(dir string, dimensions func(server string, cube string) ([]string, error)) *CSVSink {
+	s := new(CSVSink)
+	s.dir = dir
+	s.dimensions = dimensions
+	s.files = map[string]*csvFile{}
+
+	return s
+}
+
+// Write writes the transaction log entry as a record to the CSV file of its cube.
+func (s *CSVSink) Write(entry interface{}) error {
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return errors.New("csv sink only supports transaction log entries")
+	}
+
+	f, err := s.file(txnLogEntry.Server, txnLogEntry.Cube)
+	if err != nil {
+		return err
+	}
+
+	record := []string{strconv.Itoa(txnLogEntry.ID), txnLogEntry.ChangeSetID, txnLogEntry.TimeStamp, txnLogEntry.User}
+	record = append(record, txnLogEntry.Tuple...)
+	record = append(record, csvValue(txnLogEntry.OldValue), csvValue(txnLogEntry.NewValue))
+	return f.writer.Write(record)
+}
+
+// file returns the CSV file for the cube on the server, creating it, including its header, if need be.
+func (s *CSVSink) file(server string, cube string) (*csvFile, error) {
+	name := cube + ".csv"
+	if server != "" {
+		name = server + "." + name
+	}
+	if f, ok := s.files[name]; ok {
+		return f, nil
+	}
+
+	dimensions, err := s.dimensions(server, cube)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f := &csvFile{file: file, writer: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		header := []string{"ID", "ChangeSetID", "TimeStamp", "User"}
+		header = append(header, dimensions...)
+		header = append(header, "OldValue", "NewValue")
+		if err := f.writer.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	s.files[name] = f
+	return f, nil
+}
+
+// Flush writes any buffered records to the files.
+func (s *CSVSink) Flush() error {
+	for _, f := range s.files {
+		f.writer.Flush()
+		if err := f.writer.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes any buffered records and closes all files.
+func (s *CSVSink) Close() error {
+	err := s.Flush()
+	for name, f := range s.files {
+		if cerr := f.file.Close(); err == nil {
+			err = cerr
+		}
+		delete(s.files, name)
+	}
+	return err
+}
+
+// csvValue returns the representation of a cell value in a CSV file. Numeric values are written
+// without exponent, so they can be loaded as numbers, string values are written as is.
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,147 @@
+package sinks
+
+import (
+	"errors"
+	"time"
+)
+
+// PermanentError is returned by sinks rejecting entries permanently, as in delivering them again
+// would fail again, for example because the target doesn't accept them as is. Returned by Write,
+// only the entry being written got rejected. Returned by Flush, the sink discarded all entries
+// written since the last flush, the Entries rejected if known, otherwise all of them.
+type PermanentError struct {
+	Err     error
+	Entries []interface{}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent returns true if the error, or any error it wraps, is a PermanentError.
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// isPermanentStatus returns true if the status code of a response means the request got rejected
+// and sending it again won't make a difference.
+func isPermanentStatus(statusCode int) bool {
+	return statusCode/100 == 4 && statusCode != 408 && statusCode != 429
+}
+
+// DeadLetter is the record written to the dead-letter sink for every entry permanently rejected.
+type DeadLetter struct {
+	Type  string      `json:"Type"`
+	Time  string      `json:"Time"`
+	Sink  string      `json:"Sink"`
+	Error string      `json:"Error"`
+	Entry interface{} `json:"Entry"`
+}
+
+// DeadLetterSink delivers the entries written to it to the sink it wraps, writing the entries that
+// sink permanently rejects, together with the reason, to the dead-letter sink instead of failing,
+// so one bad entry doesn't block, or get dropped silently with, everything else. As a sink can
+// reject a whole batch at once, the entries written since the last flush are kept, and if rejected
+// as a whole delivered again one by one, singling out the offending entries. Any other error is
+// returned as is.
+type DeadLetterSink struct {
+	name        string
+	sink        Sink
+	deadLetters Sink
+	pending     []interface{}
+
+	// OnDeadLetter, if set, is called for every entry written to the dead-letter sink.
+	OnDeadLetter func(entry interface{}, err error)
+}
+
+// NewDeadLetterSink creates and returns a new DeadLetterSink delivering to the sink, named name,
+// writing any entries it permanently rejects to the deadLetters sink, which, as it can be shared by
+// multiple sinks, is not closed by this sink.
+func NewDeadLetterSink(name string, sink Sink, deadLetters Sink) *DeadLetterSink {
+	s := new(DeadLetterSink)
+	s.name = name
+	s.sink = sink
+	s.deadLetters = deadLetters
+
+	return s
+}
+
+// Write writes the entry to the wrapped sink, or, if rejected, to the dead-letter sink.
+func (s *DeadLetterSink) Write(entry interface{}) error {
+	err := s.sink.Write(entry)
+	if IsPermanent(err) {
+		return s.deadLetter(entry, err)
+	}
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, entry)
+	return nil
+}
+
+// Flush flushes the wrapped sink, writing the entries it rejected to the dead-letter sink.
+func (s *DeadLetterSink) Flush() error {
+	pending := s.pending
+	s.pending = nil
+
+	err := s.sink.Flush()
+	var permanentErr *PermanentError
+	if !errors.As(err, &permanentErr) {
+		return err
+	}
+	if len(permanentErr.Entries) > 0 {
+		for _, entry := range permanentErr.Entries {
+			if err := s.deadLetter(entry, permanentErr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Deliver the rejected batch one entry at a time to find out which entries got it rejected
+	for _, entry := range pending {
+		err := s.sink.Write(entry)
+		if err == nil {
+			err = s.sink.Flush()
+		}
+		if IsPermanent(err) {
+			err = s.deadLetter(entry, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes the wrapped sink and closes it.
+func (s *DeadLetterSink) Close() error {
+	err := s.Flush()
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// deadLetter writes the entry, rejected with err, to the dead-letter sink.
+func (s *DeadLetterSink) deadLetter(entry interface{}, err error) error {
+	if s.OnDeadLetter != nil {
+		s.OnDeadLetter(entry, err)
+	}
+	deadLetter := &DeadLetter{
+		Type:  "DeadLetter",
+		Time:  time.Now().UTC().Format(time.RFC3339),
+		Sink:  s.name,
+		Error: err.Error(),
+		Entry: entry,
+	}
+	if err := s.deadLetters.Write(deadLetter); err != nil {
+		return err
+	}
+	return s.deadLetters.Flush()
+}
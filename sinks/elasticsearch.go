@@ -0,0 +1,212 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// indexPatternPlaceholder matches the placeholders, either {type} or a Go time layout like
+// {2006.01}, in an index name pattern.
+var indexPatternPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// ElasticsearchSink indexes entries into Elasticsearch, or OpenSearch, using the _bulk API.
+// Entries are indexed into the index named by the index pattern in which {type} is replaced by the
+// type of the entry, txn or msg, and any other placeholder is considered a Go time layout which is
+// applied to the TimeStamp of the entry, i.e. tm1-{type}-{2006.01} yields tm1-txn-2024.06.
+type ElasticsearchSink struct {
+	client       *http.Client
+	url          string
+	indexPattern string
+	authorize    func(*http.Request)
+	lines        [][]byte
+	entries      []interface{}
+	maxRetries   int
+}
+
+// NewElasticsearchSink creates and returns a new ElasticsearchSink for the cluster at the given
+// URL, installing an index template mapping TimeStamp as a date for the indices it writes to. The
+// authorize function, if any, is called to add credentials to every request.
+func NewElasticsearchSink(url string, indexPattern string, authorize func(*http.Request)) (*ElasticsearchSink, error) {
+	s := new(ElasticsearchSink)
+	s.client = &http.Client{Timeout: time.Minute}
+	s.url = strings.TrimSuffix(url, "/")
+	s.indexPattern = indexPattern
+	s.authorize = authorize
+	s.maxRetries = 5
+
+	if err := s.installTemplate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// installTemplate installs the index template mapping the TimeStamp field to a date.
+func (s *ElasticsearchSink) installTemplate() error {
+	template := map[string]interface{}{
+		"index_patterns": []string{indexPatternPlaceholder.ReplaceAllString(s.indexPattern, "*")},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"TimeStamp": map[string]string{"type": "date"},
+				},
+			},
+		},
+	}
+	body, _ := json.Marshal(template)
+	resp, err := s.do("PUT", "/_index_template/tm1-blackhawk", "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to install index template, server responded with: %s\r\n%s", resp.Status, msg)
+	}
+	return nil
+}
+
+// Write queues the entry to be indexed on the next flush.
+func (s *ElasticsearchSink) Write(entry interface{}) error {
+	source, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.index(entry)}})
+	s.lines = append(s.lines, append(append(action, '\n'), append(source, '\n')...))
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// index returns the name of the index the entry gets indexed into.
+func (s *ElasticsearchSink) index(entry interface{}) string {
+	timeStamp, err := time.Parse(time.RFC3339, entryField(entry, "TimeStamp"))
+	if err != nil {
+		timeStamp = time.Now()
+	}
+	return indexPatternPlaceholder.ReplaceAllStringFunc(s.indexPattern, func(placeholder string) string {
+		layout := placeholder[1 : len(placeholder)-1]
+		if layout == "type" {
+			return entryType(entry)
+		}
+		return timeStamp.UTC().Format(layout)
+	})
+}
+
+// Flush indexes all queued entries, retrying the entries rejected with 429 Too Many Requests,
+// with an exponentially growing delay, until they are all indexed. Entries rejected for any other
+// reason, like not matching the mapping of the index, are returned in a PermanentError.
+func (s *ElasticsearchSink) Flush() error {
+	delay := time.Second
+	var rejected *PermanentError
+	for attempt := 0; len(s.lines) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > s.maxRetries {
+				return fmt.Errorf("%d entries still rejected after %d retries", len(s.lines), s.maxRetries)
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		results, err := s.bulk(s.lines)
+		if err != nil {
+			if IsPermanent(err) {
+				s.lines, s.entries = nil, nil
+			}
+			return err
+		}
+
+		// Retry the entries rejected because the cluster was too busy
+		var lines [][]byte
+		var entries []interface{}
+		for i, result := range results {
+			if result.Status == http.StatusTooManyRequests {
+				lines = append(lines, s.lines[i])
+				entries = append(entries, s.entries[i])
+			} else if result.Status/100 != 2 {
+				if rejected == nil {
+					rejected = &PermanentError{Err: fmt.Errorf("unable to index entry, server responded with: %d %s", result.Status, result.Error)}
+				}
+				rejected.Entries = append(rejected.Entries, s.entries[i])
+			}
+		}
+		s.lines, s.entries = lines, entries
+	}
+	if rejected != nil {
+		return rejected
+	}
+	return nil
+}
+
+// bulkResult is the result of indexing a single entry using the _bulk API.
+type bulkResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// bulk indexes the entries, passed as action and source line pairs, using a single request to the
+// _bulk API and returns the result for every entry, or none if all entries were indexed.
+func (s *ElasticsearchSink) bulk(lines [][]byte) ([]bulkResult, error) {
+	resp, err := s.do("POST", "/_bulk", "application/x-ndjson", bytes.Join(lines, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		results := make([]bulkResult, len(lines))
+		for i := range results {
+			results[i].Status = http.StatusTooManyRequests
+		}
+		return results, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("bulk request failed, server responded with: %s\r\n%s", resp.Status, msg)
+		if isPermanentStatus(resp.StatusCode) {
+			err = &PermanentError{Err: err}
+		}
+		return nil, err
+	}
+
+	res := struct {
+		Errors bool                    `json:"errors"`
+		Items  []map[string]bulkResult `json:"items"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if !res.Errors {
+		return nil, nil
+	}
+
+	results := make([]bulkResult, len(res.Items))
+	for i, item := range res.Items {
+		for _, result := range item {
+			results[i] = result
+		}
+	}
+	return results, nil
+}
+
+// do executes a request against the cluster.
+func (s *ElasticsearchSink) do(method string, path string, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.authorize != nil {
+		s.authorize(req)
+	}
+	return s.client.Do(req)
+}
+
+// Close indexes any queued entries.
+func (s *ElasticsearchSink) Close() error {
+	return s.Flush()
+}
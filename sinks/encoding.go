@@ -0,0 +1,115 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoder encodes the entries written to a sink into the payload of the messages it publishes.
+type Encoder interface {
+	// Encode returns the entry encoded.
+	Encode(entry interface{}) ([]byte, error)
+	// ContentType returns the media type of the encoded entries.
+	ContentType() string
+}
+
+// NewEncoder returns the encoder for the format, json, the default, cbor or msgpack. Avro encoders,
+// requiring more configuration, are created using NewAvroEncoder.
+func NewEncoder(format string) (Encoder, error) {
+	switch format {
+	case "", "json":
+		return jsonEncoder{}, nil
+	case "cbor":
+		return cborEncoder{}, nil
+	case "msgpack":
+		return msgpackEncoder{}, nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// encode encodes the entry using the encoder, as compact JSON if there is none.
+func encode(encoder Encoder, entry interface{}) ([]byte, error) {
+	if encoder == nil {
+		return json.Marshal(entry)
+	}
+	return encoder.Encode(entry)
+}
+
+// jsonEncoder encodes entries as compact JSON.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(entry interface{}) ([]byte, error) {
+	return json.Marshal(entry)
+}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+// cborEncoder encodes entries as CBOR, holding the same fields as their JSON encoding.
+type cborEncoder struct{}
+
+func (cborEncoder) Encode(entry interface{}) ([]byte, error) {
+	v, err := normalize(entry)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(v)
+}
+
+func (cborEncoder) ContentType() string {
+	return "application/cbor"
+}
+
+// msgpackEncoder encodes entries as MessagePack, holding the same fields as their JSON encoding.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Encode(entry interface{}) ([]byte, error) {
+	v, err := normalize(entry)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(v)
+}
+
+func (msgpackEncoder) ContentType() string {
+	return "application/msgpack"
+}
+
+// normalize returns the entry as its JSON encoding decoded into maps, slices and scalars, so binary
+// encodings hold the same fields, by the same names, as the JSON encoding. Whole numbers are
+// returned as integers, which binary encodings store more compactly.
+func normalize(entry interface{}) (interface{}, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return compactNumbers(v), nil
+}
+
+// compactNumbers replaces, recursively, the whole numbers in the decoded JSON value by integers.
+func compactNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			value[key] = compactNumbers(field)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = compactNumbers(item)
+		}
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value)
+		}
+	}
+	return v
+}
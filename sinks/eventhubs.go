@@ -0,0 +1,61 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// eventHubsMaxBatchBytes is the maximum size of a batch of events accepted by Event Hubs.
+const eventHubsMaxBatchBytes = 1024 * 1024
+
+// NewEventHubsSink creates and returns a KafkaSink publishing to an Azure Event Hub using the Kafka
+// protocol, which Event Hubs supports from the Standard tier up. The connection string, as in
+// Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=<name>;SharedAccessKey=<key>,
+// of either the namespace or the event hub, is used to authenticate. The event hub defaults to the
+// EntityPath of the connection string. Messages are keyed, and therefore partitioned, by the value
+// of the key field, i.e. Cube or User.
+func NewEventHubsSink(connectionString string, eventHub string, keyField string) (*KafkaSink, error) {
+	namespace, entityPath, err := parseConnectionString(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	if eventHub == "" {
+		eventHub = entityPath
+	}
+	if eventHub == "" {
+		return nil, fmt.Errorf("no event hub specified, nor does the connection string have an EntityPath")
+	}
+
+	s := NewKafkaSink([]string{namespace + ":9093"}, eventHub, keyField)
+	s.writer.BatchBytes = eventHubsMaxBatchBytes
+	s.writer.Transport = &kafka.Transport{
+		SASL: plain.Mechanism{Username: "$ConnectionString", Password: connectionString},
+		TLS:  &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	return s, nil
+}
+
+// parseConnectionString returns the host name of the namespace, and the entity path, if any, of an
+// Event Hubs connection string.
+func parseConnectionString(connectionString string) (string, string, error) {
+	var endpoint, entityPath string
+	for _, part := range strings.Split(connectionString, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "endpoint":
+			endpoint = strings.TrimSpace(value)
+		case "entitypath":
+			entityPath = strings.TrimSpace(value)
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid Event Hubs connection string, no valid Endpoint found")
+	}
+	return u.Hostname(), entityPath, nil
+}
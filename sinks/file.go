@@ -0,0 +1,160 @@
+package sinks
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// FileRotation defines when the file a FileSink appends to gets rotated, i.e. renamed, by suffixing
+// it with the time of rotation, and replaced by a new, empty, file.
+type FileRotation struct {
+	// MaxSize is the size, in bytes, a file can grow to before it gets rotated, 0 to disable.
+	MaxSize int64
+	// MaxAge is the time after which a file gets rotated, 0 to disable.
+	MaxAge time.Duration
+	// Compress, if set, gzip compresses rotated files.
+	Compress bool
+}
+
+// FileSink appends every entry written to it, as a line of JSON, to a file, rotating the file as
+// defined by its FileRotation.
+type FileSink struct {
+	path     string
+	rotation FileRotation
+	file     *os.File
+	opened   time.Time
+	size     int64
+	writer   *bufio.Writer
+	encoder  *json.Encoder
+}
+
+// NewFileSink creates and returns a new FileSink appending to the file at the given path.
+func NewFileSink(path string, rotation FileRotation) (*FileSink, error) {
+	s := new(FileSink)
+	s.path = path
+	s.rotation = rotation
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open opens, or creates, the file to append the entries to.
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.opened = time.Now()
+	s.size = info.Size()
+	s.writer = bufio.NewWriter(countingWriter{file, &s.size})
+	s.encoder = json.NewEncoder(s.writer)
+	return nil
+}
+
+// Write appends the entry to the file, rotating the file first if it's due. The encoder
+// terminates every entry with a newline.
+func (s *FileSink) Write(entry interface{}) error {
+	if s.rotationDue() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	return s.encoder.Encode(entry)
+}
+
+// rotationDue returns true if the file has grown too large or old.
+func (s *FileSink) rotationDue() bool {
+	size := s.size + int64(s.writer.Buffered())
+	if s.rotation.MaxSize > 0 && size >= s.rotation.MaxSize {
+		return true
+	}
+	return s.rotation.MaxAge > 0 && size > 0 && time.Since(s.opened) >= s.rotation.MaxAge
+}
+
+// rotate closes and renames the current file, compressing it if so requested, and opens a new one.
+func (s *FileSink) rotate() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	rotatedPath := s.path + "." + time.Now().Format("2006-01-02T15-04-05.000")
+	if err := os.Rename(s.path, rotatedPath); err != nil {
+		return err
+	}
+	if s.rotation.Compress {
+		if err := compressFile(rotatedPath); err != nil {
+			return err
+		}
+	}
+	return s.open()
+}
+
+// Flush writes any buffered entries to the file and commits them to stable storage.
+func (s *FileSink) Flush() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close flushes any buffered entries and closes the file.
+func (s *FileSink) Close() error {
+	err := s.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compressFile gzip compresses the file at the given path into a file with the same name with a
+// .gz extension added, and removes the original file once successfully compressed.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// countingWriter is an io.Writer keeping count of the number of bytes written through it.
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.count += int64(n)
+	return n, err
+}
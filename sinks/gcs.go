@@ -0,0 +1,48 @@
+package sinks
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GCSStore is an ObjectStore uploading objects to a Google Cloud Storage bucket.
+type GCSStore struct {
+	client     *http.Client
+	url        string
+	kmsKeyName string
+}
+
+// NewGCSStore creates and returns a new GCSStore uploading objects to the bucket. The endpoint,
+// https://storage.googleapis.com if not specified, can point to an emulator. The KMS key, if
+// specified, as in projects/p/locations/l/keyRings/r/cryptoKeys/k, is used to encrypt the objects
+// instead of the default encryption of the bucket.
+func NewGCSStore(bucket string, endpoint string, kmsKeyName string) (*GCSStore, error) {
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	client, err := newGoogleClient(endpoint, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, err
+	}
+	// Segments can take longer to upload than API requests
+	client.Timeout = 30 * time.Minute
+
+	s := new(GCSStore)
+	s.client = client
+	s.url = strings.TrimSuffix(endpoint, "/") + "/upload/storage/v1/b/" + url.PathEscape(bucket) + "/o"
+	s.kmsKeyName = kmsKeyName
+
+	return s, nil
+}
+
+// Upload uploads the file as the object with the given key into the bucket.
+func (s *GCSStore) Upload(key string, file *os.File, size int64, contentType string) error {
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	if s.kmsKeyName != "" {
+		query.Set("kmsKeyName", s.kmsKeyName)
+	}
+	return putObject(s.client, "POST", s.url+"?"+query.Encode(), http.Header{"Content-Type": {contentType}}, file, size)
+}
@@ -0,0 +1,176 @@
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// The size of, and maximum number of, the chunks a GELF message sent over udp is split into.
+const (
+	gelfChunkSize = 1420
+	gelfMaxChunks = 128
+)
+
+// GELFConfig defines the Graylog input a GELFSink sends entries to.
+type GELFConfig struct {
+	// Network is the transport, udp, tcp or tls, and Address the host and port of the GELF input.
+	Network string
+	Address string
+	// TLS is the TLS configuration used for the tls transport.
+	TLS *tls.Config
+}
+
+// GELFSink sends every entry written to it as a GELF message to Graylog, i.e. for a SIEM. Messages
+// carry a summary of the entry as short message, its JSON representation as full message, and its
+// details, like the cube, user and tuple, as additional fields, with a level derived from the entry.
+// Messages are sent gzip compressed, and chunked if need be, over udp or, null byte delimited, over
+// a tcp, or tls, connection, which is re-established if it fails.
+type GELFSink struct {
+	config   GELFConfig
+	hostname string
+	conn     net.Conn
+	writer   *bufio.Writer
+}
+
+// NewGELFSink creates and returns a new GELFSink connected to the GELF input.
+func NewGELFSink(config GELFConfig) (*GELFSink, error) {
+	s := new(GELFSink)
+	s.config = config
+	s.hostname, _ = os.Hostname()
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect connects to the GELF input.
+func (s *GELFSink) connect() error {
+	conn, err := dialLogServer(s.config.Network, s.config.Address, s.config.TLS)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// Write sends the entry as a message, buffered for tcp and tls until the next flush.
+func (s *GELFSink) Write(entry interface{}) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	fullMessage, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	msgType := entryField(entry, "Type")
+	if msgType == "" {
+		msgType = entryType(entry)
+	}
+	message := map[string]interface{}{
+		"version":       "1.1",
+		"host":          s.hostname,
+		"short_message": entrySummary(entry),
+		"full_message":  string(fullMessage),
+		"timestamp":     float64(entryTime(entry).UnixMilli()) / 1000,
+		"level":         entrySeverity(entry),
+		"_type":         msgType,
+	}
+	for _, detail := range entryDetails(entry) {
+		// _id is reserved
+		if detail[0] == "id" {
+			detail[0] = "entryId"
+		}
+		message["_"+detail[0]] = detail[1]
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if s.config.Network == "udp" {
+		err = s.send(data)
+	} else {
+		_, err = s.writer.Write(append(data, 0))
+	}
+	if err != nil && !IsPermanent(err) {
+		s.disconnect()
+	}
+	return err
+}
+
+// send sends the message, gzip compressed, as a datagram, or, if too large, as chunks.
+func (s *GELFSink) send(data []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	data = compressed.Bytes()
+	if len(data) <= gelfChunkSize {
+		_, err := s.conn.Write(data)
+		return err
+	}
+
+	count := (len(data) + gelfChunkSize - 1) / gelfChunkSize
+	if count > gelfMaxChunks {
+		return &PermanentError{Err: fmt.Errorf("GELF message of %d bytes exceeds the maximum size", len(data))}
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		chunk := data[i*gelfChunkSize:]
+		if len(chunk) > gelfChunkSize {
+			chunk = chunk[:gelfChunkSize]
+		}
+		header := append([]byte{0x1e, 0x0f}, id...)
+		if _, err := s.conn.Write(append(append(header, byte(i), byte(count)), chunk...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends any buffered messages.
+func (s *GELFSink) Flush() error {
+	if s.conn == nil {
+		return nil
+	}
+	if err := s.writer.Flush(); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+// disconnect closes the connection, after a failure, to be re-established on the next write.
+func (s *GELFSink) disconnect() {
+	s.conn.Close()
+	s.conn = nil
+}
+
+// Close sends any buffered messages and closes the connection.
+func (s *GELFSink) Close() error {
+	err := s.Flush()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+		s.conn = nil
+	}
+	return err
+}
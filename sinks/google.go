@@ -0,0 +1,75 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// newGoogleClient returns the client used to call the Google Cloud API at the endpoint, authorized
+// using the Application Default Credentials, unless the endpoint is an emulator, reached over plain
+// http, which doesn't require authorization.
+func newGoogleClient(endpoint string, scope string) (*http.Client, error) {
+	if strings.HasPrefix(endpoint, "http://") {
+		return &http.Client{Timeout: time.Minute}, nil
+	}
+	client, err := google.DefaultClient(context.Background(), scope)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = time.Minute
+	return client, nil
+}
+
+// googleRequest sends the body, if any, as JSON, to the Google Cloud API and decodes the response
+// into res, if any. Requests rejected as invalid, typically because of the entries they hold, are
+// returned as a PermanentError.
+func googleRequest(client *http.Client, method string, url string, body interface{}, res interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = &googleError{StatusCode: resp.StatusCode, Err: fmt.Errorf("Google Cloud responded with: %s\r\n%s", resp.Status, msg)}
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+			err = &PermanentError{Err: err}
+		}
+		return err
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// googleError is the error returned if the Google Cloud API responded with an unexpected status.
+type googleError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *googleError) Error() string {
+	return e.Err.Error()
+}
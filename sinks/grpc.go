@@ -0,0 +1,230 @@
+package sinks
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/feed"
+)
+
+// GRPCConfig defines how a GRPCSink serves its subscribers.
+type GRPCConfig struct {
+	// Addr is the address, as in :50051, the Feed service is served on.
+	Addr string
+	// Buffer is the number of entries buffered for every subscriber, 256 if not specified.
+	Buffer int
+	// Block, if set, makes writing wait for subscribers not keeping up once their buffer is full,
+	// holding up the tracker, rather than disconnecting them with RESOURCE_EXHAUSTED.
+	Block bool
+	// Options are the options of the gRPC server, as in its credentials.
+	Options []grpc.ServerOption
+	// Compile, if set, compiles the filter expressions subscribers pass, as for the BroadcastSink.
+	Compile func(filter string) (func(entry interface{}) bool, error)
+}
+
+// GRPCSink serves the entries written to it to any number of subscribers calling the Subscribe
+// RPC of the Feed service, as defined by feed/feed.proto, every subscriber receiving the entries
+// matching the filters of its request as strongly typed events. Entries are streamed as they are
+// written, subscribers only receive the entries written while subscribed.
+type GRPCSink struct {
+	feed.UnimplementedFeedServer
+
+	config GRPCConfig
+	server *grpc.Server
+	closed chan struct{} // Closed once the sink is closed
+
+	mutex       sync.Mutex
+	subscribers map[*grpcSubscriber]bool
+}
+
+// grpcSubscriber is a call of the Subscribe RPC.
+type grpcSubscriber struct {
+	match  func(entry interface{}) bool
+	events chan *feed.Event
+	done   chan struct{} // Closed once the call ended
+	slow   chan struct{} // Closed once the subscriber didn't keep up
+}
+
+// NewGRPCSink creates and returns a new GRPCSink, serving the Feed service on the address.
+func NewGRPCSink(config GRPCConfig) (*GRPCSink, error) {
+	if config.Buffer <= 0 {
+		config.Buffer = 256
+	}
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(GRPCSink)
+	s.config = config
+	s.closed = make(chan struct{})
+	s.subscribers = map[*grpcSubscriber]bool{}
+	s.server = grpc.NewServer(config.Options...)
+	feed.RegisterFeedServer(s.server, s)
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// Write streams the entry to the subscribers whose filters it matches.
+func (s *GRPCSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	var subscribers []*grpcSubscriber
+	for sub := range s.subscribers {
+		if sub.match(entry) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	s.mutex.Unlock()
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	event, err := feed.NewEvent(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	for _, sub := range subscribers {
+		select {
+		case sub.events <- event:
+			continue
+		case <-sub.done:
+			continue
+		default:
+		}
+		if !s.config.Block {
+			// Disconnect the subscriber, which can subscribe again, rather than silently skipping entries
+			s.unsubscribe(sub)
+			close(sub.slow)
+			continue
+		}
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-s.closed:
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, entries are streamed as they are written.
+func (s *GRPCSink) Flush() error {
+	return nil
+}
+
+// Close stops serving the Feed service, ending the calls of all subscribers.
+func (s *GRPCSink) Close() error {
+	close(s.closed)
+	s.server.GracefulStop()
+	return nil
+}
+
+// Subscribers returns the number of subscribers.
+func (s *GRPCSink) Subscribers() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subscribers)
+}
+
+// Subscribe streams the entries matching the request to the subscriber, until it cancels the call
+// or, unless writing waits for subscribers, doesn't keep up.
+func (s *GRPCSink) Subscribe(request *feed.SubscribeRequest, stream grpc.ServerStreamingServer[feed.Event]) error {
+	match, err := s.filter(request)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub := &grpcSubscriber{match: match, events: make(chan *feed.Event, s.config.Buffer), done: make(chan struct{}), slow: make(chan struct{})}
+	defer close(sub.done)
+	s.mutex.Lock()
+	s.subscribers[sub] = true
+	s.mutex.Unlock()
+	defer s.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.closed:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-sub.slow:
+			return status.Error(codes.ResourceExhausted, "subscriber too slow")
+		case event := <-sub.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// unsubscribe removes the subscriber.
+func (s *GRPCSink) unsubscribe(sub *grpcSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// filter returns the function matching the entries as specified by the request.
+func (s *GRPCSink) filter(request *feed.SubscribeRequest) (func(entry interface{}) bool, error) {
+	types := map[string]bool{}
+	for _, t := range request.Types {
+		switch t {
+		case feed.EventType_EVENT_TYPE_TRANSACTION:
+			types["txn"] = true
+		case feed.EventType_EVENT_TYPE_MESSAGE:
+			types["msg"] = true
+		case feed.EventType_EVENT_TYPE_AUDIT:
+			types["audit"] = true
+		case feed.EventType_EVENT_TYPE_OTHER:
+			types["entry"] = true
+		default:
+			return nil, fmt.Errorf("invalid type: %s", t)
+		}
+	}
+	cubes := lowerSet(request.Cubes)
+	users := lowerSet(request.Users)
+	servers := map[string]bool{}
+	for _, server := range request.Servers {
+		servers[server] = true
+	}
+	expression := func(entry interface{}) bool { return true }
+	if request.Filter != "" {
+		if s.config.Compile == nil {
+			return nil, fmt.Errorf("filter expressions are not supported")
+		}
+		var err error
+		if expression, err = s.config.Compile(request.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter: %s", err)
+		}
+	}
+
+	return func(entry interface{}) bool {
+		if len(types) > 0 && !types[entryType(entry)] {
+			return false
+		}
+		if len(cubes) > 0 && !cubes[strings.ToLower(entryField(entry, "Cube"))] {
+			return false
+		}
+		if len(users) > 0 && !users[strings.ToLower(entryField(entry, "User"))] && !users[strings.ToLower(entryField(entry, "UserName"))] {
+			return false
+		}
+		if len(servers) > 0 && !servers[entryField(entry, "Server")] {
+			return false
+		}
+		return expression(entry)
+	}, nil
+}
+
+// lowerSet returns the items, in lower case, as a set.
+func lowerSet(items []string) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range items {
+		set[strings.ToLower(item)] = true
+	}
+	return set
+}
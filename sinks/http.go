@@ -0,0 +1,181 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// httpChunkSize is the number of bytes of encoded entries collected before they're handed, as a
+// chunk, to the request streaming them to the target server.
+const httpChunkSize = 32 * 1024
+
+// DefaultMaxInFlightBytes is the default maximum number of bytes of encoded entries an HTTPSink
+// queues for the request streaming them to the target server.
+const DefaultMaxInFlightBytes = 1024 * 1024
+
+// HTTPSink streams the entries written to it, as one JSON document per flush, to a target server
+// using a POST request. The encoded entries are handed to the request through a bounded queue of
+// chunks, so writing blocks, applying backpressure to the tracker, while the target server can't
+// keep up, and a failing request is reported by the next Write instead of leaving it blocked.
+type HTTPSink struct {
+	client  *odata.Client
+	url     string
+	body    *httpRequestBody
+	buf     bytes.Buffer
+	encoder *json.Encoder
+
+	// MaxInFlightBytes, if set, is the maximum number of bytes, approximately, of encoded entries
+	// queued for the request, DefaultMaxInFlightBytes if not set. It has to be set before the first
+	// entry is written.
+	MaxInFlightBytes int
+
+	inFlight atomic.Int64 // Number of bytes queued for the request, but not read by it yet
+}
+
+// httpRequestBody is the body of the request streaming the entries, reading the chunks queued for it.
+type httpRequestBody struct {
+	sink     *HTTPSink
+	chunks   chan []byte
+	current  []byte
+	finished chan struct{} // Closed once the request has completed, err holding its result
+	err      error
+}
+
+// NewHTTPSink creates and returns a new HTTPSink posting to the specified URL.
+func NewHTTPSink(client *odata.Client, url string) *HTTPSink {
+	s := new(HTTPSink)
+	s.client = client
+	s.url = url
+	s.encoder = json.NewEncoder(&s.buf)
+
+	return s
+}
+
+// Write writes the entry into the request body, starting a new request if there isn't one yet.
+func (s *HTTPSink) Write(entry interface{}) error {
+	if s.body == nil {
+		s.start()
+		s.buf.WriteString("{ \"value\": [ ")
+	} else {
+		s.buf.WriteString(", ")
+	}
+	// Entry is JSON encoded here
+	if err := s.encoder.Encode(entry); err != nil {
+		return err
+	}
+	if s.buf.Len() < httpChunkSize {
+		return nil
+	}
+	return s.send()
+}
+
+// Flush completes the request body and waits for the target server to respond.
+func (s *HTTPSink) Flush() error {
+	if s.body == nil {
+		return nil
+	}
+	s.buf.WriteString("] }")
+	err := s.send()
+	close(s.body.chunks)
+	<-s.body.finished
+	if s.body.err != nil {
+		err = s.body.err
+	}
+
+	// Forget about whatever the request didn't read
+	for chunk := range s.body.chunks {
+		s.inFlight.Add(-int64(len(chunk)))
+	}
+	s.body = nil
+	s.buf.Reset()
+	return err
+}
+
+// Close flushes any outstanding entries.
+func (s *HTTPSink) Close() error {
+	return s.Flush()
+}
+
+// InFlightBytes returns the number of bytes of encoded entries queued for the request, but not read
+// by it yet.
+func (s *HTTPSink) InFlightBytes() int64 {
+	return s.inFlight.Load()
+}
+
+// start starts a new streaming POST request to the target server, reading the chunks queued for it.
+func (s *HTTPSink) start() {
+	maxInFlightBytes := s.MaxInFlightBytes
+	if maxInFlightBytes <= 0 {
+		maxInFlightBytes = DefaultMaxInFlightBytes
+	}
+	queueSize := maxInFlightBytes / httpChunkSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	body := &httpRequestBody{sink: s, chunks: make(chan []byte, queueSize), finished: make(chan struct{})}
+	s.body = body
+
+	go func() {
+		resp, err := s.client.ExecutePOSTRequest(s.url, "application/json", body)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("target server responded with: %s", resp.Status)
+			}
+			if isPermanentStatus(resp.StatusCode) {
+				err = &PermanentError{Err: err}
+			}
+		}
+		body.err = err
+		close(body.finished)
+	}()
+}
+
+// send queues the encoded entries collected so far for the request, waiting while the queue is full,
+// unless the request completed in the meantime, in which case nobody is reading the queue anymore.
+func (s *HTTPSink) send() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	chunk := make([]byte, s.buf.Len())
+	copy(chunk, s.buf.Bytes())
+	s.buf.Reset()
+
+	s.inFlight.Add(int64(len(chunk)))
+	select {
+	case s.body.chunks <- chunk:
+		return nil
+	case <-s.body.finished:
+		s.inFlight.Add(-int64(len(chunk)))
+		if s.body.err != nil {
+			return s.body.err
+		}
+		return errors.New("target server responded before receiving all entries")
+	}
+}
+
+// Read reads the chunks queued for the request, until the queue has been closed.
+func (b *httpRequestBody) Read(p []byte) (int, error) {
+	for len(b.current) == 0 {
+		chunk, ok := <-b.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		b.sink.inFlight.Add(-int64(len(chunk)))
+		b.current = chunk
+	}
+	n := copy(p, b.current)
+	b.current = b.current[n:]
+	return n, nil
+}
+
+// Close is called once the request is done with its body, which doesn't hold any resources.
+func (b *httpRequestBody) Close() error {
+	return nil
+}
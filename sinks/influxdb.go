@@ -0,0 +1,136 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replacers escaping the characters with a special meaning in the line protocol.
+var (
+	measurementReplacer = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", " ", `\`, `\\`)
+	tagReplacer         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", " ", `\`, `\\`)
+)
+
+// InfluxDBConfig defines the InfluxDB database an InfluxDBSink writes to.
+type InfluxDBConfig struct {
+	// URL is the URL of InfluxDB, as in http://localhost:8086.
+	URL string
+	// Org, Bucket and Token identify the bucket, and authorize writing to it, in InfluxDB 2 or later.
+	Org    string
+	Bucket string
+	Token  string
+	// Database, and, if authentication is enabled, User and Password, identify the database written
+	// to in InfluxDB 1, used if no bucket is specified.
+	Database string
+	User     string
+	Password string
+}
+
+// InfluxDBSink writes every numeric cell change, as a point, into InfluxDB, enabling time-series
+// charts of the data movement in TM1, i.e. in Grafana. Points are written to a measurement named
+// after the cube, tagged with the element of every dimension, the user and, if any, the server, with
+// the new value, and the change, as fields. Entries of any other kind are ignored.
+type InfluxDBSink struct {
+	client  *http.Client
+	url     string
+	config  InfluxDBConfig
+	points  *timeSeriesPoints
+	lines   bytes.Buffer
+	entries []interface{}
+}
+
+// NewInfluxDBSink creates and returns a new InfluxDBSink. The dimensions function is used to
+// resolve the dimensions, in order, of a cube on a server.
+func NewInfluxDBSink(config InfluxDBConfig, dimensions func(server string, cube string) ([]string, error)) (*InfluxDBSink, error) {
+	s := new(InfluxDBSink)
+	s.client = &http.Client{Timeout: time.Minute}
+	s.config = config
+	s.points = newTimeSeriesPoints(dimensions)
+	if config.Bucket != "" {
+		s.url = strings.TrimSuffix(config.URL, "/") + "/api/v2/write?" + url.Values{"org": {config.Org}, "bucket": {config.Bucket}, "precision": {"ms"}}.Encode()
+	} else if config.Database != "" {
+		s.url = strings.TrimSuffix(config.URL, "/") + "/write?" + url.Values{"db": {config.Database}, "precision": {"ms"}}.Encode()
+	} else {
+		return nil, fmt.Errorf("either a bucket or a database must be specified")
+	}
+
+	return s, nil
+}
+
+// Write queues the point for the entry, if it's a numeric cell change, to be written on the next
+// flush.
+func (s *InfluxDBSink) Write(entry interface{}) error {
+	point, err := s.points.point(entry)
+	if err != nil || point == nil {
+		return err
+	}
+
+	tags := map[string]string{"user": point.User, "server": point.Server}
+	for dimension, element := range point.Elements {
+		tags[dimension] = element
+	}
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	s.lines.WriteString(measurementReplacer.Replace(point.Cube))
+	for _, key := range keys {
+		s.lines.WriteString("," + tagReplacer.Replace(key) + "=" + tagReplacer.Replace(tags[key]))
+	}
+	fmt.Fprintf(&s.lines, " value=%s,change=%s %d\n",
+		strconv.FormatFloat(point.Value, 'f', -1, 64), strconv.FormatFloat(point.Value-point.OldValue, 'f', -1, 64), point.Time.UnixMilli())
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush writes all queued points.
+func (s *InfluxDBSink) Flush() error {
+	if s.lines.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(s.lines.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	} else if s.config.User != "" {
+		req.SetBasicAuth(s.config.User, s.config.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("InfluxDB responded with: %s\r\n%s", resp.Status, msg)
+		if !isPermanentStatus(resp.StatusCode) || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return err
+		}
+		// InfluxDB rejected the points, having written the valid ones, if any
+		err = &PermanentError{Err: err, Entries: s.entries}
+	}
+	s.lines.Reset()
+	s.entries = nil
+	return err
+}
+
+// Close writes any queued points.
+func (s *InfluxDBSink) Close() error {
+	return s.Flush()
+}
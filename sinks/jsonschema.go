@@ -0,0 +1,146 @@
+package sinks
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// jsonSchemaBaseURI is the base of the IDs of the JSON Schemas, being where they are published.
+const jsonSchemaBaseURI = "https://github.com/hubert-heijkers/tm1-blackhawk/schemas/"
+
+// JSONSchemaEncoder encodes entries as compact JSON, using the Confluent wire format, registering
+// the JSON Schema of every type of entry with the schema registry under the subject
+// <prefix>-<record name>, as for the AvroEncoder.
+type JSONSchemaEncoder struct {
+	registry *SchemaRegistry
+	prefix   string
+
+	mu      sync.Mutex
+	headers map[reflect.Type][]byte
+}
+
+// NewJSONSchemaEncoder creates and returns a new JSONSchemaEncoder registering its schemas with the
+// schema registry at the URL, using the prefix, typically the topic, for the subjects.
+func NewJSONSchemaEncoder(registryURL string, prefix string) *JSONSchemaEncoder {
+	e := new(JSONSchemaEncoder)
+	e.registry = NewSchemaRegistry(registryURL)
+	e.prefix = prefix
+	e.headers = map[reflect.Type][]byte{}
+
+	return e
+}
+
+// Encode returns the entry encoded as JSON, preceded by the header identifying its schema,
+// registering the schema if it's the first entry of its type.
+func (e *JSONSchemaEncoder) Encode(entry interface{}) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(entry)
+	e.mu.Lock()
+	header, ok := e.headers[t]
+	if !ok {
+		header, err = e.register(entry)
+		if err == nil {
+			e.headers[t] = header
+		}
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, header...), data...), nil
+}
+
+// ContentType returns the media type of JSON encoded entries.
+func (e *JSONSchemaEncoder) ContentType() string {
+	return "application/json"
+}
+
+// register registers the JSON Schema of the type of the entry, returning the header identifying it.
+func (e *JSONSchemaEncoder) register(entry interface{}) ([]byte, error) {
+	schema, err := JSONSchema(entry)
+	if err != nil {
+		return nil, err
+	}
+	record := ""
+	if t := indirectType(reflect.TypeOf(entry)); t.Kind() == reflect.Struct && !isTextMarshaler(t) {
+		record = avroNamespace + "." + avroName(t.Name())
+	}
+	id, err := e.registry.Register(registrySubject(e.prefix, record), "JSON", string(schema))
+	if err != nil {
+		return nil, err
+	}
+	return confluentHeader(id), nil
+}
+
+// JSONSchema returns the JSON Schema, draft 2020-12, of the JSON encoding of entries of the type of
+// the entry, identified by the name of the type and the SchemaVersion of the entries.
+func JSONSchema(entry interface{}) ([]byte, error) {
+	t := indirectType(reflect.TypeOf(entry))
+	schema := jsonSchemaOf(t)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	if t.Kind() == reflect.Struct && !isTextMarshaler(t) {
+		schema["$id"] = jsonSchemaBaseURI + t.Name() + ".v" + strconv.Itoa(odata.SchemaVersion) + ".schema.json"
+		schema["title"] = t.Name()
+		if properties, ok := schema["properties"].(map[string]interface{}); ok && properties["SchemaVersion"] != nil {
+			properties["SchemaVersion"] = map[string]interface{}{"type": "integer", "const": odata.SchemaVersion}
+		}
+	}
+	return json.Marshal(schema)
+}
+
+// jsonSchemaOf returns the JSON Schema of the JSON encoding of values of the type.
+func jsonSchemaOf(t reflect.Type) map[string]interface{} {
+	if isTextMarshaler(t) {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "null"}, jsonSchemaOf(t.Elem())}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": jsonSchemaOf(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": jsonSchemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, field := range avroFields(t) {
+			tag := field.Tag.Get("json")
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchemaOf(field.Type)
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,70 @@
+package sinks
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes every entry written to it as a message to a Kafka topic. Messages are keyed
+// by the value of the configured key field, i.e. Cube or ChangeSetID, which, as messages get
+// partitioned by key, guarantees that entries sharing a key are consumed in order.
+type KafkaSink struct {
+	writer   *kafka.Writer
+	keyField string
+	messages []kafka.Message
+
+	// Encoder, if set, encodes the entries, as compact JSON if not set, the content type being passed
+	// in the content-type header of every message.
+	Encoder Encoder
+}
+
+// NewKafkaSink creates and returns a new KafkaSink publishing to the topic on the given brokers.
+func NewKafkaSink(brokers []string, topic string, keyField string) *KafkaSink {
+	s := new(KafkaSink)
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	s.keyField = keyField
+
+	return s
+}
+
+// Write queues the entry as a message to be published on the next flush.
+func (s *KafkaSink) Write(entry interface{}) error {
+	value, err := encode(s.Encoder, entry)
+	if err != nil {
+		return err
+	}
+	message := kafka.Message{
+		Key:   []byte(entryField(entry, s.keyField)),
+		Value: value,
+	}
+	if s.Encoder != nil {
+		message.Headers = []kafka.Header{{Key: "content-type", Value: []byte(s.Encoder.ContentType())}}
+	}
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// Flush publishes all queued messages and waits for the brokers to acknowledge them.
+func (s *KafkaSink) Flush() error {
+	if len(s.messages) == 0 {
+		return nil
+	}
+	err := s.writer.WriteMessages(context.Background(), s.messages...)
+	s.messages = nil
+	return err
+}
+
+// Close flushes any queued messages and closes the connection to the brokers.
+func (s *KafkaSink) Close() error {
+	err := s.Flush()
+	if cerr := s.writer.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// The limits Kinesis imposes on a PutRecords request and its records.
+const (
+	kinesisMaxRecords      = 500
+	kinesisMaxRequestBytes = 5 * 1024 * 1024
+	kinesisMaxRecordBytes  = 1024 * 1024
+	kinesisMaxPartitionKey = 256
+)
+
+// kinesisDefaultPartitionKey is the partition key of entries without a value for the key field.
+const kinesisDefaultPartitionKey = "blackhawk"
+
+// KinesisSink puts every entry written to it as a record into an AWS Kinesis data stream. Records
+// are partitioned by the value of the configured key field, i.e. Cube or User, which guarantees
+// that entries sharing a key are consumed in order. Records are put in batches within the limits
+// of the PutRecords API, and records rejected because the throughput of a shard got exceeded are
+// put again, with an exponentially growing delay, until they are all accepted.
+type KinesisSink struct {
+	client     *kinesis.Client
+	stream     string
+	keyField   string
+	records    []types.PutRecordsRequestEntry
+	maxRetries int
+
+	// Encoder, if set, encodes the entries, as compact JSON if not set.
+	Encoder Encoder
+}
+
+// NewKinesisSink creates and returns a new KinesisSink putting records into the stream. The
+// credentials, and, unless specified, the region, are taken from the standard AWS sources: the
+// environment, the shared configuration and credentials files, or the IAM role of the instance,
+// task or pod. The endpoint, if specified, overrides the endpoint of the region, i.e. to use
+// LocalStack.
+func NewKinesisSink(stream string, region string, endpoint string, keyField string) (*KinesisSink, error) {
+	var options []func(*config.LoadOptions) error
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(KinesisSink)
+	s.client = kinesis.NewFromConfig(cfg, func(o *kinesis.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	s.stream = stream
+	s.keyField = keyField
+	s.maxRetries = 5
+
+	return s, nil
+}
+
+// Write queues the entry as a record to be put on the next flush. Entries too large to fit in a
+// record are rejected.
+func (s *KinesisSink) Write(entry interface{}) error {
+	data, err := encode(s.Encoder, entry)
+	if err != nil {
+		return err
+	}
+	key := entryField(entry, s.keyField)
+	if key == "" {
+		key = kinesisDefaultPartitionKey
+	}
+	if len(key) > kinesisMaxPartitionKey {
+		key = key[:kinesisMaxPartitionKey]
+	}
+	if len(data)+len(key) > kinesisMaxRecordBytes {
+		return &PermanentError{Err: fmt.Errorf("entry of %d bytes exceeds the maximum size of a Kinesis record", len(data))}
+	}
+	s.records = append(s.records, types.PutRecordsRequestEntry{Data: data, PartitionKey: aws.String(key)})
+	return nil
+}
+
+// Flush puts all queued records, retrying the records rejected because the throughput of their
+// shard got exceeded, or due to an internal failure, until they are all accepted.
+func (s *KinesisSink) Flush() error {
+	delay := time.Second
+	for attempt := 0; len(s.records) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > s.maxRetries {
+				return fmt.Errorf("%d records still rejected after %d retries", len(s.records), s.maxRetries)
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var rejected []types.PutRecordsRequestEntry
+		for len(s.records) > 0 {
+			n := s.batch()
+			failed, err := s.put(s.records[:n])
+			if err != nil {
+				s.records = append(rejected, s.records...)
+				return err
+			}
+			rejected = append(rejected, failed...)
+			s.records = s.records[n:]
+		}
+		s.records = rejected
+	}
+	s.records = nil
+	return nil
+}
+
+// batch returns the number of queued records that fit in a single PutRecords request.
+func (s *KinesisSink) batch() int {
+	size := 0
+	for i, record := range s.records {
+		size += len(record.Data) + len(*record.PartitionKey)
+		if i == kinesisMaxRecords || size > kinesisMaxRequestBytes {
+			return i
+		}
+	}
+	return len(s.records)
+}
+
+// put puts the records using a single PutRecords request and returns the records that got rejected.
+func (s *KinesisSink) put(records []types.PutRecordsRequestEntry) ([]types.PutRecordsRequestEntry, error) {
+	output, err := s.client.PutRecords(context.Background(), &kinesis.PutRecordsInput{
+		StreamName: aws.String(s.stream),
+		Records:    records,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToInt32(output.FailedRecordCount) == 0 {
+		return nil, nil
+	}
+
+	var failed []types.PutRecordsRequestEntry
+	for i, result := range output.Records {
+		if result.ErrorCode != nil {
+			failed = append(failed, records[i])
+		}
+	}
+	return failed, nil
+}
+
+// Close puts any queued records.
+func (s *KinesisSink) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,147 @@
+package sinks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// topicLevelReplacer replaces the characters not allowed in a level of an MQTT topic.
+var topicLevelReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// MQTTConfig defines how an MQTTSink publishes entries.
+type MQTTConfig struct {
+	// Broker is the URL of the broker, as in tcp://localhost:1883, ssl://broker:8883 or ws://broker/mqtt.
+	Broker string
+	// ClientID identifies the client to the broker, tm1-blackhawk if not specified.
+	ClientID string
+	// User and Password, if set, are used to authenticate.
+	User     string
+	Password string
+	// Topic is the template of the topic every entry is published to, in which {type} is replaced by
+	// the type of the entry, txn or msg, {Tuple} by the elements of the tuple, a level each, and any
+	// other placeholder, like {Server} or {Cube}, by the value of that field of the entry, i.e.
+	// tm1/{type}/{Server}/{Cube} yields tm1/txn/prod/Sales.
+	Topic string
+	// QoS is the quality of service, 0, 1 or 2, entries are published with.
+	QoS byte
+	// RetainCells, if set, publishes every transaction log entry, retained, to the topic identifying
+	// the cell, using the CellTopic template, tm1/cells/{Server}/{Cube}/{Tuple} if not specified,
+	// so subscribers get the last value of every cell as soon as they subscribe.
+	RetainCells bool
+	CellTopic   string
+	// Timeout is the time allowed to connect and, for a QoS above 0, for entries to be acknowledged,
+	// one minute if not specified.
+	Timeout time.Duration
+	// Encoder, if set, encodes the entries, as compact JSON if not set.
+	Encoder Encoder
+}
+
+// MQTTSink publishes every entry written to it as a message to an MQTT broker.
+type MQTTSink struct {
+	client  mqtt.Client
+	config  MQTTConfig
+	pending []mqtt.Token
+}
+
+// NewMQTTSink creates and returns a new MQTTSink connected to the broker.
+func NewMQTTSink(config MQTTConfig) (*MQTTSink, error) {
+	if config.ClientID == "" {
+		config.ClientID = "tm1-blackhawk"
+	}
+	if config.Topic == "" {
+		config.Topic = "tm1/{type}/{Server}/{Cube}"
+	}
+	if config.CellTopic == "" {
+		config.CellTopic = "tm1/cells/{Server}/{Cube}/{Tuple}"
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS %d, must be 0, 1 or 2", config.QoS)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Minute
+	}
+
+	options := mqtt.NewClientOptions()
+	options.AddBroker(config.Broker)
+	options.SetClientID(config.ClientID)
+	options.SetUsername(config.User)
+	options.SetPassword(config.Password)
+	options.SetAutoReconnect(true)
+	options.SetConnectTimeout(config.Timeout)
+
+	s := new(MQTTSink)
+	s.client = mqtt.NewClient(options)
+	s.config = config
+	if err := s.wait(s.client.Connect()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// topic returns the topic, using the template, the entry gets published to.
+func (s *MQTTSink) topic(template string, entry interface{}) string {
+	return indexPatternPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "type" {
+			return entryType(entry)
+		}
+		if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok && name == "Tuple" {
+			levels := make([]string, len(txnLogEntry.Tuple))
+			for i, element := range txnLogEntry.Tuple {
+				levels[i] = topicLevelReplacer.Replace(element)
+			}
+			return strings.Join(levels, "/")
+		}
+		value := entryField(entry, name)
+		if value == "" {
+			return "_"
+		}
+		return topicLevelReplacer.Replace(value)
+	})
+}
+
+// Write publishes the entry, and, if asked to, the last value of the cell it wrote, without waiting
+// for them to be acknowledged.
+func (s *MQTTSink) Write(entry interface{}) error {
+	payload, err := encode(s.config.Encoder, entry)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, s.client.Publish(s.topic(s.config.Topic, entry), s.config.QoS, false, payload))
+	if _, ok := entry.(*odata.TransactionLogEntry); ok && s.config.RetainCells {
+		s.pending = append(s.pending, s.client.Publish(s.topic(s.config.CellTopic, entry), s.config.QoS, true, payload))
+	}
+	return nil
+}
+
+// Flush waits for all messages to be published, respectively, for a QoS above 0, acknowledged.
+func (s *MQTTSink) Flush() error {
+	pending := s.pending
+	s.pending = nil
+	for _, token := range pending {
+		if err := s.wait(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait waits for the token to complete, returning its error, if any.
+func (s *MQTTSink) wait(token mqtt.Token) error {
+	if !token.WaitTimeout(s.config.Timeout) {
+		return fmt.Errorf("MQTT broker didn't respond within %s", s.config.Timeout)
+	}
+	return token.Error()
+}
+
+// Close flushes any outstanding messages and disconnects from the broker.
+func (s *MQTTSink) Close() error {
+	err := s.Flush()
+	s.client.Disconnect(250)
+	return err
+}
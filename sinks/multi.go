@@ -0,0 +1,87 @@
+package sinks
+
+import (
+	"fmt"
+)
+
+// MultiSink fans the entries written to it out to several sinks at once. Sinks are isolated from
+// each other: once a sink fails, its error is reported through OnError and the sink is skipped for
+// the remainder of the batch, while the other sinks carry on. The MultiSink itself only fails if
+// all of its sinks did. Failed sinks get another chance with the next batch after a flush.
+type MultiSink struct {
+	names  []string
+	sinks  []Sink
+	failed []bool
+
+	// OnError, if set, is called for every error returned by any of the sinks.
+	OnError func(name string, err error)
+}
+
+// NewMultiSink creates and returns a new, empty, MultiSink.
+func NewMultiSink() *MultiSink {
+	return new(MultiSink)
+}
+
+// Add registers a sink, identified by name, with the MultiSink.
+func (s *MultiSink) Add(name string, sink Sink) {
+	s.names = append(s.names, name)
+	s.sinks = append(s.sinks, sink)
+	s.failed = append(s.failed, false)
+}
+
+// Write writes the entry to all sinks that haven't failed so far.
+func (s *MultiSink) Write(entry interface{}) error {
+	for i, sink := range s.sinks {
+		if s.failed[i] {
+			continue
+		}
+		if err := sink.Write(entry); err != nil {
+			s.fail(i, err)
+		}
+	}
+	return s.err()
+}
+
+// Flush flushes all sinks, after which sinks that failed are given another chance.
+func (s *MultiSink) Flush() error {
+	return s.each(func(sink Sink) error { return sink.Flush() })
+}
+
+// Close closes all sinks.
+func (s *MultiSink) Close() error {
+	return s.each(func(sink Sink) error { return sink.Close() })
+}
+
+// each calls fn for every sink, including the ones that failed as they might need to reset their
+// state, and resets the failed state of all sinks afterwards.
+func (s *MultiSink) each(fn func(Sink) error) error {
+	for i, sink := range s.sinks {
+		// Errors of sinks that already failed have been reported before
+		if err := fn(sink); err != nil && !s.failed[i] {
+			s.fail(i, err)
+		}
+	}
+	err := s.err()
+	for i := range s.failed {
+		s.failed[i] = false
+	}
+	return err
+}
+
+// fail marks the sink at index i as failed and reports the error.
+func (s *MultiSink) fail(i int, err error) {
+	s.failed[i] = true
+	if s.OnError != nil {
+		s.OnError(s.names[i], err)
+	}
+}
+
+// err returns an error if all sinks have failed.
+func (s *MultiSink) err() error {
+	for _, failed := range s.failed {
+		if !failed {
+			return nil
+		}
+	}
+	return fmt.Errorf("all %d sinks failed", len(s.sinks))
+}
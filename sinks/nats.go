@@ -0,0 +1,192 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// subjectTokenReplacer replaces the characters not allowed in a token of a NATS subject.
+var subjectTokenReplacer = strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_", "\t", "_")
+
+// NATSConfig defines how a NATSSink publishes entries.
+type NATSConfig struct {
+	// URL is the comma-separated list of URLs of the NATS servers, nats://localhost:4222 if not
+	// specified.
+	URL string
+	// Subject is the pattern of the subject every entry is published to, in which {type} is replaced
+	// by the type of the entry, txn or msg, and any other placeholder, like {Server} or {Cube}, by
+	// the value of that field of the entry, i.e. tm1.{type}.{Server}.{Cube} yields tm1.txn.prod.Sales.
+	Subject string
+	// CredentialsFile, if set, is the NATS credentials file used to authenticate. Alternatively a
+	// user and password, or token, can be passed in the URL.
+	CredentialsFile string
+	// JetStream, if set, publishes the entries to JetStream, waiting, for at most AckTimeout, one
+	// minute if not specified, for every entry to be acknowledged as persisted.
+	JetStream  bool
+	AckTimeout time.Duration
+	// Stream, if set, is the JetStream stream the subjects are captured by, which is created if it
+	// doesn't exist yet.
+	Stream string
+	// Encoder, if set, encodes the entries, as compact JSON if not set, the content type being passed
+	// in the Content-Type header of every message.
+	Encoder Encoder
+}
+
+// NATSSink publishes every entry written to it as a message to a NATS subject, derived from the
+// entry, either using core NATS or, for persistence, JetStream. Messages published to JetStream
+// carry an ID identifying the entry, so entries published again, after a failure, are discarded
+// as duplicates by the stream.
+type NATSSink struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	config  NATSConfig
+	pending []jetstream.PubAckFuture
+}
+
+// NewNATSSink creates and returns a new NATSSink connected to the NATS servers.
+func NewNATSSink(config NATSConfig) (*NATSSink, error) {
+	if config.URL == "" {
+		config.URL = nats.DefaultURL
+	}
+	if config.Subject == "" {
+		config.Subject = "tm1.{type}.{Server}.{Cube}"
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = time.Minute
+	}
+
+	options := []nats.Option{nats.Name("tm1-blackhawk"), nats.MaxReconnects(-1)}
+	if config.CredentialsFile != "" {
+		options = append(options, nats.UserCredentials(config.CredentialsFile))
+	}
+	conn, err := nats.Connect(config.URL, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(NATSSink)
+	s.conn = conn
+	s.config = config
+	if config.JetStream {
+		if s.js, err = jetstream.New(conn); err == nil && config.Stream != "" {
+			err = s.ensureStream()
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ensureStream creates the stream, capturing all subjects matching the subject pattern, if it
+// doesn't exist yet.
+func (s *NATSSink) ensureStream() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.AckTimeout)
+	defer cancel()
+	_, err := s.js.Stream(ctx, s.config.Stream)
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return err
+	}
+
+	// Every token holding a placeholder can be anything
+	tokens := strings.Split(s.config.Subject, ".")
+	for i, token := range tokens {
+		if indexPatternPlaceholder.MatchString(token) {
+			tokens[i] = "*"
+		}
+	}
+	_, err = s.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     s.config.Stream,
+		Subjects: []string{strings.Join(tokens, ".")},
+	})
+	return err
+}
+
+// subject returns the subject the entry gets published to.
+func (s *NATSSink) subject(entry interface{}) string {
+	return indexPatternPlaceholder.ReplaceAllStringFunc(s.config.Subject, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "type" {
+			return entryType(entry)
+		}
+		value := entryField(entry, name)
+		if value == "" {
+			return "_"
+		}
+		return subjectTokenReplacer.Replace(value)
+	})
+}
+
+// Write publishes the entry, to JetStream without waiting for it to be acknowledged.
+func (s *NATSSink) Write(entry interface{}) error {
+	data, err := encode(s.config.Encoder, entry)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.subject(entry))
+	msg.Data = data
+	if s.config.Encoder != nil {
+		msg.Header.Set("Content-Type", s.config.Encoder.ContentType())
+	}
+	if s.js == nil {
+		return s.conn.PublishMsg(msg)
+	}
+
+	var options []jetstream.PublishOpt
+	if id := entryField(entry, "ID"); id != "" {
+		options = append(options, jetstream.WithMsgID(strings.Join([]string{entryType(entry), entryField(entry, "Server"), id, entryField(entry, "TimeStamp")}, ":")))
+	}
+	future, err := s.js.PublishMsgAsync(msg, options...)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, future)
+	return nil
+}
+
+// Flush waits for the server to have received all messages, respectively, for JetStream, for all
+// messages to be acknowledged. Messages JetStream failed to persist are published again and an
+// error is returned.
+func (s *NATSSink) Flush() error {
+	if s.js == nil {
+		return s.conn.FlushTimeout(s.config.AckTimeout)
+	}
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	select {
+	case <-s.js.PublishAsyncComplete():
+	case <-time.After(s.config.AckTimeout):
+		return fmt.Errorf("JetStream didn't acknowledge %d messages within %s", len(s.pending), s.config.AckTimeout)
+	}
+	pending := s.pending
+	s.pending = nil
+	var failed error
+	for _, future := range pending {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			failed = err
+			if future, err := s.js.PublishMsgAsync(future.Msg()); err == nil {
+				s.pending = append(s.pending, future)
+			}
+		}
+	}
+	return failed
+}
+
+// Close flushes any outstanding messages and closes the connection to the servers.
+func (s *NATSSink) Close() error {
+	err := s.Flush()
+	s.conn.Close()
+	return err
+}
@@ -0,0 +1,215 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetConfig defines how a ParquetSink writes entries into Parquet files.
+type ParquetConfig struct {
+	// Dir is the directory the partitions are written into.
+	Dir string
+	// RowGroupSize is the number of rows buffered before they are written as a row group, 10000 if not
+	// specified.
+	RowGroupSize int
+	// MaxFileRows and MaxFileAge are the number of rows, 1000000 if not specified, respectively the
+	// time since it got created, 1 hour if not specified, after which a file gets completed, and the
+	// next entries of its partition are written into a new file.
+	MaxFileRows int
+	MaxFileAge  time.Duration
+}
+
+// ParquetSink writes transaction log entries into Parquet files, partitioned by cube and the date
+// of their time stamp, as in cube=Sales/date=2024-06-01/part-0001.parquet, prefixed by the server,
+// as in server=prod/, for entries originating from a named server. Files are written as hidden
+// files, ignored by readers of the partitions, until they are completed, on reaching any of their
+// limits or closing the sink, and renamed.
+type ParquetSink struct {
+	config ParquetConfig
+	files  map[string]*parquetFile
+}
+
+// parquetFile is the Parquet file currently being written for a single partition.
+type parquetFile struct {
+	path    string
+	file    *os.File
+	writer  *parquet.GenericWriter[parquetRow]
+	rows    int
+	created time.Time
+}
+
+// parquetRow is the row written for a transaction log entry. Values are written as strings, and,
+// if numeric, as numbers.
+type parquetRow struct {
+	ID              int64     `parquet:"ID"`
+	ChangeSetID     string    `parquet:"ChangeSetID"`
+	TimeStamp       time.Time `parquet:"TimeStamp,timestamp(millisecond)"`
+	ReplicationTime string    `parquet:"ReplicationTime"`
+	User            string    `parquet:"User"`
+	Cube            string    `parquet:"Cube"`
+	Tuple           []string  `parquet:"Tuple,list"`
+	ValueType       string    `parquet:"ValueType"`
+	OldValue        string    `parquet:"OldValue"`
+	NewValue        string    `parquet:"NewValue"`
+	OldNumber       *float64  `parquet:"OldNumber,optional"`
+	NewNumber       *float64  `parquet:"NewNumber,optional"`
+	StatusMessage   string    `parquet:"StatusMessage"`
+	Server          string    `parquet:"Server"`
+}
+
+// NewParquetSink creates and returns a new ParquetSink writing into the configured directory.
+func NewParquetSink(config ParquetConfig) *ParquetSink {
+	if config.RowGroupSize <= 0 {
+		config.RowGroupSize = 10000
+	}
+	if config.MaxFileRows <= 0 {
+		config.MaxFileRows = 1000000
+	}
+	if config.MaxFileAge <= 0 {
+		config.MaxFileAge = time.Hour
+	}
+
+	s := new(ParquetSink)
+	s.config = config
+	s.files = map[string]*parquetFile{}
+
+	return s
+}
+
+// Write writes the transaction log entry as a row to the file of its partition.
+func (s *ParquetSink) Write(entry interface{}) error {
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return errors.New("parquet sink only supports transaction log entries")
+	}
+
+	row := parquetRow{
+		ID:              int64(txnLogEntry.ID),
+		ChangeSetID:     txnLogEntry.ChangeSetID,
+		ReplicationTime: txnLogEntry.ReplicationTime,
+		User:            txnLogEntry.User,
+		Cube:            txnLogEntry.Cube,
+		Tuple:           txnLogEntry.Tuple,
+		ValueType:       string(txnLogEntry.ValueType()),
+		Server:          txnLogEntry.Server,
+	}
+	row.TimeStamp, _ = time.Parse(time.RFC3339, txnLogEntry.TimeStamp)
+	row.OldValue, row.NewValue = txnLogEntry.StringValues()
+	if oldNumber, newNumber, ok := txnLogEntry.NumericValues(); ok {
+		row.OldNumber, row.NewNumber = &oldNumber, &newNumber
+	}
+	if txnLogEntry.StatusMessage != nil {
+		row.StatusMessage = fmt.Sprint(txnLogEntry.StatusMessage)
+	}
+
+	// Entries without a valid time stamp are filed under the date they got written
+	date := row.TimeStamp
+	if date.IsZero() {
+		date = time.Now()
+	}
+	partition := filepath.Join("cube="+partitionValue(txnLogEntry.Cube), "date="+date.UTC().Format("2006-01-02"))
+	if txnLogEntry.Server != "" {
+		partition = filepath.Join("server="+partitionValue(txnLogEntry.Server), partition)
+	}
+	f, err := s.file(partition)
+	if err != nil {
+		return err
+	}
+	if _, err := f.writer.Write([]parquetRow{row}); err != nil {
+		return err
+	}
+	f.rows++
+	if f.rows >= s.config.MaxFileRows {
+		delete(s.files, partition)
+		return f.complete()
+	}
+	return nil
+}
+
+// file returns the file being written for the partition, creating it, as the next part of the
+// partition, if need be.
+func (s *ParquetSink) file(partition string) (*parquetFile, error) {
+	if f, ok := s.files[partition]; ok {
+		return f, nil
+	}
+
+	dir := filepath.Join(s.config.Dir, partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// Continue numbering after the parts written before, if any
+	parts, err := filepath.Glob(filepath.Join(dir, "part-*.parquet"))
+	if err != nil {
+		return nil, err
+	}
+	part := len(parts) + 1
+	for _, name := range parts {
+		var n int
+		if _, err := fmt.Sscanf(filepath.Base(name), "part-%d.parquet", &n); err == nil && n >= part {
+			part = n + 1
+		}
+	}
+
+	f := new(parquetFile)
+	f.path = filepath.Join(dir, fmt.Sprintf("part-%04d.parquet", part))
+	if f.file, err = os.Create(filepath.Join(dir, "."+filepath.Base(f.path))); err != nil {
+		return nil, err
+	}
+	f.writer = parquet.NewGenericWriter[parquetRow](f.file, parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(int64(s.config.RowGroupSize)))
+	f.created = time.Now()
+	s.files[partition] = f
+	return f, nil
+}
+
+// complete writes the buffered rows, and the footer, to the file and gives it its final name.
+func (f *parquetFile) complete() error {
+	err := f.writer.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.file.Name(), f.path)
+}
+
+// Flush completes the files which reached their maximum age. The rows of other files are written,
+// once their row group is full, as they come, and are readable once their file is completed.
+func (s *ParquetSink) Flush() error {
+	var err error
+	for partition, f := range s.files {
+		if time.Since(f.created) < s.config.MaxFileAge {
+			continue
+		}
+		delete(s.files, partition)
+		if cerr := f.complete(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Close completes all files.
+func (s *ParquetSink) Close() error {
+	var err error
+	for partition, f := range s.files {
+		delete(s.files, partition)
+		if cerr := f.complete(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// partitionValue returns the value as used in the name of a partition directory, escaping the
+// characters not allowed in, or with a special meaning in, a path.
+func partitionValue(value string) string {
+	return strings.NewReplacer("/", "%2F", "\\", "%5C", "=", "%3D", ":", "%3A", "%", "%25").Replace(value)
+}
@@ -0,0 +1,89 @@
+package sinks
+
+import (
+	"github.com/hubert-heijkers/tm1-blackhawk/plugins"
+)
+
+// PluginSink writes the entries to the sink of a plugin.
+type PluginSink struct {
+	sink plugins.Sink
+}
+
+// NewPluginSink creates and returns a new PluginSink writing the entries to the sink of the plugin.
+func NewPluginSink(sink plugins.Sink) *PluginSink {
+	s := new(PluginSink)
+	s.sink = sink
+
+	return s
+}
+
+// Write writes the entry to the sink of the plugin.
+func (s *PluginSink) Write(entry interface{}) error {
+	e, err := plugins.NewEntry(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	return s.sink.Write(e)
+}
+
+// Flush flushes the sink of the plugin.
+func (s *PluginSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the sink of the plugin.
+func (s *PluginSink) Close() error {
+	return s.sink.Close()
+}
+
+// NewPluginFilterSink creates and returns a new RouteSink writing the entries matching the filter of
+// a plugin to the sink.
+func NewPluginFilterSink(sink Sink, filter plugins.Filter) *RouteSink {
+	return NewRouteSink(sink, func(entry interface{}) bool {
+		e, err := plugins.NewEntry(entry)
+		return err != nil || filter.Match(e)
+	})
+}
+
+// PluginTransformSink transforms every entry written to it, using the transformer of a plugin, before
+// writing it, represented by a map of its fields, to the sink it wraps, dropping the entries the
+// transformer drops.
+type PluginTransformSink struct {
+	sink        Sink
+	transformer plugins.Transformer
+}
+
+// NewPluginTransformSink creates and returns a new PluginTransformSink writing the entries,
+// transformed by the transformer, to the sink.
+func NewPluginTransformSink(sink Sink, transformer plugins.Transformer) *PluginTransformSink {
+	s := new(PluginTransformSink)
+	s.sink = sink
+	s.transformer = transformer
+
+	return s
+}
+
+// Write transforms the entry and, unless dropped, writes it to the wrapped sink.
+func (s *PluginTransformSink) Write(entry interface{}) error {
+	e, err := plugins.NewEntry(entry)
+	if err == nil {
+		e, err = s.transformer.Transform(e)
+	}
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	if e == nil {
+		return nil
+	}
+	return s.sink.Write(e.Fields)
+}
+
+// Flush flushes the wrapped sink.
+func (s *PluginTransformSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the wrapped sink.
+func (s *PluginTransformSink) Close() error {
+	return s.sink.Close()
+}
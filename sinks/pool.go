@@ -0,0 +1,165 @@
+package sinks
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// PoolSink delivers entries concurrently, using a pool of workers each writing to a sink of its
+// own, while preserving the order of the entries sharing the same key, as in the entries written
+// to the same cube, by always handing those to the same worker. Every worker has a bounded queue,
+// writing to a PoolSink blocks while the queue of the worker is full. As entries are delivered
+// asynchronously, a failure to write an entry is reported by a subsequent Write or Flush. Once
+// closed, writing to, flushing, or closing, a PoolSink fails with ErrPoolClosed.
+type PoolSink struct {
+	keyField string
+	workers  []*poolWorker
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	err      error
+
+	closing sync.RWMutex // Held while queueing for the workers, exclusively while closing their queues
+	closed  bool
+}
+
+// ErrPoolClosed is returned when writing to, flushing, or closing, a PoolSink which has been closed.
+var ErrPoolClosed = errors.New("pool sink is closed")
+
+// poolWorker is a worker of a PoolSink, writing the entries queued for it to its sink.
+type poolWorker struct {
+	sink  Sink
+	queue chan poolRequest
+}
+
+// poolRequest is a request for a worker, either to write an entry or, if done is set, to flush its
+// sink, after which the result is passed using done.
+type poolRequest struct {
+	entry interface{}
+	done  chan error
+}
+
+// NewPoolSink creates and returns a new PoolSink with the number of workers, each writing to the
+// sink created by newSink and queueing up to queueSize entries. Entries are assigned to workers by
+// the value of their key field, as in Cube or ChangeSetID.
+func NewPoolSink(newSink func() (Sink, error), workers int, queueSize int, keyField string) (*PoolSink, error) {
+	s := new(PoolSink)
+	s.keyField = keyField
+	for i := 0; i < workers; i++ {
+		sink, err := newSink()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		worker := &poolWorker{sink: sink, queue: make(chan poolRequest, queueSize)}
+		s.workers = append(s.workers, worker)
+		s.wg.Add(1)
+		go s.run(worker)
+	}
+
+	return s, nil
+}
+
+// run writes the entries queued for the worker to its sink, until its queue gets closed.
+func (s *PoolSink) run(worker *poolWorker) {
+	defer s.wg.Done()
+	for req := range worker.queue {
+		if req.done != nil {
+			req.done <- worker.sink.Flush()
+			continue
+		}
+		if err := worker.sink.Write(req.entry); err != nil {
+			s.setErr(err)
+		}
+	}
+}
+
+// Write queues the entry for the worker its key is assigned to. It returns the error, if any,
+// any of the workers ran into since the last Flush.
+func (s *PoolSink) Write(entry interface{}) error {
+	s.closing.RLock()
+	defer s.closing.RUnlock()
+	if s.closed {
+		return ErrPoolClosed
+	}
+	if err := s.takeErr(); err != nil {
+		return err
+	}
+	h := fnv.New32a()
+	h.Write([]byte(entryField(entry, s.keyField)))
+	s.workers[h.Sum32()%uint32(len(s.workers))].queue <- poolRequest{entry: entry}
+	return nil
+}
+
+// Flush waits for all entries queued so far to be written and flushes the sinks of all workers.
+func (s *PoolSink) Flush() error {
+	s.closing.RLock()
+	defer s.closing.RUnlock()
+	if s.closed {
+		return ErrPoolClosed
+	}
+	results := make([]chan error, len(s.workers))
+	for i, worker := range s.workers {
+		results[i] = make(chan error, 1)
+		worker.queue <- poolRequest{done: results[i]}
+	}
+	err := s.takeErr()
+	for _, result := range results {
+		if flushErr := <-result; err == nil {
+			err = flushErr
+		}
+	}
+	if err == nil {
+		err = s.takeErr()
+	}
+	return err
+}
+
+// Close writes all entries queued, stops the workers and closes their sinks.
+func (s *PoolSink) Close() error {
+	s.closing.Lock()
+	if s.closed {
+		s.closing.Unlock()
+		return ErrPoolClosed
+	}
+	s.closed = true
+	for _, worker := range s.workers {
+		close(worker.queue)
+	}
+	s.closing.Unlock()
+	s.wg.Wait()
+	err := s.takeErr()
+	for _, worker := range s.workers {
+		if closeErr := worker.sink.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// QueueDepth returns the number of entries queued for the workers, waiting to be written.
+func (s *PoolSink) QueueDepth() int64 {
+	depth := 0
+	for _, worker := range s.workers {
+		depth += len(worker.queue)
+	}
+	return int64(depth)
+}
+
+// setErr records the error, unless an error has been recorded already.
+func (s *PoolSink) setErr(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// takeErr returns, and clears, the error recorded, if any.
+func (s *PoolSink) takeErr() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
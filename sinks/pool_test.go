@@ -0,0 +1,46 @@
+package sinks_test
+
+import (
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/internal/testutil"
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestPoolSinkFailsOnceClosed(t *testing.T) {
+	var workers []*testutil.RecordingSink
+	s, err := sinks.NewPoolSink(func() (sinks.Sink, error) {
+		sink := new(testutil.RecordingSink)
+		workers = append(workers, sink)
+		return sink, nil
+	}, 2, 10, "Cube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cube := range []string{"Sales", "Revenue", "Sales"} {
+		if err := s.Write(&odata.TransactionLogEntry{Cube: cube}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written := 0
+	for _, worker := range workers {
+		written += len(worker.Entries())
+	}
+	if written != 3 {
+		t.Errorf("wrote %d entries, expected all 3 queued to be written once closed", written)
+	}
+
+	if err := s.Write(&odata.TransactionLogEntry{Cube: "Sales"}); err != sinks.ErrPoolClosed {
+		t.Errorf("got %v writing once closed, expected ErrPoolClosed", err)
+	}
+	if err := s.Flush(); err != sinks.ErrPoolClosed {
+		t.Errorf("got %v flushing once closed, expected ErrPoolClosed", err)
+	}
+	if err := s.Close(); err != sinks.ErrPoolClosed {
+		t.Errorf("got %v closing again, expected ErrPoolClosed", err)
+	}
+}
@@ -0,0 +1,136 @@
+package sinks
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The limits Pub/Sub imposes on a publish request.
+const (
+	pubSubMaxMessages     = 1000
+	pubSubMaxRequestBytes = 9 * 1024 * 1024
+)
+
+// PubSubSink publishes every entry written to it as a message to a Google Cloud Pub/Sub topic.
+// Messages carry the value of the configured key field, i.e. Cube or User, as their ordering key,
+// which, if the subscription has message ordering enabled, guarantees that entries sharing a key
+// are delivered in order, and the type of the entry, and its Server and Cube, if any, as attributes.
+type PubSubSink struct {
+	client   *http.Client
+	url      string
+	keyField string
+	messages []pubSubMessage
+	entries  []interface{}
+	rejected *PermanentError
+
+	// Encoder, if set, encodes the entries, as compact JSON if not set, the content type being passed
+	// in the contentType attribute of every message.
+	Encoder Encoder
+}
+
+// pubSubMessage is a message as published using the Pub/Sub API.
+type pubSubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// NewPubSubSink creates and returns a new PubSubSink publishing to the topic of the project. The
+// endpoint, https://pubsub.googleapis.com if not specified, can point to the Pub/Sub emulator.
+func NewPubSubSink(project string, topic string, keyField string, endpoint string) (*PubSubSink, error) {
+	if endpoint == "" {
+		endpoint = "https://pubsub.googleapis.com"
+	}
+	client, err := newGoogleClient(endpoint, "https://www.googleapis.com/auth/pubsub")
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(PubSubSink)
+	s.client = client
+	s.url = strings.TrimSuffix(endpoint, "/") + "/v1/projects/" + url.PathEscape(project) + "/topics/" + url.PathEscape(topic) + ":publish"
+	s.keyField = keyField
+
+	return s, nil
+}
+
+// Write queues the entry as a message to be published on the next flush.
+func (s *PubSubSink) Write(entry interface{}) error {
+	data, err := encode(s.Encoder, entry)
+	if err != nil {
+		return err
+	}
+	message := pubSubMessage{
+		Data:        data,
+		Attributes:  map[string]string{"type": entryType(entry)},
+		OrderingKey: entryField(entry, s.keyField),
+	}
+	if s.Encoder != nil {
+		message.Attributes["contentType"] = s.Encoder.ContentType()
+	}
+	for _, name := range []string{"Server", "Cube"} {
+		if value := entryField(entry, name); value != "" {
+			message.Attributes[name] = value
+		}
+	}
+	s.messages = append(s.messages, message)
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush publishes all queued messages, in as few requests as the limits of the Pub/Sub API allow.
+// Messages are removed from the queue as soon as their request got accepted. The messages of a
+// request Pub/Sub rejects are published again one by one, singling out, and returning in a
+// PermanentError, the offending entries.
+func (s *PubSubSink) Flush() error {
+	single := 0 // Number of messages still to be published one by one
+	for len(s.messages) > 0 {
+		n := s.batch()
+		if single > 0 {
+			n = 1
+		}
+		err := googleRequest(s.client, "POST", s.url, map[string]interface{}{"messages": s.messages[:n]}, nil)
+		if IsPermanent(err) && n > 1 {
+			single = n
+			continue
+		}
+		if IsPermanent(err) {
+			if s.rejected == nil {
+				s.rejected = &PermanentError{Err: err}
+			}
+			s.rejected.Entries = append(s.rejected.Entries, s.entries[0])
+		} else if err != nil {
+			return err
+		}
+		if single > 0 {
+			single--
+		}
+		s.messages, s.entries = s.messages[n:], s.entries[n:]
+	}
+	s.messages, s.entries = nil, nil
+
+	if rejected := s.rejected; rejected != nil {
+		s.rejected = nil
+		return rejected
+	}
+	return nil
+}
+
+// batch returns the number of queued messages that fit in a single publish request.
+func (s *PubSubSink) batch() int {
+	size := 0
+	for i, message := range s.messages {
+		// The data is base64 encoded, growing it by a third
+		size += len(message.Data)*4/3 + len(message.OrderingKey) + 100
+		if i == pubSubMaxMessages || (i > 0 && size > pubSubMaxRequestBytes) {
+			return i
+		}
+	}
+	return len(s.messages)
+}
+
+// Close publishes any queued messages.
+func (s *PubSubSink) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,80 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SchemaRegistry is a client of a, Confluent compatible, schema registry.
+type SchemaRegistry struct {
+	url    string
+	client *http.Client
+}
+
+// NewSchemaRegistry creates and returns a new SchemaRegistry for the registry at the URL.
+// Credentials, if required, can be passed in the URL.
+func NewSchemaRegistry(registryURL string) *SchemaRegistry {
+	r := new(SchemaRegistry)
+	r.url = strings.TrimSuffix(registryURL, "/")
+	r.client = &http.Client{Timeout: time.Minute}
+
+	return r
+}
+
+// Register registers the schema, of the type, AVRO or JSON, under the subject, returning its ID,
+// which is that of the existing version if the schema has been registered before. Schemas the
+// registry rejects, as being invalid or incompatible with the previous version, are returned as a
+// PermanentError.
+func (r *SchemaRegistry) Register(subject string, schemaType string, schema string) (uint32, error) {
+	body, _ := json.Marshal(map[string]string{"schemaType": schemaType, "schema": schema})
+	req, err := http.NewRequest("POST", r.url+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("schema registry responded with: %s\r\n%s", resp.Status, msg)
+		if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusUnprocessableEntity {
+			err = &PermanentError{Err: err}
+		}
+		return 0, err
+	}
+	var res struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, err
+	}
+	return res.ID, nil
+}
+
+// registrySubject returns the subject the schema of the record, or, if not a record, of any entry,
+// is registered under, using the prefix, typically the topic, as in tm1.txn-tm1.blackhawk.TransactionLogEntry.
+func registrySubject(prefix string, record string) string {
+	if record == "" {
+		return prefix + "-value"
+	}
+	return prefix + "-" + record
+}
+
+// confluentHeader returns the header, preceding every entry in the Confluent wire format,
+// identifying its schema by ID.
+func confluentHeader(id uint32) []byte {
+	header := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], id)
+	return header
+}
@@ -0,0 +1,36 @@
+package sinks
+
+// RouteSink writes only the entries matching its route to the sink it wraps, allowing different
+// entries to be routed to different sinks.
+type RouteSink struct {
+	sink  Sink
+	match func(entry interface{}) bool
+}
+
+// NewRouteSink creates and returns a new RouteSink writing the entries for which match returns true
+// to the sink.
+func NewRouteSink(sink Sink, match func(entry interface{}) bool) *RouteSink {
+	s := new(RouteSink)
+	s.sink = sink
+	s.match = match
+
+	return s
+}
+
+// Write writes the entry to the wrapped sink if it matches the route.
+func (s *RouteSink) Write(entry interface{}) error {
+	if !s.match(entry) {
+		return nil
+	}
+	return s.sink.Write(entry)
+}
+
+// Flush flushes the wrapped sink.
+func (s *RouteSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the wrapped sink.
+func (s *RouteSink) Close() error {
+	return s.sink.Close()
+}
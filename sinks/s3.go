@@ -0,0 +1,67 @@
+package sinks
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Store is an ObjectStore uploading objects to an AWS S3 bucket, or any S3 compatible store.
+type S3Store struct {
+	client     *s3.Client
+	bucket     string
+	encryption string
+	kmsKeyID   string
+}
+
+// NewS3Store creates and returns a new S3Store uploading objects to the bucket. The credentials,
+// and, unless specified, the region, are taken from the standard AWS sources. The endpoint, if
+// specified, overrides the endpoint of the region, i.e. to use MinIO. The encryption, AES256 or
+// aws:kms, if specified, is the server-side encryption applied to the objects, using, for aws:kms,
+// the KMS key, if specified, or the default key of the account otherwise.
+func NewS3Store(bucket string, region string, endpoint string, encryption string, kmsKeyID string) (*S3Store, error) {
+	var options []func(*config.LoadOptions) error
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(S3Store)
+	s.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	s.bucket = bucket
+	s.encryption = encryption
+	s.kmsKeyID = kmsKeyID
+
+	return s, nil
+}
+
+// Upload puts the file as the object with the given key into the bucket.
+func (s *S3Store) Upload(key string, file *os.File, size int64, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          file,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	}
+	if s.encryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(s.encryption)
+	}
+	if s.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+	_, err := s.client.PutObject(context.Background(), input)
+	return err
+}
@@ -0,0 +1,49 @@
+package sinks
+
+// Script is run against every entry written to a ScriptSink, returning the entry, represented by a
+// map of its fields, as changed by the script, or nil if the script dropped it.
+type Script interface {
+	Run(entry interface{}) (map[string]interface{}, error)
+	Close()
+}
+
+// ScriptSink runs a script against every entry written to it, writing the entry, as changed by the
+// script, to the sink it wraps, unless the script dropped it.
+type ScriptSink struct {
+	sink   Sink
+	script Script
+}
+
+// NewScriptSink creates and returns a new ScriptSink writing the entries, as changed by the script,
+// to the sink.
+func NewScriptSink(sink Sink, script Script) *ScriptSink {
+	s := new(ScriptSink)
+	s.sink = sink
+	s.script = script
+
+	return s
+}
+
+// Write runs the script against the entry and, unless dropped, writes it to the wrapped sink.
+func (s *ScriptSink) Write(entry interface{}) error {
+	fields, err := s.script.Run(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	if fields == nil {
+		return nil
+	}
+	return s.sink.Write(fields)
+}
+
+// Flush flushes the wrapped sink.
+func (s *ScriptSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the wrapped sink and waits for the actions fired by the script to be fired.
+func (s *ScriptSink) Close() error {
+	err := s.sink.Close()
+	s.script.Close()
+	return err
+}
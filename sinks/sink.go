@@ -0,0 +1,52 @@
+package sinks
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Sink is a destination entries, as they are being processed, are written to.
+type Sink interface {
+	// Write hands a single entry to the sink. Sinks are free to buffer entries until Flush is called.
+	Write(entry interface{}) error
+	// Flush makes sure that all entries written so far have been delivered.
+	Flush() error
+	// Close flushes any outstanding entries and releases any resources held by the sink.
+	Close() error
+}
+
+// entryField returns the string representation of the named field of an entry, or an empty string
+// if the entry doesn't have such a field.
+func entryField(entry interface{}, name string) string {
+	if fields, ok := entry.(map[string]interface{}); ok {
+		if value, ok := fields[name]; ok {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+	v := reflect.Indirect(reflect.ValueOf(entry))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(f.Interface())
+}
+
+// entryType returns the short name of the type of the entry, txn, msg or audit, or entry for entries
+// of any other type.
+func entryType(entry interface{}) string {
+	switch entry.(type) {
+	case *odata.TransactionLogEntry:
+		return "txn"
+	case *odata.MessageLogEntry:
+		return "msg"
+	case *odata.AuditLogEntry:
+		return "audit"
+	}
+	return "entry"
+}
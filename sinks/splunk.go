@@ -0,0 +1,235 @@
+package sinks
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SplunkConfig defines how a SplunkSink delivers entries to the Splunk HTTP Event Collector.
+type SplunkConfig struct {
+	// URL is the URL of the HTTP Event Collector, as in https://splunk:8088.
+	URL string
+	// Token is the HTTP Event Collector token used to authenticate.
+	Token string
+	// Index, Source and SourceType, if set, are passed with every event, otherwise the defaults of
+	// the token apply.
+	Index      string
+	Source     string
+	SourceType string
+	// Host, if set, is passed as the host of every event, otherwise the Server of the entry, if any.
+	Host string
+	// BatchSize is the maximum number of events posted in one request, 100 if not specified.
+	BatchSize int
+	// Ack, if set, waits, for at most AckTimeout, one minute if not specified, for Splunk to
+	// acknowledge the events got indexed before considering them delivered. The token must have
+	// indexer acknowledgement enabled.
+	Ack        bool
+	AckTimeout time.Duration
+	// SkipVerify skips the verification of the certificate of Splunk, which often is self-signed.
+	SkipVerify bool
+}
+
+// SplunkSink delivers entries, as events, to the Splunk HTTP Event Collector.
+type SplunkSink struct {
+	client   *http.Client
+	config   SplunkConfig
+	channel  string
+	events   [][]byte
+	entries  []interface{}
+	rejected *PermanentError
+}
+
+// splunkEvent is an event as posted to the HTTP Event Collector.
+type splunkEvent struct {
+	Time       float64     `json:"time,omitempty"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// splunkResponse is the response of the HTTP Event Collector.
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// NewSplunkSink creates and returns a new SplunkSink.
+func NewSplunkSink(config SplunkConfig) *SplunkSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = time.Minute
+	}
+
+	s := new(SplunkSink)
+	s.client = &http.Client{Timeout: time.Minute}
+	if config.SkipVerify {
+		s.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	s.config = config
+	s.config.URL = strings.TrimSuffix(config.URL, "/")
+	s.channel = newChannel()
+
+	return s
+}
+
+// newChannel returns a random identifier, formatted as a GUID, identifying the channel used to
+// request acknowledgements on.
+func newChannel() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Write queues the entry, as an event, to be posted on the next flush.
+func (s *SplunkSink) Write(entry interface{}) error {
+	event := splunkEvent{
+		Host:       s.config.Host,
+		Source:     s.config.Source,
+		SourceType: s.config.SourceType,
+		Index:      s.config.Index,
+		Event:      entry,
+	}
+	if timeStamp, err := time.Parse(time.RFC3339, entryField(entry, "TimeStamp")); err == nil {
+		event.Time = float64(timeStamp.UnixNano()/int64(time.Millisecond)) / 1000
+	}
+	if event.Host == "" {
+		event.Host = entryField(entry, "Server")
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.events = append(s.events, data)
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush posts the queued events, in batches of at most BatchSize events. Events are removed from
+// the queue as soon as their batch got accepted, and, if asked to, acknowledged. The events of a
+// batch Splunk rejects are posted again one by one, singling out, and returning in a
+// PermanentError, the offending entries.
+func (s *SplunkSink) Flush() error {
+	single := 0 // Number of events still to be posted one by one
+	for len(s.events) > 0 {
+		n := s.config.BatchSize
+		if single > 0 {
+			n = 1
+		}
+		if n > len(s.events) {
+			n = len(s.events)
+		}
+		err := s.post(s.events[:n])
+		if IsPermanent(err) && n > 1 {
+			single = n
+			continue
+		}
+		if IsPermanent(err) {
+			if s.rejected == nil {
+				s.rejected = &PermanentError{Err: err}
+			}
+			s.rejected.Entries = append(s.rejected.Entries, s.entries[0])
+		} else if err != nil {
+			return err
+		}
+		if single > 0 {
+			single--
+		}
+		s.events, s.entries = s.events[n:], s.entries[n:]
+	}
+	s.events, s.entries = nil, nil
+
+	if rejected := s.rejected; rejected != nil {
+		s.rejected = nil
+		return rejected
+	}
+	return nil
+}
+
+// post posts the events in one request and, if asked to, waits for them to be acknowledged.
+func (s *SplunkSink) post(events [][]byte) error {
+	var res splunkResponse
+	if err := s.do("/services/collector/event", bytes.Join(events, []byte("\n")), &res); err != nil {
+		return err
+	}
+	if !s.config.Ack {
+		return nil
+	}
+	if res.AckID == nil {
+		return fmt.Errorf("Splunk didn't return an acknowledgement ID, make sure indexer acknowledgement is enabled for the token")
+	}
+	return s.waitForAck(*res.AckID)
+}
+
+// waitForAck polls Splunk until it acknowledges the events with the acknowledgement ID got
+// indexed, or the acknowledgement timeout passed.
+func (s *SplunkSink) waitForAck(ackID int64) error {
+	body, _ := json.Marshal(map[string][]int64{"acks": {ackID}})
+	deadline := time.Now().Add(s.config.AckTimeout)
+	delay := 100 * time.Millisecond
+	for {
+		var res struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := s.do("/services/collector/ack", body, &res); err != nil {
+			return err
+		}
+		if res.Acks[fmt.Sprint(ackID)] {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Splunk didn't acknowledge the events with acknowledgement ID %d got indexed within %s", ackID, s.config.AckTimeout)
+		}
+		time.Sleep(delay)
+		if delay < 5*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// do posts the body to the path of the HTTP Event Collector and decodes the response into res.
+func (s *SplunkSink) do(path string, body []byte, res interface{}) error {
+	req, err := http.NewRequest("POST", s.config.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Ack {
+		req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("Splunk responded with: %s\r\n%s", resp.Status, msg)
+		// An invalid or disabled token rejects every event, rather than the events themselves
+		if isPermanentStatus(resp.StatusCode) && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+			err = &PermanentError{Err: err}
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// Close posts any queued events.
+func (s *SplunkSink) Close() error {
+	return s.Flush()
+}
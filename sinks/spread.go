@@ -0,0 +1,312 @@
+package sinks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Spread summarizes the numeric cell changes a single write operation, typically a spreading, made to
+// a cube, as detected by a SpreadSink.
+type Spread struct {
+	Type        string  `json:"Type"` // Always Spread
+	ChangeSetID string  `json:"ChangeSetID"`
+	Server      string  `json:"Server,omitempty"`
+	User        string  `json:"User"`
+	Cube        string  `json:"Cube"`
+	CellCount   int     `json:"CellCount"`
+	TotalDelta  float64 `json:"TotalDelta"`
+	// Consolidation holds, by dimension name, the element bounding the changed cells, being the
+	// element itself if all cells share it, or else their closest common consolidation, if any.
+	Consolidation map[string]string `json:"Consolidation"`
+	FirstChange   string            `json:"FirstChange"` // Time stamp of the first change
+	TimeStamp     string            `json:"TimeStamp"`   // Time stamp of the last change
+
+	elements map[string]map[string]bool // Distinct elements by dimension name
+	entries  []interface{}              // Entries held back until the spread is detected
+	updated  time.Time
+}
+
+func init() {
+	RegisterBufferedType("Spread", (*Spread)(nil))
+}
+
+// SpreadConfig defines how a SpreadSink detects spreads.
+type SpreadConfig struct {
+	// Window is the time after which a write operation without any further changes is considered
+	// complete, and MinCells the number of cells it has to change to be considered a spread.
+	Window   time.Duration
+	MinCells int
+	// Suppress, if set, drops the entries of the cells changed by a spread, only writing the Spread.
+	Suppress bool
+	// Dimensions resolves the dimensions, in order, of a cube on a server, and Parents the parents
+	// of the elements, by element name, of a dimension on a server.
+	Dimensions func(server string, cube string) ([]string, error)
+	Parents    func(server string, dimension string) (map[string][]string, error)
+}
+
+// SpreadSink wraps a sink, detecting write operations changing a large number of numeric cells of a
+// cube at once, like a spreading does, by grouping the transaction log entries sharing ChangeSetID,
+// user and cube. The entries of a group are held back until it either reaches the minimum number of
+// cells, at which point they are written, unless suppressed, together with any further entries, or
+// the window passes without any further changes, at which point they are written as is. Once the
+// window passed for a group that did reach the minimum, a Spread summarizing it is written, which,
+// as this happens from a goroutine of its own, reports any failure to deliver it from a subsequent
+// Write or Flush. Entries without a ChangeSetID, entries not changing a numeric value, and entries
+// of any other type, are written as is.
+type SpreadSink struct {
+	mutex   sync.Mutex
+	sink    Sink
+	config  SpreadConfig
+	points  *timeSeriesPoints
+	parents map[string]map[string][]string // Parents of the elements by server and dimension
+	groups  []*Spread                      // Open groups, in the order they were opened
+	timer   *time.Timer
+	err     error
+}
+
+// NewSpreadSink creates and returns a new SpreadSink wrapping the sink.
+func NewSpreadSink(sink Sink, config SpreadConfig) *SpreadSink {
+	s := new(SpreadSink)
+	s.sink = sink
+	s.config = config
+	s.points = newTimeSeriesPoints(config.Dimensions)
+	s.parents = map[string]map[string][]string{}
+
+	return s
+}
+
+// Write adds the entry to its group, writing it if the group has been detected to be a spread, or
+// writing the entries held back if the group just reached the minimum number of cells.
+func (s *SpreadSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.err; err != nil {
+		s.err = nil
+		return err
+	}
+
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok || txnLogEntry.ChangeSetID == "" {
+		return s.sink.Write(entry)
+	}
+	point, err := s.points.point(entry)
+	if err != nil {
+		return err
+	}
+	if point == nil {
+		return s.sink.Write(entry)
+	}
+
+	var group *Spread
+	for _, open := range s.groups {
+		if open.ChangeSetID == txnLogEntry.ChangeSetID && open.Server == txnLogEntry.Server && open.User == txnLogEntry.User && open.Cube == txnLogEntry.Cube {
+			group = open
+			break
+		}
+	}
+	if group == nil {
+		group = &Spread{Type: "Spread", ChangeSetID: txnLogEntry.ChangeSetID, Server: txnLogEntry.Server, User: txnLogEntry.User, Cube: txnLogEntry.Cube,
+			FirstChange: txnLogEntry.TimeStamp, elements: map[string]map[string]bool{}}
+		s.groups = append(s.groups, group)
+	}
+	group.CellCount++
+	group.TotalDelta += point.Value - point.OldValue
+	group.TimeStamp = txnLogEntry.TimeStamp
+	group.updated = time.Now()
+	for dimension, element := range point.Elements {
+		if group.elements[dimension] == nil {
+			group.elements[dimension] = map[string]bool{}
+		}
+		group.elements[dimension][element] = true
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.config.Window, s.expire)
+	}
+
+	switch {
+	case group.CellCount < s.config.MinCells:
+		group.entries = append(group.entries, entry)
+		return nil
+	case group.CellCount == s.config.MinCells:
+		entries := append(group.entries, entry)
+		group.entries = nil
+		if s.config.Suppress {
+			return nil
+		}
+		for i, held := range entries {
+			if err := s.sink.Write(held); err != nil {
+				// Keep whatever wasn't written, to be written again once the window passed
+				group.entries = entries[i:]
+				return err
+			}
+		}
+		return nil
+	case s.config.Suppress:
+		return nil
+	}
+	return s.sink.Write(entry)
+}
+
+// expire writes the groups which didn't change for the window, either as a Spread or, if they didn't
+// reach the minimum number of cells, as the entries held back, delivers them, and schedules itself
+// for the next group to expire, if any. Groups failing to be written, unless rejected permanently,
+// remain open, to be written again once the window passed again.
+func (s *SpreadSink) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.timer = nil
+
+	var err error
+	next := s.config.Window
+	open := s.groups[:0]
+	for _, group := range s.groups {
+		idle := time.Since(group.updated)
+		if idle < s.config.Window {
+			open = append(open, group)
+			if s.config.Window-idle < next {
+				next = s.config.Window - idle
+			}
+			continue
+		}
+		if err == nil {
+			err = s.write(group)
+		}
+		if err != nil && !IsPermanent(err) {
+			open = append(open, group)
+		}
+	}
+	s.groups = open
+	if err == nil {
+		err = s.sink.Flush()
+	}
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if len(s.groups) > 0 {
+		s.timer = time.AfterFunc(next, s.expire)
+	}
+}
+
+// write writes the entries held back by the group, if any, followed by the Spread, if it reached the
+// minimum number of cells. The caller is expected to hold the lock.
+func (s *SpreadSink) write(group *Spread) error {
+	for len(group.entries) > 0 {
+		if err := s.sink.Write(group.entries[0]); err != nil {
+			return err
+		}
+		group.entries = group.entries[1:]
+	}
+	if group.CellCount < s.config.MinCells {
+		return nil
+	}
+	if group.Consolidation == nil {
+		group.Consolidation = make(map[string]string, len(group.elements))
+		for dimension, elements := range group.elements {
+			if consolidation := s.consolidation(group.Server, dimension, elements); consolidation != "" {
+				group.Consolidation[dimension] = consolidation
+			}
+		}
+	}
+	return s.sink.Write(group)
+}
+
+// consolidation returns the element bounding the elements of the dimension: the element itself if
+// there's only one, or else their closest common ancestor, if any, and if the parents of the
+// elements of the dimension, which are cached, can be retrieved. The caller is expected to hold the
+// lock.
+func (s *SpreadSink) consolidation(server string, dimension string, elements map[string]bool) string {
+	if len(elements) == 1 {
+		for element := range elements {
+			return element
+		}
+	}
+	if s.config.Parents == nil {
+		return ""
+	}
+	key := server + "/" + dimension
+	parents, ok := s.parents[key]
+	if !ok {
+		var err error
+		if parents, err = s.config.Parents(server, dimension); err != nil {
+			return ""
+		}
+		s.parents[key] = parents
+	}
+
+	// The ancestors, the element itself included, of an element, closest first
+	ancestors := func(element string) []string {
+		result := []string{element}
+		seen := map[string]bool{element: true}
+		for i := 0; i < len(result); i++ {
+			for _, parent := range parents[result[i]] {
+				if !seen[parent] {
+					seen[parent] = true
+					result = append(result, parent)
+				}
+			}
+		}
+		return result
+	}
+	var candidates []string
+	common := map[string]bool{}
+	first := true
+	for element := range elements {
+		elementAncestors := ancestors(element)
+		if first {
+			candidates = elementAncestors
+			for _, ancestor := range elementAncestors {
+				common[ancestor] = true
+			}
+			first = false
+			continue
+		}
+		shared := map[string]bool{}
+		for _, ancestor := range elementAncestors {
+			if common[ancestor] {
+				shared[ancestor] = true
+			}
+		}
+		common = shared
+	}
+	for _, candidate := range candidates {
+		if common[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Flush flushes the wrapped sink. Open groups are written once the window passed.
+func (s *SpreadSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.sink.Flush()
+	if err == nil {
+		err = s.err
+	}
+	s.err = nil
+	return err
+}
+
+// Close writes all open groups and closes the wrapped sink.
+func (s *SpreadSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	err := s.err
+	for _, group := range s.groups {
+		if err == nil {
+			err = s.write(group)
+		}
+	}
+	s.groups = nil
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
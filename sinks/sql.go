@@ -0,0 +1,201 @@
+package sinks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+
+	// The database drivers supported by the SQLSink
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+// sqlDialect captures the differences between the databases supported by the SQLSink.
+type sqlDialect struct {
+	placeholder func(n int) string
+	createTable func(table string, columns string) string
+	textType    string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"postgres": {
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		createTable: func(table string, columns string) string {
+			return "CREATE TABLE IF NOT EXISTS " + table + " (" + columns + ")"
+		},
+		textType: "TEXT",
+	},
+	"sqlserver": {
+		placeholder: func(n int) string { return fmt.Sprintf("@p%d", n) },
+		createTable: func(table string, columns string) string {
+			return "IF OBJECT_ID('" + table + "', 'U') IS NULL CREATE TABLE " + table + " (" + columns + ")"
+		},
+		textType: "NVARCHAR(MAX)",
+	},
+	"sqlite": {
+		placeholder: func(n int) string { return "?" },
+		createTable: func(table string, columns string) string {
+			return "CREATE TABLE IF NOT EXISTS " + table + " (" + columns + ")"
+		},
+		textType: "TEXT",
+	},
+}
+
+// sqlTable defines the table entries of a specific type are inserted into.
+type sqlTable struct {
+	name    string
+	columns []string
+	insert  string
+	rows    [][]interface{}
+}
+
+// SQLSink inserts transaction and message log entries into tables, tm1_transaction_log and
+// tm1_message_log respectively, of a relational database, creating the tables if they don't exist
+// yet. Entries are inserted in batches using a prepared statement within a single transaction.
+type SQLSink struct {
+	db           *sql.DB
+	batchSize    int
+	transactions *sqlTable
+	messages     *sqlTable
+}
+
+// NewSQLSink creates and returns a new SQLSink for the database, using either the postgres or the
+// sqlserver driver, identified by the data source name. Entries are inserted once batchSize entries
+// have been written or when the sink gets flushed.
+func NewSQLSink(driver string, dsn string, batchSize int) (*SQLSink, error) {
+	dialect, ok := sqlDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(SQLSink)
+	s.db = db
+	s.batchSize = batchSize
+	s.transactions = newSQLTable(dialect, "tm1_transaction_log", []string{
+		"id BIGINT", "change_set_id VARCHAR(255)", "time_stamp VARCHAR(64)", "replication_time VARCHAR(64)",
+		"user_name VARCHAR(255)", "cube_name VARCHAR(255)", "tuple " + dialect.textType, "old_value " + dialect.textType,
+		"new_value " + dialect.textType, "status_message " + dialect.textType, "server_name VARCHAR(255)",
+	})
+	s.messages = newSQLTable(dialect, "tm1_message_log", []string{
+		"id BIGINT", "thread_id BIGINT", "session_id BIGINT", "level VARCHAR(32)", "time_stamp VARCHAR(64)",
+		"logger VARCHAR(255)", "message " + dialect.textType, "server_name VARCHAR(255)",
+	})
+
+	// Create the tables if they don't exist yet
+	for _, table := range []*sqlTable{s.transactions, s.messages} {
+		if _, err := db.Exec(dialect.createTable(table.name, strings.Join(table.columns, ", "))); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// newSQLTable returns the definition of the table, including the statement to insert a row into it.
+func newSQLTable(dialect sqlDialect, name string, columns []string) *sqlTable {
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = strings.Fields(column)[0]
+		placeholders[i] = dialect.placeholder(i + 1)
+	}
+	return &sqlTable{
+		name:    name,
+		columns: columns,
+		insert:  "INSERT INTO " + name + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")",
+	}
+}
+
+// Write queues the entry to be inserted, inserting the queued entries if the batch is full.
+func (s *SQLSink) Write(entry interface{}) error {
+	switch e := entry.(type) {
+	case *odata.TransactionLogEntry:
+		tuple, _ := json.Marshal(e.Tuple)
+		s.transactions.rows = append(s.transactions.rows, []interface{}{
+			e.ID, e.ChangeSetID, e.TimeStamp, e.ReplicationTime, e.User, e.Cube, string(tuple),
+			sqlValue(e.OldValue), sqlValue(e.NewValue), sqlValue(e.StatusMessage), e.Server,
+		})
+	case *odata.MessageLogEntry:
+		s.messages.rows = append(s.messages.rows, []interface{}{
+			e.ID, e.ThreadID, e.SessionID, e.Level, e.TimeStamp, e.Logger, e.Message, e.Server,
+		})
+	default:
+		return &PermanentError{Err: fmt.Errorf("sql sink doesn't support entries of type %T", entry)}
+	}
+
+	if len(s.transactions.rows)+len(s.messages.rows) >= s.batchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush inserts all queued entries.
+func (s *SQLSink) Flush() error {
+	for _, table := range []*sqlTable{s.transactions, s.messages} {
+		if err := s.insert(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert inserts the queued rows of the table within a single transaction.
+func (s *SQLSink) insert(table *sqlTable) error {
+	return insertRows(s.db, table)
+}
+
+// insertRows inserts the queued rows of the table into the database within a single transaction.
+func insertRows(db *sql.DB, table *sqlTable) error {
+	if len(table.rows) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(table.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, row := range table.rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	table.rows = nil
+	return nil
+}
+
+// Close inserts any queued entries and closes the database.
+func (s *SQLSink) Close() error {
+	err := s.Flush()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sqlValue returns the representation of a value, which can be either a number or a string, as
+// stored in a text column.
+func sqlValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return csvValue(value)
+}
@@ -0,0 +1,210 @@
+package sinks
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SQLiteSink keeps the entries written within the retention period in the tm1_entries table of an
+// embedded SQLite database, created if it doesn't exist yet, so recent activity can be queried using
+// SQL without any external database. Rows hold the time_stamp, type, server_name, cube_name,
+// user_name, id, tuple, old_value, new_value and message of the entry, as far as it has those, and
+// the entry as a whole, as JSON, in entry, which can be queried using json_extract. The table is
+// indexed by cube_name, user_name and time_stamp. Entries older than the retention period are
+// deleted every so often.
+type SQLiteSink struct {
+	db        *sql.DB
+	batchSize int
+	retention time.Duration
+	pruned    time.Time // Last time entries older than the retention period were deleted
+	entries   *sqlTable
+}
+
+// sqlitePruneInterval is how often the entries older than the retention period are deleted.
+const sqlitePruneInterval = time.Minute
+
+// The statements creating the table, and its indexes, of the SQLiteSink if they don't exist yet.
+var sqliteSchema = []string{
+	"CREATE TABLE IF NOT EXISTS tm1_entries (time_stamp TEXT, type TEXT, server_name TEXT, cube_name TEXT, user_name TEXT, " +
+		"id INTEGER, tuple TEXT, old_value, new_value, message TEXT, entry TEXT)",
+	"CREATE INDEX IF NOT EXISTS tm1_entries_cube ON tm1_entries (cube_name, time_stamp)",
+	"CREATE INDEX IF NOT EXISTS tm1_entries_user ON tm1_entries (user_name, time_stamp)",
+	"CREATE INDEX IF NOT EXISTS tm1_entries_time ON tm1_entries (time_stamp)",
+}
+
+// NewSQLiteSink creates and returns a new SQLiteSink keeping the entries written within the retention
+// period in the database at the path, created if it doesn't exist yet. Entries are inserted once
+// batchSize entries have been written or when the sink gets flushed.
+func NewSQLiteSink(path string, retention time.Duration, batchSize int) (*SQLiteSink, error) {
+	db, err := openSQLite(path, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	s := new(SQLiteSink)
+	s.db = db
+	s.batchSize = batchSize
+	s.retention = retention
+	s.entries = newSQLTable(sqlDialects["sqlite"], "tm1_entries", []string{
+		"time_stamp", "type", "server_name", "cube_name", "user_name", "id", "tuple", "old_value", "new_value", "message", "entry",
+	})
+
+	return s, nil
+}
+
+// Write queues the entry to be inserted, inserting the queued entries if the batch is full.
+func (s *SQLiteSink) Write(entry interface{}) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	// Numbers are kept as is, rather than converted to floats, so large IDs don't lose precision
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return &PermanentError{Err: fmt.Errorf("sqlite sink doesn't support entries of type %T", entry)}
+	}
+
+	typ := entryType(entry)
+	if t, ok := fields["Type"].(string); ok && typ == "entry" {
+		typ = t
+	}
+	timeStamp, _ := fields["TimeStamp"].(string)
+	if timeStamp == "" {
+		timeStamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	var tuple interface{}
+	if fields["Tuple"] != nil {
+		tupleData, _ := json.Marshal(fields["Tuple"])
+		tuple = string(tupleData)
+	}
+	s.entries.rows = append(s.entries.rows, []interface{}{
+		timeStamp, typ, sqliteValue(fields["Server"]), sqliteValue(fields["Cube"]), sqliteValue(fields["User"]),
+		sqliteValue(fields["ID"]), tuple, sqliteValue(fields["OldValue"]), sqliteValue(fields["NewValue"]),
+		sqliteValue(fields["Message"]), string(data),
+	})
+	if len(s.entries.rows) >= s.batchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush inserts all queued entries and, if it's been a while, deletes the entries older than the
+// retention period.
+func (s *SQLiteSink) Flush() error {
+	if err := insertRows(s.db, s.entries); err != nil {
+		return err
+	}
+	if s.retention <= 0 || time.Since(s.pruned) < sqlitePruneInterval {
+		return nil
+	}
+	cutoff := time.Now().Add(-s.retention).UTC().Format(time.RFC3339Nano)
+	if _, err := s.db.Exec("DELETE FROM tm1_entries WHERE time_stamp < ?", cutoff); err != nil {
+		return err
+	}
+	s.pruned = time.Now()
+	return nil
+}
+
+// Close inserts any queued entries and closes the database.
+func (s *SQLiteSink) Close() error {
+	err := s.Flush()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// QuerySQLite runs the query against the database, at the path, of a SQLiteSink, opened read-only,
+// so it can be queried while entries are being written to it, and returns the names of the columns
+// and the rows of the result.
+func QuerySQLite(path string, query string) ([]string, [][]interface{}, error) {
+	db, err := openSQLite(path, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var result [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+		for i, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		result = append(result, row)
+	}
+	return columns, result, rows.Err()
+}
+
+// openSQLite opens the SQLite database at the path, using the write-ahead log, so it can be read
+// while being written to.
+func openSQLite(path string, readOnly bool) (*sql.DB, error) {
+	registered := false
+	for _, driver := range sql.Drivers() {
+		registered = registered || driver == "sqlite"
+	}
+	if !registered {
+		return nil, fmt.Errorf("sqlite is not supported by this build of the tracker, build it using -tags sqlite")
+	}
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)"
+	if readOnly {
+		dsn += "&mode=ro"
+	} else {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer only
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// sqliteValue returns the value of a field of an entry as stored in a column: numbers as integers or
+// reals, strings as is and anything else as JSON.
+func sqliteValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string:
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case bool:
+		return v
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package sinks
+
+// The SQLite driver used by the SQLiteSink, a port of SQLite to Go not requiring cgo, which is only
+// built in when building using the sqlite tag, as it adds considerably to the size of the tracker.
+import _ "modernc.org/sqlite"
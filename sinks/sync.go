@@ -0,0 +1,39 @@
+package sinks
+
+import "sync"
+
+// SyncSink wraps a sink, serializing all calls to it, allowing it to be shared by multiple
+// goroutines, like when tracking multiple servers.
+type SyncSink struct {
+	mutex sync.Mutex
+	sink  Sink
+}
+
+// NewSyncSink creates and returns a new SyncSink wrapping the sink.
+func NewSyncSink(sink Sink) *SyncSink {
+	s := new(SyncSink)
+	s.sink = sink
+
+	return s
+}
+
+// Write writes the entry to the wrapped sink.
+func (s *SyncSink) Write(entry interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sink.Write(entry)
+}
+
+// Flush flushes the wrapped sink.
+func (s *SyncSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sink.Flush()
+}
+
+// Close closes the wrapped sink.
+func (s *SyncSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sink.Close()
+}
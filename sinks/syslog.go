@@ -0,0 +1,261 @@
+package sinks
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Syslog severities, as used by syslog and GELF.
+const (
+	severityCritical      = 2
+	severityError         = 3
+	severityWarning       = 4
+	severityNotice        = 5
+	severityInformational = 6
+	severityDebug         = 7
+)
+
+// detailFields are the fields of an entry, by the name of the detail they're reported as, reported
+// by the syslog and GELF sinks, if the entry has them.
+var detailFields = [][2]string{
+	{"server", "Server"}, {"cube", "Cube"}, {"user", "User"}, {"actor", "Actor"}, {"tuple", "Tuple"},
+	{"id", "ID"}, {"changeSetId", "ChangeSetID"}, {"oldValue", "OldValue"}, {"newValue", "NewValue"},
+	{"level", "Level"}, {"logger", "Logger"}, {"threadId", "ThreadID"}, {"sessionId", "SessionID"},
+	{"action", "Action"}, {"objectType", "ObjectType"}, {"object", "Object"}, {"userName", "UserName"},
+	{"objectName", "ObjectName"},
+}
+
+// sdValueReplacer escapes the characters not allowed in a structured data parameter value.
+var sdValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`)
+
+// SyslogConfig defines the syslog server a SyslogSink sends entries to.
+type SyslogConfig struct {
+	// Network is the transport, udp, tcp or tls, and Address the host and port of the server.
+	Network string
+	Address string
+	// TLS is the TLS configuration used for the tls transport.
+	TLS *tls.Config
+	// Facility is the facility the messages are sent with, 16, local0, if not specified.
+	Facility int
+	// AppName is the application name the messages are sent with, tm1-blackhawk if not specified.
+	AppName string
+	// StructuredDataID is the ID of the structured data element holding the details of the entry,
+	// tm1@32473 if not specified, which uses the enterprise number reserved for documentation.
+	StructuredDataID string
+}
+
+// SyslogSink sends every entry written to it as an RFC 5424 message to a syslog server, i.e. of a
+// SIEM. Messages carry a summary of the entry, and its details, like the cube, user and tuple, as
+// structured data, with a severity derived from the entry. Messages are sent as datagrams over udp
+// or, using octet counting framing, over a tcp, or tls, connection, which is re-established if it
+// fails.
+type SyslogSink struct {
+	config   SyslogConfig
+	hostname string
+	conn     net.Conn
+	writer   *bufio.Writer
+}
+
+// NewSyslogSink creates and returns a new SyslogSink connected to the syslog server.
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	if config.Facility == 0 {
+		config.Facility = 16
+	}
+	if config.AppName == "" {
+		config.AppName = "tm1-blackhawk"
+	}
+	if config.StructuredDataID == "" {
+		config.StructuredDataID = "tm1@32473"
+	}
+
+	s := new(SyslogSink)
+	s.config = config
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect connects to the syslog server.
+func (s *SyslogSink) connect() error {
+	conn, err := dialLogServer(s.config.Network, s.config.Address, s.config.TLS)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// Write sends the entry as a message, buffered for tcp and tls until the next flush.
+func (s *SyslogSink) Write(entry interface{}) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	msgID := entryField(entry, "Type")
+	if msgID == "" {
+		msgID = entryType(entry)
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + s.config.StructuredDataID)
+	for _, detail := range entryDetails(entry) {
+		sd.WriteString(" " + detail[0] + `="` + sdValueReplacer.Replace(detail[1]) + `"`)
+	}
+	sd.WriteString("]")
+	msg := fmt.Sprintf("<%d>1 %s %s %s - %s %s \ufeff%s", s.config.Facility*8+entrySeverity(entry),
+		entryTime(entry).Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.config.AppName, msgID, sd.String(), entrySummary(entry))
+
+	var err error
+	if s.config.Network == "udp" {
+		// Every message is a datagram of its own
+		_, err = s.conn.Write([]byte(msg))
+	} else {
+		_, err = fmt.Fprintf(s.writer, "%d %s", len(msg), msg)
+	}
+	if err != nil {
+		s.disconnect()
+	}
+	return err
+}
+
+// Flush sends any buffered messages.
+func (s *SyslogSink) Flush() error {
+	if s.conn == nil {
+		return nil
+	}
+	if err := s.writer.Flush(); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+// disconnect closes the connection, after a failure, to be re-established on the next write.
+func (s *SyslogSink) disconnect() {
+	s.conn.Close()
+	s.conn = nil
+}
+
+// Close sends any buffered messages and closes the connection.
+func (s *SyslogSink) Close() error {
+	err := s.Flush()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+		s.conn = nil
+	}
+	return err
+}
+
+// dialLogServer connects to the log server at the address using the transport, udp, tcp or tls.
+func dialLogServer(network string, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	switch network {
+	case "udp", "tcp":
+		return dialer.Dial(network, address)
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	}
+	return nil, fmt.Errorf("unsupported network: %s", network)
+}
+
+// entrySeverity returns the syslog severity of the entry. Message log entries map their level,
+// audit events are notices, or, for failed logins, warnings, and anything else is informational.
+func entrySeverity(entry interface{}) int {
+	if _, ok := entry.(*odata.TransactionLogEntry); ok {
+		return severityInformational
+	}
+	switch strings.ToLower(entryField(entry, "Level")) {
+	case "fatal":
+		return severityCritical
+	case "error":
+		return severityError
+	case "warning", "warn":
+		return severityWarning
+	case "debug":
+		return severityDebug
+	}
+	if entryField(entry, "Action") == "LoginFailed" {
+		return severityWarning
+	}
+	if entryField(entry, "Type") == "AuditEvent" {
+		return severityNotice
+	}
+	return severityInformational
+}
+
+// entryTime returns the time stamp of the entry, or the current time if it doesn't have one.
+func entryTime(entry interface{}) time.Time {
+	if t, err := time.Parse(time.RFC3339, entryField(entry, "TimeStamp")); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// entryDetails returns the details of the entry, as pairs of the name of the detail and its value.
+func entryDetails(entry interface{}) [][2]string {
+	var details [][2]string
+	for _, field := range detailFields {
+		value := entryField(entry, field[1])
+		if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok {
+			switch field[1] {
+			case "Tuple":
+				tuple, _ := json.Marshal(txnLogEntry.Tuple)
+				value = string(tuple)
+			case "OldValue":
+				value = csvValue(txnLogEntry.OldValue)
+			case "NewValue":
+				value = csvValue(txnLogEntry.NewValue)
+			}
+		}
+		if value != "" && value != "<nil>" {
+			details = append(details, [2]string{field[0], value})
+		}
+	}
+	return details
+}
+
+// entrySummary returns a single line summarizing the entry, its message if it has one, a sentence
+// describing the change for transaction log entries, change sets and spreads, or its JSON
+// representation otherwise.
+func entrySummary(entry interface{}) string {
+	if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok {
+		return fmt.Sprintf("%s changed %s(%s) from %s to %s", txnLogEntry.User, txnLogEntry.Cube, strings.Join(txnLogEntry.Tuple, ", "),
+			csvValue(txnLogEntry.OldValue), csvValue(txnLogEntry.NewValue))
+	}
+	if changeSet, ok := entry.(*ChangeSet); ok {
+		return fmt.Sprintf("%s changed %d cells in %s", changeSet.User, changeSet.CellCount, strings.Join(changeSet.Cubes, ", "))
+	}
+	if auditLogEntry, ok := entry.(*odata.AuditLogEntry); ok {
+		return strings.Join(strings.Fields(auditLogEntry.UserName+" "+auditLogEntry.Description+" "+auditLogEntry.ObjectType+" "+auditLogEntry.ObjectName), " ")
+	}
+	if spread, ok := entry.(*Spread); ok {
+		return fmt.Sprintf("%s spread %s over %d cells in %s", spread.User, strconv.FormatFloat(spread.TotalDelta, 'f', -1, 64), spread.CellCount, spread.Cube)
+	}
+	if message := entryField(entry, "Message"); message != "" {
+		return strings.Join(strings.Fields(message), " ")
+	}
+	if action := entryField(entry, "Action"); action != "" {
+		return strings.Join(strings.Fields(strings.Join([]string{entryField(entry, "Actor"), action, entryField(entry, "ObjectType"), entryField(entry, "Object")}, " ")), " ")
+	}
+	data, _ := json.Marshal(entry)
+	return string(data)
+}
@@ -0,0 +1,88 @@
+package sinks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// TimescaleDBSink inserts every numeric cell change, as a row, into the tm1_cell_changes hypertable
+// of a TimescaleDB database, creating the hypertable if it doesn't exist yet, enabling time-series
+// charts of the data movement in TM1, i.e. in Grafana. Rows hold the time, server, cube and user, the
+// element of every dimension, as a JSONB object, and the new value and the change. Entries of any
+// other kind are ignored.
+type TimescaleDBSink struct {
+	db        *sql.DB
+	batchSize int
+	points    *timeSeriesPoints
+	changes   *sqlTable
+}
+
+// NewTimescaleDBSink creates and returns a new TimescaleDBSink for the database identified by the
+// data source name. Rows are inserted once batchSize rows have been written or when the sink gets
+// flushed. The dimensions function is used to resolve the dimensions, in order, of a cube on a
+// server.
+func NewTimescaleDBSink(dsn string, batchSize int, dimensions func(server string, cube string) ([]string, error)) (*TimescaleDBSink, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(TimescaleDBSink)
+	s.db = db
+	s.batchSize = batchSize
+	s.points = newTimeSeriesPoints(dimensions)
+	s.changes = newSQLTable(sqlDialects["postgres"], "tm1_cell_changes", []string{
+		"time TIMESTAMPTZ NOT NULL", "server_name TEXT", "cube_name TEXT", "user_name TEXT", "elements JSONB",
+		"value DOUBLE PRECISION", "change DOUBLE PRECISION",
+	})
+
+	// Create the hypertable, and an index for querying a cube, if they don't exist yet
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS " + s.changes.name + " (" + strings.Join(s.changes.columns, ", ") + ")",
+		"SELECT create_hypertable('" + s.changes.name + "', 'time', if_not_exists => TRUE)",
+		"CREATE INDEX IF NOT EXISTS " + s.changes.name + "_cube_time ON " + s.changes.name + " (cube_name, time DESC)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Write queues the row for the entry, if it's a numeric cell change, to be inserted, inserting the
+// queued rows if the batch is full.
+func (s *TimescaleDBSink) Write(entry interface{}) error {
+	point, err := s.points.point(entry)
+	if err != nil || point == nil {
+		return err
+	}
+
+	elements, err := json.Marshal(point.Elements)
+	if err != nil {
+		return err
+	}
+	s.changes.rows = append(s.changes.rows, []interface{}{
+		point.Time, point.Server, point.Cube, point.User, string(elements), point.Value, point.Value - point.OldValue,
+	})
+	if len(s.changes.rows) >= s.batchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush inserts all queued rows.
+func (s *TimescaleDBSink) Flush() error {
+	return insertRows(s.db, s.changes)
+}
+
+// Close inserts any queued rows and closes the database.
+func (s *TimescaleDBSink) Close() error {
+	err := s.Flush()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package sinks
+
+import (
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// timeSeriesPoint is a numeric cell change as written by the time-series sinks.
+type timeSeriesPoint struct {
+	Time     time.Time
+	Server   string
+	Cube     string
+	User     string
+	Elements map[string]string // Element by dimension name
+	Value    float64
+	OldValue float64
+}
+
+// timeSeriesPoints turns transaction log entries writing numeric values into time-series points,
+// resolving the dimensions, in order, of a cube on a server using the dimensions function, unless
+// the entry has been enriched with its elements already.
+type timeSeriesPoints struct {
+	dimensions func(server string, cube string) ([]string, error)
+	cubes      map[string][]string
+}
+
+// newTimeSeriesPoints returns a new timeSeriesPoints using the dimensions function.
+func newTimeSeriesPoints(dimensions func(server string, cube string) ([]string, error)) *timeSeriesPoints {
+	p := new(timeSeriesPoints)
+	p.dimensions = dimensions
+	p.cubes = map[string][]string{}
+
+	return p
+}
+
+// point returns the point for the entry, or nil if the entry isn't a transaction log entry writing
+// a numeric value.
+func (p *timeSeriesPoints) point(entry interface{}) (*timeSeriesPoint, error) {
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return nil, nil
+	}
+	oldValue, newValue, ok := txnLogEntry.NumericValues()
+	if !ok {
+		return nil, nil
+	}
+
+	point := &timeSeriesPoint{
+		Server:   txnLogEntry.Server,
+		Cube:     txnLogEntry.Cube,
+		User:     txnLogEntry.User,
+		Elements: txnLogEntry.Elements,
+		Value:    newValue,
+		OldValue: oldValue,
+	}
+	var err error
+	if point.Time, err = time.Parse(time.RFC3339, txnLogEntry.TimeStamp); err != nil {
+		point.Time = time.Now()
+	}
+	if point.Elements == nil {
+		key := txnLogEntry.Server + "/" + txnLogEntry.Cube
+		dimensions, ok := p.cubes[key]
+		if !ok {
+			if dimensions, err = p.dimensions(txnLogEntry.Server, txnLogEntry.Cube); err != nil {
+				return nil, err
+			}
+			p.cubes[key] = dimensions
+		}
+		point.Elements = make(map[string]string, len(dimensions))
+		for i, dimension := range dimensions {
+			if i < len(txnLogEntry.Tuple) {
+				point.Elements[dimension] = txnLogEntry.Tuple[i]
+			}
+		}
+	}
+	return point, nil
+}
@@ -0,0 +1,88 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Transform reshapes entries, so they match the schema expected downstream, by selecting a subset
+// of their fields, renaming fields and adding fields with constant values, the tags.
+type Transform struct {
+	// Fields, if set, are the fields kept, by their original name, all other fields are dropped.
+	Fields []string
+	// Rename maps the original names of fields to their new names.
+	Rename map[string]string
+	// Tags are the fields, with constant values, added to every entry.
+	Tags map[string]string
+}
+
+// Apply returns the transformed entry, represented by a map of its fields.
+func (t *Transform) Apply(entry interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as is, rather than converted to floats, so large IDs don't lose precision
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	fields := map[string]interface{}{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	transformed := map[string]interface{}{}
+	if len(t.Fields) > 0 {
+		for _, name := range t.Fields {
+			if value, ok := fields[name]; ok {
+				transformed[name] = value
+			}
+		}
+	} else {
+		transformed = fields
+	}
+	for name, newName := range t.Rename {
+		if value, ok := transformed[name]; ok {
+			delete(transformed, name)
+			transformed[newName] = value
+		}
+	}
+	for name, value := range t.Tags {
+		transformed[name] = value
+	}
+	return transformed, nil
+}
+
+// TransformSink transforms every entry written to it before writing it to the sink it wraps.
+type TransformSink struct {
+	sink      Sink
+	transform *Transform
+}
+
+// NewTransformSink creates and returns a new TransformSink writing the entries, transformed by the
+// transform, to the sink.
+func NewTransformSink(sink Sink, transform *Transform) *TransformSink {
+	s := new(TransformSink)
+	s.sink = sink
+	s.transform = transform
+
+	return s
+}
+
+// Write transforms the entry and writes it to the wrapped sink.
+func (s *TransformSink) Write(entry interface{}) error {
+	transformed, err := s.transform.Apply(entry)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	return s.sink.Write(transformed)
+}
+
+// Flush flushes the wrapped sink.
+func (s *TransformSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the wrapped sink.
+func (s *TransformSink) Close() error {
+	return s.sink.Close()
+}
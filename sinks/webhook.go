@@ -0,0 +1,130 @@
+package sinks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// WebhookConfig defines how a WebhookSink delivers entries.
+type WebhookConfig struct {
+	// URL is the URL the payloads get POSTed to.
+	URL string
+	// Headers are added to every request.
+	Headers map[string]string
+	// ContentType is the content type of the payloads, application/json if not specified.
+	ContentType string
+	// Batch, if set, delivers all entries written since the last flush in one request, otherwise
+	// every entry is delivered in a request of its own.
+	Batch bool
+	// Template, if set, is used to render the payload. It's executed with the entry, or, when
+	// batching, the slice of entries, as data. If not set, the payload is the JSON representation
+	// of the entry, or, when batching, an object with the entries in its value array.
+	Template *template.Template
+	// Secret, if set, is used to sign every payload using HMAC-SHA256. The signature is passed, hex
+	// encoded, in the X-Blackhawk-Signature header as in: sha256=<signature>.
+	Secret []byte
+}
+
+// WebhookSink delivers entries to a webhook.
+type WebhookSink struct {
+	client  *http.Client
+	config  WebhookConfig
+	entries []interface{}
+}
+
+// TemplateFuncs are the functions available to payload templates, next to the standard ones.
+var TemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhookSink creates and returns a new WebhookSink.
+func NewWebhookSink(config WebhookConfig) *WebhookSink {
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+	}
+
+	s := new(WebhookSink)
+	s.client = &http.Client{Timeout: time.Minute}
+	s.config = config
+
+	return s
+}
+
+// Write delivers the entry, or, when batching, queues it for delivery on the next flush.
+func (s *WebhookSink) Write(entry interface{}) error {
+	if s.config.Batch {
+		s.entries = append(s.entries, entry)
+		return nil
+	}
+	return s.deliver(entry)
+}
+
+// Flush delivers the queued entries, if any.
+func (s *WebhookSink) Flush() error {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	err := s.deliver(s.entries)
+	s.entries = nil
+	return err
+}
+
+// Close delivers the queued entries, if any.
+func (s *WebhookSink) Close() error {
+	return s.Flush()
+}
+
+// deliver renders the payload for the data, an entry or a slice of entries, and POSTs it.
+func (s *WebhookSink) deliver(data interface{}) error {
+	var payload bytes.Buffer
+	if s.config.Template != nil {
+		if err := s.config.Template.Execute(&payload, data); err != nil {
+			return &PermanentError{Err: err}
+		}
+	} else {
+		if entries, ok := data.([]interface{}); ok {
+			data = map[string]interface{}{"value": entries}
+		}
+		if err := json.NewEncoder(&payload).Encode(data); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.config.URL, bytes.NewReader(payload.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.config.ContentType)
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if s.config.Secret != nil {
+		mac := hmac.New(sha256.New, s.config.Secret)
+		mac.Write(payload.Bytes())
+		req.Header.Set("X-Blackhawk-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("webhook responded with: %s", resp.Status)
+		if isPermanentStatus(resp.StatusCode) {
+			err = &PermanentError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/rules"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Filter decides which entries get written to the sink. A transaction log entry passes the filter
+// if it was written to one of the cubes, by one of the users, and has, for every element pattern,
+// at least one element in its tuple matching the pattern. On top of that, any entry has to match
+// the expression, if any. An empty list of cubes or users, like a nil Filter, lets everything
+// through.
+type Filter struct {
+	cubes      map[string]bool
+	users      map[string]bool
+	elements   []*regexp.Regexp
+	expression *rules.Expression
+}
+
+// NewFilter creates and returns a new Filter. Cube and user names are, like in TM1, matched case
+// insensitive, as are the regular expressions the tuple elements are matched against. The
+// expression, if not empty, is written in the expression language of the alerting rules, as in
+// `Cube == "Sales" && double(entry.NewValue) - double(entry.OldValue) > 10000`.
+func NewFilter(cubes []string, users []string, elementPatterns []string, expression string) (*Filter, error) {
+	f := new(Filter)
+	f.cubes = map[string]bool{}
+	for _, cube := range cubes {
+		f.cubes[strings.ToLower(cube)] = true
+	}
+	f.users = map[string]bool{}
+	for _, user := range users {
+		f.users[strings.ToLower(user)] = true
+	}
+	for _, pattern := range elementPatterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.elements = append(f.elements, re)
+	}
+	if expression != "" {
+		var err error
+		if f.expression, err = rules.CompileExpression(expression); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Match returns true if the entry passes the filter.
+func (f *Filter) Match(entry interface{}) bool {
+	if f == nil {
+		return true
+	}
+	if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok && !f.matchTransaction(txnLogEntry) {
+		return false
+	}
+	return f.expression == nil || f.expression.Match(entry)
+}
+
+// matchTransaction returns true if the transaction log entry was written to one of the cubes, by
+// one of the users, and has elements matching the element patterns.
+func (f *Filter) matchTransaction(entry *odata.TransactionLogEntry) bool {
+	if len(f.cubes) > 0 && !f.cubes[strings.ToLower(entry.Cube)] {
+		return false
+	}
+	if len(f.users) > 0 && !f.users[strings.ToLower(entry.User)] {
+		return false
+	}
+	for _, re := range f.elements {
+		matched := false
+		for _, element := range entry.Tuple {
+			if re.MatchString(element) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestFilterMatchesEntries(t *testing.T) {
+	filter, err := NewFilter([]string{"Sales"}, []string{"Admin", "Planner"}, []string{"^2024$", "^(jan|feb)$"},
+		`double(entry.NewValue) - double(entry.OldValue) > 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		entry *odata.TransactionLogEntry
+		match bool
+	}{
+		{"matching", &odata.TransactionLogEntry{Cube: "Sales", User: "Admin", Tuple: []string{"2024", "Jan"}, OldValue: 0.0, NewValue: 500.0}, true},
+		{"case insensitive", &odata.TransactionLogEntry{Cube: "SALES", User: "planner", Tuple: []string{"2024", "FEB"}, OldValue: 0.0, NewValue: 500.0}, true},
+		{"other cube", &odata.TransactionLogEntry{Cube: "Revenue", User: "Admin", Tuple: []string{"2024", "Jan"}, OldValue: 0.0, NewValue: 500.0}, false},
+		{"other user", &odata.TransactionLogEntry{Cube: "Sales", User: "Guest", Tuple: []string{"2024", "Jan"}, OldValue: 0.0, NewValue: 500.0}, false},
+		{"element not matching", &odata.TransactionLogEntry{Cube: "Sales", User: "Admin", Tuple: []string{"2024", "Mar"}, OldValue: 0.0, NewValue: 500.0}, false},
+		{"element partially matching", &odata.TransactionLogEntry{Cube: "Sales", User: "Admin", Tuple: []string{"20245", "Jan"}, OldValue: 0.0, NewValue: 500.0}, false},
+		{"expression not matching", &odata.TransactionLogEntry{Cube: "Sales", User: "Admin", Tuple: []string{"2024", "Jan"}, OldValue: 0.0, NewValue: 50.0}, false},
+	} {
+		if match := filter.Match(test.entry); match != test.match {
+			t.Errorf("%s: got match %v, expected %v", test.name, match, test.match)
+		}
+	}
+
+	// Entries other than transaction log entries only have to match the expression
+	if !filter.Match(map[string]interface{}{"OldValue": 0.0, "NewValue": 500.0}) {
+		t.Error("expected an entry matching the expression to pass the filter")
+	}
+	var none *Filter
+	if !none.Match(&odata.TransactionLogEntry{Cube: "Revenue"}) {
+		t.Error("expected a nil filter to let every entry through")
+	}
+	if _, err := NewFilter(nil, nil, []string{"("}, ""); err == nil {
+		t.Error("expected an invalid element pattern to be rejected")
+	}
+}
+
+func TestTrackerWritesFilteredEntries(t *testing.T) {
+	server := fake.NewServer()
+	server.AddTransactionLogEntries(newEntry("2024", "Jan"), newEntry("2023", "Feb"), newEntry("2024", "Mar"))
+	tracker, sink := newTestTracker(t, server)
+	var err error
+	if tracker.Filter, err = NewFilter(nil, nil, []string{"^2024$"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written := ids(sink); len(written) != 2 || written[0] != 1 || written[1] != 3 {
+		t.Errorf("wrote entries %v, expected [1 3]", written)
+	}
+}
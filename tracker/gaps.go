@@ -0,0 +1,95 @@
+package tracker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// checkIDs returns the gap, if DetectGaps is set, between the last entry processed and the next
+// entry of the transaction log, if the ID of the next entry doesn't follow the ID of the last one.
+// IDs lower than the last one, as seen once the server restarted, aren't considered a gap, nor are
+// IDs skipped filtering the log using a $filter, or while recovering from a lost deltaLink.
+func (t *Tracker) checkIDs(last odata.EntryPosition, next odata.EntryPosition) *Gap {
+	if !t.DetectGaps || t.gap != nil || t.QueryOptions["$filter"] != "" || last.ID == 0 || next.ID <= last.ID+1 {
+		return nil
+	}
+	gap := &Gap{
+		Type:           "Gap",
+		Server:         t.Name,
+		Collection:     t.Collection,
+		TimeStamp:      time.Now().UTC().Format(time.RFC3339),
+		Reason:         fmt.Sprintf("IDs %d to %d missing", last.ID+1, next.ID-1),
+		From:           last,
+		Until:          next,
+		FirstMissingID: last.ID + 1,
+		LastMissingID:  next.ID - 1,
+		Skipped:        next.ID - last.ID - 1,
+	}
+	if gap.FirstMissingID == gap.LastMissingID {
+		gap.Reason = fmt.Sprintf("ID %d missing", gap.FirstMissingID)
+	}
+	if t.Backfill {
+		gap.Recovery = RecoverByBackfill
+	}
+	return gap
+}
+
+// backfill reads, if Backfill is set, the entries skipped by the gap, processing the ones the server
+// still has, and writes the gap, noting the entries recovered, to the sink.
+func (t *Tracker) backfill(r *response, gap *Gap, writes map[string]int) error {
+	if t.Backfill {
+		options := map[string]string{"$filter": "ID ge " + strconv.Itoa(gap.FirstMissingID) + " and ID le " + strconv.Itoa(gap.LastMissingID)}
+		for name, value := range t.queryOptions() {
+			if name != "$filter" {
+				options[name] = value
+			}
+		}
+		for urlStr := odata.AppendQueryOptions(t.Collection, options); urlStr != ""; {
+			var err error
+			if urlStr, err = t.backfillWindow(r, gap, urlStr, writes); err != nil {
+				return err
+			}
+		}
+	}
+	return t.deliver(r, gap, true, nil)
+}
+
+// backfillWindow processes the entries, skipped by the gap, of a window of the filtered log,
+// returning the nextLink, if any, to the next window.
+func (t *Tracker) backfillWindow(r *response, gap *Gap, urlStr string, writes map[string]int) (string, error) {
+	resp, err := t.Client.ExecuteGETRequestEx(r.ctx, odata.ResolveURL(t.ServiceRootURL, urlStr), func(*http.Request) {})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	err = odata.ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while backfilling the transaction log."
+	})
+	if err != nil {
+		return "", err
+	}
+
+	nextLink := ""
+	var sinkErr error
+	err = t.newJSONReviver(resp.Body).ParseTransactionLogs(func(txnLogContainer *odata.TransactionLogContainer) error {
+		if txnLogEntry := txnLogContainer.TransactionLogEntry; txnLogEntry != nil {
+			if txnLogEntry.ID < gap.FirstMissingID || txnLogEntry.ID > gap.LastMissingID {
+				return nil
+			}
+			gap.Skipped--
+			gap.Recovered++
+			sinkErr = t.processTransactionLogEntry(r, txnLogEntry, writes)
+			return sinkErr
+		}
+		nextLink = txnLogContainer.NextLink
+		return nil
+	})
+	if err != nil && err != sinkErr && t.OnParseError != nil {
+		t.OnParseError(nil, err)
+	}
+	return nextLink, err
+}
@@ -0,0 +1,76 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestTrackerDetectsGaps(t *testing.T) {
+	for _, backfill := range []bool{false, true} {
+		server := fake.NewServer()
+		server.AddTransactionLogEntries(newEntry("2024", "Jan"))
+		server.WithholdTransactionLogEntries(newEntry("2024", "Feb"), newEntry("2024", "Mar"))
+		server.AddTransactionLogEntries(newEntry("2024", "Apr"))
+
+		tracker, sink := newTestTracker(t, server)
+		tracker.DetectGaps = true
+		tracker.Backfill = backfill
+		var gaps []*Gap
+		tracker.OnGap = func(gap *Gap) { gaps = append(gaps, gap) }
+		if err := tracker.Read(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []int{1, 4}
+		if backfill {
+			want = []int{1, 2, 3, 4}
+		}
+		if written := ids(sink); len(written) != len(want) || written[len(written)-1] != 4 || written[1] != want[1] {
+			t.Errorf("backfill %v: wrote entries %v, expected %v", backfill, written, want)
+		}
+		if len(gaps) != 1 {
+			t.Fatalf("backfill %v: got %d gaps, expected 1", backfill, len(gaps))
+		}
+		gap := gaps[0]
+		if gap.FirstMissingID != 2 || gap.LastMissingID != 3 || gap.From.ID != 1 || gap.Until.ID != 4 {
+			t.Errorf("backfill %v: got gap %+v, expected IDs 2 to 3 to be missing", backfill, gap)
+		}
+		if recovered := len(want) - 2; gap.Recovered != recovered || gap.Skipped != 2-recovered {
+			t.Errorf("backfill %v: got gap %+v, expected %d entries to be recovered", backfill, gap, recovered)
+		}
+	}
+}
+
+func TestCheckIDs(t *testing.T) {
+	tracker := New("http://server/api/v1/", "TransactionLogEntries", nil)
+	last := odata.EntryPosition{ID: 5, TimeStamp: "2024-01-01T10:00:00Z"}
+	next := func(id int) odata.EntryPosition {
+		return odata.EntryPosition{ID: id, TimeStamp: "2024-01-01T10:00:01Z"}
+	}
+	if gap := tracker.checkIDs(last, next(8)); gap != nil {
+		t.Errorf("got gap %+v without detecting gaps, expected none", gap)
+	}
+
+	tracker.DetectGaps = true
+	for id, reason := range map[int]string{6: "", 5: "", 1: "", 7: "ID 6 missing", 9: "IDs 6 to 8 missing"} {
+		got := ""
+		if gap := tracker.checkIDs(last, next(id)); gap != nil {
+			got = gap.Reason
+			if gap.Skipped != id-6 {
+				t.Errorf("ID %d: got %d entries skipped, expected %d", id, gap.Skipped, id-6)
+			}
+		}
+		if got != reason {
+			t.Errorf("ID %d: got gap %q, expected %q", id, got, reason)
+		}
+	}
+
+	// IDs skipped filtering the log aren't missing
+	tracker.QueryOptions = map[string]string{"$filter": "Cube eq 'Sales'"}
+	if gap := tracker.checkIDs(last, next(9)); gap != nil {
+		t.Errorf("got gap %+v filtering the log, expected none", gap)
+	}
+}
@@ -0,0 +1,41 @@
+package tracker
+
+import "time"
+
+// AdaptivePolling adapts the interval between delta requests to the activity of the collection,
+// halving it, down to Min, every time a delta returned entries and doubling it, up to Max, every
+// time a delta returned none. This minimizes the latency while the collection changes, without
+// hammering the server while it doesn't.
+type AdaptivePolling struct {
+	Min      time.Duration
+	Max      time.Duration
+	interval time.Duration
+}
+
+// NewAdaptivePolling creates and returns a new AdaptivePolling, between the floor, min, and the
+// ceiling, max, starting at the ceiling.
+func NewAdaptivePolling(min time.Duration, max time.Duration) *AdaptivePolling {
+	p := new(AdaptivePolling)
+	p.Min = min
+	p.Max = max
+	p.interval = max
+
+	return p
+}
+
+// Next returns the interval to wait before the next delta request, given whether the last delta
+// returned any entries.
+func (p *AdaptivePolling) Next(changed bool) time.Duration {
+	if changed {
+		p.interval /= 2
+	} else {
+		p.interval *= 2
+	}
+	if p.interval < p.Min {
+		p.interval = p.Min
+	}
+	if p.interval > p.Max {
+		p.interval = p.Max
+	}
+	return p.interval
+}
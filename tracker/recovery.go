@@ -0,0 +1,162 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Recovery is how tracking a log recovers from losing its deltaLink, as happens when the server
+// restarts.
+type Recovery string
+
+const (
+	// RecoverFromEnd starts over from the current end of the log, skipping the entries written
+	// since the last entry processed.
+	RecoverFromEnd Recovery = "end"
+	// RecoverFromLastEntry starts over from the time stamp of the last entry processed, reading the
+	// entries written since again, skipping the ones already processed.
+	RecoverFromLastEntry Recovery = "last-entry"
+	// RecoverByBackfill reads the entries of which the IDs were skipped using a query filtering by
+	// their IDs, as done for a gap detected checking the IDs of the transaction log entries.
+	RecoverByBackfill Recovery = "backfill"
+)
+
+// Gap is written to the sink once tracking started over after losing its deltaLink, noting the
+// range of entries which might be missing: the entries written after From up to, and including,
+// Until, the last entry of the log when tracking started over. Recovering from the end these are
+// skipped, recovering from the last entry they are read again, in which case only the entries the
+// server didn't retain, as in when it restarted without saving them, are missing.
+// A Gap is also written once the IDs of the transaction log entries skip from From to Until, the
+// entry following the gap, in which case FirstMissingID and LastMissingID hold the IDs skipped.
+type Gap struct {
+	Type           string              `json:"Type"` // Always Gap
+	Server         string              `json:"Server,omitempty"`
+	Collection     string              `json:"Collection"`
+	TimeStamp      string              `json:"TimeStamp"` // Time tracking started over, or the gap was detected
+	Reason         string              `json:"Reason"`    // Why the deltaLink was considered lost, or the entries missing
+	Recovery       Recovery            `json:"Recovery,omitempty"`
+	From           odata.EntryPosition `json:"From"`                     // Last entry processed before the gap, if any
+	Until          odata.EntryPosition `json:"Until"`                    // Last entry of the log when tracking started over, or the entry following the gap
+	FirstMissingID int                 `json:"FirstMissingID,omitempty"` // First ID skipped, if detected checking the IDs
+	LastMissingID  int                 `json:"LastMissingID,omitempty"`  // Last ID skipped, if detected checking the IDs
+	Skipped        int                 `json:"Skipped"`                  // Number of entries skipped recovering from the end, or still missing
+	Recovered      int                 `json:"Recovered"`                // Number of entries read again recovering from the last entry, or backfilled
+
+	idle bool // Whether the deltaLink was only presumed lost, as the log remained idle for too long
+}
+
+func init() {
+	sinks.RegisterBufferedType("Gap", (*Gap)(nil))
+}
+
+// deltaLinkLost starts over tracking the log, as the deltaLink got lost, returning the URL of the
+// collection to start over from, filtered by the time stamp of the last entry processed if
+// recovering from there.
+func (t *Tracker) deltaLinkLost(err error) string {
+	position := t.lastEntry()
+	var idle *idleError
+	t.gap = &Gap{
+		Type:       "Gap",
+		Server:     t.Name,
+		Collection: t.Collection,
+		TimeStamp:  time.Now().UTC().Format(time.RFC3339),
+		Reason:     err.Error(),
+		Recovery:   t.Recovery,
+		From:       position,
+		idle:       errors.As(err, &idle),
+	}
+	t.idleSince = time.Time{}
+
+	options := t.queryOptions()
+	if t.Recovery == RecoverFromLastEntry && position.TimeStamp != "" {
+		filter := "TimeStamp ge " + position.TimeStamp
+		if options["$filter"] != "" {
+			filter = "(" + options["$filter"] + ") and " + filter
+		}
+		filtered := map[string]string{"$filter": filter}
+		for name, value := range options {
+			if name != "$filter" {
+				filtered[name] = value
+			}
+		}
+		options = filtered
+	}
+	return odata.AppendQueryOptions(t.Collection, options)
+}
+
+// checkIdle returns ErrDeltaLinkLost, presuming the deltaLink got lost, if the log didn't return any
+// new entries for longer than MaxIdle.
+func (t *Tracker) checkIdle() error {
+	if t.Recovery == "" || t.MaxIdle <= 0 || !t.following || t.gap != nil {
+		return nil
+	}
+	if t.idleSince.IsZero() {
+		t.idleSince = time.Now()
+		return nil
+	}
+	if idle := time.Since(t.idleSince); idle > t.MaxIdle {
+		return &idleError{idle: idle.Round(time.Second)}
+	}
+	return nil
+}
+
+// idleError is the error reporting the deltaLink presumed lost, as the log remained idle.
+type idleError struct {
+	idle time.Duration
+}
+
+func (e *idleError) Error() string {
+	return fmt.Sprintf("%s: no new entries for %s", odata.ErrDeltaLinkLost, e.idle)
+}
+
+func (e *idleError) Unwrap() error {
+	return odata.ErrDeltaLinkLost
+}
+
+// recovering counts the entry, not processed before, if read while recovering, returning true if
+// it's to be skipped, as tracking recovers from the end of the log.
+func (t *Tracker) recovering() bool {
+	if t.gap == nil {
+		return false
+	}
+	if t.Recovery == RecoverFromEnd {
+		t.gap.Skipped++
+		return true
+	}
+	t.gap.Recovered++
+	return false
+}
+
+// endGap ends the recovery, once the response holding the deltaLink got processed, writing the gap,
+// ending at the last entry, to the sink. Having presumed the deltaLink lost, as the log remained
+// idle, the gap is only written if any entries showed up, proving the deltaLink was stale indeed.
+func (t *Tracker) endGap(last odata.EntryPosition) error {
+	gap := t.gap
+	if gap == nil {
+		return nil
+	}
+	t.gap = nil
+	gap.Until = last
+	if gap.idle && gap.Skipped == 0 && gap.Recovered == 0 {
+		return nil
+	}
+
+	err := t.Sink.Write(gap)
+	if err == nil {
+		err = t.Sink.Flush()
+	}
+	if t.OnSinkResult != nil {
+		t.OnSinkResult(err)
+	}
+	if err != nil {
+		return err
+	}
+	if t.OnGap != nil {
+		t.OnGap(gap)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+func TestTrackerRecoversOnceServerRestarted(t *testing.T) {
+	for _, test := range []struct {
+		recovery           Recovery
+		written            []int
+		recovered, skipped int
+	}{
+		// The entries read before the restart are skipped, the one written since is either recovered
+		// or skipped as well
+		{RecoverFromLastEntry, []int{1, 2, 3, 4}, 1, 0},
+		{RecoverFromEnd, []int{1, 2, 3}, 0, 1},
+	} {
+		server := fake.NewServer()
+		server.AddTransactionLogEntries(newEntry("2024", "Jan"), newEntry("2024", "Feb"), newEntry("2024", "Mar"))
+
+		tracker, sink := newTestTracker(t, server)
+		tracker.Recovery = test.recovery
+		ctx, cancel := context.WithCancel(context.Background())
+		deltas := 0
+		tracker.OnDelta = func(writes map[string]int) {
+			if deltas++; deltas == 1 {
+				server.Restart()
+				server.AddTransactionLogEntries(newEntry("2024", "Apr"))
+			}
+		}
+		var gaps []*Gap
+		tracker.OnGap = func(gap *Gap) {
+			gaps = append(gaps, gap)
+			cancel()
+		}
+
+		err := tracker.Track(ctx, time.Millisecond)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected tracking to stop once cancelled, got %v", test.recovery, err)
+		}
+		if written := ids(sink); len(written) != len(test.written) || written[len(written)-1] != test.written[len(test.written)-1] {
+			t.Errorf("%s: wrote entries %v, expected %v", test.recovery, written, test.written)
+		}
+		if len(gaps) != 1 {
+			t.Fatalf("%s: got %d gaps, expected 1", test.recovery, len(gaps))
+		}
+		if gap := gaps[0]; gap.Recovered != test.recovered || gap.Skipped != test.skipped || gap.From.ID != 3 || gap.Until.ID != 4 {
+			t.Errorf("%s: got gap %+v, expected %d entries recovered and %d skipped", test.recovery, gap, test.recovered, test.skipped)
+		}
+		entries := sink.Entries()
+		if gap, ok := entries[len(entries)-1].(*Gap); !ok || gap != gaps[0] {
+			t.Errorf("%s: expected the gap to be written to the sink, after the entries recovered", test.recovery)
+		}
+	}
+}
+
+func TestTrackerFailsOnceServerRestartedWithoutRecovery(t *testing.T) {
+	server := fake.NewServer()
+	server.AddTransactionLogEntries(newEntry("2024", "Jan"))
+	tracker, _ := newTestTracker(t, server)
+	tracker.OnDelta = func(writes map[string]int) { server.Restart() }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracker.Track(ctx, time.Millisecond); !odata.DeltaLinkLost(err) {
+		t.Errorf("expected tracking to fail as the deltaLink got lost, got %v", err)
+	}
+}
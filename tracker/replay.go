@@ -0,0 +1,142 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Replay processes the entries archived in the stream, one JSON encoded entry per line as written by
+// the file sink, as if they were just read from the server: they are inspected, filtered, enriched
+// and written to the sink like the entries read while tracking, tagged with the server they
+// originate from as archived. Transaction, message and audit log entries are recognized by their
+// fields, lines holding a record derived from the entries, like a Gap, which all have a Type, are
+// skipped, as those are derived again, and any other line is processed as an entity. If speed is
+// positive the entries are replayed at that multiple of the pace at which they were written,
+// according to their time stamps, otherwise as fast as possible. Replaying stops once the context
+// is done, in which case the context's error is returned.
+func (t *Tracker) Replay(ctx context.Context, stream io.Reader, speed float64) error {
+	location := t.TimeZone
+	if location == nil {
+		location = time.UTC
+	}
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	r := newResponse(stream)
+	writes := map[string]int{}
+	var previous time.Time
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry, err := archivedEntry(line)
+		if err != nil {
+			if t.OnParseError != nil {
+				t.OnParseError(json.RawMessage(line), err)
+			}
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		// Deliver whatever has been replayed before waiting until the entry is due
+		if timeStamp, err := odata.ParseTimeStamp(entryTimeStamp(entry), location); speed > 0 && err == nil {
+			if !previous.IsZero() && timeStamp.After(previous) {
+				if err := t.complete(r, nil, nil, odata.EntryPosition{}, odata.EntryPosition{}, writes); err != nil {
+					return err
+				}
+				r = newResponse(stream)
+				writes = map[string]int{}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(float64(timeStamp.Sub(previous)) / speed)):
+				}
+			}
+			if timeStamp.After(previous) {
+				previous = timeStamp
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := t.replayEntry(r, entry, writes); err != nil {
+			return t.complete(r, err, err, odata.EntryPosition{}, odata.EntryPosition{}, writes)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return t.complete(r, nil, nil, odata.EntryPosition{}, odata.EntryPosition{}, writes)
+}
+
+// replayEntry processes the archived entry, as done for the entries read from the server.
+func (t *Tracker) replayEntry(r *response, entry interface{}, writes map[string]int) error {
+	txnLogEntry, isTransaction := entry.(*odata.TransactionLogEntry)
+	if isTransaction {
+		writes[txnLogEntry.Cube]++
+	}
+	records, keep := t.inspect(entry)
+	keep = keep && t.match(entry)
+	if keep && isTransaction && t.Enrich != nil {
+		start := time.Now()
+		t.Enrich(txnLogEntry)
+		r.enrich += time.Since(start)
+	}
+	return t.deliver(r, entry, keep, records)
+}
+
+// archivedEntry decodes the archived entry, returning nil if the line holds a record derived from
+// the entries.
+func archivedEntry(line []byte) (interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	var entry interface{}
+	switch {
+	case fields["Type"] != nil:
+		return nil, nil
+	case fields["Tuple"] != nil && fields["Cube"] != nil:
+		entry = &odata.TransactionLogEntry{}
+	case fields["Logger"] != nil && fields["Level"] != nil:
+		entry = &odata.MessageLogEntry{}
+	case fields["ObjectType"] != nil && fields["Description"] != nil:
+		entry = &odata.AuditLogEntry{}
+	default:
+		var entity map[string]interface{}
+		if err := json.Unmarshal(line, &entity); err != nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+	if err := json.Unmarshal(line, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// entryTimeStamp returns the time stamp of the entry, if it has one.
+func entryTimeStamp(entry interface{}) string {
+	switch e := entry.(type) {
+	case *odata.TransactionLogEntry:
+		return e.TimeStamp
+	case *odata.MessageLogEntry:
+		return e.TimeStamp
+	case *odata.AuditLogEntry:
+		return e.TimeStamp
+	case map[string]interface{}:
+		timeStamp, _ := e["TimeStamp"].(string)
+		return timeStamp
+	}
+	return ""
+}
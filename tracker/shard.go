@@ -0,0 +1,53 @@
+package tracker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Shard is the part of the entries a tracker is responsible for when the entries of a busy server
+// are partitioned across multiple trackers. Transaction log entries are assigned to a shard by the
+// hash of the name of the cube they were written to, so all writes to a cube are processed by the
+// same tracker, in order. Any other entries are assigned to the first shard. A nil Shard processes
+// every entry.
+type Shard struct {
+	Index int // Index of the shard, from 1 up to and including Count
+	Count int // Number of shards the entries are partitioned in
+}
+
+// ParseShard parses the shard as specified by i/n, as in 2/4 for the second of four shards.
+func ParseShard(s string) (*Shard, error) {
+	index, count, ok := strings.Cut(s, "/")
+	shard := new(Shard)
+	var err1, err2 error
+	shard.Index, err1 = strconv.Atoi(strings.TrimSpace(index))
+	shard.Count, err2 = strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err1 != nil || err2 != nil || shard.Index < 1 || shard.Index > shard.Count {
+		return nil, fmt.Errorf("invalid shard %s, expected i/n, as in 2/4 for the second of four shards", s)
+	}
+	return shard, nil
+}
+
+// Owns returns whether the entry is assigned to the shard.
+func (s *Shard) Owns(entry interface{}) bool {
+	if s == nil || s.Count <= 1 {
+		return true
+	}
+	txnLogEntry, ok := entry.(*odata.TransactionLogEntry)
+	if !ok {
+		return s.Index == 1
+	}
+	// Cube names are, like in TM1, case insensitive
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(txnLogEntry.Cube)))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index-1
+}
+
+// String returns the shard as i/n.
+func (s *Shard) String() string {
+	return strconv.Itoa(s.Index) + "/" + strconv.Itoa(s.Count)
+}
@@ -0,0 +1,62 @@
+package tracker
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is the tracer of the package, using the globally registered tracer provider.
+var tracer = otel.Tracer("github.com/hubert-heijkers/tm1-blackhawk/tracker")
+
+// response keeps track of the time spent in the stages of the pipeline while processing a response.
+// As entries are parsed, enriched and written one at a time, the time spent enriching and writing
+// entries is accumulated, whatever remains is the time spent parsing.
+type response struct {
+	ctx     context.Context
+	start   time.Time
+	entries int // Number of new entries processed
+	written int // Number of entries, and records derived from them, written to the sink
+	enrich  time.Duration
+	write   time.Duration
+}
+
+// newResponse starts keeping track of the processing of the response, read from the stream, which
+// carries the span in which it's processed.
+func newResponse(stream io.Reader) *response {
+	r := new(response)
+	r.ctx = odata.StreamContext(stream)
+	r.start = time.Now()
+
+	return r
+}
+
+// end records, once all entries have been processed, the time spent in every stage on the span.
+func (r *response) end() {
+	parse := time.Since(r.start) - r.enrich - r.write
+	trace.SpanFromContext(r.ctx).SetAttributes(
+		attribute.Int("blackhawk.entries", r.entries),
+		attribute.Int64("blackhawk.parse_ms", parse.Milliseconds()),
+		attribute.Int64("blackhawk.enrich_ms", r.enrich.Milliseconds()),
+		attribute.Int64("blackhawk.write_ms", r.write.Milliseconds()),
+	)
+}
+
+// trace calls fn within a child span, with the name, of the span of the response.
+func (r *response) trace(name string, fn func() error) error {
+	_, span := tracer.Start(r.ctx, name)
+	defer span.End()
+
+	err := fn()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
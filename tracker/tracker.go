@@ -0,0 +1,487 @@
+// Package tracker tracks the transaction log, the message log, the audit log or any other collection
+// supporting track-changes of a TM1 server, writing the entries to a sink, allowing other Go programs
+// to embed TM1 change tracking.
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/sinks"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// Sink is a destination the entries, as they are being processed, are written to.
+type Sink = sinks.Sink
+
+// Authenticator adds the credentials, as expected by the authentication mode of the server, to the
+// requests of the client.
+type Authenticator = odata.Authenticator
+
+// Tracker tracks a collection of a TM1 server, writing every entry of the collection, which passes
+// the filter if any, to the sink. Tracking the transaction and message logs, the position of the
+// last entry processed is kept in the checkpoint, if any, so no entry gets written twice.
+// Every entry goes through the optional hooks, allowing the entries to be inspected, enriched and
+// the progress to be monitored.
+type Tracker struct {
+	Name           string            // Name of the server, if set every entry gets tagged with it
+	ServiceRootURL string            // Service root URL of the server
+	Collection     string            // Collection being tracked, as in TransactionLogEntries
+	QueryOptions   map[string]string // Query options, like $filter, applied to the collection
+	Client         *odata.Client     // Client, created using Processor, holding the session with the server
+	Sink           Sink              // Sink the entries get written to
+	Filter         *Filter           // Filter deciding which entries get written, if any, replaced while tracking using SetFilter
+	Checkpoint     *odata.Checkpoint // Checkpoint keeping track of the progress, if any
+	Polling        *AdaptivePolling  // Polling adapting the interval between deltas, if any
+	Shard          *Shard            // Shard of the entries processed, if the entries are partitioned across multiple trackers
+
+	// TimeZone, if set, is the time zone of the server, in which case the time stamps of the
+	// transaction and message log entries, unless they specify their offset, are interpreted as the
+	// local time in that time zone and normalized to UTC. Entries with a time stamp lying further
+	// ahead of the clock of the tracker than ClockSkew are flagged as having a future time stamp.
+	TimeZone  *time.Location
+	ClockSkew time.Duration
+
+	// Inspect, if set, is called for every new entry, before it's filtered, and returns any
+	// additional records, like events derived from the entry, to be written to the sink, and
+	// whether the entry itself should be written.
+	Inspect func(entry interface{}) ([]interface{}, bool)
+
+	// Enrich, if set, is called for every transaction log entry passing the filter, before it's
+	// written to the sink.
+	Enrich func(entry *odata.TransactionLogEntry)
+
+	// OnParseError, if set, is called for every entry skipped as it couldn't be decoded, and, with
+	// a nil raw message, when a response couldn't be parsed at all.
+	OnParseError func(raw json.RawMessage, err error)
+
+	// OnSinkResult and OnCheckpointResult, if set, are called with the result of every attempt to
+	// write to, or flush, the sink, respectively to save the checkpoint.
+	OnSinkResult       func(err error)
+	OnCheckpointResult func(err error)
+
+	// OnDelta, if set, is called after every response has been processed, and delivered,
+	// successfully, with the number of transaction log entries written by cube.
+	OnDelta func(writes map[string]int)
+
+	// OnEmptyDelta, if set, is called, after OnDelta, for every response processed successfully
+	// which didn't hold any new entries, allowing idle time to be used for bookkeeping.
+	OnEmptyDelta func()
+
+	// Recovery, if set, makes tracking a log start over, rather than fail, once the server rejects
+	// its deltaLink, as it does after a restart, or, if MaxIdle is set, once the log didn't return
+	// any new entries for longer than MaxIdle, presuming the deltaLink went stale. A Gap, noting
+	// the entries which might be missing, is written to the sink, and passed to OnGap, if set, once
+	// tracking started over.
+	Recovery Recovery
+	MaxIdle  time.Duration
+	OnGap    func(gap *Gap)
+
+	// DetectGaps, if set, makes tracking the transaction log check the IDs of its entries, which
+	// increase by one with every entry, writing a Gap, and passing it to OnGap, for any IDs skipped.
+	// If Backfill is set too, the entries skipped are read using a query filtering by their IDs and,
+	// if the server still has them, processed before the entry following them.
+	DetectGaps bool
+	Backfill   bool
+
+	filterMutex sync.RWMutex
+
+	changed   bool                // Whether any entries were processed since the last delta request
+	position  odata.EntryPosition // Position of the last entry processed, without a checkpoint
+	following bool                // Whether the next request follows a deltaLink
+	idleSince time.Time           // Time the last new entries were processed
+	gap       *Gap                // Gap being recovered from, if any
+}
+
+// New creates and returns a new Tracker of the collection of the server, writing to the sink.
+func New(serviceRootURL string, collection string, sink Sink) *Tracker {
+	t := new(Tracker)
+	t.ServiceRootURL = serviceRootURL
+	t.Collection = collection
+	t.Sink = sink
+
+	return t
+}
+
+// Processor returns the function processing the responses of the collection, with which the client
+// is to be created.
+func (t *Tracker) Processor() odata.ResponseProcessorFunc {
+	switch t.Collection {
+	case "TransactionLogEntries":
+		return t.processTransactionLogEntries
+	case "MessageLogEntries":
+		return t.processMessageLogEntries
+	case "AuditLogEntries":
+		return t.processAuditLogEntries
+	default:
+		return t.processEntities
+	}
+}
+
+// Track tracks the collection, requesting its changes every interval, or, if adaptive polling is
+// set, at the interval adapted to the activity of the collection, until the context is done, in
+// which case the context's error is returned.
+func (t *Tracker) Track(ctx context.Context, interval time.Duration) error {
+	if t.Polling != nil {
+		t.Client.Interval = func() time.Duration {
+			changed := t.changed
+			t.changed = false
+			return t.Polling.Next(changed)
+		}
+	}
+	if t.Recovery != "" {
+		t.Client.OnDeltaLinkLost = t.deltaLinkLost
+	}
+	return t.Client.TrackCollection(ctx, t.ServiceRootURL, odata.AppendQueryOptions(t.Collection, t.queryOptions()), interval, t.Checkpoint)
+}
+
+// Read reads the collection once, without tracking any subsequent changes.
+func (t *Tracker) Read(ctx context.Context) error {
+	return t.Client.ReadCollection(ctx, t.ServiceRootURL, odata.AppendQueryOptions(t.Collection, t.queryOptions()))
+}
+
+// queryOptions returns the query options applied to the collection, which, for the audit log, unless
+// specified otherwise, expand the AuditDetails of every entry.
+func (t *Tracker) queryOptions() map[string]string {
+	if t.Collection != "AuditLogEntries" || t.QueryOptions["$expand"] != "" {
+		return t.QueryOptions
+	}
+	options := map[string]string{"$expand": "AuditDetails"}
+	for name, value := range t.QueryOptions {
+		options[name] = value
+	}
+	return options
+}
+
+// processTransactionLogEntries is called every time the server has returned a response to either
+// the initial or any follow up delta requests. This function then parses the JSON in the response
+// and iterates any transaction log entries contained within it.
+// This function 'processes' the entries one by one, in the same order as they were injected into
+// the transaction log of the server. Within one run of the server you will never miss any new
+// entries nor get any entry more then once for processing.
+func (t *Tracker) processTransactionLogEntries(stream io.Reader) (string, string, error) {
+	if err := t.checkIdle(); err != nil {
+		return "", "", err
+	}
+	reviver := t.newJSONReviver(stream)
+	r := newResponse(stream)
+
+	nextLink, deltaLink := "", ""
+	var writes map[string]int // Allocated once the first entry shows up, empty deltas being the norm
+	position := t.lastEntry()
+	last := position
+	var gaps []*Gap
+	var sinkErr error
+	err := reviver.ParseTransactionLogs(func(txnLogContainer *odata.TransactionLogContainer) error {
+		if txnLogEntry := txnLogContainer.TransactionLogEntry; txnLogEntry != nil {
+			// Skip entries we've already delivered before, if we happen to read them again
+			if position.Covers(txnLogEntry.ID, txnLogEntry.TimeStamp) {
+				return nil
+			}
+			if writes == nil {
+				writes = map[string]int{}
+			}
+			next := odata.EntryPosition{ID: txnLogEntry.ID, TimeStamp: txnLogEntry.TimeStamp}
+			if gap := t.checkIDs(last, next); gap != nil {
+				if sinkErr = t.backfill(r, gap, writes); sinkErr != nil {
+					return sinkErr
+				}
+				gaps = append(gaps, gap)
+			}
+			last = next
+			if t.recovering() {
+				return nil
+			}
+			sinkErr = t.processTransactionLogEntry(r, txnLogEntry, writes)
+			return sinkErr
+		}
+		nextLink, deltaLink = txnLogContainer.NextLink, txnLogContainer.DeltaLink
+		return nil
+	})
+	if err := t.complete(r, err, sinkErr, position, last, writes); err != nil {
+		return "", "", err
+	}
+	for _, gap := range gaps {
+		if t.OnGap != nil {
+			t.OnGap(gap)
+		}
+	}
+	t.following = deltaLink != ""
+	if t.following {
+		if err := t.endGap(last); err != nil {
+			return "", "", err
+		}
+	}
+	return nextLink, deltaLink, nil
+}
+
+// processTransactionLogEntry processes a new transaction log entry, counting it by cube in writes,
+// and delivers it, unless filtered out, to the sink.
+func (t *Tracker) processTransactionLogEntry(r *response, txnLogEntry *odata.TransactionLogEntry, writes map[string]int) error {
+	txnLogEntry.Server = t.Name
+	if t.TimeZone != nil {
+		txnLogEntry.TimeStamp, txnLogEntry.FutureTimeStamp = odata.NormalizeTimeStamp(txnLogEntry.TimeStamp, t.TimeZone, time.Now(), t.ClockSkew)
+	}
+	writes[txnLogEntry.Cube]++
+	records, keep := t.inspect(txnLogEntry)
+	keep = keep && t.match(txnLogEntry)
+	if keep && t.Enrich != nil {
+		start := time.Now()
+		t.Enrich(txnLogEntry)
+		r.enrich += time.Since(start)
+	}
+	return t.deliver(r, txnLogEntry, keep, records)
+}
+
+// processMessageLogEntries is the message log counterpart of processTransactionLogEntries and
+// processes the message log entries, in the order they were written into the message log of the
+// server, in exactly the same way.
+func (t *Tracker) processMessageLogEntries(stream io.Reader) (string, string, error) {
+	if err := t.checkIdle(); err != nil {
+		return "", "", err
+	}
+	reviver := t.newJSONReviver(stream)
+	r := newResponse(stream)
+
+	nextLink, deltaLink := "", ""
+	position := t.lastEntry()
+	last := position
+	var sinkErr error
+	err := reviver.ParseMessageLogs(func(msgLogContainer *odata.MessageLogContainer) error {
+		if msgLogEntry := msgLogContainer.MessageLogEntry; msgLogEntry != nil {
+			if position.Covers(msgLogEntry.ID, msgLogEntry.TimeStamp) {
+				return nil
+			}
+			last = odata.EntryPosition{ID: msgLogEntry.ID, TimeStamp: msgLogEntry.TimeStamp}
+			if t.recovering() {
+				return nil
+			}
+			msgLogEntry.Server = t.Name
+			if t.TimeZone != nil {
+				msgLogEntry.TimeStamp, msgLogEntry.FutureTimeStamp = odata.NormalizeTimeStamp(msgLogEntry.TimeStamp, t.TimeZone, time.Now(), t.ClockSkew)
+			}
+			records, keep := t.inspect(msgLogEntry)
+			keep = keep && t.match(msgLogEntry)
+			sinkErr = t.deliver(r, msgLogEntry, keep, records)
+			return sinkErr
+		}
+		nextLink, deltaLink = msgLogContainer.NextLink, msgLogContainer.DeltaLink
+		return nil
+	})
+	if err := t.complete(r, err, sinkErr, position, last, nil); err != nil {
+		return "", "", err
+	}
+	t.following = deltaLink != ""
+	if t.following {
+		if err := t.endGap(last); err != nil {
+			return "", "", err
+		}
+	}
+	return nextLink, deltaLink, nil
+}
+
+// processAuditLogEntries is the audit log counterpart of processTransactionLogEntries and processes
+// the audit log entries, including their details, in the order they were written into the audit log
+// of the server, in exactly the same way.
+func (t *Tracker) processAuditLogEntries(stream io.Reader) (string, string, error) {
+	if err := t.checkIdle(); err != nil {
+		return "", "", err
+	}
+	reviver := t.newJSONReviver(stream)
+	r := newResponse(stream)
+
+	nextLink, deltaLink := "", ""
+	position := t.lastEntry()
+	last := position
+	var sinkErr error
+	err := reviver.ParseAuditLogs(func(auditLogContainer *odata.AuditLogContainer) error {
+		if auditLogEntry := auditLogContainer.AuditLogEntry; auditLogEntry != nil {
+			if position.Covers(auditLogEntry.ID, auditLogEntry.TimeStamp) {
+				return nil
+			}
+			last = odata.EntryPosition{ID: auditLogEntry.ID, TimeStamp: auditLogEntry.TimeStamp}
+			if t.recovering() {
+				return nil
+			}
+			auditLogEntry.Server = t.Name
+			if t.TimeZone != nil {
+				auditLogEntry.TimeStamp, auditLogEntry.FutureTimeStamp = odata.NormalizeTimeStamp(auditLogEntry.TimeStamp, t.TimeZone, time.Now(), t.ClockSkew)
+			}
+			records, keep := t.inspect(auditLogEntry)
+			keep = keep && t.match(auditLogEntry)
+			sinkErr = t.deliver(r, auditLogEntry, keep, records)
+			return sinkErr
+		}
+		nextLink, deltaLink = auditLogContainer.NextLink, auditLogContainer.DeltaLink
+		return nil
+	})
+	if err := t.complete(r, err, sinkErr, position, last, nil); err != nil {
+		return "", "", err
+	}
+	t.following = deltaLink != ""
+	if t.following {
+		if err := t.endGap(last); err != nil {
+			return "", "", err
+		}
+	}
+	return nextLink, deltaLink, nil
+}
+
+// processEntities processes the entities of any collection, other than the transaction and message
+// logs, writing them as is, represented by a map of their properties, to the sink.
+// Like the transaction and message log entries, entities are tagged with the name of the server, if
+// it has one.
+func (t *Tracker) processEntities(stream io.Reader) (string, string, error) {
+	reviver := t.newJSONReviver(stream)
+	r := newResponse(stream)
+
+	nextLink, deltaLink := "", ""
+	var sinkErr error
+	err := reviver.ParseEntities(func(entityContainer *odata.EntityContainer) error {
+		if entity := entityContainer.Entity; entity != nil {
+			if t.Name != "" {
+				entity["Server"] = t.Name
+			}
+			records, keep := t.inspect(entity)
+			keep = keep && t.match(entity)
+			sinkErr = t.deliver(r, entity, keep, records)
+			return sinkErr
+		}
+		nextLink, deltaLink = entityContainer.NextLink, entityContainer.DeltaLink
+		return nil
+	})
+	if err := t.complete(r, err, sinkErr, odata.EntryPosition{}, odata.EntryPosition{}, nil); err != nil {
+		return "", "", err
+	}
+	if deltaLink != "" {
+		if err := t.endGap(odata.EntryPosition{}); err != nil {
+			return "", "", err
+		}
+	}
+	return nextLink, deltaLink, nil
+}
+
+// SetFilter replaces the filter deciding which entries get written, taking effect as of the next
+// entry processed, without interrupting tracking.
+func (t *Tracker) SetFilter(filter *Filter) {
+	t.filterMutex.Lock()
+	defer t.filterMutex.Unlock()
+	t.Filter = filter
+}
+
+// match returns true if the entry passes the filter, if any.
+func (t *Tracker) match(entry interface{}) bool {
+	t.filterMutex.RLock()
+	defer t.filterMutex.RUnlock()
+	return t.Filter.Match(entry)
+}
+
+// inspect returns the additional records for, and whether to keep, the entry, as decided by the
+// Inspect hook, if any. Entries assigned to another shard are neither inspected nor kept.
+func (t *Tracker) inspect(entry interface{}) ([]interface{}, bool) {
+	if !t.Shard.Owns(entry) {
+		return nil, false
+	}
+	if t.Inspect == nil {
+		return nil, true
+	}
+	return t.Inspect(entry)
+}
+
+// deliver writes the entry, if it is to be kept, followed by the records to the sink, reporting the
+// result if it failed.
+func (t *Tracker) deliver(r *response, entry interface{}, keep bool, records []interface{}) error {
+	start := time.Now()
+	defer func() {
+		r.entries++
+		r.write += time.Since(start)
+	}()
+
+	var err error
+	if keep {
+		err = t.Sink.Write(entry)
+		r.written++
+	}
+	for i := 0; err == nil && i < len(records); i++ {
+		err = t.Sink.Write(records[i])
+		r.written++
+	}
+	if err != nil && t.OnSinkResult != nil {
+		t.OnSinkResult(err)
+	}
+	return err
+}
+
+// complete completes the processing of a response, which failed with err, if the sink failed with
+// sinkErr, making sure everything processed has been delivered and saving the position of the last
+// entry processed into the checkpoint. Responses without any new entries are reported as empty.
+func (t *Tracker) complete(r *response, err error, sinkErr error, position odata.EntryPosition, last odata.EntryPosition, writes map[string]int) error {
+	r.end()
+	t.changed = t.changed || r.entries > 0
+	if r.entries > 0 {
+		t.idleSince = time.Now()
+	}
+	if err != nil {
+		if err != sinkErr && t.OnParseError != nil {
+			t.OnParseError(nil, err)
+		}
+		return err
+	}
+
+	// Make sure everything we've processed has been delivered before moving on. If nothing has been
+	// written to the sink, as is the case for empty deltas, there is nothing to deliver
+	if r.written > 0 {
+		err = r.trace("tracker.flush", t.Sink.Flush)
+		if t.OnSinkResult != nil {
+			t.OnSinkResult(err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = r.trace("tracker.checkpoint", func() error {
+		return t.saveLastEntry(position, last)
+	})
+	if t.OnCheckpointResult != nil {
+		t.OnCheckpointResult(err)
+	}
+	if err != nil {
+		return err
+	}
+	if t.OnDelta != nil {
+		t.OnDelta(writes)
+	}
+	if r.entries == 0 && t.OnEmptyDelta != nil {
+		t.OnEmptyDelta()
+	}
+	return nil
+}
+
+// newJSONReviver returns the reviver parsing the stream, which reports any entry it has to skip as
+// it couldn't be decoded.
+func (t *Tracker) newJSONReviver(stream io.Reader) *odata.JSONReviver {
+	reviver := odata.NewJSONReviver(stream)
+	reviver.OnError = t.OnParseError
+	return reviver
+}
+
+// lastEntry returns the position of the last entry processed of the log, according to the checkpoint.
+func (t *Tracker) lastEntry() odata.EntryPosition {
+	if t.Checkpoint == nil {
+		return t.position
+	}
+	return t.Checkpoint.LastEntry(odata.ResolveURL(t.ServiceRootURL, t.Collection))
+}
+
+// saveLastEntry saves the position of the last entry processed of the log into the checkpoint, if
+// it moved on from the previous position.
+func (t *Tracker) saveLastEntry(previous odata.EntryPosition, position odata.EntryPosition) error {
+	t.position = position
+	if t.Checkpoint == nil || position == previous {
+		return nil
+	}
+	return t.Checkpoint.SetLastEntry(odata.ResolveURL(t.ServiceRootURL, t.Collection), position)
+}
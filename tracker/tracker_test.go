@@ -0,0 +1,103 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/internal/testutil"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// ids returns the IDs of the transaction log entries written to the sink.
+func ids(sink *testutil.RecordingSink) []int {
+	var ids []int
+	for _, entry := range sink.Entries() {
+		if txnLogEntry, ok := entry.(*odata.TransactionLogEntry); ok {
+			ids = append(ids, txnLogEntry.ID)
+		}
+	}
+	return ids
+}
+
+// newTestTracker creates a tracker of the transaction log served by the handler, writing to a
+// RecordingSink.
+func newTestTracker(t *testing.T, handler http.Handler) (*Tracker, *testutil.RecordingSink) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	sink := new(testutil.RecordingSink)
+	tracker := New(ts.URL+"/api/v1/", "TransactionLogEntries", sink)
+	tracker.Client = odata.NewClient(http.Client{}, tracker.Processor())
+	tracker.Client.Jar, _ = cookiejar.New(nil)
+	return tracker, sink
+}
+
+func newEntry(tuple ...string) odata.TransactionLogEntry {
+	return odata.TransactionLogEntry{TimeStamp: "2024-01-01T10:00:00Z", User: "Admin", Cube: "Sales",
+		Tuple: tuple, OldValue: 1.0, NewValue: 2.0}
+}
+
+func TestTrackerSkipsMalformedEntries(t *testing.T) {
+	server := fake.NewServer()
+	server.AddTransactionLogEntries(newEntry("2024", "Jan"), newEntry("2024", "Feb"), newEntry("2024", "Mar"))
+
+	// Serve the tuple of the second entry as a string, which can't be decoded as a tuple
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Accept-Encoding")
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, r)
+		for name, values := range recorder.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(bytes.Replace(recorder.Body.Bytes(), []byte(`"Tuple":["2024","Feb"]`), []byte(`"Tuple":"2024 Feb"`), 1))
+	})
+	tracker, sink := newTestTracker(t, handler)
+	var skipped []json.RawMessage
+	tracker.OnParseError = func(raw json.RawMessage, err error) {
+		if raw == nil {
+			t.Errorf("expected only the malformed entry to be skipped, got %v", err)
+		}
+		skipped = append(skipped, raw)
+	}
+
+	if err := tracker.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written := ids(sink); len(written) != 2 || written[0] != 1 || written[1] != 3 {
+		t.Errorf("wrote entries %v, expected [1 3]", written)
+	}
+	if len(skipped) != 1 || !bytes.Contains(skipped[0], []byte(`"ID":2`)) {
+		t.Errorf("skipped %s, expected the entry with ID 2", skipped)
+	}
+}
+
+func TestTrackerSkipsEntriesDeliveredBefore(t *testing.T) {
+	server := fake.NewServer()
+	server.AddTransactionLogEntries(newEntry("2024", "Jan"), newEntry("2024", "Feb"))
+	checkpoint, err := odata.LoadCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker, sink := newTestTracker(t, server)
+	tracker.Checkpoint = checkpoint
+	if err := tracker.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Reading the log again, as after reconnecting without a deltaLink, only delivers the new entries
+	server.AddTransactionLogEntries(newEntry("2024", "Mar"))
+	if err := tracker.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written := ids(sink); len(written) != 3 || written[0] != 1 || written[1] != 2 || written[2] != 3 {
+		t.Errorf("wrote entries %v, expected [1 2 3]", written)
+	}
+}
@@ -0,0 +1,316 @@
+package odata
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Authenticator adds the credentials, as expected by the authentication mode of the server, to a
+// request, allowing the client to establish a session with the server.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuthenticator authenticates using standard TM1 authentication, which maps to basic HTTP
+// authentication.
+type BasicAuthenticator struct {
+	User     string
+	Password string
+}
+
+// Authenticate adds the basic authentication header to the request.
+func (a *BasicAuthenticator) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.User, a.Password)
+	return nil
+}
+
+// CAMAuthenticator authenticates using the credentials of a user in a CAM namespace.
+type CAMAuthenticator struct {
+	User      string
+	Password  string
+	Namespace string
+}
+
+// Authenticate adds the CAMNamespace authorization header to the request.
+func (a *CAMAuthenticator) Authenticate(req *http.Request) error {
+	cred := b64.StdEncoding.EncodeToString([]byte(a.User + ":" + a.Password + ":" + a.Namespace))
+	req.Header.Set("Authorization", "CAMNamespace "+cred)
+	return nil
+}
+
+// CAMPassportAuthenticator authenticates using a CAM passport acquired beforehand, for example
+// through a single sign-on mechanism.
+type CAMPassportAuthenticator struct {
+	Passport string
+}
+
+// Authenticate adds the CAMPassport authorization header to the request.
+func (a *CAMPassportAuthenticator) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "CAMPassport "+a.Passport)
+	return nil
+}
+
+// NegotiateAuthenticator authenticates using Kerberos, by means of SPNEGO, as used by servers
+// configured for integrated security (IntegratedSecurityMode 5).
+type NegotiateAuthenticator struct {
+	client *client.Client
+	spn    string
+}
+
+// NewNegotiateAuthenticator creates and returns a new NegotiateAuthenticator, for the user in the
+// realm, using the Kerberos configuration file. The credentials are taken from the keytab, if
+// specified, or otherwise from the credential cache. If no service principal name is specified it
+// defaults to HTTP/<host of the server>.
+func NewNegotiateAuthenticator(configFile string, user string, realm string, keytabFile string, ccacheFile string, spn string) (*NegotiateAuthenticator, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.NewFromString(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	a := new(NegotiateAuthenticator)
+	a.spn = spn
+	if keytabFile != "" {
+		kt, err := keytab.Load(keytabFile)
+		if err != nil {
+			return nil, err
+		}
+		a.client = client.NewWithKeytab(user, realm, kt, cfg)
+	} else {
+		ccache, err := credentials.LoadCCache(ccacheFile)
+		if err != nil {
+			return nil, err
+		}
+		a.client, err = client.NewFromCCache(ccache, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := a.client.Login(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Authenticate adds the Negotiate authorization header, holding the Kerberos service ticket, to
+// the request.
+func (a *NegotiateAuthenticator) Authenticate(req *http.Request) error {
+	return spnego.SetSPNEGOHeader(a.client, req, a.spn)
+}
+
+// RequestAuthenticator is an Authenticator whose credentials, like a bearer token, have to be
+// passed with every request rather than only when establishing a session.
+type RequestAuthenticator interface {
+	Authenticator
+	AuthenticatesEveryRequest()
+}
+
+// DefaultIAMTokenURL is the endpoint of IBM Cloud IAM exchanging API keys for access tokens.
+const DefaultIAMTokenURL = "https://iam.cloud.ibm.com/identity/token"
+
+// IAMAuthenticator authenticates with Planning Analytics as a Service using an IBM Cloud IAM access
+// token, which is obtained in exchange for an API key and refreshed before it expires.
+type IAMAuthenticator struct {
+	mutex    sync.Mutex
+	apiKey   string
+	tokenURL string
+	token    string
+	expiry   time.Time
+}
+
+// NewIAMAuthenticator creates and returns a new IAMAuthenticator exchanging the API key for access
+// tokens at the token URL, DefaultIAMTokenURL if not specified.
+func NewIAMAuthenticator(apiKey string, tokenURL string) *IAMAuthenticator {
+	a := new(IAMAuthenticator)
+	a.apiKey = apiKey
+	a.tokenURL = tokenURL
+	if a.tokenURL == "" {
+		a.tokenURL = DefaultIAMTokenURL
+	}
+
+	return a
+}
+
+// Authenticate adds the bearer token to the request, obtaining a new token first if the current
+// one is about to expire.
+func (a *IAMAuthenticator) Authenticate(req *http.Request) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token == "" || time.Now().After(a.expiry.Add(-time.Minute)) {
+		if err := a.refresh(); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// AuthenticatesEveryRequest marks the IAMAuthenticator as a RequestAuthenticator.
+func (a *IAMAuthenticator) AuthenticatesEveryRequest() {}
+
+// CPDAuthenticator authenticates with a Planning Analytics Engine deployed on Cloud Pak for Data
+// using a bearer token, which is obtained in exchange for the user's password or API key and
+// refreshed before it expires.
+type CPDAuthenticator struct {
+	mutex    sync.Mutex
+	tokenURL string
+	user     string
+	password string
+	apiKey   string
+	token    string
+	expiry   time.Time
+}
+
+// NewCPDAuthenticator creates and returns a new CPDAuthenticator obtaining bearer tokens from the
+// authorization endpoint of the Cloud Pak for Data platform at the URL, using either the password
+// or, if specified, the API key of the user.
+func NewCPDAuthenticator(cpdURL string, user string, password string, apiKey string) *CPDAuthenticator {
+	a := new(CPDAuthenticator)
+	a.tokenURL = strings.TrimSuffix(cpdURL, "/") + "/icp4d-api/v1/authorize"
+	a.user = user
+	a.password = password
+	a.apiKey = apiKey
+
+	return a
+}
+
+// Authenticate adds the bearer token to the request, obtaining a new token first if the current
+// one is about to expire.
+func (a *CPDAuthenticator) Authenticate(req *http.Request) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token == "" || time.Now().After(a.expiry.Add(-time.Minute)) {
+		if err := a.refresh(); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// AuthenticatesEveryRequest marks the CPDAuthenticator as a RequestAuthenticator.
+func (a *CPDAuthenticator) AuthenticatesEveryRequest() {}
+
+// refresh exchanges the credentials of the user for a new bearer token.
+func (a *CPDAuthenticator) refresh() error {
+	credentials := map[string]string{"username": a.user}
+	if a.apiKey != "" {
+		credentials["api_key"] = a.apiKey
+	} else {
+		credentials["password"] = a.password
+	}
+	body, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", a.tokenURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Cloud Pak for Data responded with an unexpected result while authorizing the user."
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.Token == "" {
+		return errors.New("Cloud Pak for Data didn't return a token")
+	}
+	a.token = res.Token
+	a.expiry = tokenExpiry(res.Token)
+	Logger.Debug("Obtained Cloud Pak for Data token", "expiry", a.expiry)
+	return nil
+}
+
+// tokenExpiry returns the expiry of the JSON web token, or, if it can't be determined, one hour from
+// now, after which the token gets refreshed.
+func tokenExpiry(token string) time.Time {
+	if parts := strings.Split(token, "."); len(parts) == 3 {
+		if payload, err := b64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			var claims struct {
+				Expiry int64 `json:"exp"`
+			}
+			if json.Unmarshal(payload, &claims) == nil && claims.Expiry > 0 {
+				return time.Unix(claims.Expiry, 0)
+			}
+		}
+	}
+	return time.Now().Add(time.Hour)
+}
+
+// refresh exchanges the API key for a new access token.
+func (a *IAMAuthenticator) refresh() error {
+	form := url.Values{}
+	form.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+	form.Set("apikey", a.apiKey)
+	req, err := http.NewRequest("POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "IAM responded with an unexpected result while exchanging the API key for an access token."
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		Expiration  int64  `json:"expiration"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.AccessToken == "" {
+		return errors.New("IAM didn't return an access token")
+	}
+	a.token = res.AccessToken
+	if res.Expiration > 0 {
+		a.expiry = time.Unix(res.Expiration, 0)
+	} else {
+		a.expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	Logger.Debug("Obtained IAM access token", "expiry", a.expiry)
+	return nil
+}
@@ -0,0 +1,189 @@
+package odata
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// BatchRequest is one of the requests bundled in a $batch request.
+type BatchRequest struct {
+	Method string
+	URL    string          // URL, relative to the service root, as in Cubes('Sales')/Dimensions
+	Body   json.RawMessage // JSON body, if any
+}
+
+// ExecuteBatch executes the requests in a single round trip using a $batch request, in the client's
+// BatchFormat, either json, the JSON batch format of OData 4.01, or multipart, the multipart/mixed
+// format of OData 4.0, which is used if none is specified. It returns the responses, in the order
+// of the requests, which, like any other response, have to be validated by the caller, or an error
+// if the $batch request itself failed.
+func (client *Client) ExecuteBatch(serviceRootURL string, requests []BatchRequest) ([]*http.Response, error) {
+	var body bytes.Buffer
+	var contentType string
+	if client.BatchFormat == "json" {
+		contentType = "application/json"
+		if err := writeJSONBatch(&body, requests); err != nil {
+			return nil, err
+		}
+	} else {
+		boundary, err := writeMultipartBatch(&body, serviceRootURL, requests)
+		if err != nil {
+			return nil, err
+		}
+		contentType = "multipart/mixed; boundary=" + boundary
+	}
+
+	resp, err := client.ExecutePOSTRequest(serviceRootURL+"$batch", contentType, ioutil.NopCloser(&body))
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while executing a batch of requests."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var responses []*http.Response
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("invalid content type of batch response: %s", err)
+	case mediaType == "application/json":
+		responses, err = readJSONBatch(resp.Body, len(requests))
+	case mediaType == "multipart/mixed":
+		responses, err = readMultipartBatch(resp.Body, params["boundary"])
+	default:
+		return nil, fmt.Errorf("unexpected content type of batch response: %s", mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) != len(requests) {
+		return nil, fmt.Errorf("batch response holds %d responses for %d requests", len(responses), len(requests))
+	}
+	return responses, nil
+}
+
+// writeJSONBatch writes the requests in the JSON batch format, identifying them by their index.
+func writeJSONBatch(w io.Writer, requests []BatchRequest) error {
+	type jsonRequest struct {
+		ID      string            `json:"id"`
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body,omitempty"`
+	}
+	batch := struct {
+		Requests []jsonRequest `json:"requests"`
+	}{make([]jsonRequest, len(requests))}
+	for i, request := range requests {
+		batch.Requests[i] = jsonRequest{ID: strconv.Itoa(i), Method: request.Method, URL: request.URL, Headers: map[string]string{"Accept": "application/json"}, Body: request.Body}
+		if request.Body != nil {
+			batch.Requests[i].Headers["Content-Type"] = "application/json"
+		}
+	}
+	return json.NewEncoder(w).Encode(batch)
+}
+
+// readJSONBatch reads the responses, which might be in any order, in the JSON batch format.
+func readJSONBatch(r io.Reader, count int) ([]*http.Response, error) {
+	var batch struct {
+		Responses []struct {
+			ID      string            `json:"id"`
+			Status  int               `json:"status"`
+			Headers map[string]string `json:"headers"`
+			Body    json.RawMessage   `json:"body"`
+		} `json:"responses"`
+	}
+	if err := json.NewDecoder(r).Decode(&batch); err != nil {
+		return nil, err
+	}
+	responses := make([]*http.Response, count)
+	for _, response := range batch.Responses {
+		i, err := strconv.Atoi(response.ID)
+		if err != nil || i < 0 || i >= count || responses[i] != nil {
+			return nil, fmt.Errorf("unexpected id in batch response: %s", response.ID)
+		}
+		resp := &http.Response{StatusCode: response.Status, Status: strconv.Itoa(response.Status) + " " + http.StatusText(response.Status), Header: http.Header{}}
+		for name, value := range response.Headers {
+			resp.Header.Set(name, value)
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(response.Body))
+		responses[i] = resp
+	}
+	for i, resp := range responses {
+		if resp == nil {
+			return nil, fmt.Errorf("batch response holds no response for request %d", i)
+		}
+	}
+	return responses, nil
+}
+
+// writeMultipartBatch writes the requests, using their absolute URL, in the multipart/mixed batch
+// format, returning the boundary separating them.
+func writeMultipartBatch(w io.Writer, serviceRootURL string, requests []BatchRequest) (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary("batch_" + hex.EncodeToString(id)); err != nil {
+		return "", err
+	}
+	for i, request := range requests {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/http"},
+			"Content-Transfer-Encoding": {"binary"},
+			"Content-ID":                {strconv.Itoa(i)},
+		})
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(part, "%s %s HTTP/1.1\r\nAccept: application/json\r\n", request.Method, ResolveURL(serviceRootURL, request.URL))
+		if request.Body != nil {
+			fmt.Fprintf(part, "Content-Type: application/json\r\nContent-Length: %d\r\n", len(request.Body))
+		}
+		fmt.Fprint(part, "\r\n")
+		part.Write(request.Body)
+	}
+	return mw.Boundary(), mw.Close()
+}
+
+// readMultipartBatch reads the responses, in the order of the requests, in the multipart/mixed
+// batch format.
+func readMultipartBatch(r io.Reader, boundary string) ([]*http.Response, error) {
+	var responses []*http.Response
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return responses, nil
+		} else if err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		responses = append(responses, resp)
+	}
+}
@@ -0,0 +1,112 @@
+package odata
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// cellsetExpand is the $expand query option returning the members of the tuples of the axes, and the
+// cells, of a cellset.
+const cellsetExpand = "$expand=Axes($expand=Tuples($expand=Members($select=Name))),Cells($select=Ordinal,Value,FormattedValue)"
+
+// Cell is a cell of a cellset, as returned by executing an MDX query or a view.
+type Cell struct {
+	Ordinal        int         `json:"Ordinal"`
+	Value          interface{} `json:"Value"`
+	FormattedValue string      `json:"FormattedValue"`
+	Tuple          []string    `json:"-"` // Names of the members of the cell, those of the first axis first
+}
+
+// cellsetAxis is an axis of a cellset, holding the names of the members of every tuple.
+type cellsetAxis struct {
+	Tuples []struct {
+		Members []struct {
+			Name string `json:"Name"`
+		} `json:"Members"`
+	} `json:"Tuples"`
+}
+
+// ExecuteMDX executes the MDX query, passing every cell of the resulting cellset, as it's streamed,
+// to the callback, and deletes the cellset once done. Executing stops as soon as the callback
+// returns an error, which is then returned to the caller.
+func (client *Client) ExecuteMDX(serviceRootURL string, mdx string, callback func(*Cell) error) error {
+	body, err := json.Marshal(map[string]string{"MDX": mdx})
+	if err != nil {
+		return err
+	}
+	return client.executeCellset(serviceRootURL, "ExecuteMDX?"+cellsetExpand, string(body), "executing MDX", callback)
+}
+
+// ExecuteView executes the, public or private, view of the cube, passing every cell of the resulting
+// cellset, as it's streamed, to the callback, and deletes the cellset once done. Executing stops as
+// soon as the callback returns an error, which is then returned to the caller.
+func (client *Client) ExecuteView(serviceRootURL string, cube string, view string, private bool, callback func(*Cell) error) error {
+	views := "Views"
+	if private {
+		views = "PrivateViews"
+	}
+	return client.executeCellset(serviceRootURL, "Cubes("+KeyLiteral(cube)+")/"+views+"("+KeyLiteral(view)+")/tm1.Execute?"+cellsetExpand, "{}", "executing view "+view+" of cube "+cube, callback)
+}
+
+// CellValue returns the value of the cell of the cube at the tuple, holding the element of every
+// dimension, in order, of the cube.
+func (client *Client) CellValue(serviceRootURL string, cube string, dimensions []string, tuple []string) (interface{}, error) {
+	if len(dimensions) != len(tuple) {
+		return nil, errors.New("the tuple doesn't hold an element for every dimension of cube " + cube)
+	}
+	members := make([]string, len(tuple))
+	for i, element := range tuple {
+		members[i] = mdxName(dimensions[i]) + "." + mdxName(dimensions[i]) + "." + mdxName(element)
+	}
+	var value interface{}
+	err := client.ExecuteMDX(serviceRootURL, "SELECT {("+strings.Join(members, ",")+")} ON 0 FROM "+mdxName(cube), func(cell *Cell) error {
+		value = cell.Value
+		return nil
+	})
+	return value, err
+}
+
+// mdxName returns the name, enclosed in square brackets and escaped, to be used in MDX.
+func mdxName(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// executeCellset posts the body to the URL, relative to the service root, creating a cellset, which
+// is streamed to the callback and deleted afterwards.
+func (client *Client) executeCellset(serviceRootURL string, urlStr string, body string, context string, callback func(*Cell) error) error {
+	resp, err := client.ExecutePOSTRequest(serviceRootURL+urlStr, "application/json", ioutil.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		err = ValidateStatusCode(resp, 201, func() string {
+			return "Server responded with an unexpected result while " + context + "."
+		})
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	id, err := NewJSONReviver(resp.Body).ParseCellset(callback)
+	if id != "" {
+		if derr := client.deleteCellset(serviceRootURL, id); err == nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// deleteCellset deletes the cellset, freeing the memory it holds on the server.
+func (client *Client) deleteCellset(serviceRootURL string, id string) error {
+	resp, err := client.ExecuteDELETERequest(serviceRootURL + "Cellsets(" + KeyLiteral(id) + ")")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ValidateStatusCode(resp, 204, func() string {
+		return "Server responded with an unexpected result while deleting cellset " + id + "."
+	})
+}
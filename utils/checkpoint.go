@@ -0,0 +1,232 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint keeps track of the last deltaLink returned, and the last entry processed, for every
+// tracked collection and persists them in a store, allowing tracking to resume where it left off after a restart, or, if the store
+// is shared, on another instance of the tracker. A checkpoint is safe for concurrent use.
+type Checkpoint struct {
+	mutex  sync.Mutex
+	store  CheckpointStore
+	states map[string]CollectionState // As last loaded or saved, by collection
+}
+
+// CollectionState is the state of a tracked collection as saved in a checkpoint.
+type CollectionState struct {
+	DeltaLink string        `json:"DeltaLink,omitempty"`
+	LastEntry EntryPosition `json:"LastEntry"`
+}
+
+// CheckpointStore persists the state of the tracked collections, by collection, as saved in a
+// checkpoint. Stores shared by multiple instances of the tracker allow any of them to continue
+// tracking a collection where another one left off.
+type CheckpointStore interface {
+	// Load returns the state of the collection, which is empty if none has been saved yet.
+	Load(collection string) (CollectionState, error)
+	// Save saves the state of the collection.
+	Save(collection string, state CollectionState) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// EntryPosition identifies an entry in a log by its ID and time stamp.
+type EntryPosition struct {
+	ID        int    `json:"ID"`
+	TimeStamp string `json:"TimeStamp"`
+}
+
+// Covers returns true if the entry with the ID and time stamp was written at or before the position.
+// As IDs might start over once the server restarts, an entry is only covered if both its ID and its
+// time stamp are at or before the position.
+func (p EntryPosition) Covers(id int, timeStamp string) bool {
+	if p.TimeStamp == "" || id > p.ID {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, timeStamp)
+	pt, perr := time.Parse(time.RFC3339Nano, p.TimeStamp)
+	if err != nil || perr != nil {
+		return timeStamp <= p.TimeStamp
+	}
+	return !t.After(pt)
+}
+
+// NewCheckpoint creates and returns a new Checkpoint persisting the state of the collections in the store.
+func NewCheckpoint(store CheckpointStore) *Checkpoint {
+	c := new(Checkpoint)
+	c.store = store
+	c.states = map[string]CollectionState{}
+
+	return c
+}
+
+// LoadCheckpoint loads the checkpoint from the file at the given path. If the file doesn't exist
+// yet an empty checkpoint is returned which will be written to that path once saved.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	store, err := NewFileCheckpointStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCheckpoint(store), nil
+}
+
+// DeltaLink returns the last saved deltaLink for the collection, or an empty string if none. The
+// state of the collection is loaded from the store, so a deltaLink saved by another instance of the
+// tracker sharing the store is picked up. A failure to load it is treated as if none was saved.
+func (c *Checkpoint) DeltaLink(collection string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.load(collection).DeltaLink
+}
+
+// SetDeltaLink records the deltaLink for the collection and saves the checkpoint.
+func (c *Checkpoint) SetDeltaLink(collection string, deltaLink string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state := c.state(collection)
+	state.DeltaLink = deltaLink
+	return c.save(collection, state)
+}
+
+// LastEntry returns the position of the last entry processed of the collection, if any, loaded from
+// the store as for DeltaLink.
+func (c *Checkpoint) LastEntry(collection string) EntryPosition {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.load(collection).LastEntry
+}
+
+// SetLastEntry records the position of the last entry processed of the collection and saves the
+// checkpoint.
+func (c *Checkpoint) SetLastEntry(collection string, position EntryPosition) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state := c.state(collection)
+	state.LastEntry = position
+	return c.save(collection, state)
+}
+
+// Close closes the store of the checkpoint.
+func (c *Checkpoint) Close() error {
+	return c.store.Close()
+}
+
+// load loads the state of the collection from the store, falling back to the state last loaded or
+// saved if it can't be loaded, expecting the caller to hold the lock.
+func (c *Checkpoint) load(collection string) CollectionState {
+	state, err := c.store.Load(collection)
+	if err != nil {
+		return c.states[collection]
+	}
+	c.states[collection] = state
+	return state
+}
+
+// state returns the state of the collection, loading it from the store if it hasn't been loaded or
+// saved yet, expecting the caller to hold the lock.
+func (c *Checkpoint) state(collection string) CollectionState {
+	if state, ok := c.states[collection]; ok {
+		return state
+	}
+	return c.load(collection)
+}
+
+// save saves the state of the collection, expecting the caller to hold the lock.
+func (c *Checkpoint) save(collection string, state CollectionState) error {
+	if err := c.store.Save(collection, state); err != nil {
+		return err
+	}
+	c.states[collection] = state
+	return nil
+}
+
+// FileCheckpointStore persists the state of the collections in a JSON file, holding the deltaLinks
+// and the positions of the last entries by collection, which is rewritten every time a state gets
+// saved. The file is written to a temporary file first, which then replaces the existing file, so a
+// crash never leaves a partially written checkpoint.
+type FileCheckpointStore struct {
+	mutex       sync.Mutex
+	path        string
+	DeltaLinks  map[string]string        `json:"DeltaLinks"`
+	LastEntries map[string]EntryPosition `json:"LastEntries,omitempty"`
+}
+
+// NewFileCheckpointStore creates and returns a new FileCheckpointStore persisting the state of the
+// collections in the file at the given path, which it's loaded from if it exists.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := new(FileCheckpointStore)
+	s.path = path
+	s.DeltaLinks = map[string]string{}
+	s.LastEntries = map[string]EntryPosition{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.DeltaLinks == nil {
+		s.DeltaLinks = map[string]string{}
+	}
+	if s.LastEntries == nil {
+		s.LastEntries = map[string]EntryPosition{}
+	}
+	return s, nil
+}
+
+// Load returns the state of the collection as held in the file.
+func (s *FileCheckpointStore) Load(collection string) (CollectionState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return CollectionState{DeltaLink: s.DeltaLinks[collection], LastEntry: s.LastEntries[collection]}, nil
+}
+
+// Save saves the state of the collection, rewriting the file.
+func (s *FileCheckpointStore) Save(collection string, state CollectionState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state.DeltaLink != "" {
+		s.DeltaLinks[collection] = state.DeltaLink
+	}
+	if state.LastEntry != (EntryPosition{}) {
+		s.LastEntries[collection] = state.LastEntry
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// Close does nothing, as the file is rewritten every time a state gets saved.
+func (s *FileCheckpointStore) Close() error {
+	return nil
+}
+
+// encodeCollectionState returns the state of a collection, as saved by the stores holding it as JSON.
+func encodeCollectionState(state CollectionState) string {
+	data, _ := json.Marshal(state)
+	return string(data)
+}
+
+// decodeCollectionState returns the state of a collection saved as JSON.
+func decodeCollectionState(data string) (CollectionState, error) {
+	var state CollectionState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return CollectionState{}, fmt.Errorf("invalid checkpoint: %s", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,84 @@
+package odata
+
+import (
+	"database/sql"
+	"fmt"
+
+	// The database drivers supported by the SQLCheckpointStore
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+// The statements creating the table of the SQLCheckpointStore, if it doesn't exist yet, loading the
+// state of a collection and saving it, by database driver.
+var sqlCheckpointStatements = map[string][3]string{
+	"postgres": {
+		"CREATE TABLE IF NOT EXISTS tm1_checkpoints (collection VARCHAR(900) PRIMARY KEY, state TEXT)",
+		"SELECT state FROM tm1_checkpoints WHERE collection = $1",
+		"INSERT INTO tm1_checkpoints (collection, state) VALUES ($1, $2) ON CONFLICT (collection) DO UPDATE SET state = EXCLUDED.state",
+	},
+	"sqlserver": {
+		"IF OBJECT_ID('tm1_checkpoints', 'U') IS NULL CREATE TABLE tm1_checkpoints (collection NVARCHAR(450) PRIMARY KEY, state NVARCHAR(MAX))",
+		"SELECT state FROM tm1_checkpoints WHERE collection = @p1",
+		"MERGE tm1_checkpoints WITH (HOLDLOCK) AS t USING (SELECT @p1 AS collection, @p2 AS state) AS s ON t.collection = s.collection " +
+			"WHEN MATCHED THEN UPDATE SET state = s.state WHEN NOT MATCHED THEN INSERT (collection, state) VALUES (s.collection, s.state);",
+	},
+}
+
+// SQLCheckpointStore persists the state of the collections, as JSON, in the tm1_checkpoints table of
+// a relational database, created if it doesn't exist yet.
+type SQLCheckpointStore struct {
+	db     *sql.DB
+	load   string
+	save   string
+	prefix string
+}
+
+// NewSQLCheckpointStore creates and returns a new SQLCheckpointStore for the database, using either
+// the postgres or the sqlserver driver, identified by the data source name, persisting the state of
+// the collections by the key made up of the prefix and the collection.
+func NewSQLCheckpointStore(driver string, dsn string, prefix string) (*SQLCheckpointStore, error) {
+	statements, ok := sqlCheckpointStatements[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(statements[0]); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := new(SQLCheckpointStore)
+	s.db = db
+	s.load = statements[1]
+	s.save = statements[2]
+	s.prefix = prefix
+
+	return s, nil
+}
+
+// Load returns the state of the collection as saved in the database.
+func (s *SQLCheckpointStore) Load(collection string) (CollectionState, error) {
+	var state string
+	err := s.db.QueryRow(s.load, s.prefix+collection).Scan(&state)
+	if err == sql.ErrNoRows {
+		return CollectionState{}, nil
+	} else if err != nil {
+		return CollectionState{}, err
+	}
+	return decodeCollectionState(state)
+}
+
+// Save saves the state of the collection in the database.
+func (s *SQLCheckpointStore) Save(collection string, state CollectionState) error {
+	_, err := s.db.Exec(s.save, s.prefix+collection, encodeCollectionState(state))
+	return err
+}
+
+// Close closes the database.
+func (s *SQLCheckpointStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,27 @@
+package odata
+
+import "testing"
+
+func TestEntryPositionCovers(t *testing.T) {
+	position := EntryPosition{ID: 10, TimeStamp: "2024-01-01T10:00:00Z"}
+	for _, test := range []struct {
+		name      string
+		id        int
+		timeStamp string
+		covers    bool
+	}{
+		{"same entry", 10, "2024-01-01T10:00:00Z", true},
+		{"earlier entry", 9, "2024-01-01T09:59:59Z", true},
+		{"later entry", 11, "2024-01-01T10:00:00Z", false},
+		{"ID started over", 1, "2024-01-02T08:00:00Z", false},
+		{"other time zone", 9, "2024-01-01T11:00:00+01:00", true},
+		{"fractional seconds", 9, "2024-01-01T10:00:00.5Z", false},
+	} {
+		if covers := position.Covers(test.id, test.timeStamp); covers != test.covers {
+			t.Errorf("%s: got %v, expected %v", test.name, covers, test.covers)
+		}
+	}
+	if (EntryPosition{}).Covers(1, "2024-01-01T10:00:00Z") {
+		t.Error("expected an empty position not to cover any entry")
+	}
+}
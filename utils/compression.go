@@ -0,0 +1,88 @@
+package odata
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gzipReadCloser decompresses the gzip compressed body of a response, closing both when closed.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// acceptEncoding asks the server to compress its response, if compression is enabled.
+func (client *Client) acceptEncoding(req *http.Request) {
+	if client.Compression {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+}
+
+// decompress transparently decompresses the body of the response if it's gzip compressed, and
+// remembers whether the server advertised, using the Accept-Encoding header, that it accepts gzip
+// compressed requests.
+func (client *Client) decompress(resp *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		return resp, err
+	}
+	if strings.Contains(resp.Header.Get("Accept-Encoding"), "gzip") {
+		client.mutex.Lock()
+		if client.gzipHosts == nil {
+			client.gzipHosts = map[string]bool{}
+		}
+		client.gzipHosts[resp.Request.URL.Host] = true
+		client.mutex.Unlock()
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp, nil
+	}
+
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &gzipReadCloser{Reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// compress compresses the body of the request, streaming it through a gzip writer, if compression
+// is enabled and the server advertised it accepts gzip compressed requests.
+func (client *Client) compress(req *http.Request) {
+	if !client.Compression || req.Body == nil {
+		return
+	}
+	client.mutex.Lock()
+	accepted := client.gzipHosts[req.URL.Host]
+	client.mutex.Unlock()
+	if !accepted {
+		return
+	}
+
+	body := req.Body
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		writer := gzip.NewWriter(pipeWriter)
+		_, err := io.Copy(writer, body)
+		if err == nil {
+			err = writer.Close()
+		}
+		body.Close()
+		pipeWriter.CloseWithError(err)
+	}()
+	req.Body = pipeReader
+	req.GetBody = nil
+	req.ContentLength = -1
+	req.Header.Set("Content-Encoding", "gzip")
+}
@@ -0,0 +1,102 @@
+package odata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ODataError is the error returned if the server responds with an unexpected status. If the body
+// of the response is an OData error, its code, which for TM1 is the TM1 error code, message,
+// target and details are available as well.
+type ODataError struct {
+	Context    string             // Description of the request that failed
+	StatusCode int                // Status code of the response
+	Status     string             // Status of the response, as in "404 Not Found"
+	Code       string             // Code of the OData error, if any
+	Message    string             // Message of the OData error, if any
+	Target     string             // Target of the OData error, if any
+	Details    []ODataErrorDetail // Details of the OData error, if any
+	Body       string             // Body of the response
+}
+
+// ODataErrorDetail is one of the details of an OData error.
+type ODataErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Target  string `json:"target"`
+}
+
+// Error returns the description of the request, the status and either the message of the OData
+// error or, if the body isn't an OData error, the body of the response.
+func (e *ODataError) Error() string {
+	var sb strings.Builder
+	if e.Context != "" {
+		sb.WriteString(e.Context)
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString("Server responded with: " + e.Status + "\r\n")
+	if e.Code == "" && e.Message == "" {
+		sb.WriteString(e.Body)
+		return sb.String()
+	}
+	if e.Code != "" {
+		sb.WriteString("[" + e.Code + "] ")
+	}
+	sb.WriteString(e.Message)
+	for _, detail := range e.Details {
+		sb.WriteString("\r\n")
+		if detail.Code != "" {
+			sb.WriteString("[" + detail.Code + "] ")
+		}
+		sb.WriteString(detail.Message)
+	}
+	return sb.String()
+}
+
+// newODataError returns the error for the response, parsing its body as an OData error if it is one.
+func newODataError(resp *http.Response, body []byte, context string) *ODataError {
+	odataErr := new(ODataError)
+	odataErr.Context = context
+	odataErr.StatusCode = resp.StatusCode
+	odataErr.Status = resp.Status
+	odataErr.Body = string(body)
+
+	var payload struct {
+		Error struct {
+			Code    string             `json:"code"`
+			Message string             `json:"message"`
+			Target  string             `json:"target"`
+			Details []ODataErrorDetail `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		odataErr.Code = payload.Error.Code
+		odataErr.Message = payload.Error.Message
+		odataErr.Target = payload.Error.Target
+		odataErr.Details = payload.Error.Details
+	}
+	return odataErr
+}
+
+// peekODataError returns the error for the failed response without consuming its body, which is
+// replaced by a copy of what was read.
+func peekODataError(resp *http.Response) *ODataError {
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return newODataError(resp, body, "")
+}
+
+// ErrorCode returns the code of the OData error, which for TM1 is the TM1 error code, if the error
+// is, or wraps, an ODataError, or an empty string otherwise.
+func ErrorCode(err error) string {
+	var odataErr *ODataError
+	if errors.As(err, &odataErr) {
+		return odataErr.Code
+	}
+	return ""
+}
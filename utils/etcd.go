@@ -0,0 +1,278 @@
+package odata
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EtcdClient is a minimal client of etcd, version 3.4 or later, using its JSON gateway. Requests go
+// to the first of the endpoints responding. If a user is specified, the client authenticates, and
+// authenticates again once its token expired. The client is safe for concurrent use.
+type EtcdClient struct {
+	endpoints []string
+	user      string
+	password  string
+	client    *http.Client
+
+	mutex sync.Mutex
+	token string
+}
+
+// etcdKeyValue is a key and its value as returned by etcd.
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// NewEtcdClient creates and returns a new EtcdClient for the cluster at the endpoints, as in
+// http://localhost:2379, authenticating as the user, if any, and using the TLS configuration, if any,
+// for https endpoints.
+func NewEtcdClient(endpoints []string, user string, password string, tlsConfig *tls.Config) *EtcdClient {
+	c := new(EtcdClient)
+	for _, endpoint := range endpoints {
+		c.endpoints = append(c.endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+	c.user = user
+	c.password = password
+	c.client = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	return c
+}
+
+// Get returns the value of the key, and whether the key exists.
+func (c *EtcdClient) Get(key string) (string, bool, error) {
+	var response struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := c.Call("/v3/kv/range", map[string]interface{}{"key": etcdEncode(key)}, &response); err != nil {
+		return "", false, err
+	}
+	if len(response.Kvs) == 0 {
+		return "", false, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(response.Kvs[0].Value)
+	return string(value), true, err
+}
+
+// Put sets the value of the key.
+func (c *EtcdClient) Put(key string, value string) error {
+	return c.Call("/v3/kv/put", map[string]interface{}{"key": etcdEncode(key), "value": etcdEncode(value)}, nil)
+}
+
+// Call posts the request to the path, as in /v3/kv/range, of the gateway of the first endpoint
+// responding, decoding the response, if any, into response.
+func (c *EtcdClient) Call(path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, endpoint := range c.endpoints {
+		lastErr = c.call(endpoint, path, body, response, true)
+		if _, ok := lastErr.(*etcdError); lastErr == nil || ok {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// etcdError is an error returned by etcd, as opposed to an error reaching it.
+type etcdError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *etcdError) Error() string {
+	return "etcd: " + e.Message
+}
+
+// call posts the request to the path of the gateway of the endpoint, authenticating first, if need
+// be, and again if the token expired and retry is set.
+func (c *EtcdClient) call(endpoint string, path string, body []byte, response interface{}, retry bool) error {
+	token, err := c.authenticate(endpoint, false)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := new(etcdError)
+		if json.NewDecoder(resp.Body).Decode(e) != nil || e.Message == "" {
+			return fmt.Errorf("etcd responded with %s", resp.Status)
+		}
+		if retry && c.user != "" && strings.Contains(e.Message, "token") {
+			if _, err := c.authenticate(endpoint, true); err != nil {
+				return err
+			}
+			return c.call(endpoint, path, body, response, false)
+		}
+		return e
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// authenticate returns the token to authenticate requests with, authenticating if there's none yet,
+// or if renew is set, or an empty string if no user is specified.
+func (c *EtcdClient) authenticate(endpoint string, renew bool) (string, error) {
+	if c.user == "" {
+		return "", nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token != "" && !renew {
+		return c.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": c.user, "password": c.password})
+	resp, err := c.client.Post(endpoint+"/v3/auth/authenticate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to authenticate with etcd as %s: %s", c.user, resp.Status)
+	}
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	c.token = response.Token
+	return c.token, nil
+}
+
+// etcdEncode returns the key, or value, base64 encoded, as expected by the gateway.
+func etcdEncode(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// EtcdCheckpointStore persists the state of the collections in etcd, as JSON, by the key made up of
+// the prefix and the collection.
+type EtcdCheckpointStore struct {
+	client *EtcdClient
+	prefix string
+}
+
+// NewEtcdCheckpointStore creates and returns a new EtcdCheckpointStore persisting the state of the
+// collections using the client, by the key made up of the prefix and the collection.
+func NewEtcdCheckpointStore(client *EtcdClient, prefix string) *EtcdCheckpointStore {
+	s := new(EtcdCheckpointStore)
+	s.client = client
+	s.prefix = prefix
+
+	return s
+}
+
+// Load returns the state of the collection as saved in etcd.
+func (s *EtcdCheckpointStore) Load(collection string) (CollectionState, error) {
+	value, ok, err := s.client.Get(s.prefix + collection)
+	if err != nil || !ok {
+		return CollectionState{}, err
+	}
+	return decodeCollectionState(value)
+}
+
+// Save saves the state of the collection in etcd.
+func (s *EtcdCheckpointStore) Save(collection string, state CollectionState) error {
+	return s.client.Put(s.prefix+collection, encodeCollectionState(state))
+}
+
+// Close does nothing, as every request is sent on its own.
+func (s *EtcdCheckpointStore) Close() error {
+	return nil
+}
+
+// EtcdLease is a Lease kept in etcd, as the key holding the holder of the lease, attached to an etcd
+// lease, which expires, deleting the key, unless kept alive.
+type EtcdLease struct {
+	client *EtcdClient
+	key    string
+	holder string
+	id     string // ID of the etcd lease the key is attached to, if held
+}
+
+// NewEtcdLease creates and returns a new EtcdLease, by the key, for the holder, using the client.
+func NewEtcdLease(client *EtcdClient, key string, holder string) *EtcdLease {
+	l := new(EtcdLease)
+	l.client = client
+	l.key = key
+	l.holder = holder
+
+	return l
+}
+
+// Acquire keeps the etcd lease alive, if held, or otherwise grants a new one and creates the key
+// attached to it, if the key doesn't exist, as in the lease isn't held by another holder. As etcd
+// leases last whole seconds, the ttl is rounded up to seconds.
+func (l *EtcdLease) Acquire(ttl time.Duration) (bool, error) {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if l.id != "" {
+		var response struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		if err := l.client.Call("/v3/lease/keepalive", map[string]interface{}{"ID": l.id}, &response); err != nil {
+			return false, err
+		}
+		if ttl, _ := strconv.ParseInt(response.Result.TTL, 10, 64); ttl > 0 {
+			return true, nil
+		}
+		// The lease expired, and with it the key, so start over
+		l.id = ""
+	}
+
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := l.client.Call("/v3/lease/grant", map[string]interface{}{"TTL": seconds}, &grant); err != nil {
+		return false, err
+	}
+	var txn struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := l.client.Call("/v3/kv/txn", map[string]interface{}{
+		"compare": []interface{}{map[string]interface{}{"key": etcdEncode(l.key), "result": "EQUAL", "target": "CREATE", "create_revision": "0"}},
+		"success": []interface{}{map[string]interface{}{"request_put": map[string]interface{}{"key": etcdEncode(l.key), "value": etcdEncode(l.holder), "lease": grant.ID}}},
+	}, &txn)
+	if err != nil || !txn.Succeeded {
+		l.client.Call("/v3/lease/revoke", map[string]interface{}{"ID": grant.ID}, nil)
+		return false, err
+	}
+	l.id = grant.ID
+	return true, nil
+}
+
+// Release revokes the etcd lease, if held, deleting the key attached to it.
+func (l *EtcdLease) Release() error {
+	if l.id == "" {
+		return nil
+	}
+	err := l.client.Call("/v3/lease/revoke", map[string]interface{}{"ID": l.id}, nil)
+	l.id = ""
+	return err
+}
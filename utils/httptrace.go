@@ -0,0 +1,122 @@
+package odata
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// LevelTrace is the level, below debug, at which the bodies of responses, and the wire-level dumps
+// of the requests and responses traced by a TraceTransport, are logged.
+const LevelTrace = slog.Level(-8)
+
+// traceBodyLimit is the maximum number of bytes of a body included in a dump.
+const traceBodyLimit = 64 * 1024
+
+// Patterns matching the credentials, in headers, JSON properties and form or query parameters, which
+// get redacted from dumps, keeping the name, and, for the Authorization header, the scheme.
+var (
+	redactedHeader   = regexp.MustCompile(`(?im)^((?:Proxy-)?Authorization:[ \t]*(?:[\w-]+[ \t]+)?|(?:Set-)?Cookie:[ \t]*|X-Api-Key:[ \t]*)[^\r\n]+`)
+	redactedProperty = regexp.MustCompile(`(?i)("[\w-]*(?:password|passwd|secret|token|apikey|api_key|passport)[\w-]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	redactedParam    = regexp.MustCompile(`(?i)([?&\s][\w-]*(?:password|passwd|secret|token|apikey|api_key|passport)[\w-]*=)[^&\s]*`)
+)
+
+// Redact returns the dump of a request or response with any credentials, like the Authorization
+// and Cookie headers and passwords, replaced by [REDACTED], so it can be shared safely.
+func Redact(dump []byte) []byte {
+	dump = redactedHeader.ReplaceAll(dump, []byte("${1}[REDACTED]"))
+	dump = redactedProperty.ReplaceAll(dump, []byte(`${1}"[REDACTED]"`))
+	return redactedParam.ReplaceAll(dump, []byte("${1}[REDACTED]"))
+}
+
+// TraceTransport is an http.RoundTripper logging, at the trace level, a wire-level dump of every
+// request and response, with credentials redacted, and bodies truncated to 64KB. The body of a
+// response is logged once it has been read, and closed, by the client, so responses are still
+// streamed. Compressed bodies are dumped as they are sent and received, i.e. compressed.
+type TraceTransport struct {
+	next http.RoundTripper
+}
+
+// NewTraceTransport creates and returns a new TraceTransport using the next RoundTripper to execute
+// the requests.
+func NewTraceTransport(next http.RoundTripper) *TraceTransport {
+	t := new(TraceTransport)
+	t.next = next
+
+	return t
+}
+
+// RoundTrip logs a dump of the request, executes it using the next RoundTripper, and logs a dump
+// of the response.
+func (t *TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !Logger.Enabled(ctx, LevelTrace) {
+		return t.next.RoundTrip(req)
+	}
+
+	dump, err := httputil.DumpRequestOut(req, req.ContentLength >= 0 && req.ContentLength <= traceBodyLimit)
+	if err != nil {
+		return nil, err
+	}
+	Logger.Log(ctx, LevelTrace, "HTTP request", "method", req.Method, "url", string(Redact([]byte(req.URL.String()))), "dump", string(Redact(dump)))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		Logger.Log(ctx, LevelTrace, "HTTP request failed", "method", req.Method, "url", string(Redact([]byte(req.URL.String()))), "duration", time.Since(start), "error", err)
+		return resp, err
+	}
+	header, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body = &traceBody{ReadCloser: resp.Body, ctx: ctx, request: req.Method + " " + string(Redact([]byte(req.URL.String()))), header: header, start: start}
+	return resp, nil
+}
+
+// traceBody is the body of a traced response, capturing up to the first 64KB read, which is logged,
+// together with the header, once the body has been closed.
+type traceBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	request string
+	header  []byte
+	start   time.Time
+	body    bytes.Buffer
+	size    int64
+	once    sync.Once
+}
+
+// Read reads from the body, capturing what's read, up to the limit.
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if remaining := traceBodyLimit - b.body.Len(); remaining > 0 {
+			if remaining > n {
+				remaining = n
+			}
+			b.body.Write(p[:remaining])
+		}
+		b.size += int64(n)
+	}
+	return n, err
+}
+
+// Close closes the body and logs the dump of the response.
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		dump := append(b.header, b.body.Bytes()...)
+		if b.size > int64(b.body.Len()) {
+			dump = append(dump, "\r\n[TRUNCATED]"...)
+		}
+		Logger.Log(b.ctx, LevelTrace, "HTTP response", "request", b.request, "bytes", b.size, "duration", time.Since(b.start), "dump", string(Redact(dump)))
+	})
+	return err
+}
@@ -6,9 +6,14 @@ import (
 	"io"
 )
 
-// JSONReviver is the data type used to parse JSON streams.
+// JSONReviver is the data type used to parse JSON streams. Entries that can't be decoded, for
+// example because a property has an unexpected type, are skipped, reported through OnError, after
+// which parsing continues with the next entry.
 type JSONReviver struct {
 	decoder *json.Decoder
+
+	// OnError, if set, is called for every entry that is skipped, with its raw JSON and the reason.
+	OnError func(raw json.RawMessage, err error)
 }
 
 // NewJSONReviver returns a new JSON reviver.
@@ -20,25 +25,227 @@ func NewJSONReviver(stream io.Reader) *JSONReviver {
 }
 
 // ParseTransactionLogs parses an incoming stream response that contains transaction log entries.
-func (r *JSONReviver) ParseTransactionLogs(callback func(*TransactionLogContainer)) error {
-	t, err := r.decoder.Token()
+// Parsing stops as soon as the callback returns an error, which is then returned to the caller.
+func (r *JSONReviver) ParseTransactionLogs(callback func(*TransactionLogContainer) error) error {
+	nextLink, deltaLink, err := r.parseCollection(func() error {
+		// Read next item (large object)
+		txnLog := TransactionLogEntry{}
+		if ok, err := r.decodeEntry(&txnLog); !ok {
+			return err
+		}
+		txnLog.SchemaVersion = SchemaVersion
+
+		txnLogContainer := TransactionLogContainer{
+			TransactionLogEntry: &txnLog,
+		}
+		// Give transactionLog to the callback for processing.
+		return callback(&txnLogContainer)
+	})
 	if err != nil {
 		return err
 	}
 
+	// Done parsing
+	return callback(&TransactionLogContainer{NextLink: nextLink, DeltaLink: deltaLink})
+}
+
+// ParseMessageLogs parses an incoming stream response that contains message log entries.
+// Parsing stops as soon as the callback returns an error, which is then returned to the caller.
+func (r *JSONReviver) ParseMessageLogs(callback func(*MessageLogContainer) error) error {
+	nextLink, deltaLink, err := r.parseCollection(func() error {
+		// Read next item
+		msgLog := MessageLogEntry{}
+		if ok, err := r.decodeEntry(&msgLog); !ok {
+			return err
+		}
+		msgLog.SchemaVersion = SchemaVersion
+
+		msgLogContainer := MessageLogContainer{
+			MessageLogEntry: &msgLog,
+		}
+		// Give messageLog to the callback for processing.
+		return callback(&msgLogContainer)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Done parsing
+	return callback(&MessageLogContainer{NextLink: nextLink, DeltaLink: deltaLink})
+}
+
+// ParseAuditLogs parses an incoming stream response that contains audit log entries, with their
+// AuditDetails expanded.
+// Parsing stops as soon as the callback returns an error, which is then returned to the caller.
+func (r *JSONReviver) ParseAuditLogs(callback func(*AuditLogContainer) error) error {
+	nextLink, deltaLink, err := r.parseCollection(func() error {
+		// Read next item
+		auditLog := AuditLogEntry{}
+		if ok, err := r.decodeEntry(&auditLog); !ok {
+			return err
+		}
+		auditLog.SchemaVersion = SchemaVersion
+
+		auditLogContainer := AuditLogContainer{
+			AuditLogEntry: &auditLog,
+		}
+		// Give auditLog to the callback for processing.
+		return callback(&auditLogContainer)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Done parsing
+	return callback(&AuditLogContainer{NextLink: nextLink, DeltaLink: deltaLink})
+}
+
+// ParseEntities parses an incoming stream response that contains a collection of any entity type,
+// passing every entity to the callback as a map of its properties, allowing any collection to be
+// processed without the need for a dedicated type and parser.
+// Parsing stops as soon as the callback returns an error, which is then returned to the caller.
+func (r *JSONReviver) ParseEntities(callback func(*EntityContainer) error) error {
+	nextLink, deltaLink, err := r.parseCollection(func() error {
+		// Read next item
+		entity := map[string]interface{}{}
+		if ok, err := r.decodeEntry(&entity); !ok {
+			return err
+		}
+
+		// Give entity to the callback for processing.
+		return callback(&EntityContainer{Entity: entity})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Done parsing
+	return callback(&EntityContainer{NextLink: nextLink, DeltaLink: deltaLink})
+}
+
+// ParseCellset parses an incoming stream response that contains a cellset, with its axes expanded
+// before its cells, passing every cell, with the members of its tuple, to the callback. It returns
+// the ID of the cellset, if found. Parsing stops as soon as the callback returns an error, which is
+// then returned to the caller.
+func (r *JSONReviver) ParseCellset(callback func(*Cell) error) (string, error) {
+	if err := r.expectDelim('{'); err != nil {
+		return "", err
+	}
+
+	id := ""
+	var axes []cellsetAxis
+	for r.decoder.More() {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return id, err
+		}
+
+		switch token {
+		case "ID":
+			err = r.decoder.Decode(&id)
+		case "Axes":
+			err = r.decoder.Decode(&axes)
+		case "Cells":
+			err = r.parseCells(axes, callback)
+		default:
+			var skipped json.RawMessage
+			err = r.decoder.Decode(&skipped)
+		}
+		if err != nil {
+			return id, err
+		}
+	}
+	return id, r.expectDelim('}')
+}
+
+// parseCells parses the array of cells of a cellset, passing every cell, with the members of its
+// tuple on the axes, to the callback.
+func (r *JSONReviver) parseCells(axes []cellsetAxis, callback func(*Cell) error) error {
+	if err := r.expectDelim('['); err != nil {
+		return err
+	}
+	for r.decoder.More() {
+		cell := new(Cell)
+		if ok, err := r.decodeEntry(cell); !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The ordinal runs along the first axis first
+		ordinal := cell.Ordinal
+		for _, axis := range axes {
+			if len(axis.Tuples) == 0 {
+				continue
+			}
+			for _, member := range axis.Tuples[ordinal%len(axis.Tuples)].Members {
+				cell.Tuple = append(cell.Tuple, member.Name)
+			}
+			ordinal /= len(axis.Tuples)
+		}
+		if err := callback(cell); err != nil {
+			return err
+		}
+	}
+	return r.expectDelim(']')
+}
+
+// expectDelim reads the next token, which has to be the delimiter.
+func (r *JSONReviver) expectDelim(delim json.Delim) error {
+	token, err := r.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return errors.New("JSON delimiter " + delim.String() + " not found")
+	}
+	return nil
+}
+
+// decodeEntry decodes the next entry in the stream into v. It returns false if the entry has to be
+// skipped, with an error if the stream itself can't be read any further, in which case parsing has
+// to stop, or without one if the entry itself couldn't be decoded, which is reported through OnError.
+func (r *JSONReviver) decodeEntry(v interface{}) (bool, error) {
+	var raw json.RawMessage
+	if err := r.decoder.Decode(&raw); err != nil {
+		return false, errors.New("unable to read entry: " + err.Error())
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		if r.OnError != nil {
+			r.OnError(raw, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// parseCollection parses the outer JSON object of a collection response, calling parseEntry for
+// every element in its 'value' array, and returns the nextLink and deltaLink, if any, found in the
+// response.
+func (r *JSONReviver) parseCollection(parseEntry func() error) (string, string, error) {
+	t, err := r.decoder.Token()
+	if err != nil {
+		return "", "", err
+	}
+
 	if delim, ok := t.(json.Delim); !ok || delim != '{' {
-		return errors.New("JSON object start delimiter not found")
+		return "", "", errors.New("JSON object start delimiter not found")
 	}
 
+	nextLink := ""
 	deltaLink := ""
 
 	for r.decoder.More() {
 		token, err := r.decoder.Token()
 		if err != nil {
-			return err
+			return "", "", err
 		}
 
-		if token == "@odata.deltaLink" {
+		switch token {
+		case "@odata.nextLink":
+			r.decoder.Decode(&nextLink)
+		case "@odata.deltaLink":
 			r.decoder.Decode(&deltaLink)
 		}
 
@@ -50,50 +257,37 @@ func (r *JSONReviver) ParseTransactionLogs(callback func(*TransactionLogContaine
 		// 'value' should contain an array
 		token, err = r.decoder.Token()
 		if err != nil {
-			return err
+			return "", "", err
 		}
 
 		if delim, ok := token.(json.Delim); !ok || delim != '[' {
-			return errors.New("JSON array start delimiter not found")
+			return "", "", errors.New("JSON array start delimiter not found")
 		}
 
 		// Read array elements
 		for r.decoder.More() {
-			// Read next item (large object)
-			txnLog := TransactionLogEntry{}
-
-			err := r.decoder.Decode(&txnLog)
-			if err != nil {
-				return errors.New("unable to decode transaction log entry")
-			}
-
-			txnLogContainer := TransactionLogContainer{
-				TransactionLogEntry: &txnLog,
+			if err := parseEntry(); err != nil {
+				return "", "", err
 			}
-			// Give transactionLog to the callback for processing.
-			callback(&txnLogContainer)
 		}
 		// End of Array
 		token, err = r.decoder.Token()
 		if err != nil {
-			return err
+			return "", "", err
 		}
 
 		if delim, ok := token.(json.Delim); !ok || delim != ']' {
-			return errors.New("JSON array end delimiter not found")
+			return "", "", errors.New("JSON array end delimiter not found")
 		}
 	}
 
 	t, err = r.decoder.Token()
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	if delim, ok := t.(json.Delim); !ok || delim != '}' {
-		return errors.New("JSON object end delimiter not found")
+		return "", "", errors.New("JSON object end delimiter not found")
 	}
 
-	// Done parsing
-	callback(&TransactionLogContainer{DeltaLink: deltaLink})
-
-	return nil
+	return nextLink, deltaLink, nil
 }
@@ -0,0 +1,90 @@
+package odata
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Lease is a lock, by name, held by a single holder at a time, for as long as the holder keeps
+// renewing it before it expires, allowing instances sharing a checkpoint store to elect the one of
+// them doing the work.
+type Lease interface {
+	// Acquire acquires the lease for the ttl, or renews it for the ttl if already held, and returns
+	// whether it's held.
+	Acquire(ttl time.Duration) (bool, error)
+	// Release releases the lease, if held, so another holder can acquire it right away.
+	Release() error
+}
+
+// The statements creating the table of the SQLLease, if it doesn't exist yet, acquiring, or renewing,
+// a lease, affecting a row only if acquired, and releasing it, by database driver. Leases expire by
+// the clock of the database, so the clocks of the holders don't matter.
+var sqlLeaseStatements = map[string][3]string{
+	"postgres": {
+		"CREATE TABLE IF NOT EXISTS tm1_leases (name VARCHAR(900) PRIMARY KEY, holder VARCHAR(255), expires TIMESTAMPTZ)",
+		"INSERT INTO tm1_leases (name, holder, expires) VALUES ($1, $2, NOW() + CAST($3 AS DOUBLE PRECISION) * INTERVAL '1 millisecond') " +
+			"ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires = EXCLUDED.expires " +
+			"WHERE tm1_leases.holder = EXCLUDED.holder OR tm1_leases.expires < NOW()",
+		"DELETE FROM tm1_leases WHERE name = $1 AND holder = $2",
+	},
+	"sqlserver": {
+		"IF OBJECT_ID('tm1_leases', 'U') IS NULL CREATE TABLE tm1_leases (name NVARCHAR(450) PRIMARY KEY, holder NVARCHAR(255), expires DATETIME2)",
+		"MERGE tm1_leases WITH (HOLDLOCK) AS t USING (SELECT @p1 AS name, @p2 AS holder) AS s ON t.name = s.name " +
+			"WHEN MATCHED AND (t.holder = s.holder OR t.expires < SYSUTCDATETIME()) THEN UPDATE SET holder = s.holder, expires = DATEADD(millisecond, @p3, SYSUTCDATETIME()) " +
+			"WHEN NOT MATCHED THEN INSERT (name, holder, expires) VALUES (s.name, s.holder, DATEADD(millisecond, @p3, SYSUTCDATETIME()));",
+		"DELETE FROM tm1_leases WHERE name = @p1 AND holder = @p2",
+	},
+}
+
+// SQLLease is a Lease kept in the tm1_leases table of a relational database, created if it doesn't
+// exist yet, holding a row, by name, with the holder of the lease and the time it expires.
+type SQLLease struct {
+	db      *sql.DB
+	acquire string
+	release string
+	name    string
+	holder  string
+}
+
+// NewSQLLease creates and returns a new SQLLease, by the name, for the holder, kept in the database,
+// using either the postgres or the sqlserver driver, identified by the data source name.
+func NewSQLLease(driver string, dsn string, name string, holder string) (*SQLLease, error) {
+	statements, ok := sqlLeaseStatements[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(statements[0]); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	l := new(SQLLease)
+	l.db = db
+	l.acquire = statements[1]
+	l.release = statements[2]
+	l.name = name
+	l.holder = holder
+
+	return l, nil
+}
+
+// Acquire acquires, or renews, the lease, if it isn't held by another holder, or it expired.
+func (l *SQLLease) Acquire(ttl time.Duration) (bool, error) {
+	result, err := l.db.Exec(l.acquire, l.name, l.holder, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Release releases the lease, if held.
+func (l *SQLLease) Release() error {
+	_, err := l.db.Exec(l.release, l.name, l.holder)
+	return err
+}
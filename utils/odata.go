@@ -1,25 +1,95 @@
 package odata
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
-var Verbose = true
+// Logger is the logger used by the package, which logs the requests being executed at the debug level,
+// and the bodies of the responses at the trace level.
+var Logger = slog.Default()
 
-// ResponseProcessorFunc is a callback function used to stream parse a response.
-type ResponseProcessorFunc func(io.Reader) (string, string)
+// ResponseProcessorFunc is a callback function used to stream parse a response. It returns the
+// nextLink and deltaLink found in the response, if any, or an error if the response could not be
+// processed.
+type ResponseProcessorFunc func(io.Reader) (string, string, error)
 
 // Client is an OData Client
 type Client struct {
 	http.Client
 	processorFunc ResponseProcessorFunc
+
+	// RetryPolicy, if set, defines how requests failing due to transient failures are retried.
+	RetryPolicy *RetryPolicy
+
+	// Authenticator, if set, authenticates the client with the server, both when logging in and
+	// when the session has expired.
+	Authenticator Authenticator
+
+	// MaxPageSize, if set, asks the server, using the odata.maxpagesize preference, to return
+	// collections in pages of at most this many entities, bounding the memory used per response.
+	MaxPageSize int
+
+	// Preferences are any additional preferences passed in the Prefer header when reading or
+	// tracking collections.
+	Preferences []string
+
+	// Interval, if set, returns the time to wait before requesting the next delta when tracking a
+	// collection, instead of the fixed interval passed to TrackCollection.
+	Interval func() time.Duration
+
+	// Compression, if set, asks the server to gzip compress its responses, which are decompressed
+	// transparently, and gzip compresses the body of POST requests to servers advertising, using
+	// the Accept-Encoding header in any of their responses, that they accept compressed requests.
+	Compression bool
+
+	// UserAgent, SessionContext and Headers, if set, are passed with every request, SessionContext
+	// using the TM1-SessionContext header, which names the session as shown by TM1 monitoring tools.
+	UserAgent      string
+	SessionContext string
+	Headers        map[string]string
+
+	// OnDeltaLinkLost, if set, is called when tracking a collection if the server rejects the
+	// deltaLink, as it does once it restarted, or the processor of the response reports the deltaLink
+	// as lost, with the error, and returns the URL, relative to the service root, of the collection
+	// to start tracking over from, or an empty string to stop tracking, returning the error.
+	OnDeltaLinkLost func(err error) string
+
+	// BatchFormat, if set, either json or multipart, is the format of the $batch requests bundling
+	// lookups, like the attributes of multiple elements, in a single round trip, instead of
+	// requesting them one by one.
+	BatchFormat string
+
+	// Limiter, if set, limits the rate at which requests, including retries, are sent to the server,
+	// protecting it from a misconfigured client, every request waiting for a token of the bucket.
+	Limiter *rate.Limiter
+
+	mutex     sync.Mutex
+	gzipHosts map[string]bool // Hosts accepting gzip compressed requests
 }
 
+// ErrTrackChangesNotApplied is returned when tracking a collection if the server didn't apply the
+// odata.track-changes preference, meaning no deltas can be requested.
+var ErrTrackChangesNotApplied = errors.New("server did not apply the odata.track-changes preference")
+
+// ErrDeltaLinkLost is returned, or wrapped, by the processor of a response to a delta request if it
+// considers the deltaLink no longer valid, as in it doesn't return the changes anymore.
+var ErrDeltaLinkLost = errors.New("delta link no longer valid")
+
 // NewClient creates and returns a new OData Client
 func NewClient(client http.Client, fn ResponseProcessorFunc) *Client {
 	c := new(Client)
@@ -29,8 +99,14 @@ func NewClient(client http.Client, fn ResponseProcessorFunc) *Client {
 	return c
 }
 
+// SchemaVersion is the version of the schema of the transaction, message and audit log entries as
+// emitted by the tracker, carried by every entry. It's to be incremented whenever the fields of
+// these entries change.
+const SchemaVersion = 1
+
 // TransactionLogContainer contains a TransactionLogEntry with
 type TransactionLogContainer struct {
+	NextLink  string `json:"@odata.nextLink"`
 	DeltaLink string `json:"@odata.deltaLink"`
 	*TransactionLogEntry
 }
@@ -47,118 +123,723 @@ type TransactionLogEntry struct {
 	OldValue        interface{} `json:"OldValue"`
 	NewValue        interface{} `json:"NewValue"`
 	StatusMessage   interface{} `json:"StatusMessage"`
+	Server          string      `json:"Server,omitempty"` // Name of the server the entry originates from, if any
+	SchemaVersion   int         `json:"SchemaVersion"`    // Version of the schema of the entry, SchemaVersion
+
+	// Elements and Attributes, if the entry has been enriched, hold the element, and the values of
+	// its attributes, by dimension name
+	Elements   map[string]string                 `json:"Elements,omitempty"`
+	Attributes map[string]map[string]interface{} `json:"Attributes,omitempty"`
+
+	// Values, if the values have been parsed, holds the old and new value according to their type
+	Values *TypedValues `json:"Values,omitempty"`
+
+	// FutureTimeStamp, if the time stamp has been normalized, tells whether it lies in the future
+	FutureTimeStamp bool `json:"FutureTimeStamp,omitempty"`
 }
 
-func (client *Client) ExecuteGETRequest(urlStr string) *http.Response {
-	// Create new, GET, request
-	req, _ := http.NewRequest("GET", urlStr, nil)
-	// Add the OData-Version header
-	req.Header.Add("OData-Version", "4.0")
-	// We'll be expecting a JSON formatted response, set Accept header accordingly
-	req.Header.Add("Accept", "application/json")
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
+// MessageLogContainer contains a MessageLogEntry with
+type MessageLogContainer struct {
+	NextLink  string `json:"@odata.nextLink"`
+	DeltaLink string `json:"@odata.deltaLink"`
+	*MessageLogEntry
+}
+
+// MessageLogEntry defines the structure of a single MessageLog entity
+type MessageLogEntry struct {
+	ID            int    `json:"ID"`
+	ThreadID      int    `json:"ThreadID"`
+	SessionID     int    `json:"SessionID"`
+	Level         string `json:"Level"`
+	TimeStamp     string `json:"TimeStamp"`
+	Logger        string `json:"Logger"`
+	Message       string `json:"Message"`
+	Server        string `json:"Server,omitempty"` // Name of the server the entry originates from, if any
+	SchemaVersion int    `json:"SchemaVersion"`    // Version of the schema of the entry, SchemaVersion
+
+	// FutureTimeStamp, if the time stamp has been normalized, tells whether it lies in the future
+	FutureTimeStamp bool `json:"FutureTimeStamp,omitempty"`
+}
+
+// AuditLogContainer contains an AuditLogEntry with
+type AuditLogContainer struct {
+	NextLink  string `json:"@odata.nextLink"`
+	DeltaLink string `json:"@odata.deltaLink"`
+	*AuditLogEntry
+}
+
+// AuditLogEntry defines the structure of a single AuditLog entity, a change to an object, like a
+// process being edited, the rules of a cube being saved or a client being added to a group,
+// including its expanded AuditDetails
+type AuditLogEntry struct {
+	ID            int           `json:"ID"`
+	TimeStamp     string        `json:"TimeStamp"`
+	UserName      string        `json:"UserName"`
+	Description   string        `json:"Description"`
+	ObjectType    string        `json:"ObjectType"`
+	ObjectName    string        `json:"ObjectName"`
+	AuditDetails  []AuditDetail `json:"AuditDetails,omitempty"`
+	Server        string        `json:"Server,omitempty"` // Name of the server the entry originates from, if any
+	SchemaVersion int           `json:"SchemaVersion"`    // Version of the schema of the entry, SchemaVersion
+
+	// FutureTimeStamp, if the time stamp has been normalized, tells whether it lies in the future
+	FutureTimeStamp bool `json:"FutureTimeStamp,omitempty"`
+}
+
+// AuditDetail defines the structure of a single AuditDetail entity, one of the objects affected by
+// the change an AuditLogEntry is about
+type AuditDetail struct {
+	ID         int    `json:"ID"`
+	TimeStamp  string `json:"TimeStamp"`
+	ObjectType string `json:"ObjectType"`
+	ObjectName string `json:"ObjectName"`
+}
+
+// EntityContainer contains an entity, of any type, represented by a map of its properties with
+type EntityContainer struct {
+	NextLink  string
+	DeltaLink string
+	Entity    map[string]interface{}
+}
+
+// SessionCollection defines the structure of a response containing a collection of Sessions
+type SessionCollection struct {
+	Sessions []Session `json:"value"`
+}
+
+// Session defines the structure of a single Session entity, including its expanded User and Threads
+type Session struct {
+	ID      int    `json:"ID"`
+	Context string `json:"Context"`
+	Active  bool   `json:"Active"`
+	User    *struct {
+		Name string `json:"Name"`
+	} `json:"User"`
+	Threads []Thread `json:"Threads"`
+}
+
+// ThreadCollection defines the structure of a response containing a collection of Threads
+type ThreadCollection struct {
+	Threads []Thread `json:"value"`
+}
+
+// Thread defines the structure of a single Thread entity
+type Thread struct {
+	ID          int    `json:"ID"`
+	Type        string `json:"Type"`
+	Name        string `json:"Name"`
+	Context     string `json:"Context"`
+	State       string `json:"State"`
+	Function    string `json:"Function"`
+	ObjectType  string `json:"ObjectType"`
+	ObjectName  string `json:"ObjectName"`
+	RLocks      int    `json:"RLocks"`
+	IXLocks     int    `json:"IXLocks"`
+	WLocks      int    `json:"WLocks"`
+	ElapsedTime string `json:"ElapsedTime"`
+	WaitTime    string `json:"WaitTime"`
+	Info        string `json:"Info"`
+}
+
+// Login establishes a session with the server, authenticating using the client's Authenticator, by
+// requesting the version of the server, which is returned.
+func (client *Client) Login(serviceRootURL string) (string, error) {
+	req, err := http.NewRequest("GET", serviceRootURL+"Configuration/ProductVersion/$value", nil)
+	if err != nil {
+		return "", err
 	}
-	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
+	if client.Authenticator != nil {
+		if err := client.Authenticator.Authenticate(req); err != nil {
+			return "", err
+		}
+	}
+
+	// We'll expect text back in this case so we won't do any content type verification here
+	req.Header.Add("Accept", "*/*")
+	resp, err := client.decompress(client.do(req))
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return resp
+	defer resp.Body.Close()
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while asking for its version number."
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The body simply contains the version number of the server
+	version, err := ioutil.ReadAll(resp.Body)
+	return string(version), err
 }
 
-func (client *Client) ExecuteGETRequestEx(urlStr string, preReq func(*http.Request)) *http.Response {
-	// Create new, GET, request
-	req, _ := http.NewRequest("GET", urlStr, nil)
+func (client *Client) ExecuteGETRequest(urlStr string) (*http.Response, error) {
+	return client.ExecuteGETRequestEx(context.Background(), urlStr, func(*http.Request) {})
+}
+
+func (client *Client) ExecuteGETRequestEx(ctx context.Context, urlStr string, preReq func(*http.Request)) (*http.Response, error) {
+	// Create new, GET, request, which gets aborted once the context is done
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
 	// Add the OData-Version header
 	req.Header.Add("OData-Version", "4.0")
 	// We'll be expecting a JSON formatted response, set Accept header accordingly
 	req.Header.Add("Accept", "application/json")
 	// Allow additional processing of the request before actually executing
 	preReq(req)
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
-	}
+	client.acceptEncoding(req)
+	Logger.Debug("Executing request", "method", req.Method, "url", req.URL.String())
 	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
-	if err != nil {
-		log.Fatal(err)
-	}
-	return resp
+	return client.decompress(client.do(req))
 }
 
-func (client *Client) ExecutePOSTRequest(urlStr, contentType string, stream io.ReadCloser) *http.Response {
-	req, _ := http.NewRequest("POST", urlStr, stream)
+func (client *Client) ExecutePOSTRequest(urlStr, contentType string, stream io.ReadCloser) (*http.Response, error) {
+	req, err := http.NewRequest("POST", urlStr, stream)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Add("Content-Type", contentType)
 	// Add the OData-Version header
 	req.Header.Add("OData-Version", "4.0")
 	// We'll be expecting a JSON formatted response, set Accept header accordingly
 	req.Header.Add("Accept", "application/json")
+	client.acceptEncoding(req)
+	client.compress(req)
+	Logger.Debug("Executing request", "method", req.Method, "url", req.URL.String())
 
 	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
+	return client.decompress(client.do(req))
+}
+
+// ExecuteDELETERequest executes a DELETE request, as in deleting an entity, against the URL.
+func (client *Client) ExecuteDELETERequest(urlStr string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", urlStr, nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return resp
+	// Add the OData-Version header
+	req.Header.Add("OData-Version", "4.0")
+	req.Header.Add("Accept", "application/json")
+	Logger.Debug("Executing request", "method", req.Method, "url", req.URL.String())
+
+	// Execute the request
+	return client.decompress(client.do(req))
 }
 
-func (client *Client) IterateCollection(datasourceServiceRootURL string, urlStr string, processResponse func([]byte) (int, string)) {
+func (client *Client) IterateCollection(datasourceServiceRootURL string, urlStr string, processResponse func([]byte) (int, string)) error {
 	// Set up the request to retrieve the collection given the passed url
 	// Note: While we are requesting the collection completely in one request, the service might
 	// opt to apply server driven paging and give us a partial response with a nextLink which
 	// subsequently can be used to retrieve the next chunk or remainder of the collection.
 	for nextLink := urlStr; nextLink != ""; {
-		resp := client.ExecuteGETRequest(datasourceServiceRootURL + nextLink)
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		if Verbose == true {
-			fmt.Println(string(body))
+		resp, err := client.ExecuteGETRequest(ResolveURL(datasourceServiceRootURL, nextLink))
+		if err != nil {
+			return err
+		}
+		err = ValidateStatusCode(resp, 200, func() string {
+			return "Server responded with an unexpected result while iterating the collection."
+		})
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if Logger.Enabled(context.Background(), LevelTrace) {
+			Logger.Log(context.Background(), LevelTrace, "Received response", "body", string(Redact(body)))
 		}
 
 		// Process the response
 		_, nextLink = processResponse(body)
 	}
+	return nil
 }
 
-func (client *Client) TrackCollection(serviceRootURL string, urlStr string, interval time.Duration) {
+// ReadCollection reads the collection, processing the response, and any subsequent responses
+// following the nextLinks, using the client's processor function, without tracking changes.
+// Reading stops if the context is done, in which case the context's error is returned.
+func (client *Client) ReadCollection(ctx context.Context, serviceRootURL string, urlStr string) error {
+	collection := urlStr
+	for urlStr != "" {
+		nextLink, _, err := client.processWindow(ctx, "odata.read", ResolveURL(serviceRootURL, urlStr), false, func(resp *http.Response) error {
+			return ValidateStatusCode(resp, 200, func() string {
+				return "Server responded with an unexpected result while reading the collection."
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		// Continue with the next window of the collection, if any
+		urlStr = ""
+		if nextLink != "" {
+			urlStr = preserveQueryOptions(nextLink, collection)
+		}
+	}
+	return nil
+}
+
+// TrackCollection tracks the collection, processing the initial response and any subsequent delta
+// responses using the client's processor function. If a checkpoint is passed, tracking resumes from
+// the deltaLink saved in the checkpoint, if any, and every new deltaLink is saved into it. As the
+// checkpoint can be shared by multiple servers, deltaLinks are saved by the collection's full URL.
+// Tracking continues until the context is done, in which case the context's error is returned.
+func (client *Client) TrackCollection(ctx context.Context, serviceRootURL string, urlStr string, interval time.Duration, checkpoint *Checkpoint) error {
+	collection := urlStr
+	checkpointKey := ResolveURL(serviceRootURL, collection)
+
+	// Resume from the last deltaLink we've seen, if we have one
+	// Note: Checkpoints written before deltaLinks were saved by full URL used the collection as key
+	if checkpoint != nil {
+		if deltaLink := checkpoint.DeltaLink(checkpointKey); deltaLink != "" {
+			urlStr = deltaLink
+		} else if deltaLink := checkpoint.DeltaLink(collection); deltaLink != "" {
+			urlStr = deltaLink
+		}
+	}
+
 	// Set up the request to retrieve the collection given the passed url
 	// Note: While we are requesting the collection completely in one request, the service might
 	// opt to apply server driven paging and give us a partial response with a nextLink which
 	// subsequently can be used to retrieve the next chunk or remainder of the collection.
-	for urlStr := urlStr; urlStr != ""; {
-		resp := client.ExecuteGETRequestEx(serviceRootURL+urlStr, func(req *http.Request) { req.Header.Add("Prefer", "odata.track-changes") })
-		defer resp.Body.Close()
+	initial := urlStr == collection
+	following := !initial // Whether urlStr is a deltaLink
+	for urlStr != "" {
+		nextLink, deltaLink, err := client.processWindow(ctx, "odata.delta", ResolveURL(serviceRootURL, urlStr), true, func(resp *http.Response) error {
+			err := ValidateStatusCode(resp, 200, func() string {
+				return "Server responded with an unexpected result while tracking the collection."
+			})
+			if err != nil {
+				return err
+			}
 
-		// Process the response
-		nextLink, deltaLink := client.processorFunc(resp.Body)
+			// Before processing the initial response make sure the server is going to give us deltas,
+			// there is no point in processing the collection if we can't track it afterwards
+			if initial {
+				initial = false
+				if !preferenceApplied(resp, "odata.track-changes") {
+					return fmt.Errorf("%w to %s, make sure the collection supports tracking changes", ErrTrackChangesNotApplied, collection)
+				}
+			}
+			return nil
+		})
+		if err != nil && following && client.OnDeltaLinkLost != nil && DeltaLinkLost(err) {
+			// Start over, typically from the current end of the log, rather than failing for good
+			if urlStr = client.OnDeltaLinkLost(err); urlStr != "" {
+				initial, following = true, false
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		following = false
 
 		// TM1 doesn't but other services could return a nextLink when applying server side windowing
 		// while returning the collection. Note that, following OData conventions, only the last
 		// window, which does not have a nextLink, contains a deltaLink.
 		if nextLink != "" {
 			// Continue processing the collection being returned
-			urlStr = nextLink
+			urlStr = preserveQueryOptions(nextLink, collection)
 		} else if deltaLink != "" {
-			// Wait a second before querying for the next deltaLink
-			time.Sleep(interval)
+			// Everything up to this deltaLink has been processed, remember where to continue from
+			deltaLink = preserveQueryOptions(deltaLink, collection)
+			if checkpoint != nil {
+				if err := checkpoint.SetDeltaLink(checkpointKey, deltaLink); err != nil {
+					return err
+				}
+			}
+
+			// Wait a second before querying for the next deltaLink, unless we're asked to stop
+			wait := interval
+			if client.Interval != nil {
+				wait = client.Interval()
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
 
 			// Continue with the deltaLink
 			urlStr = deltaLink
+			following = true
 		} else {
 			// Seems the server is no longer willing to give us deltas.
 			break
 		}
 	}
+	return nil
+}
+
+// DeltaLinkLost returns true if the error, returned following a deltaLink, means the deltaLink is no
+// longer valid, as in the server responded with 410 Gone, 404 Not Found or 400 Bad Request, as
+// servers do once they restarted, or the processor of the response returned ErrDeltaLinkLost.
+func DeltaLinkLost(err error) bool {
+	if errors.Is(err, ErrDeltaLinkLost) {
+		return true
+	}
+	var odataErr *ODataError
+	if errors.As(err, &odataErr) {
+		switch odataErr.StatusCode {
+		case http.StatusGone, http.StatusNotFound, http.StatusBadRequest:
+			return true
+		}
+	}
+	return false
+}
+
+// prefer returns the function setting the Prefer header, with the odata.track-changes preference
+// if tracking changes, the odata.maxpagesize preference if a maximum page size is set, and any
+// additional preferences.
+func (client *Client) prefer(trackChanges bool) func(req *http.Request) {
+	var preferences []string
+	if trackChanges {
+		preferences = append(preferences, "odata.track-changes")
+	}
+	if client.MaxPageSize > 0 {
+		preferences = append(preferences, "odata.maxpagesize="+strconv.Itoa(client.MaxPageSize))
+	}
+	preferences = append(preferences, client.Preferences...)
+	return func(req *http.Request) {
+		if len(preferences) > 0 {
+			req.Header.Set("Prefer", strings.Join(preferences, ", "))
+		}
+	}
+}
+
+// preferenceApplied returns true if the server reported, using the Preference-Applied header, that
+// it applied the preference.
+func preferenceApplied(resp *http.Response, preference string) bool {
+	for _, header := range resp.Header.Values("Preference-Applied") {
+		for _, applied := range strings.Split(header, ",") {
+			if name, _, _ := strings.Cut(strings.TrimSpace(applied), "="); name == preference {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AppendQueryOptions returns the URL with the query options, like $filter or $select, appended to
+// it. Options are appended in alphabetical order and empty options are ignored.
+func AppendQueryOptions(urlStr string, options map[string]string) string {
+	names := make([]string, 0, len(options))
+	for name, value := range options {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		separator := "?"
+		if strings.Contains(urlStr, "?") {
+			separator = "&"
+		}
+		urlStr += separator + name + "=" + escapeQueryValue(options[name])
+	}
+	return urlStr
+}
+
+// escapeQueryValue escapes the value of a query option. Spaces are escaped as %20, rather than +,
+// as not every service treats a + as a space.
+func escapeQueryValue(value string) string {
+	return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
+
+// preserveQueryOptions returns the link, a nextLink or deltaLink returned by the service, with any
+// of the query options specified for the collection, which the link doesn't specify itself, added
+// to it, making sure the options keep being applied when following the link. Paging options, $top
+// and $skip, are not carried over as the service already accounts for those in its links.
+func preserveQueryOptions(link string, collection string) string {
+	i := strings.Index(collection, "?")
+	if i < 0 {
+		return link
+	}
+	options, err := url.ParseQuery(collection[i+1:])
+	if err != nil {
+		return link
+	}
+	linkOptions := url.Values{}
+	if j := strings.Index(link, "?"); j >= 0 {
+		linkOptions, _ = url.ParseQuery(link[j+1:])
+	}
+
+	missing := map[string]string{}
+	for name := range options {
+		if name == "$top" || name == "$skip" {
+			continue
+		}
+		if _, ok := linkOptions[name]; !ok {
+			missing[name] = options.Get(name)
+		}
+	}
+	return AppendQueryOptions(link, missing)
+}
+
+// ResolveURL resolves a, possibly relative, URL, like the links returned by the service, against
+// the service root URL.
+func ResolveURL(serviceRootURL string, urlStr string) string {
+	if strings.HasPrefix(urlStr, "http://") || strings.HasPrefix(urlStr, "https://") {
+		return urlStr
+	}
+	return serviceRootURL + urlStr
+}
+
+// TracksChanges returns true if the service applies the track-changes preference to the collection,
+// reported using the Preference-Applied header, as required to track it.
+func (client *Client) TracksChanges(serviceRootURL string, collection string) (bool, error) {
+	resp, err := client.ExecuteGETRequestEx(context.Background(), ResolveURL(serviceRootURL, collection), client.prefer(true))
+	if err != nil {
+		return false, err
+	}
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while requesting the collection " + collection + "."
+	})
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return preferenceApplied(resp, "odata.track-changes"), nil
+}
+
+// CubeDimensions returns the names of the dimensions, in order, of the specified cube.
+func (client *Client) CubeDimensions(serviceRootURL string, cube string) ([]string, error) {
+	resp, err := client.ExecuteGETRequest(serviceRootURL + "Cubes(" + KeyLiteral(cube) + ")/Dimensions?$select=Name")
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving the dimensions of cube " + cube + "."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Dimensions []struct {
+			Name string `json:"Name"`
+		} `json:"value"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	dimensions := make([]string, len(res.Dimensions))
+	for i, dimension := range res.Dimensions {
+		dimensions[i] = dimension.Name
+	}
+	return dimensions, nil
+}
+
+// Databases returns the names of the databases hosted by a Planning Analytics Engine, version 12 or
+// later, which exposes every database as a service of its own under Databases('name')/.
+func (client *Client) Databases(serviceRootURL string) ([]string, error) {
+	resp, err := client.ExecuteGETRequest(serviceRootURL + "Databases?$select=Name")
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving its databases."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Databases []struct {
+			Name string `json:"Name"`
+		} `json:"value"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	databases := make([]string, len(res.Databases))
+	for i, database := range res.Databases {
+		databases[i] = database.Name
+	}
+	return databases, nil
+}
+
+// DatabaseURL returns the service root URL of the database hosted by the Planning Analytics Engine
+// with the service root URL.
+func DatabaseURL(serviceRootURL string, database string) string {
+	return ResolveURL(serviceRootURL, "Databases("+KeyLiteral(database)+")/")
+}
+
+// ElementAttributes returns the values of the attributes of the element in the hierarchy, named
+// after the dimension, of the dimension.
+func (client *Client) ElementAttributes(serviceRootURL string, dimension string, element string, attributes []string) (map[string]interface{}, error) {
+	resp, err := client.ExecuteGETRequest(serviceRootURL + elementAttributesURL(dimension, element, attributes))
+	if err != nil {
+		return nil, err
+	}
+	return decodeElementAttributes(resp, dimension, element)
+}
+
+// ElementsAttributes returns the values of the attributes of the elements, each a pair of the name
+// of the dimension and the element, in the order of the elements, retrieving them in a single round
+// trip if the client has a BatchFormat.
+func (client *Client) ElementsAttributes(serviceRootURL string, elements [][2]string, attributes []string) ([]map[string]interface{}, error) {
+	values := make([]map[string]interface{}, len(elements))
+	if client.BatchFormat == "" || len(elements) < 2 {
+		for i, element := range elements {
+			var err error
+			if values[i], err = client.ElementAttributes(serviceRootURL, element[0], element[1], attributes); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	requests := make([]BatchRequest, len(elements))
+	for i, element := range elements {
+		requests[i] = BatchRequest{Method: "GET", URL: elementAttributesURL(element[0], element[1], attributes)}
+	}
+	responses, err := client.ExecuteBatch(serviceRootURL, requests)
+	if err != nil {
+		return nil, err
+	}
+	for i, resp := range responses {
+		if values[i], err = decodeElementAttributes(resp, elements[i][0], elements[i][1]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// elementAttributesURL returns the URL, relative to the service root, of the values of the
+// attributes of the element.
+func elementAttributesURL(dimension string, element string, attributes []string) string {
+	selects := make([]string, len(attributes))
+	for i, attribute := range attributes {
+		selects[i] = "Attributes/" + url.PathEscape(attribute)
+	}
+	return "Dimensions(" + KeyLiteral(dimension) + ")/Hierarchies(" + KeyLiteral(dimension) + ")/Elements(" + KeyLiteral(element) + ")?$select=" + strings.Join(selects, ",")
+}
+
+// decodeElementAttributes validates, and decodes, the response holding the values of the
+// attributes of the element.
+func decodeElementAttributes(resp *http.Response, dimension string, element string) (map[string]interface{}, error) {
+	err := ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving the attributes of element " + element + " of dimension " + dimension + "."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Attributes map[string]interface{} `json:"Attributes"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res.Attributes, nil
+}
+
+// ElementParents returns the parents of every element, by element name, which has any in the
+// hierarchy, named after the dimension, of the dimension.
+func (client *Client) ElementParents(serviceRootURL string, dimension string) (map[string][]string, error) {
+	resp, err := client.ExecuteGETRequest(serviceRootURL + "Dimensions(" + KeyLiteral(dimension) + ")/Hierarchies(" + KeyLiteral(dimension) + ")/Edges?$select=ParentName,ComponentName")
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateStatusCode(resp, 200, func() string {
+		return "Server responded with an unexpected result while retrieving the edges of dimension " + dimension + "."
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Edges []struct {
+			ParentName    string `json:"ParentName"`
+			ComponentName string `json:"ComponentName"`
+		} `json:"value"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	parents := map[string][]string{}
+	for _, edge := range res.Edges {
+		parents[edge.ComponentName] = append(parents[edge.ComponentName], edge.ParentName)
+	}
+	return parents, nil
+}
+
+// ExecuteProcess executes the TurboIntegrator process, passing the parameters, by name, and waits
+// for it to complete. It returns an error if the process didn't complete successfully, including
+// the name of its error log file, if any.
+func (client *Client) ExecuteProcess(serviceRootURL string, process string, parameters map[string]string) error {
+	type parameter struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	}
+	req := struct {
+		Parameters []parameter `json:"Parameters"`
+	}{[]parameter{}}
+	for name, value := range parameters {
+		req.Parameters = append(req.Parameters, parameter{Name: name, Value: value})
+	}
+	sort.Slice(req.Parameters, func(i, j int) bool { return req.Parameters[i].Name < req.Parameters[j].Name })
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ExecutePOSTRequest(serviceRootURL+"Processes("+KeyLiteral(process)+")/tm1.ExecuteWithReturn", "application/json", ioutil.NopCloser(strings.NewReader(string(body))))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		err = ValidateStatusCode(resp, 201, func() string {
+			return "Server responded with an unexpected result while executing process " + process + "."
+		})
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Status       string `json:"ProcessExecuteStatusCode"`
+		ErrorLogFile *struct {
+			Filename string `json:"Filename"`
+		} `json:"ErrorLogFile"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.Status != "CompletedSuccessfully" {
+		if res.ErrorLogFile != nil && res.ErrorLogFile.Filename != "" {
+			return fmt.Errorf("process %s completed with status %s, see %s", process, res.Status, res.ErrorLogFile.Filename)
+		}
+		return fmt.Errorf("process %s completed with status %s", process, res.Status)
+	}
+	return nil
+}
+
+// KeyLiteral returns the string as a key literal, quoted and escaped, to be used in a URL, as in
+// Cubes('name').
+func KeyLiteral(s string) string {
+	return "'" + url.PathEscape(strings.Replace(s, "'", "''", -1)) + "'"
 }
 
-func ValidateStatusCode(resp *http.Response, statusCode int, logFmt func() string) {
+// ValidateStatusCode returns an *ODataError, including the OData error or body of the response, if
+// the response doesn't have the expected status code. The body of the response is closed in that case.
+func ValidateStatusCode(resp *http.Response, statusCode int, logFmt func() string) error {
 	if resp.StatusCode != statusCode {
 		defer resp.Body.Close()
 		body, _ := ioutil.ReadAll(resp.Body)
-		log.Fatal(logFmt() + "\r\nServer responded with: " + resp.Status + "\r\n" + string(body))
+		return newODataError(resp, body, logFmt())
 	}
+	return nil
 }
@@ -0,0 +1,240 @@
+package odata_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-blackhawk/fake"
+	"github.com/hubert-heijkers/tm1-blackhawk/utils"
+)
+
+// transactionLog processes the responses of the transaction log, keeping the IDs of the entries
+// read, and calling onDeltaLink, if set, for every response ending with a deltaLink.
+type transactionLog struct {
+	ids         []int
+	responses   int
+	onDeltaLink func(n int)
+	deltaLinks  int
+}
+
+func (l *transactionLog) process(stream io.Reader) (string, string, error) {
+	l.responses++
+	nextLink, deltaLink := "", ""
+	err := odata.NewJSONReviver(stream).ParseTransactionLogs(func(txnLogContainer *odata.TransactionLogContainer) error {
+		if txnLogEntry := txnLogContainer.TransactionLogEntry; txnLogEntry != nil {
+			l.ids = append(l.ids, txnLogEntry.ID)
+			return nil
+		}
+		nextLink, deltaLink = txnLogContainer.NextLink, txnLogContainer.DeltaLink
+		return nil
+	})
+	if err == nil && deltaLink != "" {
+		l.deltaLinks++
+		if l.onDeltaLink != nil {
+			l.onDeltaLink(l.deltaLinks)
+		}
+	}
+	return nextLink, deltaLink, err
+}
+
+// newTestClient creates a client, keeping its session in a cookie jar, processing the responses
+// of the transaction log, and returns it with the service root URL of the handler.
+func newTestClient(t *testing.T, handler http.Handler, log *transactionLog) (*odata.Client, string) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	client := odata.NewClient(http.Client{}, log.process)
+	client.Jar, _ = cookiejar.New(nil)
+	return client, ts.URL + "/api/v1/"
+}
+
+func addEntries(server *fake.Server, n int) {
+	for i := 0; i < n; i++ {
+		server.AddTransactionLogEntries(odata.TransactionLogEntry{TimeStamp: "2024-01-01T10:00:00Z", User: "Admin",
+			Cube: "Sales", Tuple: []string{"2024", "Jan"}, OldValue: 1.0, NewValue: 2.0})
+	}
+}
+
+func TestTrackCollectionFollowsNextLinksThenDeltaLink(t *testing.T) {
+	server := fake.NewServer()
+	server.PageSize = 2
+	addEntries(server, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := new(transactionLog)
+	log.onDeltaLink = func(n int) {
+		if n == 1 {
+			addEntries(server, 2)
+		} else {
+			cancel()
+		}
+	}
+	client, serviceRootURL := newTestClient(t, server, log)
+
+	err := client.TrackCollection(ctx, serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected tracking to stop once cancelled, got %v", err)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(log.ids, want) {
+		t.Errorf("read entries %v, expected %v", log.ids, want)
+	}
+	// Three pages of the collection, followed by the delta holding the entries added since
+	if log.responses != 4 {
+		t.Errorf("processed %d responses, expected 4", log.responses)
+	}
+}
+
+func TestTrackCollectionStartsOverOnceDeltaLinkLost(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := fake.NewServer()
+			addEntries(server, 3)
+
+			// Reject the first deltaLink followed, as a server does once it restarted
+			var rejected int32
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("$deltatoken") != "" && atomic.CompareAndSwapInt32(&rejected, 0, 1) {
+					http.Error(w, "Delta token is no longer valid", status)
+					return
+				}
+				server.ServeHTTP(w, r)
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			log := new(transactionLog)
+			log.onDeltaLink = func(n int) {
+				if n == 2 {
+					cancel()
+				}
+			}
+			client, serviceRootURL := newTestClient(t, handler, log)
+			var lost []error
+			client.OnDeltaLinkLost = func(err error) string {
+				lost = append(lost, err)
+				return "TransactionLogEntries"
+			}
+
+			err := client.TrackCollection(ctx, serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected tracking to stop once cancelled, got %v", err)
+			}
+			if len(lost) != 1 || !odata.DeltaLinkLost(lost[0]) {
+				t.Fatalf("expected the deltaLink to be reported lost once, got %v", lost)
+			}
+			if want := []int{1, 2, 3, 1, 2, 3}; !reflect.DeepEqual(log.ids, want) {
+				t.Errorf("read entries %v, expected %v", log.ids, want)
+			}
+		})
+	}
+}
+
+func TestTrackCollectionFailsOnceDeltaLinkLostWithoutHandler(t *testing.T) {
+	server := fake.NewServer()
+	addEntries(server, 1)
+
+	log := new(transactionLog)
+	log.onDeltaLink = func(n int) {
+		server.Restart()
+	}
+	client, serviceRootURL := newTestClient(t, server, log)
+
+	err := client.TrackCollection(context.Background(), serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+	var odataErr *odata.ODataError
+	if !errors.As(err, &odataErr) || odataErr.StatusCode != http.StatusGone {
+		t.Fatalf("expected tracking to fail with 410 Gone, got %v", err)
+	}
+}
+
+func TestTrackCollectionAuthenticatesOnceSessionExpired(t *testing.T) {
+	server := fake.NewServer()
+	server.User, server.Password = "Admin", "apple"
+	addEntries(server, 2)
+
+	var authenticated, unauthorized int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt32(&authenticated, 1)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, r)
+		if recorder.Code == http.StatusUnauthorized {
+			atomic.AddInt32(&unauthorized, 1)
+		}
+		for name, values := range recorder.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := new(transactionLog)
+	log.onDeltaLink = func(n int) {
+		if n == 1 {
+			server.ExpireSessions()
+			addEntries(server, 1)
+		} else {
+			cancel()
+		}
+	}
+	client, serviceRootURL := newTestClient(t, handler, log)
+	client.Authenticator = &odata.BasicAuthenticator{User: "Admin", Password: "apple"}
+
+	if _, err := client.Login(serviceRootURL); err != nil {
+		t.Fatal(err)
+	}
+	err := client.TrackCollection(ctx, serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected tracking to stop once cancelled, got %v", err)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(log.ids, want) {
+		t.Errorf("read entries %v, expected %v", log.ids, want)
+	}
+	// Logging in, and authenticating again once the delta request got rejected
+	if n := atomic.LoadInt32(&unauthorized); n != 1 {
+		t.Errorf("got %d unauthorized responses, expected 1", n)
+	}
+	if n := atomic.LoadInt32(&authenticated); n != 2 {
+		t.Errorf("authenticated %d times, expected 2", n)
+	}
+}
+
+func TestTrackCollectionFailsIfServerDoesNotTrackChanges(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, strings.NewReader(`{"value":[]}`))
+	})
+	client, serviceRootURL := newTestClient(t, handler, new(transactionLog))
+
+	err := client.TrackCollection(context.Background(), serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+	if !errors.Is(err, odata.ErrTrackChangesNotApplied) {
+		t.Fatalf("expected %v, got %v", odata.ErrTrackChangesNotApplied, err)
+	}
+}
+
+func TestTrackCollectionReportsCancellationDuringRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold on to the request until the client aborts it
+		cancel()
+		<-r.Context().Done()
+	})
+	client, serviceRootURL := newTestClient(t, handler, new(transactionLog))
+
+	err := client.TrackCollection(ctx, serviceRootURL, "TransactionLogEntries", time.Millisecond, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,169 @@
+package odata
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig holds the proxy used to connect to a server. If no URL is specified the proxy, if any,
+// is taken from the HTTP_PROXY and HTTPS_PROXY environment variables. Either way hosts listed in
+// the NO_PROXY environment variable are connected to directly.
+type ProxyConfig struct {
+	URL      string // URL of the proxy, using the http, https, socks5 or socks5h scheme
+	User     string // User to authenticate with, unless part of the URL, as in DOMAIN\user for NTLM
+	Password string // Password to authenticate with, unless part of the URL
+	NTLM     bool   // Authenticate with the proxy using NTLM instead of basic authentication
+}
+
+// apply configures the transport to connect through the proxy, dialing connections using the dialer.
+func (c *ProxyConfig) apply(tr *http.Transport, dialer *net.Dialer) error {
+	if c.URL == "" {
+		tr.Proxy = http.ProxyFromEnvironment
+		return nil
+	}
+
+	proxyURL, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if c.User != "" {
+		proxyURL.User = url.UserPassword(c.User, c.Password)
+	}
+	config := &httpproxy.Config{HTTPProxy: proxyURL.String(), HTTPSProxy: proxyURL.String(), NoProxy: httpproxy.FromEnvironment().NoProxy}
+	proxyFunc := config.ProxyFunc()
+	if !c.NTLM {
+		tr.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+		return nil
+	}
+
+	// The transport only supports basic authentication with a proxy, for NTLM a tunnel to the server
+	// is established, and authenticated, before handing the connection to the transport
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return fmt.Errorf("NTLM authentication requires an http or https proxy, not %q", proxyURL.Scheme)
+	}
+	tr.Proxy = nil
+	tr.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if tunnel, _ := proxyFunc(&url.URL{Scheme: "https", Host: addr}); tunnel == nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return dialNTLM(ctx, dialer, proxyURL, addr)
+	}
+	return nil
+}
+
+// dialNTLM returns a connection to the address tunneled through the proxy, authenticating with the
+// proxy using NTLM.
+func dialNTLM(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	negotiate, err := ntlmssp.NewNegotiateMessage("", "")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := connect(conn, reader, addr, negotiate)
+	if err == nil && resp.StatusCode == http.StatusProxyAuthRequired {
+		challenge, ok := ntlmChallenge(resp)
+		if !ok {
+			conn.Close()
+			return nil, fmt.Errorf("proxy didn't respond with an NTLM challenge")
+		}
+		user, password := "", ""
+		if proxyURL.User != nil {
+			user = proxyURL.User.Username()
+			password, _ = proxyURL.User.Password()
+		}
+		var authenticate []byte
+		authenticate, err = ntlmssp.NewAuthenticateMessage(challenge, user, password, nil)
+		if err == nil {
+			resp, err = connect(conn, reader, addr, authenticate)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// connect asks the proxy, over the connection, to establish a tunnel to the address, passing the
+// NTLM message along, and returns its response.
+func connect(conn net.Conn, reader *bufio.Reader, addr string, message []byte) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{"Proxy-Authorization": {"NTLM " + base64.StdEncoding.EncodeToString(message)}},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	// Drain the body of a refusal, if any, as the same connection is used for the next message, once
+	// accepted whatever follows belongs to the tunnel
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// ntlmChallenge returns the NTLM challenge in the response of the proxy, and true, if there is one.
+func ntlmChallenge(resp *http.Response) ([]byte, bool) {
+	for _, header := range resp.Header.Values("Proxy-Authenticate") {
+		if !strings.HasPrefix(header, "NTLM ") {
+			continue
+		}
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(header, "NTLM ")))
+		if err == nil {
+			return challenge, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,45 @@
+package odata
+
+import "testing"
+
+func TestAppendQueryOptions(t *testing.T) {
+	for _, test := range []struct {
+		url     string
+		options map[string]string
+		want    string
+	}{
+		{"TransactionLogEntries", nil, "TransactionLogEntries"},
+		{"TransactionLogEntries", map[string]string{"$top": "10", "$filter": "Cube eq 'Sales'", "$select": ""},
+			"TransactionLogEntries?$filter=Cube%20eq%20%27Sales%27&$top=10"},
+		{"AuditLogEntries?$expand=AuditDetails", map[string]string{"$select": "ID,UserName"},
+			"AuditLogEntries?$expand=AuditDetails&$select=ID%2CUserName"},
+	} {
+		if got := AppendQueryOptions(test.url, test.options); got != test.want {
+			t.Errorf("got %s, expected %s", got, test.want)
+		}
+	}
+}
+
+func TestPreserveQueryOptions(t *testing.T) {
+	collection := "TransactionLogEntries?$filter=Cube%20eq%20%27Sales%27&$select=ID,Cube&$top=100&$skip=10"
+	for _, test := range []struct {
+		link string
+		want string
+	}{
+		// Options dropped by the service are added, except for the paging options
+		{"TransactionLogEntries?$deltatoken=abc",
+			"TransactionLogEntries?$deltatoken=abc&$filter=Cube%20eq%20%27Sales%27&$select=ID%2CCube"},
+		{"http://server/api/v1/TransactionLogEntries?$skiptoken=2",
+			"http://server/api/v1/TransactionLogEntries?$skiptoken=2&$filter=Cube%20eq%20%27Sales%27&$select=ID%2CCube"},
+		// Options kept by the service are left as is
+		{"TransactionLogEntries?$filter=Cube%20eq%20%27Sales%27&$select=ID,Cube&$deltatoken=abc",
+			"TransactionLogEntries?$filter=Cube%20eq%20%27Sales%27&$select=ID,Cube&$deltatoken=abc"},
+	} {
+		if got := preserveQueryOptions(test.link, collection); got != test.want {
+			t.Errorf("got %s, expected %s", got, test.want)
+		}
+	}
+	if got := preserveQueryOptions("TransactionLogEntries?$deltatoken=abc", "TransactionLogEntries"); got != "TransactionLogEntries?$deltatoken=abc" {
+		t.Errorf("got %s, expected the link to be left as is without any query options", got)
+	}
+}
@@ -0,0 +1,28 @@
+package odata
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// NewLimiter returns the token bucket limiting the requests to the rate, in requests per second,
+// allowing bursts of up to burst requests, or, if burst isn't specified, of the rate rounded up.
+func NewLimiter(limit float64, burst int) *rate.Limiter {
+	if burst <= 0 {
+		burst = int(limit)
+		if float64(burst) < limit {
+			burst++
+		}
+	}
+	return rate.NewLimiter(rate.Limit(limit), burst)
+}
+
+// limit waits, if the client's Limiter is set, until the request is allowed to be sent, unless the
+// context of the request is done first, in which case the context's error is returned.
+func (client *Client) limit(req *http.Request) error {
+	if client.Limiter == nil {
+		return nil
+	}
+	return client.Limiter.Wait(req.Context())
+}
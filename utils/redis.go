@@ -0,0 +1,277 @@
+package odata
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisError is an error reply of Redis.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// RedisClient is a minimal client of Redis, sending commands using its protocol, RESP, over a single
+// connection, which is established when needed and again after it failed. Replies are returned as a
+// string, for simple strings and bulk strings, nil, for null replies, an int64, for integers, or a
+// []interface{}, for arrays. The client is safe for concurrent use.
+type RedisClient struct {
+	addr      string
+	user      string
+	password  string
+	db        int
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisClient creates and returns a new RedisClient for the server identified by the URL, as in
+// redis://:password@localhost:6379/0, using rediss as scheme to connect using TLS.
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := new(RedisClient)
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tlsConfig = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("invalid redis URL %s, expected redis:// or rediss://", rawURL)
+	}
+	c.addr = u.Host
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %s", db)
+		}
+	}
+	c.timeout = 10 * time.Second
+
+	return c, nil
+}
+
+// Do sends the command, with its arguments, and returns the reply.
+func (c *RedisClient) Do(args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(args...)
+	if _, ok := err.(RedisError); err != nil && !ok {
+		// The connection is in an unknown state, start over with a new one next time
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// Close closes the connection, if any.
+func (c *RedisClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// connect connects to the server, authenticating and selecting the database, if need be, expecting
+// the caller to hold the lock.
+func (c *RedisClient) connect() error {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.user != "" {
+			args = []string{"AUTH", c.user, c.password}
+		}
+		if _, err = c.do(args...); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err = c.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends the command and reads its reply, expecting the caller to hold the lock.
+func (c *RedisClient) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads the next reply from the connection.
+func (c *RedisClient) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: invalid reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		elements := make([]interface{}, n)
+		for i := range elements {
+			if elements[i], err = c.readReply(); err != nil {
+				if _, ok := err.(RedisError); !ok {
+					return nil, err
+				}
+				elements[i] = err
+			}
+		}
+		return elements, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
+
+// RedisCheckpointStore persists the state of the collections in Redis, as JSON, by the key made up
+// of the prefix and the collection.
+type RedisCheckpointStore struct {
+	client *RedisClient
+	prefix string
+}
+
+// NewRedisCheckpointStore creates and returns a new RedisCheckpointStore persisting the state of the
+// collections using the client, by the key made up of the prefix and the collection.
+func NewRedisCheckpointStore(client *RedisClient, prefix string) *RedisCheckpointStore {
+	s := new(RedisCheckpointStore)
+	s.client = client
+	s.prefix = prefix
+
+	return s
+}
+
+// Load returns the state of the collection as saved in Redis.
+func (s *RedisCheckpointStore) Load(collection string) (CollectionState, error) {
+	reply, err := s.client.Do("GET", s.prefix+collection)
+	if err != nil || reply == nil {
+		return CollectionState{}, err
+	}
+	return decodeCollectionState(reply.(string))
+}
+
+// Save saves the state of the collection in Redis.
+func (s *RedisCheckpointStore) Save(collection string, state CollectionState) error {
+	_, err := s.client.Do("SET", s.prefix+collection, encodeCollectionState(state))
+	return err
+}
+
+// Close closes the connection to Redis.
+func (s *RedisCheckpointStore) Close() error {
+	return s.client.Close()
+}
+
+// The scripts renewing the lease, if held by the holder, or acquiring it, if not held at all, and
+// releasing it, if held by the holder, atomically.
+const (
+	redisAcquireScript = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end " +
+		"if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then return 1 end return 0"
+	redisReleaseScript = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end return 0"
+)
+
+// RedisLease is a Lease kept in Redis, as the key holding the holder of the lease, which expires,
+// and gets deleted by Redis, unless renewed.
+type RedisLease struct {
+	client *RedisClient
+	key    string
+	holder string
+}
+
+// NewRedisLease creates and returns a new RedisLease, by the key, for the holder, using the client.
+func NewRedisLease(client *RedisClient, key string, holder string) *RedisLease {
+	l := new(RedisLease)
+	l.client = client
+	l.key = key
+	l.holder = holder
+
+	return l
+}
+
+// Acquire acquires, or renews, the lease, if it isn't held by another holder.
+func (l *RedisLease) Acquire(ttl time.Duration) (bool, error) {
+	reply, err := l.client.Do("EVAL", redisAcquireScript, "1", l.key, l.holder, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// Release releases the lease, if held.
+func (l *RedisLease) Release() error {
+	_, err := l.client.Do("EVAL", redisReleaseScript, "1", l.key, l.holder)
+	return err
+}
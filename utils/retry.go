@@ -0,0 +1,182 @@
+package odata
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines if, and how, requests that failed due to what is likely a transient failure,
+// like a network hiccup or a server being restarted, get retried. Retries are delayed using
+// exponential backoff with full jitter: the delay before attempt n is a random duration between 0
+// and the minimum of MaxDelay and BaseDelay*2^n. Failed responses are retried if either their
+// status code is one of the RetryableStatusCodes or their OData error code, which for TM1 is the
+// TM1 error code, is one of the RetryableErrorCodes.
+type RetryPolicy struct {
+	MaxAttempts          int
+	BaseDelay            time.Duration
+	MaxDelay             time.Duration
+	RetryableStatusCodes []int
+	RetryableErrorCodes  []string
+}
+
+// DefaultRetryPolicy returns the retry policy used unless configured otherwise.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          5,
+		BaseDelay:            500 * time.Millisecond,
+		MaxDelay:             30 * time.Second,
+		RetryableStatusCodes: []int{429, 502, 503, 504},
+	}
+}
+
+// isRetryableStatusCode returns true if a response with the status code should be retried.
+func (p *RetryPolicy) isRetryableStatusCode(statusCode int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableResponse returns true if the response should be retried, either because of its status
+// code or because of the code of the OData error it returned.
+func (p *RetryPolicy) isRetryableResponse(resp *http.Response) bool {
+	if p.isRetryableStatusCode(resp.StatusCode) {
+		return true
+	}
+	if len(p.RetryableErrorCodes) == 0 || resp.StatusCode < 400 {
+		return false
+	}
+	code := peekODataError(resp).Code
+	for _, retryable := range p.RetryableErrorCodes {
+		if code != "" && code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the time to wait before the next attempt, given the number of attempts made so far.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	backoff := p.MaxDelay
+	if attempt < 32 && p.BaseDelay<<uint(attempt) < p.MaxDelay {
+		backoff = p.BaseDelay << uint(attempt)
+	}
+	// Honor the server asking us to come back after a number of seconds, within reason
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter := time.Duration(seconds) * time.Second
+			if retryAfter > p.MaxDelay {
+				retryAfter = p.MaxDelay
+			}
+			return retryAfter
+		}
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// do executes the request, retrying it according to the client's retry policy if set. Requests
+// with a body can only be retried if the body can be reproduced, which isn't the case for
+// requests streaming their body, those are always executed only once.
+func (client *Client) do(req *http.Request) (*http.Response, error) {
+	client.setHeaders(req)
+	policy := client.RetryPolicy
+	if policy == nil || (req.Body != nil && req.GetBody == nil) {
+		return client.send(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := client.send(req)
+		if req.Context().Err() != nil || attempt >= policy.MaxAttempts {
+			return resp, err
+		}
+		if err == nil && !policy.isRetryableResponse(resp) {
+			return resp, nil
+		}
+
+		delay := policy.delay(attempt-1, resp)
+		if err != nil {
+			Logger.Warn("Request failed, retrying", "method", req.Method, "url", req.URL.String(), "error", err, "delay", delay)
+		} else {
+			Logger.Warn("Request returned a retryable status, retrying", "method", req.Method, "url", req.URL.String(), "status", resp.Status, "delay", delay)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+
+		// Rewind the body, if any, for the next attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// setHeaders sets the User-Agent, TM1-SessionContext and additional headers of the request.
+func (client *Client) setHeaders(req *http.Request) {
+	if client.UserAgent != "" {
+		req.Header.Set("User-Agent", client.UserAgent)
+	}
+	if client.SessionContext != "" {
+		req.Header.Set("TM1-SessionContext", client.SessionContext)
+	}
+	for name, value := range client.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// send executes the request. If the server responds with 401 Unauthorized, typically because the
+// session expired, the request is authenticated using the client's Authenticator, provided it wasn't
+// authenticated already, and executed once more, establishing a new session.
+// Requests are authenticated up front if the Authenticator has to authenticate every request.
+func (client *Client) send(req *http.Request) (*http.Response, error) {
+	if authenticator, ok := client.Authenticator.(RequestAuthenticator); ok {
+		if err := authenticator.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.limit(req); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || client.Authenticator == nil || req.Header.Get("Authorization") != "" {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	if err := client.Authenticator.Authenticate(req); err != nil {
+		return nil, err
+	}
+	Logger.Info("Session expired, authenticating again", "url", req.URL.String())
+	if err := client.limit(req); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
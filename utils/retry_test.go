@@ -0,0 +1,87 @@
+package odata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRetriesTransientFailures(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		status   int
+		body     string
+		attempts int
+	}{
+		{"retryable status", http.StatusServiceUnavailable, "", 3},
+		{"retryable error code", http.StatusInternalServerError, `{"error":{"code":"278","message":"Server busy"}}`, 3},
+		{"other error code", http.StatusInternalServerError, `{"error":{"code":"42","message":"Failed"}}`, 1},
+		{"not retryable", http.StatusNotFound, "", 1},
+	} {
+		attempts := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts++; attempts < 3 {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+				return
+			}
+			w.Write([]byte("{}"))
+		}))
+		client := NewClient(http.Client{}, nil)
+		client.RetryPolicy = &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond,
+			RetryableStatusCodes: []int{503}, RetryableErrorCodes: []string{"278"}}
+		resp, err := client.ExecuteGETRequest(ts.URL)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if attempts != test.attempts {
+			t.Errorf("%s: made %d attempts, expected %d", test.name, attempts, test.attempts)
+		}
+	}
+}
+
+func TestRetryPolicyStopsAfterMaxAttempts(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	client := NewClient(http.Client{}, nil)
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond,
+		RetryableStatusCodes: []int{503}}
+	resp, err := client.ExecuteGETRequest(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if attempts != 3 || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("made %d attempts, got %s, expected the last of 3 attempts to be returned", attempts, resp.Status)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 100; i++ {
+			if delay := policy.delay(attempt, nil); delay < 0 || delay >= max {
+				t.Fatalf("attempt %d: got delay %s, expected it to be less than %s", attempt, delay, max)
+			}
+		}
+	}
+	if delay := policy.delay(100, nil); delay < 0 || delay >= time.Second {
+		t.Errorf("got delay %s, expected the backoff to be capped at %s", delay, time.Second)
+	}
+
+	// The server asking to come back later is honored, up to the maximum delay
+	for retryAfter, want := range map[string]time.Duration{"0": 0, "1": time.Second, "3600": time.Second} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {retryAfter}}}
+		if delay := policy.delay(0, resp); delay != want {
+			t.Errorf("Retry-After %s: got delay %s, expected %s", retryAfter, delay, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package odata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// timeStampLayouts are the layouts time stamps are parsed with, with, and without, an offset.
+var timeStampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"}
+
+// ParseTimeStamp parses the time stamp, interpreting it, unless it specifies its offset, as the
+// local time in the location.
+func ParseTimeStamp(timeStamp string, location *time.Location) (time.Time, error) {
+	var err error
+	for i, layout := range timeStampLayouts {
+		var t time.Time
+		if i == 0 {
+			t, err = time.Parse(layout, timeStamp)
+		} else {
+			t, err = time.ParseInLocation(layout, timeStamp, location)
+		}
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// NormalizeTimeStamp returns the time stamp, interpreted as the local time in the location unless
+// it specifies its offset, in RFC 3339 in UTC, and whether it lies further ahead of now than the
+// tolerated clock skew. Time stamps which can't be parsed are returned as is.
+func NormalizeTimeStamp(timeStamp string, location *time.Location, now time.Time, skew time.Duration) (string, bool) {
+	t, err := ParseTimeStamp(timeStamp, location)
+	if err != nil {
+		return timeStamp, false
+	}
+	return t.UTC().Format(time.RFC3339Nano), t.After(now.Add(skew))
+}
+
+// durationPattern matches an ISO 8601 duration in weeks, days, hours, minutes and seconds, as in
+// P0DT01H30M05S or PT2.5S.
+var durationPattern = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)W)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// durationUnits are the units of the components of an ISO 8601 duration matched by durationPattern.
+var durationUnits = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+// ParseDuration parses an ISO 8601 duration, as the server reports, for example, the time a thread
+// has been executing its current operation. Years and months, not having a fixed length, aren't
+// supported.
+func ParseDuration(duration string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(duration)
+	if m == nil || duration == "P" || duration[len(duration)-1] == 'T' {
+		return 0, fmt.Errorf("invalid duration %q", duration)
+	}
+	var d time.Duration
+	for i, unit := range durationUnits {
+		if m[i+1] != "" {
+			value, _ := strconv.ParseFloat(m[i+1], 64)
+			d += time.Duration(value * float64(unit))
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,26 @@
+package odata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for duration, want := range map[string]time.Duration{
+		"P0DT00H00M00S": 0,
+		"PT2.5S":        2500 * time.Millisecond,
+		"P0DT01H30M05S": time.Hour + 30*time.Minute + 5*time.Second,
+		"P1DT2H":        26 * time.Hour,
+		"P1W":           7 * 24 * time.Hour,
+	} {
+		got, err := ParseDuration(duration)
+		if err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v, expected %v", duration, got, err, want)
+		}
+	}
+	for _, duration := range []string{"", "P", "PT", "P1Y", "5S", "PT1H2"} {
+		if _, err := ParseDuration(duration); err == nil {
+			t.Errorf("ParseDuration(%q) succeeded, expected an error", duration)
+		}
+	}
+}
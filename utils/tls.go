@@ -0,0 +1,39 @@
+package odata
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// NewTLSConfig returns the TLS configuration used to connect to a server. If a CA file is specified,
+// the server's certificate is verified against the certificates in that PEM encoded file instead of
+// the system's certificate pool. If a client certificate and key file are specified, the client
+// presents that certificate to the server. Verification of the server's certificate can be skipped
+// altogether, which, as it makes the connection vulnerable to man-in-the-middle attacks, should
+// only ever be used for development purposes.
+func NewTLSConfig(caFile string, certFile string, keyFile string, skipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file " + caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
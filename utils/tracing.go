@@ -0,0 +1,89 @@
+package odata
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is the tracer of the package, using the globally registered tracer provider, which, unless
+// one has been registered, doesn't record anything.
+var tracer = otel.Tracer("github.com/hubert-heijkers/tm1-blackhawk/utils")
+
+// contextReader is the body of a response, as passed to the processor function, carrying the
+// context, including the span, in which the response gets processed.
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+// StreamContext returns the context, including the span, in which the stream, as passed to a
+// processor function, gets processed, or the background context if it doesn't carry one.
+func StreamContext(stream io.Reader) context.Context {
+	if r, ok := stream.(*contextReader); ok {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// processWindow requests, and processes, one window of the collection, within a span named after the
+// operation, with child spans for fetching, up to receiving the response headers, and processing
+// the response. The response is validated, before it gets processed, using the validate function.
+func (client *Client) processWindow(ctx context.Context, operation string, urlStr string, trackChanges bool, validate func(*http.Response) error) (nextLink string, deltaLink string, err error) {
+	ctx, span := tracer.Start(ctx, operation, trace.WithAttributes(attribute.String("url.full", urlStr)))
+	defer span.End()
+
+	resp, err := client.fetch(ctx, urlStr, trackChanges, validate)
+	if err == nil {
+		nextLink, deltaLink, err = client.process(ctx, resp.Body)
+		resp.Body.Close()
+	}
+	// Fetching, or processing, fails if the request got aborted, report why it got aborted if so
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	recordError(span, err)
+	return nextLink, deltaLink, err
+}
+
+// fetch executes the GET request, within a span, and validates the response.
+func (client *Client) fetch(ctx context.Context, urlStr string, trackChanges bool, validate func(*http.Response) error) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, "odata.fetch", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", "GET"),
+		attribute.String("url.full", urlStr),
+	))
+	defer span.End()
+
+	resp, err := client.ExecuteGETRequestEx(ctx, urlStr, client.prefer(trackChanges))
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if err = validate(resp); err != nil {
+			resp.Body.Close()
+		}
+	}
+	recordError(span, err)
+	return resp, err
+}
+
+// process processes the body of the response, within a span, using the client's processor function.
+func (client *Client) process(ctx context.Context, body io.Reader) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "odata.process")
+	defer span.End()
+
+	nextLink, deltaLink, err := client.processorFunc(&contextReader{Reader: body, ctx: ctx})
+	recordError(span, err)
+	return nextLink, deltaLink, err
+}
+
+// recordError records the error, if any, on the span, marking the span as failed.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,57 @@
+package odata
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig holds the timeouts, keep-alive and connection pool settings of the transport used
+// to connect to a server. A zero timeout means no timeout.
+type TransportConfig struct {
+	DialTimeout           time.Duration // Time allowed to establish a connection
+	TLSHandshakeTimeout   time.Duration // Time allowed for the TLS handshake
+	ResponseHeaderTimeout time.Duration // Time allowed for the server to respond, once the request has been sent
+	KeepAlive             time.Duration // Interval between keep-alive probes, negative to disable them
+	DisableKeepAlives     bool          // Use a connection for a single request only
+	MaxIdleConns          int           // Maximum number of idle connections, zero for no limit
+	MaxIdleConnsPerHost   int           // Maximum number of idle connections per host
+	IdleConnTimeout       time.Duration // Time an idle connection is kept open
+	Proxy                 ProxyConfig   // Proxy to connect through
+}
+
+// DefaultTransportConfig returns the transport configuration used unless configured otherwise,
+// which, unlike the defaults of the http package, makes sure a server that stopped responding
+// can't block the tracker forever.
+func DefaultTransportConfig() *TransportConfig {
+	return &TransportConfig{
+		DialTimeout:           30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Minute,
+		KeepAlive:             30 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// NewTransport returns the transport, using the TLS configuration, configured according to the
+// transport configuration.
+func NewTransport(config *TransportConfig, tlsConfig *tls.Config) (*http.Transport, error) {
+	dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: config.KeepAlive}
+	tr := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		DisableKeepAlives:     config.DisableKeepAlives,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+	}
+	if err := config.Proxy.apply(tr, dialer); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
@@ -0,0 +1,104 @@
+package odata
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of the values written to a cell, as in numeric or string.
+type ValueType string
+
+const (
+	NumericValue ValueType = "Numeric"
+	StringValue  ValueType = "String"
+)
+
+// stringPrefix is the prefix TM1 uses to tell string values from numeric values in the transaction log.
+const stringPrefix = "S:"
+
+// TypedValues holds the old and new value of a transaction log entry parsed according to their type.
+// Only the numbers are set for numeric values, only the strings for string values.
+type TypedValues struct {
+	ValueType ValueType `json:"ValueType"`
+	OldNumber *float64  `json:"OldNumber,omitempty"`
+	NewNumber *float64  `json:"NewNumber,omitempty"`
+	OldString *string   `json:"OldString,omitempty"`
+	NewString *string   `json:"NewString,omitempty"`
+}
+
+// ValueType returns the type of the values written by the entry. The values are strings if either
+// of them is prefixed by S:, or isn't a number, and numeric otherwise.
+func (e *TransactionLogEntry) ValueType() ValueType {
+	for _, value := range []interface{}{e.OldValue, e.NewValue} {
+		if s, ok := value.(string); ok {
+			if _, numeric := parseNumber(s); !numeric {
+				return StringValue
+			}
+		}
+	}
+	return NumericValue
+}
+
+// NumericValues returns the old and new value as numbers, and true, if the values are numeric. A
+// missing value is returned as 0, like TM1 treats an empty numeric cell.
+func (e *TransactionLogEntry) NumericValues() (float64, float64, bool) {
+	if e.ValueType() != NumericValue {
+		return 0, 0, false
+	}
+	oldValue, _ := numberValue(e.OldValue)
+	newValue, _ := numberValue(e.NewValue)
+	return oldValue, newValue, true
+}
+
+// StringValues returns the old and new value as strings, without the S: prefix. Numeric values are
+// formatted in their shortest form.
+func (e *TransactionLogEntry) StringValues() (string, string) {
+	return stringValue(e.OldValue), stringValue(e.NewValue)
+}
+
+// ParseValues sets the Values of the entry to its old and new value parsed according to their type.
+func (e *TransactionLogEntry) ParseValues() {
+	typed := new(TypedValues)
+	typed.ValueType = e.ValueType()
+	if oldValue, newValue, ok := e.NumericValues(); ok {
+		typed.OldNumber, typed.NewNumber = &oldValue, &newValue
+	} else {
+		oldValue, newValue := e.StringValues()
+		typed.OldString, typed.NewString = &oldValue, &newValue
+	}
+	e.Values = typed
+}
+
+// parseNumber returns the number the string represents, and true, unless it's prefixed by S: or
+// isn't a number at all.
+func parseNumber(s string) (float64, bool) {
+	if strings.HasPrefix(s, stringPrefix) {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return number, err == nil
+}
+
+// numberValue returns the value, as decoded from JSON, as a number, and true, if it is one.
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		return parseNumber(v)
+	}
+	return 0, false
+}
+
+// stringValue returns the value, as decoded from JSON, as a string without the S: prefix.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimPrefix(v, stringPrefix)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package odata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of a TM1 server, as in 10.2.20500.123 for 10.2.2 FP5, 11.8.01300.1 or
+// 12.0.0, consisting of the major, minor, build and revision numbers.
+type Version struct {
+	Major    int
+	Minor    int
+	Build    int
+	Revision int
+
+	text string
+}
+
+// Minimal versions of the server supporting the features the tracker depends on.
+var (
+	// Deltas, using the track-changes preference, got implemented in 10.2.2 FP5 for both the
+	// message log and transaction logs.
+	MinDeltasVersion = Version{Major: 10, Minor: 2, Build: 20500}
+
+	// Version 12, the Planning Analytics Engine, no longer exposes the Threads collection.
+	MinEngineVersion = Version{Major: 12}
+)
+
+// ParseVersion parses the version of the server, as returned by the ProductVersion configuration
+// property. Missing numbers, as in 12.0, are treated as zero.
+func ParseVersion(s string) (Version, error) {
+	v := Version{text: strings.TrimSpace(s)}
+	parts := strings.Split(v.text, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return Version{}, fmt.Errorf("invalid version: %q", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Build, &v.Revision}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version: %q", s)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if the version is lower than, equal to or higher than the other version.
+func (v Version) Compare(other Version) int {
+	a := [4]int{v.Major, v.Minor, v.Build, v.Revision}
+	b := [4]int{other.Major, other.Minor, other.Build, other.Revision}
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast returns true if the version is equal to or higher than the other version.
+func (v Version) AtLeast(other Version) bool {
+	return v.Compare(other) >= 0
+}
+
+// SupportsDeltas returns true if the server supports tracking changes to its logs.
+func (v Version) SupportsDeltas() bool {
+	return v.AtLeast(MinDeltasVersion)
+}
+
+// SupportsThreads returns true if the server exposes the Threads collection.
+func (v Version) SupportsThreads() bool {
+	return !v.AtLeast(MinEngineVersion)
+}
+
+// String returns the version as returned by the server.
+func (v Version) String() string {
+	if v.text != "" {
+		return v.text
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Build, v.Revision)
+}